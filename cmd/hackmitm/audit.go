@@ -0,0 +1,140 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"hackmitm/pkg/audit"
+	"hackmitm/pkg/config"
+	"hackmitm/pkg/logger"
+)
+
+// auditUsage audit 子命令帮助信息
+const auditUsage = `用法: %s audit <子命令> [选项]
+
+子命令:
+  verify     校验审计日志哈希链，发现被修改、删除或插入的记录
+
+使用 "%s audit <子命令> -help" 查看子命令选项
+`
+
+// runAuditCommand 执行 audit 子命令，返回进程退出码
+func runAuditCommand(args []string) int {
+	if len(args) == 0 || args[0] == "-help" || args[0] == "--help" || args[0] == "help" {
+		fmt.Printf(auditUsage, os.Args[0], os.Args[0])
+		return 0
+	}
+
+	// 子命令输出以终端提示为主，仅保留警告及以上级别的日志
+	logger.DefaultLogger.SetLevel(logger.WarnLevel)
+
+	switch args[0] {
+	case "verify":
+		return auditVerify(args[1:])
+	default:
+		printError("未知的 audit 子命令: %s", args[0])
+		fmt.Printf(auditUsage, os.Args[0], os.Args[0])
+		return 2
+	}
+}
+
+// auditVerify 校验审计日志，链断裂时返回退出码 1
+func auditVerify(args []string) int {
+	fs := flag.NewFlagSet("audit verify", flag.ExitOnError)
+	configPath := fs.String("config", "configs/config.json", "配置文件路径（用于确定审计日志文件）")
+	file := fs.String("file", "", "审计日志文件（覆盖配置文件中的 audit.file）")
+	jsonOutput := fs.Bool("json", false, "以JSON格式输出校验结果")
+	fs.Parse(args)
+
+	path := *file
+	if path == "" {
+		cfg, err := config.LoadConfig(*configPath)
+		if err != nil {
+			printError("加载配置文件失败: %v", err)
+			return 1
+		}
+		path = cfg.GetAudit().File
+	}
+
+	result, err := audit.Verify(path)
+	if err != nil {
+		printError("%v", err)
+		return 1
+	}
+
+	if *jsonOutput {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		encoder.Encode(result)
+	} else {
+		printInfo("审计日志: %s", path)
+		printInfo("已校验事件: %d，未启用哈希链的事件: %d", result.Events, result.Unchained)
+		if result.Events+result.Unchained > 0 {
+			printInfo("序号范围: %d - %d", result.FirstSeq, result.LastSeq)
+		}
+		if result.LastHash != "" {
+			printInfo("最后哈希: %s", result.LastHash)
+		}
+	}
+
+	if result.BrokenLine > 0 {
+		printError("❌ 第 %d 行校验失败: %s", result.BrokenLine, result.Problem)
+		return 1
+	}
+	if !*jsonOutput {
+		printSuccess("✅ 哈希链完整")
+		if result.Unchained > 0 {
+			printWarning("⚠️  %d 条事件未启用哈希链，无法发现对其的修改", result.Unchained)
+		}
+	}
+	return 0
+}
+
+// initAudit 按配置打开审计日志并设置为全局审计日志，配置重新加载时同步更新
+func initAudit(cfg *config.Config, configPath string) (*audit.Logger, error) {
+	auditLogger, err := audit.New(cfg.GetAudit())
+	if err != nil {
+		return nil, err
+	}
+	audit.SetDefault(auditLogger)
+
+	cfg.Subscribe(config.SectionAudit, func(_, current *config.Config) error {
+		return auditLogger.Configure(current.Audit)
+	})
+	// 只记录变更的配置路径，不记录值（可能包含密码等敏感信息）
+	cfg.Subscribe(config.SectionAll, func(old, current *config.Config) error {
+		audit.Record(audit.Event{
+			Type:    audit.TypeConfig,
+			Action:  "reload",
+			Target:  configPath,
+			Details: map[string]interface{}{"changed": config.Diff(old, current)},
+		})
+		return nil
+	})
+
+	audit.Record(audit.Event{Type: audit.TypeConfig, Action: "load", Target: configPath})
+	return auditLogger, nil
+}
+
+// openAuditFromConfig 子命令按配置文件打开审计日志（如 ca 子命令记录CA操作），配置不可用时不记录
+func openAuditFromConfig(configPath string) {
+	cfg, err := config.LoadConfig(configPath)
+	if err != nil || !cfg.GetAudit().Enabled {
+		return
+	}
+	auditLogger, err := audit.New(cfg.GetAudit())
+	if err != nil {
+		printWarning("⚠️  打开审计日志失败: %v", err)
+		return
+	}
+	audit.SetDefault(auditLogger)
+}
+
+// closeAudit 关闭全局审计日志
+func closeAudit() {
+	if auditLogger := audit.Default(); auditLogger != nil {
+		auditLogger.Close()
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"hackmitm/pkg/security"
+)
+
+// authUsage auth 子命令帮助信息
+const authUsage = `用法: %s auth <子命令> [选项]
+
+子命令:
+  hash       生成密码哈希（从标准输入读取密码），用于 security.users 或 htpasswd 文件
+
+使用 "%s auth <子命令> -help" 查看子命令选项
+`
+
+// runAuthCommand 执行 auth 子命令，返回进程退出码
+func runAuthCommand(args []string) int {
+	if len(args) == 0 || args[0] == "-help" || args[0] == "--help" || args[0] == "help" {
+		fmt.Printf(authUsage, os.Args[0], os.Args[0])
+		return 0
+	}
+
+	var err error
+	switch args[0] {
+	case "hash":
+		err = authHash(args[1:])
+	default:
+		printError("未知的 auth 子命令: %s", args[0])
+		fmt.Printf(authUsage, os.Args[0], os.Args[0])
+		return 2
+	}
+
+	if err != nil {
+		printError("%v", err)
+		return 1
+	}
+	return 0
+}
+
+// authHash 读取密码并输出哈希
+func authHash(args []string) error {
+	fs := flag.NewFlagSet("auth hash", flag.ExitOnError)
+	algorithm := fs.String("algo", security.HashBcrypt, "哈希算法 (bcrypt, argon2id)")
+	username := fs.String("user", "", "用户名（指定时输出 htpasswd 格式的 用户名:哈希）")
+	fs.Parse(args)
+
+	// 提示输出到标准错误，便于重定向标准输出
+	fmt.Fprint(os.Stderr, "请输入密码: ")
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && line == "" {
+		return fmt.Errorf("读取密码失败: %w", err)
+	}
+	fmt.Fprintln(os.Stderr)
+
+	password := strings.TrimRight(line, "\r\n")
+	if password == "" {
+		return fmt.Errorf("密码不能为空")
+	}
+
+	hash, err := security.HashPassword(password, *algorithm)
+	if err != nil {
+		return err
+	}
+
+	if *username != "" {
+		fmt.Printf("%s:%s\n", *username, hash)
+	} else {
+		fmt.Println(hash)
+	}
+	return nil
+}
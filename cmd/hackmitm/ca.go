@@ -0,0 +1,379 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"hackmitm/pkg/cert"
+	"hackmitm/pkg/config"
+	"hackmitm/pkg/logger"
+)
+
+// caUsage ca 子命令帮助信息
+const caUsage = `用法: %s ca <子命令> [选项]
+
+子命令:
+  generate   生成新的CA证书
+  inspect    查看当前CA证书信息（指纹、有效期）
+  export     导出CA证书（pem, der, p12）
+  rotate     轮换CA证书，旧CA在宽限期内仍受信任
+  issue      为指定主机签发一次性叶子证书
+
+使用 "%s ca <子命令> -help" 查看子命令选项
+`
+
+// runCACommand 执行 ca 子命令，返回进程退出码
+func runCACommand(args []string) int {
+	if len(args) == 0 || args[0] == "-help" || args[0] == "--help" || args[0] == "help" {
+		fmt.Printf(caUsage, os.Args[0], os.Args[0])
+		return 0
+	}
+
+	// 子命令输出以终端提示为主，仅保留警告及以上级别的日志
+	logger.DefaultLogger.SetLevel(logger.WarnLevel)
+	defer closeAudit()
+
+	var err error
+	switch args[0] {
+	case "generate":
+		err = caGenerate(args[1:])
+	case "inspect":
+		err = caInspect(args[1:])
+	case "export":
+		err = caExport(args[1:])
+	case "rotate":
+		err = caRotate(args[1:])
+	case "issue":
+		err = caIssue(args[1:])
+	default:
+		printError("未知的 ca 子命令: %s", args[0])
+		fmt.Printf(caUsage, os.Args[0], os.Args[0])
+		return 2
+	}
+
+	if err != nil {
+		printError("%v", err)
+		return 1
+	}
+	return 0
+}
+
+// caCommonFlags ca 子命令通用选项
+type caCommonFlags struct {
+	configPath string
+	certDir    string
+}
+
+// register 注册通用选项
+func (f *caCommonFlags) register(fs *flag.FlagSet) {
+	fs.StringVar(&f.configPath, "config", "configs/config.json", "配置文件路径（用于确定证书目录）")
+	fs.StringVar(&f.certDir, "cert-dir", "", "证书目录（覆盖配置文件中的 tls.cert_dir）")
+}
+
+// resolveCertDir 解析证书目录
+func (f *caCommonFlags) resolveCertDir() (string, error) {
+	if f.certDir != "" {
+		return f.certDir, nil
+	}
+
+	cfg, err := config.LoadConfig(f.configPath)
+	if err != nil {
+		return "", fmt.Errorf("加载配置文件失败: %w", err)
+	}
+	return cfg.GetTLS().CertDir, nil
+}
+
+// openCertManager 打开证书管理器（CA不存在时使用给定选项生成）
+func (f *caCommonFlags) openCertManager(caOpts cert.CAOptions) (*cert.CertManager, string, error) {
+	certDir, err := f.resolveCertDir()
+	if err != nil {
+		return nil, "", err
+	}
+	// CA操作记录到服务运行时使用的同一审计日志
+	openAuditFromConfig(f.configPath)
+
+	certMgr, err := cert.NewCertManager(cert.CertOptions{
+		CertDir: certDir,
+		CA:      caOpts,
+	})
+	if err != nil {
+		return nil, "", fmt.Errorf("创建证书管理器失败: %w", err)
+	}
+	return certMgr, certDir, nil
+}
+
+// caSubjectFlags CA主题与算法选项
+type caSubjectFlags struct {
+	commonName   string
+	organization string
+	unit         string
+	country      string
+	algorithm    string
+	validity     time.Duration
+}
+
+// register 注册主题选项
+func (f *caSubjectFlags) register(fs *flag.FlagSet) {
+	fs.StringVar(&f.commonName, "cn", "HackMITM Root CA", "CA通用名称")
+	fs.StringVar(&f.organization, "org", "HackMITM", "组织名称")
+	fs.StringVar(&f.unit, "ou", "HackMITM Root CA", "组织单位")
+	fs.StringVar(&f.country, "country", "CN", "国家代码")
+	fs.StringVar(&f.algorithm, "algorithm", cert.AlgorithmECDSAP256,
+		"密钥算法 (ecdsa-p256, ecdsa-p384, rsa-2048, rsa-3072, rsa-4096)")
+	fs.DurationVar(&f.validity, "validity", 10*365*24*time.Hour, "CA有效期")
+}
+
+// options 转换为CA选项
+func (f *caSubjectFlags) options() cert.CAOptions {
+	return cert.CAOptions{
+		CommonName:         f.commonName,
+		Organization:       f.organization,
+		OrganizationalUnit: f.unit,
+		Country:            f.country,
+		Algorithm:          f.algorithm,
+		Validity:           f.validity,
+	}
+}
+
+// caGenerate 生成新的CA证书
+func caGenerate(args []string) error {
+	fs := flag.NewFlagSet("ca generate", flag.ExitOnError)
+	var common caCommonFlags
+	var subject caSubjectFlags
+	common.register(fs)
+	subject.register(fs)
+	force := fs.Bool("force", false, "覆盖已存在的CA证书")
+	fs.Parse(args)
+
+	certDir, err := common.resolveCertDir()
+	if err != nil {
+		return err
+	}
+
+	existed := cert.CAExists(certDir)
+	if existed && !*force {
+		return fmt.Errorf("CA证书已存在于 %s，使用 -force 覆盖或使用 rotate 轮换", certDir)
+	}
+
+	common.certDir = certDir
+	certMgr, _, err := common.openCertManager(subject.options())
+	if err != nil {
+		return err
+	}
+	defer certMgr.Stop()
+
+	if existed {
+		if err := certMgr.RegenerateCA(subject.options()); err != nil {
+			return fmt.Errorf("重新生成CA证书失败: %w", err)
+		}
+	}
+
+	printSuccess("✅ CA证书已生成: %s", certDir)
+	printCAInfo(certMgr.GetCAInfo())
+	return nil
+}
+
+// caInspect 查看CA证书信息
+func caInspect(args []string) error {
+	fs := flag.NewFlagSet("ca inspect", flag.ExitOnError)
+	var common caCommonFlags
+	common.register(fs)
+	asJSON := fs.Bool("json", false, "以JSON格式输出")
+	fs.Parse(args)
+
+	certDir, err := common.resolveCertDir()
+	if err != nil {
+		return err
+	}
+	if !cert.CAExists(certDir) {
+		return fmt.Errorf("CA证书不存在: %s", certDir)
+	}
+
+	certMgr, _, err := common.openCertManager(cert.CAOptions{})
+	if err != nil {
+		return err
+	}
+	defer certMgr.Stop()
+
+	info := certMgr.GetCAInfo()
+	if *asJSON {
+		data, err := json.MarshalIndent(info, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(data))
+		return nil
+	}
+
+	printCAInfo(info)
+	for _, issue := range certMgr.CheckCA(30 * 24 * time.Hour) {
+		printWarning("⚠️  %s", issue)
+	}
+	return nil
+}
+
+// caExport 导出CA证书
+func caExport(args []string) error {
+	fs := flag.NewFlagSet("ca export", flag.ExitOnError)
+	var common caCommonFlags
+	common.register(fs)
+	format := fs.String("format", "pem", "导出格式 (pem, der, p12)")
+	output := fs.String("out", "", "输出文件路径")
+	password := fs.String("password", "", "PKCS#12 密码（也可通过环境变量 HACKMITM_P12_PASSWORD 设置）")
+	fs.Parse(args)
+
+	if *output == "" {
+		return fmt.Errorf("必须指定输出文件 -out")
+	}
+	if *password == "" {
+		*password = os.Getenv("HACKMITM_P12_PASSWORD")
+	}
+
+	certDir, err := common.resolveCertDir()
+	if err != nil {
+		return err
+	}
+	if !cert.CAExists(certDir) {
+		return fmt.Errorf("CA证书不存在: %s", certDir)
+	}
+
+	certMgr, _, err := common.openCertManager(cert.CAOptions{})
+	if err != nil {
+		return err
+	}
+	defer certMgr.Stop()
+
+	if err := certMgr.ExportCA(*output, *format, *password); err != nil {
+		return err
+	}
+
+	printSuccess("✅ CA证书已导出: %s", *output)
+	return nil
+}
+
+// caRotate 轮换CA证书
+func caRotate(args []string) error {
+	fs := flag.NewFlagSet("ca rotate", flag.ExitOnError)
+	var common caCommonFlags
+	var subject caSubjectFlags
+	common.register(fs)
+	subject.register(fs)
+	grace := fs.Duration("grace", 30*24*time.Hour, "旧CA继续受信任的宽限期（0表示立即失效）")
+	fs.Parse(args)
+
+	certDir, err := common.resolveCertDir()
+	if err != nil {
+		return err
+	}
+	if !cert.CAExists(certDir) {
+		return fmt.Errorf("CA证书不存在，请先使用 generate 生成: %s", certDir)
+	}
+
+	certMgr, _, err := common.openCertManager(cert.CAOptions{})
+	if err != nil {
+		return err
+	}
+	defer certMgr.Stop()
+
+	if err := certMgr.RotateCA(subject.options(), *grace); err != nil {
+		return fmt.Errorf("轮换CA证书失败: %w", err)
+	}
+
+	printSuccess("✅ CA证书轮换完成，请重启代理服务器并在客户端安装新CA")
+	printCAInfo(certMgr.GetCAInfo())
+	return nil
+}
+
+// caIssue 签发一次性叶子证书
+func caIssue(args []string) error {
+	fs := flag.NewFlagSet("ca issue", flag.ExitOnError)
+	var common caCommonFlags
+	common.register(fs)
+	hosts := fs.String("host", "", "主机名或IP，多个以逗号分隔（第一个作为CommonName）")
+	validity := fs.Duration("validity", 397*24*time.Hour, "证书有效期")
+	certOut := fs.String("cert-out", "", "证书输出路径（默认 <host>-cert.pem）")
+	keyOut := fs.String("key-out", "", "私钥输出路径（默认 <host>-key.pem）")
+	fs.Parse(args)
+
+	var hostList []string
+	for _, h := range strings.Split(*hosts, ",") {
+		if h = strings.TrimSpace(h); h != "" {
+			hostList = append(hostList, h)
+		}
+	}
+	if len(hostList) == 0 {
+		return fmt.Errorf("必须指定 -host")
+	}
+
+	baseName := strings.ReplaceAll(hostList[0], "*", "_wildcard")
+	if *certOut == "" {
+		*certOut = baseName + "-cert.pem"
+	}
+	if *keyOut == "" {
+		*keyOut = baseName + "-key.pem"
+	}
+
+	certDir, err := common.resolveCertDir()
+	if err != nil {
+		return err
+	}
+	if !cert.CAExists(certDir) {
+		return fmt.Errorf("CA证书不存在，请先使用 generate 生成: %s", certDir)
+	}
+
+	certMgr, _, err := common.openCertManager(cert.CAOptions{})
+	if err != nil {
+		return err
+	}
+	defer certMgr.Stop()
+
+	leaf, err := certMgr.IssueCertificate(hostList, *validity)
+	if err != nil {
+		return fmt.Errorf("签发证书失败: %w", err)
+	}
+
+	if err := cert.WriteCertificate(leaf, *certOut, *keyOut); err != nil {
+		return err
+	}
+
+	printSuccess("✅ 证书已签发: %s", strings.Join(hostList, ", "))
+	printInfo("📄 证书: %s", *certOut)
+	printInfo("🔑 私钥: %s", *keyOut)
+	return nil
+}
+
+// printCAInfo 打印CA证书信息
+func printCAInfo(info *cert.CAInfo) {
+	printSeparator()
+	printCAInfoFields(info)
+	if info.GraceUntil != nil {
+		printInfo("%s宽限期至:%s %s", ColorBold, ColorReset, info.GraceUntil.Format(time.RFC3339))
+		if info.Previous != nil {
+			printInfo("%s旧CA:%s", ColorBold, ColorReset)
+			printCAInfoFields(info.Previous)
+		}
+	}
+	printSeparator()
+}
+
+// printCAInfoFields 打印证书字段
+func printCAInfoFields(info *cert.CAInfo) {
+	remaining := time.Until(info.NotAfter)
+	expiry := fmt.Sprintf("%s (剩余 %d 天)", info.NotAfter.Format(time.RFC3339), int(remaining.Hours()/24))
+	if remaining <= 0 {
+		expiry = fmt.Sprintf("%s%s (已过期)%s", ColorRed, info.NotAfter.Format(time.RFC3339), ColorReset)
+	}
+
+	printInfo("%s主题:%s       %s", ColorBold, ColorReset, info.Subject)
+	printInfo("%s颁发者:%s     %s", ColorBold, ColorReset, info.Issuer)
+	printInfo("%s序列号:%s     %s", ColorBold, ColorReset, info.SerialNumber)
+	printInfo("%s算法:%s       %s", ColorBold, ColorReset, info.Algorithm)
+	printInfo("%s生效时间:%s   %s", ColorBold, ColorReset, info.NotBefore.Format(time.RFC3339))
+	printInfo("%s过期时间:%s   %s", ColorBold, ColorReset, expiry)
+	printInfo("%sSHA-1:%s      %s", ColorBold, ColorReset, info.SHA1Fingerprint)
+	printInfo("%sSHA-256:%s    %s", ColorBold, ColorReset, info.SHA256Fingerprint)
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"hackmitm/pkg/config"
+	"hackmitm/pkg/logger"
+	"hackmitm/pkg/plugin"
+)
+
+// configUsage config 子命令帮助信息
+const configUsage = `用法: %s config <子命令> [选项]
+
+子命令:
+  check      校验配置文件（字段取值、未知字段、引用的文件）
+  schema     输出配置的JSON Schema，用于编辑器补全
+  print      输出组合 include 与配置档后的配置（-resolved 输出最终生效配置，密码和令牌默认隐藏）
+
+使用 "%s config <子命令> -help" 查看子命令选项
+`
+
+// runConfigCommand 执行 config 子命令，返回进程退出码
+func runConfigCommand(args []string) int {
+	if len(args) == 0 || args[0] == "-help" || args[0] == "--help" || args[0] == "help" {
+		fmt.Printf(configUsage, os.Args[0], os.Args[0])
+		return 0
+	}
+
+	logger.DefaultLogger.SetLevel(logger.WarnLevel)
+
+	var err error
+	switch args[0] {
+	case "check":
+		err = configCheck(args[1:])
+	case "schema":
+		err = configSchema(args[1:])
+	case "print":
+		err = configPrint(args[1:])
+	default:
+		printError("未知的 config 子命令: %s", args[0])
+		fmt.Printf(configUsage, os.Args[0], os.Args[0])
+		return 2
+	}
+
+	if err != nil {
+		printError("%v", err)
+		return 1
+	}
+	return 0
+}
+
+// configCheck 校验配置文件，存在错误时返回非零退出码
+func configCheck(args []string) error {
+	fs := flag.NewFlagSet("config check", flag.ExitOnError)
+	configPath := fs.String("config", "configs/config.json", "配置文件路径")
+	profile := fs.String("profile", os.Getenv("HACKMITM_PROFILE"), "选用的配置档")
+	strict := fs.Bool("strict", false, "将警告视为错误")
+	fs.Parse(args)
+
+	if _, err := os.Stat(*configPath); err != nil {
+		return fmt.Errorf("无法读取配置文件: %w", err)
+	}
+
+	report, err := config.CheckConfig(*configPath, config.LoadOptions{Profile: *profile, BuiltinPlugin: plugin.IsRegistered})
+	if err != nil {
+		return err
+	}
+
+	for _, issue := range report.Errors {
+		printError("%s", issue)
+	}
+	for _, issue := range report.Warnings {
+		printWarning("%s", issue)
+	}
+
+	switch {
+	case len(report.Errors) > 0:
+		return fmt.Errorf("配置校验失败: %d 个错误, %d 个警告", len(report.Errors), len(report.Warnings))
+	case *strict && len(report.Warnings) > 0:
+		return fmt.Errorf("配置校验失败（严格模式）: %d 个警告", len(report.Warnings))
+	}
+
+	printSuccess("配置校验通过: %s (%d 个警告)", *configPath, len(report.Warnings))
+	return nil
+}
+
+// configSchema 输出JSON Schema
+func configSchema(args []string) error {
+	fs := flag.NewFlagSet("config schema", flag.ExitOnError)
+	output := fs.String("out", "", "输出文件路径（默认标准输出）")
+	fs.Parse(args)
+
+	data, err := config.GenerateSchema()
+	if err != nil {
+		return fmt.Errorf("生成JSON Schema失败: %w", err)
+	}
+
+	if *output == "" {
+		_, err = os.Stdout.Write(data)
+		return err
+	}
+
+	if err := os.WriteFile(*output, data, 0644); err != nil {
+		return fmt.Errorf("写入JSON Schema失败: %w", err)
+	}
+	printSuccess("JSON Schema已写入: %s", *output)
+	return nil
+}
+
+// configPrint 输出组合后的配置
+func configPrint(args []string) error {
+	fs := flag.NewFlagSet("config print", flag.ExitOnError)
+	configPath := fs.String("config", "configs/config.json", "配置文件路径")
+	profile := fs.String("profile", os.Getenv("HACKMITM_PROFILE"), "选用的配置档")
+	resolved := fs.Bool("resolved", false, "输出最终生效的配置（含默认值和环境变量覆盖）")
+	reveal := fs.Bool("show-secrets", false, "明文输出密码、密码哈希和API令牌（默认以 "+config.RedactedValue+" 代替）")
+	format := fs.String("format", "", "输出格式 (json, yaml)，默认与配置文件相同")
+	fs.Parse(args)
+
+	outputFormat := strings.ToLower(*format)
+	switch outputFormat {
+	case "":
+		outputFormat = config.FormatJSON
+		if ext := strings.ToLower(filepath.Ext(*configPath)); ext == ".yaml" || ext == ".yml" {
+			outputFormat = config.FormatYAML
+		}
+	case "yml":
+		outputFormat = config.FormatYAML
+	case config.FormatJSON, config.FormatYAML:
+	default:
+		return fmt.Errorf("不支持的输出格式: %s", *format)
+	}
+
+	data, err := config.ResolvedDocument(*configPath, config.LoadOptions{Profile: *profile, BuiltinPlugin: plugin.IsRegistered}, *resolved, *reveal, outputFormat)
+	if err != nil {
+		return err
+	}
+	_, err = os.Stdout.Write(data)
+	return err
+}
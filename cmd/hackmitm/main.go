@@ -4,11 +4,14 @@ import (
 	"context"
 	"flag"
 	"fmt"
+	"net"
+	"net/http"
 	"os"
 	"os/exec"
 	"os/signal"
 	"path/filepath"
 	"runtime"
+	"strconv"
 	"strings"
 	"syscall"
 	"time"
@@ -16,6 +19,7 @@ import (
 	"hackmitm/pkg/cert"
 	"hackmitm/pkg/config"
 	"hackmitm/pkg/logger"
+	"hackmitm/pkg/monitor"
 	"hackmitm/pkg/plugin"
 	"hackmitm/pkg/proxy"
 )
@@ -35,6 +39,8 @@ var (
 	help       = flag.Bool("help", false, "显示帮助信息")
 	daemon     = flag.Bool("daemon", false, "以守护进程模式运行")
 	pidFile    = flag.String("pid-file", "", "PID 文件路径")
+	profile    = flag.String("profile", os.Getenv("HACKMITM_PROFILE"), "选用配置文件中定义的配置档（也可通过 HACKMITM_PROFILE 指定）")
+	watchConf  = flag.Duration("watch-config", 5*time.Second, "配置文件变更检查间隔（0表示仅在收到SIGHUP时重新加载）")
 )
 
 // 颜色常量
@@ -51,6 +57,20 @@ const (
 )
 
 func main() {
+	// 处理子命令
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "ca":
+			os.Exit(runCACommand(os.Args[2:]))
+		case "config":
+			os.Exit(runConfigCommand(os.Args[2:]))
+		case "auth":
+			os.Exit(runAuthCommand(os.Args[2:]))
+		case "audit":
+			os.Exit(runAuditCommand(os.Args[2:]))
+		}
+	}
+
 	// 解析命令行参数
 	flag.Parse()
 
@@ -109,6 +129,14 @@ func main() {
 	}
 	printSuccess("✅ 配置文件加载成功")
 
+	// 打开审计日志，CA自动生成、插件加载等启动期操作同样需要记录
+	auditLogger, err := initAudit(cfg, *configFile)
+	if err != nil {
+		printError("打开审计日志失败: %v", err)
+		os.Exit(1)
+	}
+	defer auditLogger.Close()
+
 	// 初始化证书管理器
 	printInfo("🔐 正在初始化证书管理器...")
 	certMgr, err := initCertManager(cfg)
@@ -145,6 +173,8 @@ func main() {
 		printError("启动服务器失败: %v", err)
 		os.Exit(1)
 	}
+	monitorServer := startMonitor(cfg, server, certMgr)
+	defer stopMonitor(monitorServer)
 
 	// 显示启动成功信息
 	printSeparator()
@@ -152,13 +182,18 @@ func main() {
 	serverConfig := cfg.GetServer()
 	printInfo("📡 监听地址: %s%s:%d%s", ColorBold+ColorCyan, serverConfig.ListenAddr, serverConfig.ListenPort, ColorReset)
 	printInfo("🌍 代理地址: %shttp://%s:%d%s", ColorBold+ColorGreen, serverConfig.ListenAddr, serverConfig.ListenPort, ColorReset)
-	printInfo("📊 监控地址: %shttp://%s:%d%s", ColorBold+ColorBlue, serverConfig.ListenAddr, cfg.GetMonitoring().Port, ColorReset)
+	if monitoringConfig := cfg.GetMonitoring(); monitoringConfig.Enabled {
+		printInfo("📊 监控地址: %shttp://%s%s", ColorBold+ColorBlue, net.JoinHostPort(monitoringConfig.ListenAddr, strconv.Itoa(monitoringConfig.Port)), ColorReset)
+	}
 	printSeparator()
 	printInfo("💡 提示: 按 %sCtrl+C%s 停止服务器", ColorBold+ColorYellow, ColorReset)
 	printSeparator()
 
 	// 等待中断信号
-	waitForShutdown(ctx, server)
+	if *watchConf > 0 {
+		cfg.StartConfigWatcher(*watchConf)
+	}
+	waitForShutdown(ctx, server, cfg)
 
 	printSuccess("👋 HackMITM 已安全退出")
 }
@@ -195,13 +230,24 @@ func showHelp() {
 
 `, ColorBold, ColorCyan, ColorReset)
 	fmt.Printf("%s用法:%s\n", ColorBold, ColorReset)
-	fmt.Printf("  %s [选项]\n\n", os.Args[0])
+	fmt.Printf("  %s [选项]\n", os.Args[0])
+	fmt.Printf("  %s <子命令> [选项]\n\n", os.Args[0])
+	fmt.Printf("%s子命令:%s\n", ColorBold, ColorReset)
+	fmt.Printf("  ca        CA证书管理 (generate, inspect, export, rotate, issue)\n")
+	fmt.Printf("  config    配置管理 (check, schema, print)\n")
+	fmt.Printf("  auth      代理认证工具 (hash)\n")
+	fmt.Printf("  audit     审计日志工具 (verify)\n\n")
 	fmt.Printf("%s选项:%s\n", ColorBold, ColorReset)
 	flag.PrintDefaults()
 	fmt.Printf("\n%s示例:%s\n", ColorBold, ColorReset)
 	fmt.Printf("  %s%s -config configs/config.json%s\n", ColorGreen, os.Args[0], ColorReset)
 	fmt.Printf("  %s%s -config configs/config-no-plugins.json -log-level debug%s\n", ColorGreen, os.Args[0], ColorReset)
 	fmt.Printf("  %s%s -daemon -pid-file /var/run/hackmitm.pid%s\n", ColorGreen, os.Args[0], ColorReset)
+	fmt.Printf("  %s%s ca inspect%s\n", ColorGreen, os.Args[0], ColorReset)
+	fmt.Printf("  %s%s -config configs/config.json -profile mobile%s\n", ColorGreen, os.Args[0], ColorReset)
+	fmt.Printf("  %s%s config check -config configs/config.json%s\n", ColorGreen, os.Args[0], ColorReset)
+	fmt.Printf("  %s%s config print -resolved -profile mobile%s\n", ColorGreen, os.Args[0], ColorReset)
+	fmt.Printf("  %s%s audit verify -config configs/config.json%s\n", ColorGreen, os.Args[0], ColorReset)
 	fmt.Printf("\n%s更多信息:%s https://github.com/your-org/hackmitm\n", ColorBold, ColorReset)
 }
 
@@ -287,14 +333,12 @@ func loadConfig(configPath string) (*config.Config, error) {
 		return nil, fmt.Errorf("获取配置文件绝对路径失败: %w", err)
 	}
 
-	// 加载配置
-	cfg, err := config.LoadConfig(absPath)
+	// 加载配置（组合 include 与配置档，并完成校验）
+	cfg, err := config.LoadConfigWithOptions(absPath, config.LoadOptions{Profile: *profile, BuiltinPlugin: plugin.IsRegistered})
 	if err != nil {
-		return nil, fmt.Errorf("解析配置文件失败: %w", err)
+		return nil, fmt.Errorf("加载配置文件失败: %w", err)
 	}
 
-	// 配置加载成功，无需额外验证
-
 	return cfg, nil
 }
 
@@ -309,17 +353,73 @@ func initCertManager(cfg *config.Config) (*cert.CertManager, error) {
 
 	// 创建证书管理器
 	certMgr, err := cert.NewCertManager(cert.CertOptions{
-		CertDir:     tlsConfig.CertDir,
-		EnableCache: true,
-		CacheTTL:    24 * time.Hour,
+		CertDir:      tlsConfig.CertDir,
+		EnableCache:  tlsConfig.EnableCertCache,
+		CacheTTL:     tlsConfig.CertCacheTTL,
+		LeafValidity: tlsConfig.LeafValidity,
+		LeafBackdate: tlsConfig.LeafBackdate,
+
+		Wildcard:          tlsConfig.WildcardCerts,
+		ExactMatchDomains: tlsConfig.ExactMatchDomains,
 	})
 	if err != nil {
 		return nil, fmt.Errorf("创建证书管理器失败: %w", err)
 	}
 
+	// 检查CA证书强度与有效期
+	for _, issue := range certMgr.CheckCA(tlsConfig.CAExpiryWarning) {
+		printWarning("⚠️  %s", issue)
+	}
+
 	return certMgr, nil
 }
 
+// startMonitor 启动监控服务器（未启用时返回nil）
+func startMonitor(cfg *config.Config, server *proxy.Server, certMgr *cert.CertManager) *monitor.MonitorServer {
+	monitoringConfig := cfg.GetMonitoring()
+	if !monitoringConfig.Enabled {
+		return nil
+	}
+
+	metrics := monitor.NewMetrics()
+	metrics.SetProxyStatsProvider(server)
+
+	healthChecker := monitor.NewHealthChecker()
+	if monitoringConfig.HealthChecks.MemoryLimitMB > 0 {
+		healthChecker.AddCheck(monitor.NewMemoryCheck(monitoringConfig.HealthChecks.MemoryLimitMB))
+	}
+	if monitoringConfig.HealthChecks.MaxGoroutines > 0 {
+		healthChecker.AddCheck(monitor.NewGoroutineCheck(monitoringConfig.HealthChecks.MaxGoroutines))
+	}
+	healthChecker.AddCheck(monitor.NewCAExpiryCheck(certMgr, cfg.GetTLS().CAExpiryWarning))
+
+	monitorServer := monitor.NewMonitorServer(monitoringConfig.ListenAddr, monitoringConfig.Port, metrics, healthChecker)
+	monitorServer.SetAccessListProvider(server)
+	monitorServer.SetBanProvider(server)
+	monitorServer.SetFlowProvider(server)
+	monitorServer.SetAPIToken(monitoringConfig.APIToken)
+	if monitoringConfig.APIToken == "" {
+		printWarning("⚠️  未配置 monitoring.api_token，除 /health 外的监控API不可用")
+	}
+	go func() {
+		if err := monitorServer.Start(); err != nil && err != http.ErrServerClosed {
+			printError("监控服务器运行失败: %v", err)
+		}
+	}()
+
+	return monitorServer
+}
+
+// stopMonitor 停止监控服务器
+func stopMonitor(monitorServer *monitor.MonitorServer) {
+	if monitorServer == nil {
+		return
+	}
+	if err := monitorServer.Stop(); err != nil {
+		printWarning("⚠️  关闭监控服务器失败: %v", err)
+	}
+}
+
 // loadPlugins 加载插件
 func loadPlugins(server *proxy.Server, cfg *config.Config) error {
 	pluginsConfig := cfg.GetPlugins()
@@ -338,13 +438,7 @@ func loadPlugins(server *proxy.Server, cfg *config.Config) error {
 
 		printInfo("📦 正在加载插件: %s", pluginCfg.Name)
 		// 转换配置类型
-		pluginConfig := &plugin.PluginConfig{
-			Name:     pluginCfg.Name,
-			Enabled:  pluginCfg.Enabled,
-			Path:     pluginCfg.Path,
-			Config:   pluginCfg.Config,
-			Priority: pluginCfg.Priority,
-		}
+		pluginConfig := proxy.NewPluginConfig(pluginCfg)
 		if err := server.GetPluginManager().LoadPlugin(pluginConfig); err != nil {
 			printWarning("❌ 插件 %s 加载失败: %v", pluginCfg.Name, err)
 			continue
@@ -366,18 +460,27 @@ func loadPlugins(server *proxy.Server, cfg *config.Config) error {
 	return nil
 }
 
-// waitForShutdown 等待关闭信号并优雅关闭
-func waitForShutdown(ctx context.Context, server *proxy.Server) {
+// waitForShutdown 等待关闭信号并优雅关闭，SIGHUP 触发配置重新加载
+func waitForShutdown(ctx context.Context, server *proxy.Server, cfg *config.Config) {
 	// 创建信号通道
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
 
 	// 等待信号
-	select {
-	case sig := <-sigChan:
-		printInfo("📨 收到信号: %v，开始优雅关闭...", sig)
-	case <-ctx.Done():
-		printInfo("📨 收到上下文取消信号，开始关闭...")
+wait:
+	for {
+		select {
+		case sig := <-sigChan:
+			if sig == syscall.SIGHUP {
+				reloadConfig(cfg)
+				continue
+			}
+			printInfo("📨 收到信号: %v，开始优雅关闭...", sig)
+			break wait
+		case <-ctx.Done():
+			printInfo("📨 收到上下文取消信号，开始关闭...")
+			break wait
+		}
 	}
 
 	// 创建关闭超时上下文
@@ -408,6 +511,26 @@ func waitForShutdown(ctx context.Context, server *proxy.Server) {
 	}
 }
 
+// reloadConfig 重新加载配置文件并提示需要重启的字段
+func reloadConfig(cfg *config.Config) {
+	printInfo("🔄 收到 SIGHUP，正在重新加载配置...")
+
+	result, err := cfg.ForceReload()
+	if err != nil {
+		printError("重新加载配置失败: %v", err)
+		return
+	}
+
+	if len(result.Changed) == 0 {
+		printInfo("📋 配置无变化")
+		return
+	}
+	printSuccess("✅ 配置已重新加载: %s", strings.Join(result.Changed, ", "))
+	if len(result.RestartRequired) > 0 {
+		printWarning("⚠️  以下配置需要重启后生效: %s", strings.Join(result.RestartRequired, ", "))
+	}
+}
+
 // writePidFile 写入 PID 文件
 func writePidFile(pidFile string) error {
 	pid := os.Getpid()
@@ -499,6 +622,14 @@ func runMainProgram() error {
 	}
 	printSuccess("✅ 配置文件加载成功")
 
+	// 打开审计日志，CA自动生成、插件加载等启动期操作同样需要记录
+	auditLogger, err := initAudit(cfg, *configFile)
+	if err != nil {
+		printError("打开审计日志失败: %v", err)
+		return err
+	}
+	defer auditLogger.Close()
+
 	// 初始化证书管理器
 	printInfo("🔐 正在初始化证书管理器...")
 	certMgr, err := initCertManager(cfg)
@@ -531,9 +662,14 @@ func runMainProgram() error {
 		printError("启动服务器失败: %v", err)
 		return err
 	}
+	monitorServer := startMonitor(cfg, server, certMgr)
+	defer stopMonitor(monitorServer)
 
 	// 等待中断信号
-	waitForShutdown(ctx, server)
+	if *watchConf > 0 {
+		cfg.StartConfigWatcher(*watchConf)
+	}
+	waitForShutdown(ctx, server, cfg)
 
 	printSuccess("👋 HackMITM 已安全退出")
 	return nil
@@ -0,0 +1,9 @@
+package main
+
+// 编译进二进制文件的插件，配置中同名的插件无需 .so 文件即可加载；
+// 静态构建（CGO_ENABLED=0）时无法加载 .so 插件，只能使用这些插件
+import (
+	_ "hackmitm/plugins/examples/request_logger"
+	_ "hackmitm/plugins/examples/security"
+	_ "hackmitm/plugins/examples/stats"
+)
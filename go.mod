@@ -2,6 +2,13 @@ module hackmitm
 
 go 1.21
 
-require github.com/sirupsen/logrus v1.9.3
+require (
+	github.com/sirupsen/logrus v1.9.3
+	github.com/tetratelabs/wazero v1.5.0
+	golang.org/x/crypto v0.16.0
+	golang.org/x/net v0.19.0
+	gopkg.in/yaml.v3 v3.0.1
+	software.sslmate.com/src/go-pkcs12 v0.4.0
+)
 
 require golang.org/x/sys v0.15.0 // indirect
@@ -0,0 +1,313 @@
+// Package audit 提供只追加的 JSON Lines 安全审计日志，支持哈希链防篡改
+// Package audit provides an append-only, optionally hash-chained JSON lines audit log
+package audit
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"hackmitm/pkg/config"
+	"hackmitm/pkg/logger"
+)
+
+// 事件类型
+const (
+	// TypeAccess 访问决策
+	TypeAccess = "access"
+	// TypeConfig 配置加载与变更
+	TypeConfig = "config"
+	// TypePlugin 插件加载与卸载
+	TypePlugin = "plugin"
+	// TypeCA CA证书操作
+	TypeCA = "ca"
+)
+
+// 访问决策
+const (
+	ActionAllow       = "allow"
+	ActionDeny        = "deny"
+	ActionPassthrough = "passthrough"
+)
+
+// tailReadSize 恢复哈希链时从文件末尾读取的字节数
+const tailReadSize = 64 * 1024
+
+// Event 审计事件
+type Event struct {
+	// Time 事件时间
+	Time time.Time `json:"time"`
+	// Seq 序号，在同一文件中连续递增
+	Seq uint64 `json:"seq"`
+	// Type 事件类型
+	Type string `json:"type"`
+	// Action 动作，访问事件为 allow/deny/passthrough
+	Action string `json:"action"`
+	// User 认证用户名
+	User string `json:"user,omitempty"`
+	// ClientIP 客户端IP
+	ClientIP string `json:"client_ip,omitempty"`
+	// Method 请求方法
+	Method string `json:"method,omitempty"`
+	// Target 目标（URL、插件名、证书路径等）
+	Target string `json:"target,omitempty"`
+	// Rule 作出决策的规则或插件
+	Rule string `json:"rule,omitempty"`
+	// Reason 原因
+	Reason string `json:"reason,omitempty"`
+	// Details 附加信息
+	Details map[string]interface{} `json:"details,omitempty"`
+	// PrevHash 上一条事件的哈希
+	PrevHash string `json:"prev_hash,omitempty"`
+	// Hash 本条事件的哈希，覆盖除自身以外的全部字段（含 prev_hash）
+	Hash string `json:"hash,omitempty"`
+}
+
+// Logger 审计日志写入器
+// Logger appends audit events to a JSON lines file
+type Logger struct {
+	// config 审计配置
+	config config.AuditConfig
+	// file 当前打开的审计文件，未启用时为nil
+	file *os.File
+	// size 本进程最后一次写入后的文件大小，用于发现其他进程追加的记录
+	size int64
+	// seq 最后一条事件的序号
+	seq uint64
+	// lastHash 最后一条事件的哈希
+	lastHash string
+	// written 写入的事件数
+	written int64
+	// failed 写入失败的事件数
+	failed int64
+	// mutex 保护并发写入
+	mutex sync.Mutex
+}
+
+// New 创建审计日志写入器
+func New(auditConfig config.AuditConfig) (*Logger, error) {
+	l := &Logger{}
+	if err := l.Configure(auditConfig); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// Configure 应用配置，文件路径变化时重新打开
+func (l *Logger) Configure(auditConfig config.AuditConfig) error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if !auditConfig.Enabled {
+		if l.file != nil {
+			l.file.Close()
+			l.file = nil
+			logger.Info("审计日志已禁用")
+		}
+		l.config = auditConfig
+		return nil
+	}
+
+	if l.file != nil && auditConfig.File == l.config.File {
+		l.config = auditConfig
+		return nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(auditConfig.File), 0755); err != nil {
+		return fmt.Errorf("创建审计日志目录失败: %w", err)
+	}
+	file, err := os.OpenFile(auditConfig.File, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return fmt.Errorf("打开审计日志失败: %w", err)
+	}
+
+	if l.file != nil {
+		l.file.Close()
+	}
+	l.file = file
+	l.config = auditConfig
+	if err := l.recoverLocked(); err != nil {
+		logger.Warnf("读取审计日志末尾失败，哈希链将重新开始: %v", err)
+		l.seq, l.lastHash = 0, ""
+	}
+
+	logger.Infof("审计日志已启用: %s（哈希链: %t）", auditConfig.File, auditConfig.HashChain)
+	return nil
+}
+
+// recoverLocked 从文件最后一条记录恢复序号和哈希（调用方需持有锁）
+func (l *Logger) recoverLocked() error {
+	info, err := l.file.Stat()
+	if err != nil {
+		return err
+	}
+	l.size = info.Size()
+	l.seq, l.lastHash = 0, ""
+	if l.size == 0 {
+		return nil
+	}
+
+	reader, err := os.Open(l.config.File)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	offset := l.size - tailReadSize
+	if offset < 0 {
+		offset = 0
+	}
+	buf := make([]byte, l.size-offset)
+	if _, err := reader.ReadAt(buf, offset); err != nil && err != io.EOF {
+		return err
+	}
+
+	buf = bytes.TrimRight(buf, "\n")
+	if i := bytes.LastIndexByte(buf, '\n'); i >= 0 {
+		buf = buf[i+1:]
+	}
+	var last Event
+	if err := json.Unmarshal(buf, &last); err != nil {
+		return fmt.Errorf("解析最后一条审计记录失败: %w", err)
+	}
+	l.seq, l.lastHash = last.Seq, last.Hash
+	return nil
+}
+
+// Enabled 是否启用
+func (l *Logger) Enabled() bool {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return l.file != nil
+}
+
+// Record 写入审计事件，未启用或关闭了允许事件记录时忽略
+func (l *Logger) Record(event Event) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if l.file == nil {
+		return
+	}
+	if event.Type == TypeAccess && event.Action == ActionAllow && !l.config.LogAllowed {
+		return
+	}
+
+	// 其他进程（如 hackmitm ca 子命令）追加过记录时，从文件末尾重新接续哈希链
+	if info, err := l.file.Stat(); err == nil && info.Size() != l.size {
+		if err := l.recoverLocked(); err != nil {
+			logger.Warnf("审计日志被外部修改且无法解析末尾记录: %v", err)
+		}
+	}
+
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+	event.Seq = l.seq + 1
+	event.PrevHash, event.Hash = "", ""
+	if l.config.HashChain {
+		event.PrevHash = l.lastHash
+	}
+
+	line, hash, err := encodeEvent(event, l.config.HashChain)
+	if err != nil {
+		atomic.AddInt64(&l.failed, 1)
+		logger.Errorf("编码审计事件失败: %v", err)
+		return
+	}
+
+	n, err := l.file.Write(line)
+	l.size += int64(n)
+	if err != nil {
+		atomic.AddInt64(&l.failed, 1)
+		logger.Errorf("写入审计日志失败: %v", err)
+		return
+	}
+	if l.config.Sync {
+		if err := l.file.Sync(); err != nil {
+			logger.Errorf("同步审计日志失败: %v", err)
+		}
+	}
+
+	l.seq = event.Seq
+	l.lastHash = hash
+	atomic.AddInt64(&l.written, 1)
+}
+
+// encodeEvent 编码为一行 JSON，启用哈希链时在末尾追加 hash 字段
+// hash = sha256(不含 hash 字段的 JSON)，校验时去掉末尾的 hash 字段即可还原被哈希的原始字节
+func encodeEvent(event Event, chain bool) ([]byte, string, error) {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return nil, "", err
+	}
+	if !chain {
+		return append(body, '\n'), "", nil
+	}
+
+	sum := sha256.Sum256(body)
+	hash := hex.EncodeToString(sum[:])
+	line := make([]byte, 0, len(body)+len(hash)+12)
+	line = append(line, body[:len(body)-1]...)
+	line = append(line, `,"hash":"`...)
+	line = append(line, hash...)
+	line = append(line, "\"}\n"...)
+	return line, hash, nil
+}
+
+// Close 关闭审计日志
+func (l *Logger) Close() error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if l.file == nil {
+		return nil
+	}
+	err := l.file.Close()
+	l.file = nil
+	return err
+}
+
+// GetStats 获取统计信息
+func (l *Logger) GetStats() map[string]interface{} {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	return map[string]interface{}{
+		"enabled":    l.file != nil,
+		"file":       l.config.File,
+		"hash_chain": l.config.HashChain,
+		"seq":        l.seq,
+		"last_hash":  l.lastHash,
+		"written":    atomic.LoadInt64(&l.written),
+		"failed":     atomic.LoadInt64(&l.failed),
+	}
+}
+
+// defaultLogger 全局审计日志，供各模块直接记录
+var defaultLogger atomic.Pointer[Logger]
+
+// SetDefault 设置全局审计日志
+func SetDefault(l *Logger) {
+	defaultLogger.Store(l)
+}
+
+// Default 返回全局审计日志，未设置时为nil
+func Default() *Logger {
+	return defaultLogger.Load()
+}
+
+// Record 写入全局审计日志，未设置时忽略
+func Record(event Event) {
+	if l := defaultLogger.Load(); l != nil {
+		l.Record(event)
+	}
+}
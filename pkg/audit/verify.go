@@ -0,0 +1,102 @@
+package audit
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+)
+
+// hashSuffix 行末的 hash 字段
+var hashSuffix = regexp.MustCompile(`,"hash":"([0-9a-f]{64})"\}$`)
+
+// VerifyResult 哈希链校验结果
+type VerifyResult struct {
+	// Events 校验通过的事件数
+	Events int `json:"events"`
+	// Unchained 未启用哈希链的事件数（无法校验）
+	Unchained int `json:"unchained"`
+	// FirstSeq 第一条事件序号
+	FirstSeq uint64 `json:"first_seq"`
+	// LastSeq 最后一条事件序号
+	LastSeq uint64 `json:"last_seq"`
+	// LastHash 最后一条事件的哈希，可定期记录到外部用于发现截断
+	LastHash string `json:"last_hash"`
+	// BrokenLine 第一处校验失败的行号，0 表示全部通过
+	BrokenLine int `json:"broken_line,omitempty"`
+	// Problem 校验失败原因
+	Problem string `json:"problem,omitempty"`
+}
+
+// Verify 校验审计日志的哈希链：每行哈希与内容一致、prev_hash 指向上一行、序号连续
+// 文件无法读取时返回错误，链断裂时通过 BrokenLine 和 Problem 报告
+func Verify(path string) (*VerifyResult, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("打开审计日志失败: %w", err)
+	}
+	defer file.Close()
+
+	result := &VerifyResult{}
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+
+	var prevHash string
+	var prevSeq uint64
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+
+		broken := func(format string, args ...interface{}) (*VerifyResult, error) {
+			result.BrokenLine = lineNo
+			result.Problem = fmt.Sprintf(format, args...)
+			return result, nil
+		}
+
+		var event Event
+		if err := json.Unmarshal(line, &event); err != nil {
+			return broken("无法解析: %v", err)
+		}
+		if result.Events+result.Unchained > 0 && event.Seq != prevSeq+1 {
+			return broken("序号不连续: 期望 %d，实际 %d（记录可能被删除或插入）", prevSeq+1, event.Seq)
+		}
+		if result.Events+result.Unchained == 0 {
+			result.FirstSeq = event.Seq
+		}
+
+		if event.Hash == "" {
+			result.Unchained++
+			prevHash, prevSeq = "", event.Seq
+			continue
+		}
+
+		match := hashSuffix.FindSubmatchIndex(line)
+		if match == nil {
+			return broken("hash 字段不在行末")
+		}
+		body := append(append([]byte{}, line[:match[0]]...), '}')
+		sum := sha256.Sum256(body)
+		if hex.EncodeToString(sum[:]) != event.Hash {
+			return broken("内容与哈希不符（记录被修改）")
+		}
+		if event.PrevHash != prevHash {
+			return broken("prev_hash 与上一条记录不符（记录被删除、插入或重排）")
+		}
+
+		result.Events++
+		prevHash, prevSeq = event.Hash, event.Seq
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("读取审计日志失败: %w", err)
+	}
+
+	result.LastSeq = prevSeq
+	result.LastHash = prevHash
+	return result, nil
+}
@@ -0,0 +1,172 @@
+package audit
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"hackmitm/pkg/config"
+)
+
+// writeChain 写入 n 条启用哈希链的审计事件，返回日志文件路径
+func writeChain(t *testing.T, n int) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	l, err := New(config.AuditConfig{Enabled: true, File: path, HashChain: true, LogAllowed: true})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	for i := 0; i < n; i++ {
+		l.Record(Event{Type: TypeAccess, Action: ActionDeny, ClientIP: "10.0.0.1", Target: fmt.Sprintf("http://a.test/%d", i)})
+	}
+	if err := l.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+	return path
+}
+
+// readLines 读取日志的各行
+func readLines(t *testing.T, path string) [][]byte {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return bytes.Split(bytes.TrimRight(data, "\n"), []byte("\n"))
+}
+
+// writeLines 以各行覆盖日志
+func writeLines(t *testing.T, path string, lines [][]byte) {
+	t.Helper()
+	data := append(bytes.Join(lines, []byte("\n")), '\n')
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestVerifyDetectsTampering(t *testing.T) {
+	tests := []struct {
+		name string
+		// tamper 修改日志各行，返回修改后的行
+		tamper func(lines [][]byte) [][]byte
+		// wantLine 期望报告的第一处断裂行号，0 表示校验通过
+		wantLine int
+		// wantProblem 断裂原因包含的文字
+		wantProblem string
+	}{
+		{
+			name:   "未修改",
+			tamper: func(lines [][]byte) [][]byte { return lines },
+		},
+		{
+			name: "修改记录内容",
+			tamper: func(lines [][]byte) [][]byte {
+				lines[2] = bytes.Replace(lines[2], []byte(`"action":"deny"`), []byte(`"action":"allow"`), 1)
+				return lines
+			},
+			wantLine:    3,
+			wantProblem: "内容与哈希不符",
+		},
+		{
+			name: "删除中间的记录",
+			tamper: func(lines [][]byte) [][]byte {
+				return append(lines[:1:1], lines[2:]...)
+			},
+			wantLine:    2,
+			wantProblem: "序号不连续",
+		},
+		{
+			name: "交换两条记录",
+			tamper: func(lines [][]byte) [][]byte {
+				lines[1], lines[2] = lines[2], lines[1]
+				return lines
+			},
+			wantLine:    2,
+			wantProblem: "序号不连续",
+		},
+		{
+			name: "删除记录后重新编号",
+			tamper: func(lines [][]byte) [][]byte {
+				lines = append(lines[:1:1], lines[2:]...)
+				for i := 1; i < len(lines); i++ {
+					lines[i] = bytes.Replace(lines[i], []byte(fmt.Sprintf(`"seq":%d`, i+2)), []byte(fmt.Sprintf(`"seq":%d`, i+1)), 1)
+				}
+				return lines
+			},
+			wantLine:    2,
+			wantProblem: "内容与哈希不符",
+		},
+		{
+			name: "去掉哈希冒充未启用哈希链的记录",
+			tamper: func(lines [][]byte) [][]byte {
+				line := string(lines[3])
+				line = line[:strings.LastIndex(line, `,"hash":`)] + "}"
+				lines[3] = []byte(line)
+				return lines
+			},
+			wantLine:    5,
+			wantProblem: "prev_hash",
+		},
+		{
+			name: "无法解析的行",
+			tamper: func(lines [][]byte) [][]byte {
+				lines[0] = []byte("{broken")
+				return lines
+			},
+			wantLine:    1,
+			wantProblem: "无法解析",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := writeChain(t, 5)
+			writeLines(t, path, tt.tamper(readLines(t, path)))
+
+			result, err := Verify(path)
+			if err != nil {
+				t.Fatalf("Verify() error = %v", err)
+			}
+			if result.BrokenLine != tt.wantLine {
+				t.Fatalf("BrokenLine = %d (%s), want %d", result.BrokenLine, result.Problem, tt.wantLine)
+			}
+			if !strings.Contains(result.Problem, tt.wantProblem) {
+				t.Errorf("Problem = %q, want containing %q", result.Problem, tt.wantProblem)
+			}
+			if tt.wantLine == 0 && (result.Events != 5 || result.FirstSeq != 1 || result.LastSeq != 5 || result.LastHash == "") {
+				t.Errorf("result = %+v, want 5 chained events with seq 1..5", result)
+			}
+		})
+	}
+}
+
+func TestLoggerResumesChainAfterReopen(t *testing.T) {
+	path := writeChain(t, 3)
+	lastHash := ""
+	if result, err := Verify(path); err != nil || result.BrokenLine != 0 {
+		t.Fatalf("Verify() = %+v, %v", result, err)
+	} else {
+		lastHash = result.LastHash
+	}
+
+	l, err := New(config.AuditConfig{Enabled: true, File: path, HashChain: true})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	if stats := l.GetStats(); stats["last_hash"] != lastHash {
+		t.Errorf("重新打开后 last_hash = %v, want %s", stats["last_hash"], lastHash)
+	}
+	l.Record(Event{Type: TypeCA, Action: "export", Target: "ca.pem"})
+	l.Close()
+
+	result, err := Verify(path)
+	if err != nil {
+		t.Fatalf("Verify() error = %v", err)
+	}
+	if result.BrokenLine != 0 || result.Events != 4 || result.LastSeq != 4 {
+		t.Errorf("result = %+v, want 4 chained events", result)
+	}
+}
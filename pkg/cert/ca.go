@@ -0,0 +1,574 @@
+// Package cert CA证书生成、轮换与导出
+package cert
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"hackmitm/pkg/audit"
+	"hackmitm/pkg/logger"
+
+	"software.sslmate.com/src/go-pkcs12"
+)
+
+// CA相关文件名
+const (
+	caKeyFileName      = "ca-key.pem"
+	caCertFileName     = "ca-cert.pem"
+	prevCAKeyFileName  = "ca-prev-key.pem"
+	prevCACertFileName = "ca-prev-cert.pem"
+	crossCertFileName  = "ca-cross-cert.pem"
+)
+
+const (
+	// defaultCAValidity 默认CA有效期
+	defaultCAValidity = 10 * 365 * 24 * time.Hour
+	// defaultLeafValidity 默认叶子证书有效期
+	defaultLeafValidity = 397 * 24 * time.Hour
+	// maxLeafValidity 叶子证书最长有效期（Apple 平台拒绝超过398天的证书）
+	maxLeafValidity = 398 * 24 * time.Hour
+	// defaultLeafBackdate 默认叶子证书生效时间回拨
+	defaultLeafBackdate = time.Hour
+)
+
+// 支持的CA密钥算法
+const (
+	AlgorithmECDSAP256 = "ecdsa-p256"
+	AlgorithmECDSAP384 = "ecdsa-p384"
+	AlgorithmRSA2048   = "rsa-2048"
+	AlgorithmRSA3072   = "rsa-3072"
+	AlgorithmRSA4096   = "rsa-4096"
+)
+
+// CAOptions CA证书生成选项
+// CAOptions options for generating a CA certificate
+type CAOptions struct {
+	// CommonName 通用名称
+	CommonName string
+	// Organization 组织名称
+	Organization string
+	// OrganizationalUnit 组织单位
+	OrganizationalUnit string
+	// Country 国家代码
+	Country string
+	// Algorithm 密钥算法
+	Algorithm string
+	// Validity 有效期
+	Validity time.Duration
+}
+
+// CAInfo CA证书信息
+// CAInfo CA certificate information
+type CAInfo struct {
+	Subject           string    `json:"subject"`
+	Issuer            string    `json:"issuer"`
+	SerialNumber      string    `json:"serial_number"`
+	Algorithm         string    `json:"algorithm"`
+	NotBefore         time.Time `json:"not_before"`
+	NotAfter          time.Time `json:"not_after"`
+	SHA1Fingerprint   string    `json:"sha1_fingerprint"`
+	SHA256Fingerprint string    `json:"sha256_fingerprint"`
+	// GraceUntil 轮换宽限期截止时间（无宽限期时为nil）
+	GraceUntil *time.Time `json:"grace_until,omitempty"`
+	// Previous 宽限期内仍受信任的旧CA
+	Previous *CAInfo `json:"previous,omitempty"`
+}
+
+// withDefaults 填充默认值
+func (o CAOptions) withDefaults() CAOptions {
+	if o.CommonName == "" {
+		o.CommonName = "HackMITM Root CA"
+	}
+	if o.Organization == "" {
+		o.Organization = "HackMITM"
+	}
+	if o.OrganizationalUnit == "" {
+		o.OrganizationalUnit = "HackMITM Root CA"
+	}
+	if o.Country == "" {
+		o.Country = "CN"
+	}
+	if o.Algorithm == "" {
+		o.Algorithm = AlgorithmECDSAP256
+	}
+	if o.Validity <= 0 {
+		o.Validity = defaultCAValidity
+	}
+	return o
+}
+
+// generateKey 按算法生成私钥
+func generateKey(algorithm string) (crypto.Signer, error) {
+	switch strings.ToLower(algorithm) {
+	case AlgorithmECDSAP256:
+		return ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case AlgorithmECDSAP384:
+		return ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	case AlgorithmRSA2048:
+		return rsa.GenerateKey(rand.Reader, 2048)
+	case AlgorithmRSA3072:
+		return rsa.GenerateKey(rand.Reader, 3072)
+	case AlgorithmRSA4096:
+		return rsa.GenerateKey(rand.Reader, 4096)
+	default:
+		return nil, fmt.Errorf("不支持的密钥算法: %s", algorithm)
+	}
+}
+
+// randomSerialNumber 生成随机证书序列号
+func randomSerialNumber() (*big.Int, error) {
+	limit := new(big.Int).Lsh(big.NewInt(1), 128)
+	serial, err := rand.Int(rand.Reader, limit)
+	if err != nil {
+		return nil, fmt.Errorf("生成证书序列号失败: %w", err)
+	}
+	return serial, nil
+}
+
+// caTemplate 构建CA证书模板
+func caTemplate(opts CAOptions, serial *big.Int, notBefore, notAfter time.Time) *x509.Certificate {
+	return &x509.Certificate{
+		SerialNumber: serial,
+		Subject: pkix.Name{
+			Country:            []string{opts.Country},
+			Organization:       []string{opts.Organization},
+			OrganizationalUnit: []string{opts.OrganizationalUnit},
+			CommonName:         opts.CommonName,
+		},
+		NotBefore:             notBefore,
+		NotAfter:              notAfter,
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+}
+
+// createCA 创建自签名CA证书
+func createCA(opts CAOptions) (*x509.Certificate, crypto.Signer, error) {
+	opts = opts.withDefaults()
+
+	caKey, err := generateKey(opts.Algorithm)
+	if err != nil {
+		return nil, nil, fmt.Errorf("生成CA私钥失败: %w", err)
+	}
+
+	serial, err := randomSerialNumber()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	now := time.Now()
+	template := caTemplate(opts, serial, now, now.Add(opts.Validity))
+
+	// 自签名CA证书
+	caCertBytes, err := x509.CreateCertificate(rand.Reader, template, template, caKey.Public(), caKey)
+	if err != nil {
+		return nil, nil, fmt.Errorf("创建CA证书失败: %w", err)
+	}
+
+	caCert, err := x509.ParseCertificate(caCertBytes)
+	if err != nil {
+		return nil, nil, fmt.Errorf("解析CA证书失败: %w", err)
+	}
+
+	return caCert, caKey, nil
+}
+
+// marshalPrivateKey 将私钥编码为PEM
+func marshalPrivateKey(key crypto.Signer) ([]byte, error) {
+	switch k := key.(type) {
+	case *ecdsa.PrivateKey:
+		der, err := x509.MarshalECPrivateKey(k)
+		if err != nil {
+			return nil, err
+		}
+		return pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}), nil
+	case *rsa.PrivateKey:
+		return pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(k)}), nil
+	default:
+		der, err := x509.MarshalPKCS8PrivateKey(key)
+		if err != nil {
+			return nil, err
+		}
+		return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), nil
+	}
+}
+
+// parsePrivateKey 解析PEM私钥
+func parsePrivateKey(block *pem.Block) (crypto.Signer, error) {
+	switch block.Type {
+	case "EC PRIVATE KEY":
+		return x509.ParseECPrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		return x509.ParsePKCS1PrivateKey(block.Bytes)
+	}
+
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("不支持的私钥类型: %T", key)
+	}
+	return signer, nil
+}
+
+// saveCA 保存CA私钥和证书
+func saveCA(dir, keyName, certName string, caCert *x509.Certificate, caKey crypto.Signer) error {
+	keyPEM, err := marshalPrivateKey(caKey)
+	if err != nil {
+		return fmt.Errorf("序列化CA私钥失败: %w", err)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, keyName), keyPEM, 0600); err != nil {
+		return fmt.Errorf("保存CA私钥失败: %w", err)
+	}
+
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: caCert.Raw})
+	if err := os.WriteFile(filepath.Join(dir, certName), certPEM, 0644); err != nil {
+		return fmt.Errorf("保存CA证书失败: %w", err)
+	}
+
+	return nil
+}
+
+// readCA 读取CA私钥和证书
+func readCA(keyPath, certPath string) (*x509.Certificate, crypto.Signer, error) {
+	keyPEM, err := os.ReadFile(keyPath)
+	if err != nil {
+		return nil, nil, fmt.Errorf("读取CA私钥失败: %w", err)
+	}
+
+	keyBlock, _ := pem.Decode(keyPEM)
+	if keyBlock == nil {
+		return nil, nil, fmt.Errorf("解码CA私钥失败")
+	}
+
+	caKey, err := parsePrivateKey(keyBlock)
+	if err != nil {
+		return nil, nil, fmt.Errorf("解析CA私钥失败: %w", err)
+	}
+
+	caCert, err := readCertificate(certPath)
+	if err != nil {
+		return nil, nil, fmt.Errorf("读取CA证书失败: %w", err)
+	}
+
+	return caCert, caKey, nil
+}
+
+// readCertificate 读取PEM证书文件
+func readCertificate(path string) (*x509.Certificate, error) {
+	certPEM, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	certBlock, _ := pem.Decode(certPEM)
+	if certBlock == nil {
+		return nil, fmt.Errorf("解码证书失败: %s", path)
+	}
+
+	return x509.ParseCertificate(certBlock.Bytes)
+}
+
+// loadCrossCert 加载交叉签名证书，过期则忽略（调用方需持有 caMutex 写锁）
+func (cm *CertManager) loadCrossCert() {
+	crossPath := filepath.Join(cm.certDir, crossCertFileName)
+	cross, err := readCertificate(crossPath)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			logger.Warnf("读取交叉签名证书失败: %v", err)
+		}
+		return
+	}
+
+	if time.Now().After(cross.NotAfter) {
+		logger.Infof("CA轮换宽限期已结束 (%s)，不再附带交叉签名证书", cross.NotAfter.Format(time.RFC3339))
+		return
+	}
+
+	cm.crossCert = cross
+	logger.Infof("CA轮换宽限期内，旧CA仍受信任至 %s", cross.NotAfter.Format(time.RFC3339))
+}
+
+// currentCA 返回当前CA证书、私钥和仍在宽限期内的交叉签名证书
+func (cm *CertManager) currentCA() (*x509.Certificate, crypto.Signer, *x509.Certificate) {
+	cm.caMutex.RLock()
+	defer cm.caMutex.RUnlock()
+
+	cross := cm.crossCert
+	if cross != nil && time.Now().After(cross.NotAfter) {
+		cross = nil
+	}
+	return cm.caCert, cm.caKey, cross
+}
+
+// caCertificate 返回当前CA证书
+func (cm *CertManager) caCertificate() *x509.Certificate {
+	cm.caMutex.RLock()
+	defer cm.caMutex.RUnlock()
+	return cm.caCert
+}
+
+// RegenerateCA 使用指定选项重新生成CA证书，旧CA将被覆盖
+// RegenerateCA replaces the current CA with a newly generated one
+func (cm *CertManager) RegenerateCA(opts CAOptions) error {
+	cm.caMutex.Lock()
+	defer cm.caMutex.Unlock()
+
+	cm.caOptions = opts
+	if err := cm.generateCA(); err != nil {
+		return err
+	}
+
+	// 旧CA的交叉签名证书已无意义
+	cm.crossCert = nil
+	os.Remove(filepath.Join(cm.certDir, crossCertFileName))
+	cm.ClearCache()
+	recordCAEvent("regenerate", cm.certDir, map[string]interface{}{
+		"subject":     cm.caCert.Subject.String(),
+		"fingerprint": certFingerprint(cm.caCert),
+	})
+	return nil
+}
+
+// recordCAEvent 记录CA证书操作审计事件
+func recordCAEvent(action, target string, details map[string]interface{}) {
+	audit.Record(audit.Event{Type: audit.TypeCA, Action: action, Target: target, Details: details})
+}
+
+// RotateCA 轮换CA证书，旧CA在宽限期内仍受信任
+// RotateCA rotates the CA, keeping the old one trusted for a grace period
+//
+// 新CA会由旧CA交叉签名，宽限期内签发的叶子证书附带该交叉签名证书，
+// 因此只安装了旧CA的客户端仍能验证证书链。
+func (cm *CertManager) RotateCA(opts CAOptions, grace time.Duration) error {
+	cm.caMutex.Lock()
+	defer cm.caMutex.Unlock()
+
+	opts = opts.withDefaults()
+
+	oldCert, oldKey := cm.caCert, cm.caKey
+
+	// 新旧CA主题相同会导致交叉签名证书被误认为自签名证书
+	if opts.CommonName == oldCert.Subject.CommonName {
+		opts.CommonName = fmt.Sprintf("%s %s", opts.CommonName, time.Now().Format("2006-01"))
+	}
+
+	newCert, newKey, err := createCA(opts)
+	if err != nil {
+		return err
+	}
+
+	// 备份旧CA
+	if err := saveCA(cm.certDir, prevCAKeyFileName, prevCACertFileName, oldCert, oldKey); err != nil {
+		return fmt.Errorf("备份旧CA失败: %w", err)
+	}
+
+	crossPath := filepath.Join(cm.certDir, crossCertFileName)
+	var cross *x509.Certificate
+	if grace > 0 {
+		graceUntil := time.Now().Add(grace)
+		if graceUntil.After(oldCert.NotAfter) {
+			graceUntil = oldCert.NotAfter
+		}
+
+		serial, err := randomSerialNumber()
+		if err != nil {
+			return err
+		}
+
+		// 使用旧CA为新CA的公钥签发交叉证书
+		template := caTemplate(opts, serial, newCert.NotBefore, graceUntil)
+		template.SubjectKeyId = newCert.SubjectKeyId
+		crossBytes, err := x509.CreateCertificate(rand.Reader, template, oldCert, newKey.Public(), oldKey)
+		if err != nil {
+			return fmt.Errorf("创建交叉签名证书失败: %w", err)
+		}
+		cross, err = x509.ParseCertificate(crossBytes)
+		if err != nil {
+			return fmt.Errorf("解析交叉签名证书失败: %w", err)
+		}
+
+		crossPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: crossBytes})
+		if err := os.WriteFile(crossPath, crossPEM, 0644); err != nil {
+			return fmt.Errorf("保存交叉签名证书失败: %w", err)
+		}
+	} else {
+		os.Remove(crossPath)
+	}
+
+	if err := saveCA(cm.certDir, caKeyFileName, caCertFileName, newCert, newKey); err != nil {
+		return err
+	}
+
+	cm.caCert = newCert
+	cm.caKey = newKey
+	cm.caOptions = opts
+	cm.crossCert = cross
+	cm.ClearCache()
+
+	recordCAEvent("rotate", cm.certDir, map[string]interface{}{
+		"subject":          newCert.Subject.String(),
+		"fingerprint":      certFingerprint(newCert),
+		"previous_subject": oldCert.Subject.String(),
+		"grace":            grace.String(),
+	})
+	logger.Infof("CA证书轮换完成: %s", newCert.Subject.CommonName)
+	return nil
+}
+
+// describeCertificate 生成证书信息
+func describeCertificate(c *x509.Certificate) *CAInfo {
+	sha1Sum := sha1.Sum(c.Raw)
+	sha1Parts := make([]string, len(sha1Sum))
+	for i, b := range sha1Sum {
+		sha1Parts[i] = fmt.Sprintf("%02X", b)
+	}
+
+	return &CAInfo{
+		Subject:           c.Subject.String(),
+		Issuer:            c.Issuer.String(),
+		SerialNumber:      fmt.Sprintf("%X", c.SerialNumber),
+		Algorithm:         describeKeyAlgorithm(c.PublicKey),
+		NotBefore:         c.NotBefore,
+		NotAfter:          c.NotAfter,
+		SHA1Fingerprint:   strings.Join(sha1Parts, ":"),
+		SHA256Fingerprint: formatFingerprint(sha256.Sum256(c.Raw)),
+	}
+}
+
+// describeKeyAlgorithm 描述公钥算法
+func describeKeyAlgorithm(pub crypto.PublicKey) string {
+	switch k := pub.(type) {
+	case *ecdsa.PublicKey:
+		return fmt.Sprintf("ECDSA %s", k.Curve.Params().Name)
+	case *rsa.PublicKey:
+		return fmt.Sprintf("RSA %d", k.N.BitLen())
+	default:
+		return fmt.Sprintf("%T", pub)
+	}
+}
+
+// GetCAInfo 获取当前CA证书信息
+// GetCAInfo returns information about the current CA
+func (cm *CertManager) GetCAInfo() *CAInfo {
+	caCert, _, cross := cm.currentCA()
+	info := describeCertificate(caCert)
+
+	if cross != nil {
+		graceUntil := cross.NotAfter
+		info.GraceUntil = &graceUntil
+		if prev, err := readCertificate(filepath.Join(cm.certDir, prevCACertFileName)); err == nil {
+			info.Previous = describeCertificate(prev)
+		}
+	}
+
+	return info
+}
+
+// ExportCA 按指定格式导出CA证书
+// ExportCA exports the CA in the given format (pem, der, p12)
+//
+// p12格式包含CA私钥，用于导入其他测试工具，必须提供密码。
+func (cm *CertManager) ExportCA(outputPath, format, password string) error {
+	var data []byte
+	mode := os.FileMode(0644)
+
+	switch strings.ToLower(format) {
+	case "pem", "":
+		data = cm.GetCACert()
+	case "der", "crt", "cer":
+		data = cm.GetCACertDER()
+	case "p12", "pkcs12", "pfx":
+		if password == "" {
+			return fmt.Errorf("导出PKCS#12需要设置密码")
+		}
+		caCert, caKey, _ := cm.currentCA()
+		encoded, err := pkcs12.Modern.Encode(caKey, caCert, nil, password)
+		if err != nil {
+			return fmt.Errorf("编码PKCS#12失败: %w", err)
+		}
+		data = encoded
+		mode = 0600
+	default:
+		return fmt.Errorf("不支持的导出格式: %s", format)
+	}
+
+	if err := os.WriteFile(outputPath, data, mode); err != nil {
+		return fmt.Errorf("导出CA证书失败: %w", err)
+	}
+
+	recordCAEvent("export", outputPath, map[string]interface{}{
+		"format":      strings.ToLower(format),
+		"private_key": mode == 0600,
+	})
+	logger.Infof("CA证书已导出到: %s (%s)", outputPath, format)
+	return nil
+}
+
+// IssueCertificate 为指定主机签发一次性叶子证书（不进入缓存）
+// IssueCertificate issues a one-off leaf certificate for the given hosts
+func (cm *CertManager) IssueCertificate(hosts []string, validity time.Duration) (*tls.Certificate, error) {
+	if validity <= 0 {
+		validity = cm.leafValidity
+	}
+	cert, err := cm.issueLeaf(hosts, validity)
+	if err != nil {
+		return nil, err
+	}
+	recordCAEvent("issue", strings.Join(hosts, ","), map[string]interface{}{
+		"validity": validity.String(),
+	})
+	return cert, nil
+}
+
+// WriteCertificate 将TLS证书链和私钥写入PEM文件
+// WriteCertificate writes a TLS certificate chain and key as PEM files
+func WriteCertificate(cert *tls.Certificate, certPath, keyPath string) error {
+	var certPEM []byte
+	for _, der := range cert.Certificate {
+		certPEM = append(certPEM, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})...)
+	}
+	if err := os.WriteFile(certPath, certPEM, 0644); err != nil {
+		return fmt.Errorf("写入证书失败: %w", err)
+	}
+
+	signer, ok := cert.PrivateKey.(crypto.Signer)
+	if !ok {
+		return fmt.Errorf("不支持的私钥类型: %T", cert.PrivateKey)
+	}
+	keyPEM, err := marshalPrivateKey(signer)
+	if err != nil {
+		return fmt.Errorf("序列化私钥失败: %w", err)
+	}
+	if err := os.WriteFile(keyPath, keyPEM, 0600); err != nil {
+		return fmt.Errorf("写入私钥失败: %w", err)
+	}
+
+	return nil
+}
+
+// CAExists 检查证书目录中是否已存在CA
+func CAExists(certDir string) bool {
+	_, err := os.Stat(filepath.Join(certDir, caKeyFileName))
+	return err == nil
+}
@@ -0,0 +1,127 @@
+// Package cert CA证书导出功能
+package cert
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+	"strings"
+)
+
+// GetCACertDER 获取DER编码的CA证书
+// GetCACertDER returns the DER encoded CA certificate
+func (cm *CertManager) GetCACertDER() []byte {
+	caCert := cm.caCertificate()
+	der := make([]byte, len(caCert.Raw))
+	copy(der, caCert.Raw)
+	return der
+}
+
+// GetCAFingerprint 获取CA证书的SHA-256指纹（冒号分隔的十六进制）
+// GetCAFingerprint returns the SHA-256 fingerprint of the CA certificate
+func (cm *CertManager) GetCAFingerprint() string {
+	return certFingerprint(cm.caCertificate())
+}
+
+// certFingerprint 证书的SHA-256指纹（冒号分隔的十六进制）
+func certFingerprint(c *x509.Certificate) string {
+	return formatFingerprint(sha256.Sum256(c.Raw))
+}
+
+// GetCACommonName 获取CA证书通用名称
+func (cm *CertManager) GetCACommonName() string {
+	return cm.caCertificate().Subject.CommonName
+}
+
+// GetMobileConfig 生成用于iOS/macOS安装CA的.mobileconfig描述文件
+// GetMobileConfig generates an Apple configuration profile containing the CA
+func (cm *CertManager) GetMobileConfig() []byte {
+	caCert := cm.caCertificate()
+	sum := sha256.Sum256(caCert.Raw)
+	// 基于指纹生成稳定的UUID，同一CA重复下载时描述文件保持一致
+	profileUUID := uuidFromBytes(sum[:16])
+	payloadUUID := uuidFromBytes(sum[16:])
+	name := caCert.Subject.CommonName
+
+	var sb strings.Builder
+	sb.WriteString(`<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
+<plist version="1.0">
+<dict>
+	<key>PayloadContent</key>
+	<array>
+		<dict>
+			<key>PayloadCertificateFileName</key>
+			<string>hackmitm-ca.cer</string>
+			<key>PayloadContent</key>
+			<data>`)
+	sb.WriteString(base64.StdEncoding.EncodeToString(caCert.Raw))
+	sb.WriteString(`</data>
+			<key>PayloadDescription</key>
+			<string>Adds a CA root certificate</string>
+			<key>PayloadDisplayName</key>
+			<string>`)
+	sb.WriteString(xmlEscape(name))
+	sb.WriteString(`</string>
+			<key>PayloadIdentifier</key>
+			<string>com.apple.security.root.`)
+	sb.WriteString(payloadUUID)
+	sb.WriteString(`</string>
+			<key>PayloadType</key>
+			<string>com.apple.security.root</string>
+			<key>PayloadUUID</key>
+			<string>`)
+	sb.WriteString(payloadUUID)
+	sb.WriteString(`</string>
+			<key>PayloadVersion</key>
+			<integer>1</integer>
+		</dict>
+	</array>
+	<key>PayloadDisplayName</key>
+	<string>`)
+	sb.WriteString(xmlEscape(name))
+	sb.WriteString(`</string>
+	<key>PayloadIdentifier</key>
+	<string>hackmitm.ca.`)
+	sb.WriteString(profileUUID)
+	sb.WriteString(`</string>
+	<key>PayloadRemovalDisallowed</key>
+	<false/>
+	<key>PayloadType</key>
+	<string>Configuration</string>
+	<key>PayloadUUID</key>
+	<string>`)
+	sb.WriteString(profileUUID)
+	sb.WriteString(`</string>
+	<key>PayloadVersion</key>
+	<integer>1</integer>
+</dict>
+</plist>
+`)
+	return []byte(sb.String())
+}
+
+// formatFingerprint 格式化指纹为冒号分隔的大写十六进制
+func formatFingerprint(sum [32]byte) string {
+	parts := make([]string, len(sum))
+	for i, b := range sum {
+		parts[i] = fmt.Sprintf("%02X", b)
+	}
+	return strings.Join(parts, ":")
+}
+
+// uuidFromBytes 将16字节转换为UUID字符串
+func uuidFromBytes(b []byte) string {
+	u := make([]byte, 16)
+	copy(u, b)
+	u[6] = (u[6] & 0x0f) | 0x40 // 版本4
+	u[8] = (u[8] & 0x3f) | 0x80 // RFC 4122 变体
+	return fmt.Sprintf("%X-%X-%X-%X-%X", u[0:4], u[4:6], u[6:8], u[8:10], u[10:16])
+}
+
+// xmlEscape 转义XML特殊字符
+func xmlEscape(s string) string {
+	replacer := strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;", `"`, "&quot;", "'", "&apos;")
+	return replacer.Replace(s)
+}
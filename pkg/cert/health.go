@@ -0,0 +1,60 @@
+package cert
+
+import (
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/x509"
+	"fmt"
+	"time"
+)
+
+// minRSABits CA证书可接受的最小RSA密钥长度
+const minRSABits = 2048
+
+// CANotAfter 返回当前CA证书的过期时间
+// CANotAfter returns the expiry time of the current CA certificate
+func (cm *CertManager) CANotAfter() time.Time {
+	return cm.caCertificate().NotAfter
+}
+
+// CheckCA 检查CA证书的强度与有效期，返回发现的问题列表
+// CheckCA inspects the CA for weak keys, weak signatures and upcoming expiry
+func (cm *CertManager) CheckCA(warnBefore time.Duration) []string {
+	return auditCACertificate(cm.caCertificate(), warnBefore, time.Now())
+}
+
+// auditCACertificate 审查CA证书，warnBefore 为到期告警提前量
+func auditCACertificate(c *x509.Certificate, warnBefore time.Duration, now time.Time) []string {
+	var issues []string
+
+	switch k := c.PublicKey.(type) {
+	case *rsa.PublicKey:
+		if bits := k.N.BitLen(); bits < minRSABits {
+			issues = append(issues, fmt.Sprintf("CA使用弱RSA密钥: %d 位（至少需要 %d 位）", bits, minRSABits))
+		}
+	case *ecdsa.PublicKey:
+		if bits := k.Curve.Params().BitSize; bits < 256 {
+			issues = append(issues, fmt.Sprintf("CA使用弱椭圆曲线: %s", k.Curve.Params().Name))
+		}
+	}
+
+	switch c.SignatureAlgorithm {
+	case x509.MD2WithRSA, x509.MD5WithRSA, x509.SHA1WithRSA, x509.DSAWithSHA1, x509.ECDSAWithSHA1:
+		issues = append(issues, fmt.Sprintf("CA使用不安全的签名算法: %s", c.SignatureAlgorithm))
+	}
+
+	if !c.IsCA || !c.BasicConstraintsValid {
+		issues = append(issues, "CA证书缺少有效的 BasicConstraints CA 标记")
+	}
+
+	remaining := c.NotAfter.Sub(now)
+	switch {
+	case remaining <= 0:
+		issues = append(issues, fmt.Sprintf("CA证书已于 %s 过期", c.NotAfter.Format(time.RFC3339)))
+	case warnBefore > 0 && remaining <= warnBefore:
+		issues = append(issues, fmt.Sprintf("CA证书将于 %s 过期（剩余 %d 天）",
+			c.NotAfter.Format(time.RFC3339), int(remaining.Hours()/24)))
+	}
+
+	return issues
+}
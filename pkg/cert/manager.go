@@ -3,6 +3,7 @@
 package cert
 
 import (
+	"crypto"
 	"crypto/ecdsa"
 	"crypto/elliptic"
 	"crypto/rand"
@@ -11,7 +12,6 @@ import (
 	"crypto/x509/pkix"
 	"encoding/pem"
 	"fmt"
-	"math/big"
 	"net"
 	"os"
 	"path/filepath"
@@ -25,9 +25,15 @@ import (
 // CertManager certificate manager
 type CertManager struct {
 	// caKey CA私钥
-	caKey *ecdsa.PrivateKey
+	caKey crypto.Signer
 	// caCert CA证书
 	caCert *x509.Certificate
+	// crossCert 轮换宽限期内由旧CA交叉签名的新CA证书
+	crossCert *x509.Certificate
+	// caOptions 生成CA证书时使用的选项
+	caOptions CAOptions
+	// caMutex 保护 caKey、caCert、crossCert 和 caOptions，轮换或重新生成CA时与签发证书互斥
+	caMutex sync.RWMutex
 	// certCache 证书缓存
 	certCache map[string]*cacheCert
 	// cacheMutex 缓存锁
@@ -38,6 +44,14 @@ type CertManager struct {
 	enableCache bool
 	// cacheTTL 缓存TTL
 	cacheTTL time.Duration
+	// leafValidity 叶子证书有效期
+	leafValidity time.Duration
+	// leafBackdate 叶子证书生效时间回拨
+	leafBackdate time.Duration
+	// wildcard 按可注册域名签发通配符证书
+	wildcard bool
+	// exactMatchDomains 不使用通配符证书的域名
+	exactMatchDomains []string
 	// cleanupTicker 清理定时器
 	cleanupTicker *time.Ticker
 	// stopCleanup 停止清理
@@ -48,6 +62,17 @@ type CertManager struct {
 type cacheCert struct {
 	cert      *tls.Certificate
 	createdAt time.Time
+	// names 证书包含的SAN（通配符证书使用）
+	names []string
+}
+
+// newCacheCert 创建缓存证书
+func newCacheCert(cert *tls.Certificate, names []string) *cacheCert {
+	return &cacheCert{
+		cert:      cert,
+		createdAt: time.Now(),
+		names:     names,
+	}
 }
 
 // CertOptions 证书选项
@@ -59,6 +84,16 @@ type CertOptions struct {
 	EnableCache bool
 	// CacheTTL 缓存TTL
 	CacheTTL time.Duration
+	// CA 首次生成CA证书时使用的选项
+	CA CAOptions
+	// LeafValidity 叶子证书有效期（默认397天，最长398天）
+	LeafValidity time.Duration
+	// LeafBackdate 叶子证书生效时间回拨，容忍客户端时钟偏差（负值表示不回拨）
+	LeafBackdate time.Duration
+	// Wildcard 为同一可注册域名下的子域名签发共享的通配符证书
+	Wildcard bool
+	// ExactMatchDomains 需要精确匹配证书的域名（包含其子域名），不使用通配符证书
+	ExactMatchDomains []string
 }
 
 // NewCertManager 创建新的证书管理器
@@ -70,6 +105,18 @@ func NewCertManager(opts CertOptions) (*CertManager, error) {
 	if opts.CacheTTL == 0 {
 		opts.CacheTTL = 24 * time.Hour
 	}
+	if opts.LeafValidity <= 0 {
+		opts.LeafValidity = defaultLeafValidity
+	}
+	if opts.LeafValidity > maxLeafValidity {
+		logger.Warnf("叶子证书有效期 %v 超过客户端允许的上限，已调整为 %v", opts.LeafValidity, maxLeafValidity)
+		opts.LeafValidity = maxLeafValidity
+	}
+	if opts.LeafBackdate == 0 {
+		opts.LeafBackdate = defaultLeafBackdate
+	} else if opts.LeafBackdate < 0 {
+		opts.LeafBackdate = 0
+	}
 
 	// 创建证书目录
 	if err := os.MkdirAll(opts.CertDir, 0755); err != nil {
@@ -77,11 +124,17 @@ func NewCertManager(opts CertOptions) (*CertManager, error) {
 	}
 
 	cm := &CertManager{
-		certCache:   make(map[string]*cacheCert),
-		certDir:     opts.CertDir,
-		enableCache: opts.EnableCache,
-		cacheTTL:    opts.CacheTTL,
-		stopCleanup: make(chan bool),
+		certCache:    make(map[string]*cacheCert),
+		certDir:      opts.CertDir,
+		enableCache:  opts.EnableCache,
+		cacheTTL:     opts.CacheTTL,
+		leafValidity: opts.LeafValidity,
+		leafBackdate: opts.LeafBackdate,
+		wildcard:     opts.Wildcard,
+		caOptions:    opts.CA,
+		stopCleanup:  make(chan bool),
+
+		exactMatchDomains: normalizeDomains(opts.ExactMatchDomains),
 	}
 
 	// 初始化CA证书
@@ -138,83 +191,45 @@ func (cm *CertManager) Stop() {
 // initCA 初始化CA证书
 // initCA initializes CA certificate
 func (cm *CertManager) initCA() error {
-	caKeyPath := filepath.Join(cm.certDir, "ca-key.pem")
-	caCertPath := filepath.Join(cm.certDir, "ca-cert.pem")
+	cm.caMutex.Lock()
+	defer cm.caMutex.Unlock()
+
+	caKeyPath := filepath.Join(cm.certDir, caKeyFileName)
+	caCertPath := filepath.Join(cm.certDir, caCertFileName)
 
 	// 检查CA文件是否存在
 	if _, err := os.Stat(caKeyPath); os.IsNotExist(err) {
 		logger.Info("CA证书不存在，正在生成新的CA证书")
-		return cm.generateCA()
+		if err := cm.generateCA(); err != nil {
+			return err
+		}
+		recordCAEvent("generate", cm.certDir, map[string]interface{}{
+			"subject":     cm.caCert.Subject.String(),
+			"fingerprint": certFingerprint(cm.caCert),
+		})
+		return nil
 	}
 
 	// 加载现有CA证书
-	return cm.loadCA(caKeyPath, caCertPath)
+	if err := cm.loadCA(caKeyPath, caCertPath); err != nil {
+		return err
+	}
+
+	// 加载轮换宽限期内的交叉签名证书
+	cm.loadCrossCert()
+	return nil
 }
 
-// generateCA 生成CA证书
+// generateCA 生成CA证书（调用方需持有 caMutex 写锁）
 // generateCA generates CA certificate
 func (cm *CertManager) generateCA() error {
-	// 生成ECDSA私钥
-	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	caCert, caKey, err := createCA(cm.caOptions)
 	if err != nil {
-		return fmt.Errorf("生成CA私钥失败: %w", err)
-	}
-
-	// 创建CA证书模板
-	template := x509.Certificate{
-		SerialNumber: big.NewInt(1),
-		Subject: pkix.Name{
-			Country:            []string{"CN"},
-			Organization:       []string{"HackMITM"},
-			OrganizationalUnit: []string{"HackMITM Root CA"},
-			CommonName:         "HackMITM Root CA",
-		},
-		NotBefore:             time.Now(),
-		NotAfter:              time.Now().Add(10 * 365 * 24 * time.Hour), // 10年有效期
-		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
-		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
-		BasicConstraintsValid: true,
-		IsCA:                  true,
-		MaxPathLen:            0,
+		return err
 	}
 
-	// 自签名CA证书
-	caCertBytes, err := x509.CreateCertificate(rand.Reader, &template, &template, &caKey.PublicKey, caKey)
-	if err != nil {
-		return fmt.Errorf("创建CA证书失败: %w", err)
-	}
-
-	// 解析CA证书
-	caCert, err := x509.ParseCertificate(caCertBytes)
-	if err != nil {
-		return fmt.Errorf("解析CA证书失败: %w", err)
-	}
-
-	// 保存CA私钥
-	caKeyPath := filepath.Join(cm.certDir, "ca-key.pem")
-	keyBytes, err := x509.MarshalECPrivateKey(caKey)
-	if err != nil {
-		return fmt.Errorf("序列化CA私钥失败: %w", err)
-	}
-
-	keyPEM := pem.EncodeToMemory(&pem.Block{
-		Type:  "EC PRIVATE KEY",
-		Bytes: keyBytes,
-	})
-
-	if err := os.WriteFile(caKeyPath, keyPEM, 0600); err != nil {
-		return fmt.Errorf("保存CA私钥失败: %w", err)
-	}
-
-	// 保存CA证书
-	caCertPath := filepath.Join(cm.certDir, "ca-cert.pem")
-	certPEM := pem.EncodeToMemory(&pem.Block{
-		Type:  "CERTIFICATE",
-		Bytes: caCertBytes,
-	})
-
-	if err := os.WriteFile(caCertPath, certPEM, 0644); err != nil {
-		return fmt.Errorf("保存CA证书失败: %w", err)
+	if err := saveCA(cm.certDir, caKeyFileName, caCertFileName, caCert, caKey); err != nil {
+		return err
 	}
 
 	cm.caKey = caKey
@@ -224,39 +239,12 @@ func (cm *CertManager) generateCA() error {
 	return nil
 }
 
-// loadCA 加载CA证书
+// loadCA 加载CA证书（调用方需持有 caMutex 写锁）
 // loadCA loads CA certificate
 func (cm *CertManager) loadCA(keyPath, certPath string) error {
-	// 加载CA私钥
-	keyPEM, err := os.ReadFile(keyPath)
-	if err != nil {
-		return fmt.Errorf("读取CA私钥失败: %w", err)
-	}
-
-	keyBlock, _ := pem.Decode(keyPEM)
-	if keyBlock == nil {
-		return fmt.Errorf("解码CA私钥失败")
-	}
-
-	caKey, err := x509.ParseECPrivateKey(keyBlock.Bytes)
-	if err != nil {
-		return fmt.Errorf("解析CA私钥失败: %w", err)
-	}
-
-	// 加载CA证书
-	certPEM, err := os.ReadFile(certPath)
+	caCert, caKey, err := readCA(keyPath, certPath)
 	if err != nil {
-		return fmt.Errorf("读取CA证书失败: %w", err)
-	}
-
-	certBlock, _ := pem.Decode(certPEM)
-	if certBlock == nil {
-		return fmt.Errorf("解码CA证书失败")
-	}
-
-	caCert, err := x509.ParseCertificate(certBlock.Bytes)
-	if err != nil {
-		return fmt.Errorf("解析CA证书失败: %w", err)
+		return err
 	}
 
 	cm.caKey = caKey
@@ -269,12 +257,22 @@ func (cm *CertManager) loadCA(keyPath, certPath string) error {
 // GetCertificate 获取指定域名的证书
 // GetCertificate gets certificate for specified domain
 func (cm *CertManager) GetCertificate(domain string) (*tls.Certificate, error) {
+	// 通配符模式下按可注册域名缓存
+	if registrable, name, ok := cm.wildcardTarget(domain); ok {
+		cached, err := cm.getWildcardCertificate(registrable, name)
+		if err != nil {
+			return nil, fmt.Errorf("生成通配符证书失败: %w", err)
+		}
+		cm.storeCache(registrable, cached)
+		return cached.cert, nil
+	}
+
 	// 检查缓存
 	if cm.enableCache {
 		cm.cacheMutex.RLock()
 		if cached, exists := cm.certCache[domain]; exists {
 			// 检查是否过期
-			if time.Since(cached.createdAt) < cm.cacheTTL {
+			if cm.isFresh(cached) {
 				cm.cacheMutex.RUnlock()
 				return cached.cert, nil
 			}
@@ -289,62 +287,112 @@ func (cm *CertManager) GetCertificate(domain string) (*tls.Certificate, error) {
 	}
 
 	// 添加到缓存
-	if cm.enableCache {
-		cm.cacheMutex.Lock()
-		cm.certCache[domain] = &cacheCert{
-			cert:      cert,
-			createdAt: time.Now(),
-		}
-		cm.cacheMutex.Unlock()
-	}
+	cm.storeCache(domain, newCacheCert(cert, nil))
 
 	return cert, nil
 }
 
+// isFresh 检查缓存证书是否仍在TTL内
+func (cm *CertManager) isFresh(cached *cacheCert) bool {
+	return time.Since(cached.createdAt) < cm.cacheTTL
+}
+
+// storeCache 将证书写入缓存
+func (cm *CertManager) storeCache(key string, cached *cacheCert) {
+	if !cm.enableCache {
+		return
+	}
+
+	cm.cacheMutex.Lock()
+	cm.certCache[key] = cached
+	cm.cacheMutex.Unlock()
+}
+
 // generateServerCert 生成服务器证书
 // generateServerCert generates server certificate
 func (cm *CertManager) generateServerCert(domain string) (*tls.Certificate, error) {
+	cert, err := cm.issueLeaf([]string{domain}, cm.leafValidity)
+	if err != nil {
+		return nil, err
+	}
+
+	logger.Debugf("为域名 %s 生成服务器证书成功", domain)
+	return cert, nil
+}
+
+// issueLeaf 为指定主机列表签发叶子证书，第一个主机作为CommonName
+func (cm *CertManager) issueLeaf(hosts []string, validity time.Duration) (*tls.Certificate, error) {
+	if len(hosts) == 0 {
+		return nil, fmt.Errorf("主机列表为空")
+	}
+
 	// 生成服务器私钥
 	serverKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
 	if err != nil {
 		return nil, fmt.Errorf("生成服务器私钥失败: %w", err)
 	}
 
+	serialNumber, err := randomSerialNumber()
+	if err != nil {
+		return nil, err
+	}
+
+	// 取当前CA的快照，签发过程中CA被轮换时仍使用一致的证书、私钥和交叉签名证书
+	caCert, caKey, cross := cm.currentCA()
+
+	// 生效时间回拨以容忍客户端时钟偏差，过期时间不超过CA证书
+	now := time.Now()
+	notBefore := now.Add(-cm.leafBackdate)
+	if notBefore.Before(caCert.NotBefore) {
+		notBefore = caCert.NotBefore
+	}
+	notAfter := now.Add(validity)
+	if notAfter.After(caCert.NotAfter) {
+		notAfter = caCert.NotAfter
+	}
+
 	// 创建服务器证书模板
 	template := x509.Certificate{
-		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		SerialNumber: serialNumber,
 		Subject: pkix.Name{
 			Country:            []string{"CN"},
 			Organization:       []string{"HackMITM"},
 			OrganizationalUnit: []string{"HackMITM Server"},
-			CommonName:         domain,
+			CommonName:         hosts[0],
 		},
-		NotBefore:    time.Now(),
-		NotAfter:     time.Now().Add(365 * 24 * time.Hour), // 1年有效期
+		NotBefore:    notBefore,
+		NotAfter:     notAfter,
 		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
 		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
-		DNSNames:     []string{domain},
 		SubjectKeyId: []byte{1, 2, 3, 4, 6},
 	}
 
-	// 如果域名是IP地址，添加到IPAddresses字段
-	if ip := net.ParseIP(domain); ip != nil {
-		template.IPAddresses = []net.IP{ip}
+	// IP地址放入IPAddresses字段，其余放入DNSNames
+	for _, host := range hosts {
+		if ip := net.ParseIP(host); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else {
+			template.DNSNames = append(template.DNSNames, host)
+		}
 	}
 
 	// 使用CA证书签名服务器证书
-	serverCertBytes, err := x509.CreateCertificate(rand.Reader, &template, cm.caCert, &serverKey.PublicKey, cm.caKey)
+	serverCertBytes, err := x509.CreateCertificate(rand.Reader, &template, caCert, &serverKey.PublicKey, caKey)
 	if err != nil {
 		return nil, fmt.Errorf("创建服务器证书失败: %w", err)
 	}
 
-	// 构建TLS证书
+	// 构建TLS证书，宽限期内附带交叉签名证书以兼容仍信任旧CA的客户端
+	chain := [][]byte{serverCertBytes}
+	if cross != nil {
+		chain = append(chain, cross.Raw)
+	}
+
 	cert := &tls.Certificate{
-		Certificate: [][]byte{serverCertBytes},
+		Certificate: chain,
 		PrivateKey:  serverKey,
 	}
 
-	logger.Debugf("为域名 %s 生成服务器证书成功", domain)
 	return cert, nil
 }
 
@@ -353,7 +401,7 @@ func (cm *CertManager) generateServerCert(domain string) (*tls.Certificate, erro
 func (cm *CertManager) GetCACert() []byte {
 	return pem.EncodeToMemory(&pem.Block{
 		Type:  "CERTIFICATE",
-		Bytes: cm.caCert.Raw,
+		Bytes: cm.caCertificate().Raw,
 	})
 }
 
@@ -365,6 +413,7 @@ func (cm *CertManager) ExportCACert(outputPath string) error {
 		return fmt.Errorf("导出CA证书失败: %w", err)
 	}
 
+	recordCAEvent("export", outputPath, map[string]interface{}{"format": "pem", "private_key": false})
 	logger.Infof("CA证书已导出到: %s", outputPath)
 	return nil
 }
@@ -392,5 +441,8 @@ func (cm *CertManager) GetCacheStats() map[string]interface{} {
 		"cache_enabled": cm.enableCache,
 		"cache_size":    len(cm.certCache),
 		"cache_ttl":     cm.cacheTTL.String(),
+		"leaf_validity": cm.leafValidity.String(),
+		"leaf_backdate": cm.leafBackdate.String(),
+		"wildcard":      cm.wildcard,
 	}
 }
@@ -0,0 +1,117 @@
+package cert
+
+import (
+	"net"
+	"sort"
+	"strings"
+
+	"golang.org/x/net/publicsuffix"
+)
+
+// maxWildcardNames 单张通配符证书最多包含的SAN数量，超过后重新从基础名称开始累积
+const maxWildcardNames = 100
+
+// wildcardTarget 计算域名对应的缓存键和所需的证书名称
+// 返回可注册域名（eTLD+1）以及覆盖该域名所需的SAN，
+// 无法使用通配符证书时 ok 为 false
+func (cm *CertManager) wildcardTarget(domain string) (registrable, name string, ok bool) {
+	if !cm.wildcard || net.ParseIP(domain) != nil {
+		return "", "", false
+	}
+
+	domain = strings.ToLower(strings.TrimSuffix(domain, "."))
+	if cm.isExactMatch(domain) {
+		return "", "", false
+	}
+
+	registrable, err := publicsuffix.EffectiveTLDPlusOne(domain)
+	if err != nil {
+		return "", "", false
+	}
+
+	// 可注册域名本身使用精确名称，子域名使用父级通配符（通配符只覆盖一级标签）
+	if domain == registrable {
+		return registrable, registrable, true
+	}
+	return registrable, "*." + domain[strings.Index(domain, ".")+1:], true
+}
+
+// isExactMatch 检查域名是否在精确匹配列表中（包含其子域名）
+func (cm *CertManager) isExactMatch(domain string) bool {
+	for _, exact := range cm.exactMatchDomains {
+		if domain == exact || strings.HasSuffix(domain, "."+exact) {
+			return true
+		}
+	}
+	return false
+}
+
+// getWildcardCertificate 获取覆盖指定名称的通配符证书，
+// 同一可注册域名下的所有名称合并在一张多SAN证书中
+func (cm *CertManager) getWildcardCertificate(registrable, name string) (*cacheCert, error) {
+	var names []string
+
+	if cm.enableCache {
+		cm.cacheMutex.RLock()
+		cached, exists := cm.certCache[registrable]
+		cm.cacheMutex.RUnlock()
+
+		if exists && cm.isFresh(cached) {
+			if containsName(cached.names, name) {
+				return cached, nil
+			}
+			if len(cached.names) < maxWildcardNames {
+				names = append(names, cached.names...)
+			}
+		}
+	}
+
+	names = mergeNames(names, registrable, "*."+registrable, name)
+	cert, err := cm.issueLeaf(names, cm.leafValidity)
+	if err != nil {
+		return nil, err
+	}
+
+	return newCacheCert(cert, names), nil
+}
+
+// containsName 检查名称列表中是否包含指定名称
+func containsName(names []string, name string) bool {
+	for _, n := range names {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+// mergeNames 合并名称列表并去重，可注册域名保持在首位作为CommonName
+func mergeNames(names []string, registrable string, extra ...string) []string {
+	set := make(map[string]struct{}, len(names)+len(extra))
+	for _, n := range append(names, extra...) {
+		set[n] = struct{}{}
+	}
+	delete(set, registrable)
+
+	merged := make([]string, 0, len(set)+1)
+	for n := range set {
+		merged = append(merged, n)
+	}
+	sort.Strings(merged)
+
+	return append([]string{registrable}, merged...)
+}
+
+// normalizeDomains 规范化域名列表（小写、去除通配符前缀和首尾点）
+func normalizeDomains(domains []string) []string {
+	var result []string
+	for _, d := range domains {
+		d = strings.ToLower(strings.TrimSpace(d))
+		d = strings.TrimPrefix(d, "*.")
+		d = strings.Trim(d, ".")
+		if d != "" {
+			result = append(result, d)
+		}
+	}
+	return result
+}
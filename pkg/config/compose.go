@@ -0,0 +1,332 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// 配置组合相关的保留字段
+const (
+	// includeKey 顶层字段，引用其他配置文件（字符串或字符串列表，相对路径基于当前文件所在目录）
+	includeKey = "include"
+	// profilesKey 顶层字段，定义命名配置档，每个配置档是覆盖在主配置上的部分配置
+	profilesKey = "profiles"
+	// appendKey 列表合并指令：追加到已有列表末尾
+	appendKey = "$append"
+	// prependKey 列表合并指令：插入到已有列表开头
+	prependKey = "$prepend"
+)
+
+// LoadOptions 配置加载选项
+type LoadOptions struct {
+	// Profile 选用的配置档名称，为空时不应用配置档
+	Profile string
+	// BuiltinPlugin 判断名称是否为编译进二进制文件的插件（如 plugin.IsRegistered），
+	// 内置插件校验时跳过路径检查；为nil时不识别内置插件
+	BuiltinPlugin func(name string) bool
+}
+
+// composition 组合后的配置文档
+type composition struct {
+	doc      map[string]interface{}
+	sources  []string
+	profiles []string
+}
+
+// composer 递归加载 include 引用的配置文件
+type composer struct {
+	sources  []string
+	visiting map[string]bool
+	// profiles 各配置档按定义顺序收集的覆盖文档（include 的文件在前）
+	profiles map[string][]map[string]interface{}
+}
+
+// composeDocument 按 include -> 当前文件 -> 配置档 的顺序依次覆盖到 base 上
+// base 为合并起点（解析生效配置时为默认配置文档），文件不存在时直接返回 base
+func composeDocument(filePath string, base map[string]interface{}, profile string) (*composition, error) {
+	result := &composition{doc: base}
+
+	if _, err := os.Stat(filePath); os.IsNotExist(err) {
+		if profile != "" {
+			return nil, fmt.Errorf("配置文件不存在，无法应用配置档: %s", profile)
+		}
+		return result, nil
+	}
+
+	c := &composer{
+		visiting: make(map[string]bool),
+		profiles: make(map[string][]map[string]interface{}),
+	}
+	doc, err := c.load(filePath, base)
+	if err != nil {
+		return nil, err
+	}
+	result.sources = c.sources
+
+	for name := range c.profiles {
+		result.profiles = append(result.profiles, name)
+	}
+	sort.Strings(result.profiles)
+
+	if profile != "" {
+		overlays, exists := c.profiles[profile]
+		if !exists {
+			available := "无"
+			if len(result.profiles) > 0 {
+				available = strings.Join(result.profiles, ", ")
+			}
+			return nil, fmt.Errorf("未定义的配置档: %s（可用: %s）", profile, available)
+		}
+		for _, overlay := range overlays {
+			doc = mergeObject(doc, overlay)
+		}
+	}
+
+	result.doc = doc
+	return result, nil
+}
+
+// load 解析配置文件，先将其 include 的文件依次覆盖到 acc 上，再覆盖当前文件
+func (c *composer) load(path string, acc map[string]interface{}) (map[string]interface{}, error) {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	if c.visiting[absPath] {
+		return nil, fmt.Errorf("配置文件循环包含: %s", path)
+	}
+	c.visiting[absPath] = true
+	defer delete(c.visiting, absPath)
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("读取配置文件失败: %w", err)
+	}
+	doc, err := decodeDocument(data, formatFromPath(path))
+	if err != nil {
+		return nil, fmt.Errorf("解析配置文件失败 %s: %w", path, err)
+	}
+	c.sources = append(c.sources, path)
+
+	includes, err := includeList(doc[includeKey])
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s: %w", path, includeKey, err)
+	}
+	delete(doc, includeKey)
+
+	for _, include := range includes {
+		if !filepath.IsAbs(include) {
+			include = filepath.Join(filepath.Dir(path), include)
+		}
+		if acc, err = c.load(include, acc); err != nil {
+			return nil, err
+		}
+	}
+
+	// 配置档中的列表指令需要作用于最终合并结果，因此单独收集，选用时再应用
+	if raw, exists := doc[profilesKey]; exists {
+		profiles, ok := toObject(raw)
+		if !ok {
+			return nil, fmt.Errorf("%s: %s: 必须是对象", path, profilesKey)
+		}
+		for name, value := range profiles {
+			overlay, ok := toObject(value)
+			if !ok {
+				return nil, fmt.Errorf("%s: %s.%s: 必须是对象", path, profilesKey, name)
+			}
+			c.profiles[name] = append(c.profiles[name], overlay)
+		}
+		delete(doc, profilesKey)
+	}
+
+	return mergeObject(acc, doc), nil
+}
+
+// includeList 解析 include 字段
+func includeList(value interface{}) ([]string, error) {
+	switch v := value.(type) {
+	case nil:
+		return nil, nil
+	case string:
+		return []string{v}, nil
+	case []interface{}:
+		list := make([]string, 0, len(v))
+		for _, item := range v {
+			s, ok := item.(string)
+			if !ok {
+				return nil, fmt.Errorf("必须是文件路径字符串列表")
+			}
+			list = append(list, s)
+		}
+		return list, nil
+	}
+	return nil, fmt.Errorf("必须是文件路径字符串或字符串列表")
+}
+
+// mergeValue 合并两个文档值：对象深度合并；列表默认整体替换，
+// 使用 {"$append": [...]} / {"$prepend": [...]} 显式追加到已有列表
+func mergeValue(base, overlay interface{}) interface{} {
+	obj, ok := toObject(overlay)
+	if !ok {
+		return overlay
+	}
+
+	if isListDirective(obj) {
+		baseList, _ := base.([]interface{})
+		prepend, _ := obj[prependKey].([]interface{})
+		appendList, _ := obj[appendKey].([]interface{})
+
+		list := make([]interface{}, 0, len(prepend)+len(baseList)+len(appendList))
+		list = append(list, prepend...)
+		list = append(list, baseList...)
+		return append(list, appendList...)
+	}
+
+	merged := make(map[string]interface{})
+	if baseObj, ok := toObject(base); ok {
+		for key, value := range baseObj {
+			merged[key] = value
+		}
+	}
+	for key, value := range obj {
+		merged[key] = mergeValue(merged[key], value)
+	}
+	return merged
+}
+
+// mergeObject 将 overlay 深度合并到 base 上，返回新对象
+func mergeObject(base, overlay map[string]interface{}) map[string]interface{} {
+	merged, _ := mergeValue(base, overlay).(map[string]interface{})
+	return merged
+}
+
+// isListDirective 检查对象是否为列表合并指令
+func isListDirective(obj map[string]interface{}) bool {
+	if len(obj) == 0 {
+		return false
+	}
+	for key := range obj {
+		if key != appendKey && key != prependKey {
+			return false
+		}
+	}
+	return true
+}
+
+// defaultDocument 将默认配置转换为通用文档，作为合并起点
+func defaultDocument() (map[string]interface{}, error) {
+	data, err := json.Marshal(orderedValue(reflect.ValueOf(getDefaultConfig()).Elem()))
+	if err != nil {
+		return nil, err
+	}
+	return decodeDocument(data, FormatJSON)
+}
+
+// latestModTime 返回各配置文件中最新的修改时间
+func latestModTime(sources []string) (time.Time, error) {
+	var latest time.Time
+	for _, source := range sources {
+		stat, err := os.Stat(source)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if stat.ModTime().After(latest) {
+			latest = stat.ModTime()
+		}
+	}
+	return latest, nil
+}
+
+// RedactedValue 替换输出中密码、密码哈希和令牌等敏感字段的占位值
+const RedactedValue = "***"
+
+// ResolvedDocument 返回组合 include 与配置档后的配置文档
+// resolved 为 true 时输出最终生效的完整配置（含默认值与环境变量覆盖），否则仅输出配置文件组合结果；
+// reveal 为 false 时敏感字段（security.password、security.users[].password_hash、monitoring.api_token）替换为 RedactedValue
+// ResolvedDocument renders the composed configuration in the given format (json or yaml)
+func ResolvedDocument(filePath string, opts LoadOptions, resolved, reveal bool, format string) ([]byte, error) {
+	if !resolved {
+		comp, err := composeDocument(filePath, make(map[string]interface{}), opts.Profile)
+		if err != nil {
+			return nil, err
+		}
+		if !reveal {
+			redactDocument(comp.doc)
+		}
+		return encodeGeneric(comp.doc, format)
+	}
+
+	config, report, err := loadConfig(filePath, opts)
+	if err != nil {
+		return nil, err
+	}
+	if err := report.Err(); err != nil {
+		return nil, err
+	}
+	if !reveal {
+		config.redactSecrets()
+	}
+	return config.encodeDocument(format)
+}
+
+// redactSecrets 将敏感字段替换为 RedactedValue，未设置的字段保持为空
+func (c *Config) redactSecrets() {
+	if c.Security.Password != "" {
+		c.Security.Password = RedactedValue
+	}
+	for i := range c.Security.Users {
+		if c.Security.Users[i].PasswordHash != "" {
+			c.Security.Users[i].PasswordHash = RedactedValue
+		}
+	}
+	if c.Monitoring.APIToken != "" {
+		c.Monitoring.APIToken = RedactedValue
+	}
+}
+
+// redactDocument 将组合文档中的敏感字段替换为 RedactedValue
+func redactDocument(doc map[string]interface{}) {
+	redact := func(section map[string]interface{}, key string) {
+		if value, ok := section[key].(string); ok && value != "" {
+			section[key] = RedactedValue
+		}
+	}
+	if security, ok := doc["security"].(map[string]interface{}); ok {
+		redact(security, "password")
+		if users, ok := security["users"].([]interface{}); ok {
+			for _, user := range users {
+				if user, ok := user.(map[string]interface{}); ok {
+					redact(user, "password_hash")
+				}
+			}
+		}
+	}
+	if monitoring, ok := doc["monitoring"].(map[string]interface{}); ok {
+		redact(monitoring, "api_token")
+	}
+}
+
+// encodeGeneric 序列化通用文档（键按字母顺序输出）
+func encodeGeneric(doc map[string]interface{}, format string) ([]byte, error) {
+	if format == FormatYAML {
+		return yaml.Marshal(doc)
+	}
+
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetIndent("", "  ")
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(doc); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
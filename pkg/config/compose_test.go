@@ -0,0 +1,218 @@
+package config
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestComposeDocument(t *testing.T) {
+	tests := []struct {
+		name string
+		// files 相对临时目录的文件及内容，从 main.json 开始加载
+		files   map[string]string
+		profile string
+		want    string
+		wantErr string
+	}{
+		{
+			name: "当前文件覆盖include的文件",
+			files: map[string]string{
+				"base.json": `{"a":{"x":1,"y":2},"list":[1,2]}`,
+				"main.json": `{"include":"base.json","a":{"y":3}}`,
+			},
+			want: `{"a":{"x":1,"y":3},"list":[1,2]}`,
+		},
+		{
+			name: "列表默认整体替换",
+			files: map[string]string{
+				"base.json": `{"list":[1,2]}`,
+				"main.json": `{"include":"base.json","list":[9]}`,
+			},
+			want: `{"list":[9]}`,
+		},
+		{
+			name: "列表追加与前插指令",
+			files: map[string]string{
+				"base.json": `{"list":[1,2]}`,
+				"main.json": `{"include":"base.json","list":{"$prepend":[0],"$append":[3]}}`,
+			},
+			want: `{"list":[0,1,2,3]}`,
+		},
+		{
+			name: "多个include按顺序覆盖",
+			files: map[string]string{
+				"one.json":  `{"a":1,"b":1}`,
+				"two.yaml":  "b: 2\nc: 2\n",
+				"main.json": `{"include":["one.json","two.yaml"],"c":3}`,
+			},
+			want: `{"a":1,"b":2,"c":3}`,
+		},
+		{
+			name: "相对路径基于被包含文件所在目录",
+			files: map[string]string{
+				"sub/b.json": `{"include":"c.json","b":1}`,
+				"sub/c.json": `{"c":1}`,
+				"main.json":  `{"include":"sub/b.json"}`,
+			},
+			want: `{"b":1,"c":1}`,
+		},
+		{
+			name: "未选用配置档时不应用",
+			files: map[string]string{
+				"main.json": `{"list":[1],"profiles":{"dev":{"list":{"$append":[2]}}}}`,
+			},
+			want: `{"list":[1]}`,
+		},
+		{
+			name: "配置档的列表指令作用于最终结果",
+			files: map[string]string{
+				"base.json": `{"list":[0]}`,
+				"main.json": `{"include":"base.json","list":{"$append":[1]},"profiles":{"dev":{"list":{"$append":[2]}}}}`,
+			},
+			profile: "dev",
+			want:    `{"list":[0,1,2]}`,
+		},
+		{
+			name: "各文件定义的同名配置档依次应用",
+			files: map[string]string{
+				"base.json": `{"profiles":{"dev":{"a":1,"b":1}}}`,
+				"main.json": `{"include":"base.json","profiles":{"dev":{"b":2}}}`,
+			},
+			profile: "dev",
+			want:    `{"a":1,"b":2}`,
+		},
+		{
+			name: "未定义的配置档",
+			files: map[string]string{
+				"main.json": `{"profiles":{"dev":{},"prod":{}}}`,
+			},
+			profile: "test",
+			wantErr: "未定义的配置档: test（可用: dev, prod）",
+		},
+		{
+			name: "循环包含",
+			files: map[string]string{
+				"a.json":    `{"include":"main.json"}`,
+				"main.json": `{"include":"a.json"}`,
+			},
+			wantErr: "配置文件循环包含",
+		},
+		{
+			name: "include类型错误",
+			files: map[string]string{
+				"main.json": `{"include":[1]}`,
+			},
+			wantErr: "必须是文件路径字符串列表",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			for name, content := range tt.files {
+				path := filepath.Join(dir, name)
+				if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			comp, err := composeDocument(filepath.Join(dir, "main.json"), make(map[string]interface{}), tt.profile)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("composeDocument() error = %v, want containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("composeDocument() error = %v", err)
+			}
+			got, err := json.Marshal(comp.doc)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("composeDocument() = %s, want %s", got, tt.want)
+			}
+			if len(comp.sources) != len(tt.files) {
+				t.Errorf("sources = %v, want %d files", comp.sources, len(tt.files))
+			}
+		})
+	}
+}
+
+func TestComposeDocumentMissingFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "missing.json")
+	base := map[string]interface{}{"a": 1}
+
+	comp, err := composeDocument(path, base, "")
+	if err != nil || comp.doc["a"] != 1 {
+		t.Errorf("文件不存在时应返回 base: %v, %v", comp, err)
+	}
+	if _, err := composeDocument(path, base, "dev"); err == nil {
+		t.Error("文件不存在时选用配置档未返回错误")
+	}
+}
+
+func TestRedactDocument(t *testing.T) {
+	var doc map[string]interface{}
+	if err := json.Unmarshal([]byte(`{
+		"security": {"password": "secret", "users": [{"username": "a", "password_hash": "$2a$10$x"}, {"username": "b"}]},
+		"monitoring": {"api_token": "", "port": 9090}
+	}`), &doc); err != nil {
+		t.Fatal(err)
+	}
+
+	redactDocument(doc)
+	got, _ := json.Marshal(doc)
+	want := `{"monitoring":{"api_token":"","port":9090},"security":{"password":"***","users":[{"password_hash":"***","username":"a"},{"username":"b"}]}}`
+	if string(got) != want {
+		t.Errorf("redactDocument() = %s, want %s", got, want)
+	}
+}
+
+func TestCheckConfigBuiltinPlugin(t *testing.T) {
+	builtin := func(name string) bool { return name == "request-logger" }
+
+	tests := []struct {
+		name    string
+		plugin  string
+		lookup  func(string) bool
+		wantErr string
+	}{
+		{name: "已注册的内置插件", plugin: `{"name":"request-logger","enabled":true,"runtime":"builtin"}`, lookup: builtin},
+		{name: "按名称识别native插件", plugin: `{"name":"request-logger","enabled":true}`, lookup: builtin},
+		{name: "未注册的内置插件", plugin: `{"name":"missing","enabled":true,"runtime":"builtin"}`, lookup: builtin, wantErr: "未找到内置插件"},
+		{name: "未传入判断函数时不识别内置插件", plugin: `{"name":"request-logger","enabled":true}`, wantErr: "必须指定路径"},
+		// 未传入判断函数时无法确定插件是否存在，不报错
+		{name: "未传入判断函数时不检查内置插件", plugin: `{"name":"missing","enabled":true,"runtime":"builtin"}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "config.json")
+			content := `{"plugins":{"enabled":true,"plugins":[` + tt.plugin + `]}}`
+			if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			report, err := CheckConfig(path, LoadOptions{BuiltinPlugin: tt.lookup})
+			if err != nil {
+				t.Fatalf("CheckConfig() error = %v", err)
+			}
+			err = report.Err()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("CheckConfig() 校验错误 = %v", err)
+				}
+			} else if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("CheckConfig() 校验错误 = %v, want containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -3,9 +3,10 @@
 package config
 
 import (
-	"encoding/json"
 	"fmt"
 	"os"
+	"reflect"
+	"strings"
 	"sync"
 	"time"
 
@@ -35,11 +36,34 @@ type Config struct {
 	PatternRecognition PatternRecognitionConfig `json:"pattern_recognition"`
 	// Fingerprint 指纹识别配置
 	Fingerprint FingerprintConfig `json:"fingerprint"`
+	// Scope 测试范围配置
+	Scope ScopeConfig `json:"scope"`
+	// Audit 安全审计日志配置
+	Audit AuditConfig `json:"audit"`
+	// Flows 流量记录配置
+	Flows FlowsConfig `json:"flows"`
+	// Policies 用户策略，按顺序匹配第一条包含请求用户的策略
+	Policies []PolicyConfig `json:"policies"`
 
 	// 内部字段
 	mu       sync.RWMutex
 	filePath string
 	lastMod  time.Time
+	// format 配置文件格式（json 或 yaml），保存时保持一致
+	format string
+	// profile 加载时选用的配置档
+	profile string
+	// builtinPlugin 加载时传入的内置插件判断函数，重新加载时沿用
+	builtinPlugin func(name string) bool
+	// sources 组合出当前配置的所有文件（主文件及 include 的文件）
+	sources []string
+
+	// reloadMu 串行化重新加载
+	reloadMu sync.Mutex
+	// subMu 保护订阅者列表
+	subMu sync.Mutex
+	// subscribers 各配置段的变更订阅者
+	subscribers map[string][]ChangeHandler
 }
 
 // ServerConfig 服务器配置
@@ -53,6 +77,25 @@ type ServerConfig struct {
 	ReadTimeout time.Duration `json:"read_timeout"`
 	// WriteTimeout 写入超时时间
 	WriteTimeout time.Duration `json:"write_timeout"`
+	// TLS 代理监听端口的TLS配置（客户端通过 HTTPS 连接代理）
+	TLS ListenerTLSConfig `json:"tls"`
+}
+
+// ListenerTLSConfig 代理监听端口TLS及客户端证书（mTLS）配置
+// ListenerTLSConfig serves the proxy listener over TLS with optional client certificate authentication
+type ListenerTLSConfig struct {
+	// Enabled 代理监听端口使用TLS
+	Enabled bool `json:"enabled"`
+	// CertFile 监听证书文件，为空时使用 CA 按客户端请求的主机名签发
+	CertFile string `json:"cert_file"`
+	// KeyFile 监听证书私钥文件
+	KeyFile string `json:"key_file"`
+	// ClientCAFile 签发客户端证书的 CA（PEM，可包含多个证书）
+	ClientCAFile string `json:"client_ca_file"`
+	// ClientAuth 客户端证书要求: none 不请求, optional 请求但不强制, require 必须提供有效证书
+	ClientAuth string `json:"client_auth"`
+	// CRLFile 证书吊销列表（PEM 或 DER），修改后自动重新加载
+	CRLFile string `json:"crl_file"`
 }
 
 // TLSConfig TLS配置
@@ -68,6 +111,24 @@ type TLSConfig struct {
 	EnableCertCache bool `json:"enable_cert_cache"`
 	// CertCacheTTL 证书缓存TTL
 	CertCacheTTL time.Duration `json:"cert_cache_ttl"`
+	// CAPortalHost CA证书下载页面的魔法主机名（为空则禁用）
+	CAPortalHost string `json:"ca_portal_host"`
+	// LeafValidity 叶子证书有效期（部分客户端要求不超过398天）
+	LeafValidity time.Duration `json:"leaf_validity"`
+	// LeafBackdate 叶子证书生效时间向前回拨的时长，用于容忍客户端时钟偏差
+	LeafBackdate time.Duration `json:"leaf_backdate"`
+	// CAExpiryWarning CA证书到期前多久开始告警
+	CAExpiryWarning time.Duration `json:"ca_expiry_warning"`
+	// WildcardCerts 按可注册域名签发通配符证书，减少子域名众多站点的证书生成
+	WildcardCerts bool `json:"wildcard_certs"`
+	// ExactMatchDomains 需要精确匹配证书的域名（包含其子域名）
+	ExactMatchDomains []string `json:"exact_match_domains"`
+	// KeyLogFile NSS格式TLS密钥日志文件路径（为空时使用 SSLKEYLOGFILE 环境变量）
+	KeyLogFile string `json:"key_log_file"`
+	// KeyLogPerRun 每次启动写入新的带时间戳的密钥日志文件（所有TLS会话共用该文件，不按会话拆分）
+	KeyLogPerRun bool `json:"key_log_per_run"`
+	// KeyLogMaxSizeMB 单个密钥日志文件最大大小（MB），超过后切换到新的带时间戳文件，0表示不限制
+	KeyLogMaxSizeMB int `json:"key_log_max_size_mb"`
 }
 
 // ProxyConfig 代理配置
@@ -92,16 +153,61 @@ type ProxyConfig struct {
 type SecurityConfig struct {
 	// EnableAuth 启用认证
 	EnableAuth bool `json:"enable_auth"`
-	// Username 用户名
+	// Username 用户名（单用户兼容配置，建议改用 Users）
 	Username string `json:"username"`
-	// Password 密码
+	// Password 密码，可以是明文或 bcrypt/argon2id 哈希
 	Password string `json:"password"`
-	// Whitelist IP白名单
+	// Users 多用户认证列表
+	Users []UserConfig `json:"users"`
+	// HtpasswdFile htpasswd 格式的用户文件（支持 bcrypt、apr1、SHA），修改后自动重新加载
+	HtpasswdFile string `json:"htpasswd_file"`
+	// AuthRealm 407 质询中的 realm
+	AuthRealm string `json:"auth_realm"`
+	// Whitelist IP白名单，支持IP、CIDR和 "起始IP-结束IP" 范围
 	Whitelist []string `json:"whitelist"`
-	// Blacklist IP黑名单
+	// Blacklist IP黑名单，格式同白名单
 	Blacklist []string `json:"blacklist"`
+	// WhitelistFiles 外部白名单文件（每行一个条目，# 开头为注释），修改后自动重新加载
+	WhitelistFiles []string `json:"whitelist_files"`
+	// BlacklistFiles 外部黑名单文件
+	BlacklistFiles []string `json:"blacklist_files"`
+	// TrustedProxies 可信代理（IP、CIDR或范围），仅当直连对端在列表中时才采信
+	// Forwarded/X-Forwarded-For/X-Real-IP 头，为空时始终使用直连地址
+	TrustedProxies []string `json:"trusted_proxies"`
+	// ClientCert 客户端证书到用户名的映射，用于审计和按用户的策略
+	ClientCert ClientCertConfig `json:"client_cert"`
 	// RateLimit 限流配置
 	RateLimit RateLimitConfig `json:"rate_limit"`
+	// AutoBan 自动封禁配置
+	AutoBan AutoBanConfig `json:"auto_ban"`
+	// DialGuard 上游连接的目标地址限制（SSRF防护）
+	DialGuard DialGuardConfig `json:"dial_guard"`
+}
+
+// UserConfig 代理认证用户
+// UserConfig proxy authentication user
+type UserConfig struct {
+	// Username 用户名
+	Username string `json:"username"`
+	// PasswordHash 密码哈希（bcrypt 或 argon2id，可用 hackmitm auth hash 生成）
+	PasswordHash string `json:"password_hash"`
+}
+
+// ClientCertConfig 客户端证书用户映射
+// ClientCertConfig maps verified client certificates to usernames
+type ClientCertConfig struct {
+	// UsernameField 未命中 users 映射时取作用户名的证书字段: cn, email, dns, subject
+	UsernameField string `json:"username_field"`
+	// Users 证书主题到用户名的显式映射
+	Users []ClientCertUser `json:"users"`
+}
+
+// ClientCertUser 证书主题到用户名的映射
+type ClientCertUser struct {
+	// Subject 证书主题，可以是完整 DN（如 "CN=alice,O=Lab"）或仅 CN
+	Subject string `json:"subject"`
+	// Username 映射的用户名
+	Username string `json:"username"`
 }
 
 // RateLimitConfig 限流配置
@@ -109,10 +215,74 @@ type SecurityConfig struct {
 type RateLimitConfig struct {
 	// Enabled 启用限流
 	Enabled bool `json:"enabled"`
-	// MaxRequests 最大请求数
+	// MaxRequests 最大请求数（未配置 rules 时按客户端IP限流）
 	MaxRequests int `json:"max_requests"`
 	// Window 时间窗口
 	Window time.Duration `json:"window"`
+	// Burst 突发容量，0 表示等于 max_requests
+	Burst int `json:"burst"`
+	// Rules 限流规则，配置后取代 max_requests/window/burst，所有规则都通过才放行
+	Rules []RateLimitRule `json:"rules"`
+}
+
+// RateLimitRule 令牌桶限流规则
+// RateLimitRule token bucket rate limit rule keyed on one or more request dimensions
+type RateLimitRule struct {
+	// Name 规则名称，用于日志和统计
+	Name string `json:"name"`
+	// Key 限流维度组合：client_ip、user、host
+	// 包含 user 的规则只作用于已认证的请求
+	Key []string `json:"key"`
+	// Requests 每个时间窗口补充的令牌数
+	Requests int `json:"requests"`
+	// Window 时间窗口
+	Window time.Duration `json:"window"`
+	// Burst 突发容量，0 表示等于 requests
+	Burst int `json:"burst"`
+}
+
+// DialGuardConfig 上游连接地址限制，在建立连接时检查解析出的实际地址以防御 DNS 重绑定
+// DialGuardConfig restricts which addresses the proxy may dial upstream
+type DialGuardConfig struct {
+	// Enabled 启用上游连接地址检查
+	Enabled bool `json:"enabled"`
+	// BlockLoopback 禁止连接回环地址和未指定地址（127.0.0.0/8、::1、0.0.0.0、::）
+	BlockLoopback bool `json:"block_loopback"`
+	// BlockPrivate 禁止连接私有地址（10/8、172.16/12、192.168/16、100.64/10、fc00::/7）
+	BlockPrivate bool `json:"block_private"`
+	// BlockLinkLocal 禁止连接链路本地地址（169.254/16，含云服务元数据地址，以及 fe80::/10）
+	BlockLinkLocal bool `json:"block_link_local"`
+	// Block 额外禁止的地址（IP、CIDR或范围）
+	Block []string `json:"block"`
+	// Allow 允许连接的地址（IP、CIDR或范围），优先于所有禁止规则
+	Allow []string `json:"allow"`
+	// AllowHosts 允许连接的主机名（支持 * 通配符），匹配时不检查解析出的地址
+	AllowHosts []string `json:"allow_hosts"`
+}
+
+// AutoBanConfig 自动封禁配置，客户端在 find_time 内的违规次数达到阈值时被临时封禁
+// AutoBanConfig configures fail2ban-style temporary bans with escalating durations
+type AutoBanConfig struct {
+	// Enabled 启用自动封禁
+	Enabled bool `json:"enabled"`
+	// FindTime 违规计数的时间窗口
+	FindTime time.Duration `json:"find_time"`
+	// MaxAuthFailures 认证失败次数阈值，0 表示不统计
+	MaxAuthFailures int `json:"max_auth_failures"`
+	// MaxRateLimitHits 触发限流次数阈值，0 表示不统计
+	MaxRateLimitHits int `json:"max_rate_limit_hits"`
+	// MaxFilterDenials 被插件过滤器拒绝次数阈值，0 表示不统计
+	MaxFilterDenials int `json:"max_filter_denials"`
+	// BanTime 首次封禁时长
+	BanTime time.Duration `json:"ban_time"`
+	// BanMultiplier 再次封禁时的时长倍数
+	BanMultiplier float64 `json:"ban_multiplier"`
+	// MaxBanTime 封禁时长上限，封禁结束后超过该时长未再违规则重新从 ban_time 开始
+	MaxBanTime time.Duration `json:"max_ban_time"`
+	// StateFile 封禁状态文件，重启后恢复，为空时不持久化
+	StateFile string `json:"state_file"`
+	// Ignore 永不封禁的地址（IP、CIDR或范围）
+	Ignore []string `json:"ignore"`
 }
 
 // MonitoringConfig 监控配置
@@ -120,8 +290,12 @@ type RateLimitConfig struct {
 type MonitoringConfig struct {
 	// Enabled 启用监控
 	Enabled bool `json:"enabled"`
+	// ListenAddr 监听地址，默认仅监听本机回环地址
+	ListenAddr string `json:"listen_addr"`
 	// Port 监控端口
 	Port int `json:"port"`
+	// APIToken 监控API（/health 除外）与流量管理员的 Bearer 令牌，为空时只有 /health 可用
+	APIToken string `json:"api_token"`
 	// HealthChecks 健康检查配置
 	HealthChecks HealthCheckConfig `json:"health_checks"`
 }
@@ -174,6 +348,89 @@ type PatternRecognitionConfig struct {
 	CacheTTL int `json:"cache_ttl"`
 }
 
+// ScopeConfig 测试范围配置，范围外的目标在发起上游连接前被拦截或直接透传
+// ScopeConfig restricts which destinations may be intercepted during an engagement
+type ScopeConfig struct {
+	// Enabled 启用范围控制
+	Enabled bool `json:"enabled"`
+	// OutOfScope 范围外请求的处理方式：block（返回拦截页面）或 passthrough（透传，不解密、不记录、不经过插件）
+	OutOfScope string `json:"out_of_scope"`
+	// Include 范围内规则，为空时除 exclude 外的目标均在范围内
+	Include []ScopeRule `json:"include"`
+	// Exclude 范围外规则，优先于 include
+	Exclude []ScopeRule `json:"exclude"`
+	// Files 范围文件，每行一条规则，以 - 开头表示排除
+	Files []string `json:"files"`
+}
+
+// AuditConfig 安全审计日志配置
+// AuditConfig configures the append-only JSON lines audit log
+type AuditConfig struct {
+	// Enabled 启用审计日志
+	Enabled bool `json:"enabled"`
+	// File 审计日志文件（JSON Lines，只追加）
+	File string `json:"file"`
+	// HashChain 每条记录包含上一条记录的哈希，可用 hackmitm audit verify 检查篡改
+	HashChain bool `json:"hash_chain"`
+	// LogAllowed 记录被允许的请求，关闭后只记录拒绝、透传及其他事件
+	LogAllowed bool `json:"log_allowed"`
+	// Sync 每条记录写入后同步到磁盘
+	Sync bool `json:"sync"`
+}
+
+// FlowsConfig 流量记录配置，记录的流量按用户隔离，通过监控接口 /flows 查询
+// FlowsConfig configures the in-memory per-user flow store
+type FlowsConfig struct {
+	// Enabled 默认是否记录流量，用户策略可单独开启或关闭
+	Enabled bool `json:"enabled"`
+	// MaxFlows 每个用户保留的最近流量条数
+	MaxFlows int `json:"max_flows"`
+	// MaxBodySize 每个请求和响应记录的最大正文字节数，超出部分截断
+	MaxBodySize int `json:"max_body_size"`
+}
+
+// PolicyConfig 用户策略，多个测试人员共用一个实例时按用户（或用户组）区分插件、范围、限流和流量记录
+// PolicyConfig applies plugins, scope, rate limits and recording settings to a set of users
+type PolicyConfig struct {
+	// Name 策略名称
+	Name string `json:"name"`
+	// Users 适用的用户名，支持 * 通配符，列出多个用户即可作为用户组
+	Users []string `json:"users"`
+	// Plugins 对这些用户生效的插件（支持 * 通配符），为空时所有插件生效
+	Plugins []string `json:"plugins"`
+	// ExcludePlugins 对这些用户禁用的插件，优先于 plugins
+	ExcludePlugins []string `json:"exclude_plugins"`
+	// Scope 额外的范围规则，与全局范围同时生效（两者都在范围内才允许）
+	Scope PolicyScopeConfig `json:"scope"`
+	// RateLimit 额外的限流规则，key 为空时按用户限流
+	RateLimit []RateLimitRule `json:"rate_limit"`
+	// Record 是否记录这些用户的流量，未设置时使用 flows.enabled
+	Record *bool `json:"record"`
+}
+
+// PolicyScopeConfig 策略范围规则，范围外请求的处理方式与全局 scope.out_of_scope 相同
+type PolicyScopeConfig struct {
+	// Include 范围内规则，为空时除 exclude 外的目标均在范围内
+	Include []ScopeRule `json:"include"`
+	// Exclude 范围外规则，优先于 include
+	Exclude []ScopeRule `json:"exclude"`
+	// Files 范围文件，在加载和重新加载配置时读取
+	Files []string `json:"files"`
+}
+
+// ScopeRule 范围规则，各字段为空表示不限制，所有非空字段都匹配时规则生效
+// ScopeRule matches a destination by host, port, scheme and path
+type ScopeRule struct {
+	// Host 主机：精确域名、通配符（*.example.com）、CIDR（10.0.0.0/8）或 re: 开头的正则
+	Host string `json:"host"`
+	// Port 端口：单个端口、逗号分隔的列表或范围（8000-9000）
+	Port string `json:"port"`
+	// Scheme 协议：http、https、ws、wss，可用逗号分隔多个
+	Scheme string `json:"scheme"`
+	// Path 路径：通配符（/api/*）或 re: 开头的正则
+	Path string `json:"path"`
+}
+
 // FingerprintConfig 指纹识别配置
 type FingerprintConfig struct {
 	// Enabled 启用指纹识别
@@ -217,6 +474,56 @@ type ConfigPluginConfig struct {
 	Priority int `json:"priority"`
 	// Config 插件配置
 	Config map[string]interface{} `json:"config"`
+	// Runtime 运行方式：native（Go plugin .so，默认）、process（独立进程，通过 JSON-RPC 通信）、
+	// wasm（WebAssembly 模块）或 builtin（编译进二进制文件的插件）；
+	// 为空且路径以 .wasm 结尾时按 wasm 加载，为空或 native 时优先查找同名的内置插件
+	Runtime string `json:"runtime"`
+	// Process 进程外插件选项，runtime 为 process 时有效
+	Process ProcessPluginConfig `json:"process"`
+	// Wasm WebAssembly 插件选项，runtime 为 wasm 时有效
+	Wasm WasmPluginConfig `json:"wasm"`
+	// Isolation 调用隔离选项：超时和熔断
+	Isolation IsolationPluginConfig `json:"isolation"`
+}
+
+// ProcessPluginConfig 进程外插件配置，零值字段使用默认值
+type ProcessPluginConfig struct {
+	// Args 启动参数
+	Args []string `json:"args"`
+	// Env 额外的环境变量
+	Env map[string]string `json:"env"`
+	// Transport 通信方式：stdio（默认）或 unix
+	Transport string `json:"transport"`
+	// CallTimeout 单次调用超时，默认5秒
+	CallTimeout time.Duration `json:"call_timeout"`
+	// HealthInterval 健康检查间隔，默认10秒
+	HealthInterval time.Duration `json:"health_interval"`
+	// MaxRestarts 连续重启次数上限，默认5，负数表示不限制
+	MaxRestarts int `json:"max_restarts"`
+	// MaxBodySize 发送给插件的最大正文字节数，默认1MB
+	MaxBodySize int `json:"max_body_size"`
+}
+
+// WasmPluginConfig WebAssembly 插件配置，零值字段使用默认值
+type WasmPluginConfig struct {
+	// MaxMemory 每个实例的最大内存字节数，默认64MB
+	MaxMemory int `json:"max_memory"`
+	// CallTimeout 单次钩子调用的最长执行时间，默认1秒
+	CallTimeout time.Duration `json:"call_timeout"`
+	// MaxBodySize 插件可读取和修改的最大正文字节数，默认1MB
+	MaxBodySize int `json:"max_body_size"`
+}
+
+// IsolationPluginConfig 插件调用隔离配置，零值字段使用默认值
+type IsolationPluginConfig struct {
+	// CallTimeout 单次钩子调用超时，默认5秒，负数表示不限制
+	CallTimeout time.Duration `json:"call_timeout"`
+	// ErrorThreshold 触发熔断的错误率（0-1），默认0.5
+	ErrorThreshold float64 `json:"error_threshold"`
+	// Window 计算错误率的最近调用次数，默认20，负数表示不熔断
+	Window int `json:"window"`
+	// OpenDuration 熔断后暂停调用的时间，之后放行一次试探调用，默认30秒
+	OpenDuration time.Duration `json:"open_duration"`
 }
 
 var (
@@ -239,6 +546,10 @@ func getDefaultConfig() *Config {
 			ListenAddr:   "0.0.0.0",
 			ReadTimeout:  30 * time.Second,
 			WriteTimeout: 30 * time.Second,
+			TLS: ListenerTLSConfig{
+				Enabled:    false,
+				ClientAuth: "require",
+			},
 		},
 		TLS: TLSConfig{
 			CertDir:         "./certs",
@@ -246,6 +557,10 @@ func getDefaultConfig() *Config {
 			CACertFile:      "./certs/ca-cert.pem",
 			EnableCertCache: true,
 			CertCacheTTL:    24 * time.Hour,
+			CAPortalHost:    "hackmitm.ca",
+			LeafValidity:    397 * 24 * time.Hour,
+			LeafBackdate:    time.Hour,
+			CAExpiryWarning: 30 * 24 * time.Hour,
 		},
 		Proxy: ProxyConfig{
 			EnableHTTP:        true,
@@ -256,20 +571,52 @@ func getDefaultConfig() *Config {
 			EnableCompression: true,
 		},
 		Security: SecurityConfig{
-			EnableAuth: false,
-			Username:   "",
-			Password:   "",
-			Whitelist:  []string{},
-			Blacklist:  []string{},
+			EnableAuth:     false,
+			Username:       "",
+			Password:       "",
+			Users:          []UserConfig{},
+			AuthRealm:      "HackMITM",
+			Whitelist:      []string{},
+			Blacklist:      []string{},
+			WhitelistFiles: []string{},
+			BlacklistFiles: []string{},
+			TrustedProxies: []string{},
+			ClientCert: ClientCertConfig{
+				UsernameField: "cn",
+				Users:         []ClientCertUser{},
+			},
 			RateLimit: RateLimitConfig{
 				Enabled:     true,
 				MaxRequests: 100,
 				Window:      time.Minute,
+				Rules:       []RateLimitRule{},
+			},
+			AutoBan: AutoBanConfig{
+				Enabled:          false,
+				FindTime:         10 * time.Minute,
+				MaxAuthFailures:  5,
+				MaxRateLimitHits: 50,
+				MaxFilterDenials: 3,
+				BanTime:          10 * time.Minute,
+				BanMultiplier:    2,
+				MaxBanTime:       24 * time.Hour,
+				StateFile:        "./data/bans.json",
+				Ignore:           []string{"127.0.0.1", "::1"},
+			},
+			DialGuard: DialGuardConfig{
+				Enabled:        false,
+				BlockLoopback:  true,
+				BlockPrivate:   true,
+				BlockLinkLocal: true,
+				Block:          []string{},
+				Allow:          []string{},
+				AllowHosts:     []string{},
 			},
 		},
 		Monitoring: MonitoringConfig{
-			Enabled: true,
-			Port:    9090,
+			Enabled:    true,
+			ListenAddr: "127.0.0.1",
+			Port:       9090,
 			HealthChecks: HealthCheckConfig{
 				MemoryLimitMB: 512,
 				MaxGoroutines: 10000,
@@ -329,40 +676,120 @@ func getDefaultConfig() *Config {
 			CacheTTL:        300,
 			FaviconTimeout:  10,
 		},
+		Scope: ScopeConfig{
+			Enabled:    false,
+			OutOfScope: "block",
+			Include:    []ScopeRule{},
+			Exclude:    []ScopeRule{},
+			Files:      []string{},
+		},
+		Audit: AuditConfig{
+			Enabled:    false,
+			File:       "./logs/audit.jsonl",
+			HashChain:  true,
+			LogAllowed: true,
+			Sync:       false,
+		},
+		Flows: FlowsConfig{
+			Enabled:     false,
+			MaxFlows:    500,
+			MaxBodySize: 64 * 1024,
+		},
+		Policies: []PolicyConfig{},
 	}
 }
 
 // LoadConfig 从文件加载配置
 // LoadConfig loads configuration from file
+//
+// 支持JSON和YAML（按扩展名 .yaml/.yml 判断），时长字段可写作 "30s" 或纳秒整数，
+// 顶层 include 字段可引用其他配置文件，最后应用 HACKMITM_* 环境变量覆盖。校验错误会导致加载失败，未知字段仅记录警告。
 func LoadConfig(filePath string) (*Config, error) {
+	return LoadConfigWithOptions(filePath, LoadOptions{})
+}
+
+// LoadConfigWithOptions 按选项加载配置（如选用配置档）
+// LoadConfigWithOptions loads configuration applying includes and the selected profile
+func LoadConfigWithOptions(filePath string, opts LoadOptions) (*Config, error) {
+	config, report, err := loadConfig(filePath, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, warning := range report.Warnings {
+		logger.Warnf("配置警告: %s", warning)
+	}
+	if err := report.Err(); err != nil {
+		return nil, err
+	}
+
+	if opts.Profile != "" {
+		logger.Infof("配置文件加载成功: %s (配置档: %s)", filePath, opts.Profile)
+	} else {
+		logger.Infof("配置文件加载成功: %s", filePath)
+	}
+	return config, nil
+}
+
+// CheckConfig 加载并校验配置文件，返回完整的校验报告而不因校验错误失败
+// CheckConfig loads and validates a configuration file, returning all issues found
+func CheckConfig(filePath string, opts LoadOptions) (*ValidationReport, error) {
+	_, report, err := loadConfig(filePath, opts)
+	return report, err
+}
+
+// loadConfig 组合配置文件（include、配置档）、应用环境变量覆盖并校验
+func loadConfig(filePath string, opts LoadOptions) (*Config, *ValidationReport, error) {
 	config := getDefaultConfig()
 	config.filePath = filePath
+	config.format = formatFromPath(filePath)
+	config.profile = opts.Profile
+	config.builtinPlugin = opts.BuiltinPlugin
 
 	if _, err := os.Stat(filePath); os.IsNotExist(err) {
 		logger.Warnf("配置文件不存在，使用默认配置: %s", filePath)
-		return config, nil
 	}
 
-	data, err := os.ReadFile(filePath)
+	// 以默认配置为起点合并，使列表追加指令可以作用于默认列表
+	base, err := defaultDocument()
 	if err != nil {
-		return nil, fmt.Errorf("读取配置文件失败: %w", err)
+		return nil, nil, fmt.Errorf("生成默认配置失败: %w", err)
 	}
+	comp, err := composeDocument(filePath, base, opts.Profile)
+	if err != nil {
+		return nil, nil, err
+	}
+	doc := comp.doc
 
-	if err := json.Unmarshal(data, config); err != nil {
-		return nil, fmt.Errorf("解析配置文件失败: %w", err)
+	// 记录所有来源文件及最新修改时间，任一文件变化都会触发重新加载
+	config.sources = comp.sources
+	if config.lastMod, err = latestModTime(comp.sources); err != nil {
+		return nil, nil, fmt.Errorf("获取配置文件状态失败: %w", err)
 	}
 
-	// 获取文件修改时间
-	if stat, err := os.Stat(filePath); err == nil {
-		config.lastMod = stat.ModTime()
+	// 应用环境变量覆盖
+	overrides, err := applyEnvOverrides(doc, os.Environ())
+	if err != nil {
+		return nil, nil, fmt.Errorf("应用环境变量失败: %w", err)
+	}
+	if len(overrides) > 0 {
+		logger.Infof("环境变量覆盖配置字段: %s", strings.Join(overrides, ", "))
 	}
 
-	logger.Infof("配置文件加载成功: %s", filePath)
-	return config, nil
+	unknown := &ValidationReport{}
+	checkUnknownFields(reflect.TypeOf(config).Elem(), doc, "", unknown)
+
+	if err := config.applyDocument(doc); err != nil {
+		return nil, nil, fmt.Errorf("解析配置文件失败: %w", describeDecodeError(err))
+	}
+
+	report := config.Validate()
+	report.Warnings = append(unknown.Warnings, report.Warnings...)
+	return config, report, nil
 }
 
 // SaveConfig 保存配置到文件
-// SaveConfig saves configuration to file
+// SaveConfig saves configuration to file in its original format (JSON or YAML)
 func (c *Config) SaveConfig() error {
 	c.mu.RLock()
 	defer c.mu.RUnlock()
@@ -370,8 +797,12 @@ func (c *Config) SaveConfig() error {
 	if c.filePath == "" {
 		return fmt.Errorf("配置文件路径为空")
 	}
+	// 组合配置写回主文件会丢失 include 和配置档结构
+	if len(c.sources) > 1 || c.profile != "" {
+		return fmt.Errorf("配置由 include 或配置档组合而成，无法写回: %s", c.filePath)
+	}
 
-	data, err := json.MarshalIndent(c, "", "  ")
+	data, err := c.encodeDocument(c.format)
 	if err != nil {
 		return fmt.Errorf("序列化配置失败: %w", err)
 	}
@@ -384,37 +815,6 @@ func (c *Config) SaveConfig() error {
 	return nil
 }
 
-// Reload 重新加载配置
-// Reload reloads the configuration
-func (c *Config) Reload() error {
-	c.mu.Lock()
-	defer c.mu.Unlock()
-
-	if c.filePath == "" {
-		return fmt.Errorf("配置文件路径为空")
-	}
-
-	stat, err := os.Stat(c.filePath)
-	if err != nil {
-		return fmt.Errorf("获取配置文件状态失败: %w", err)
-	}
-
-	// 检查文件是否已修改
-	if !stat.ModTime().After(c.lastMod) {
-		return nil // 文件未修改
-	}
-
-	newConfig, err := LoadConfig(c.filePath)
-	if err != nil {
-		return fmt.Errorf("重新加载配置失败: %w", err)
-	}
-
-	// 更新配置
-	*c = *newConfig
-	logger.Info("配置已重新加载")
-	return nil
-}
-
 // GetServer 获取服务器配置
 // GetServer returns server configuration
 func (c *Config) GetServer() ServerConfig {
@@ -495,6 +895,35 @@ func (c *Config) GetFingerprint() FingerprintConfig {
 	return c.Fingerprint
 }
 
+// GetScope 获取测试范围配置
+// GetScope returns scope configuration
+func (c *Config) GetScope() ScopeConfig {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.Scope
+}
+
+// GetAudit 获取审计日志配置
+func (c *Config) GetAudit() AuditConfig {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.Audit
+}
+
+// GetFlows 获取流量记录配置
+func (c *Config) GetFlows() FlowsConfig {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.Flows
+}
+
+// GetPolicies 获取用户策略
+func (c *Config) GetPolicies() []PolicyConfig {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return append([]PolicyConfig(nil), c.Policies...)
+}
+
 // StartConfigWatcher 启动配置文件监控
 // StartConfigWatcher starts configuration file watcher
 func (c *Config) StartConfigWatcher(interval time.Duration) {
@@ -0,0 +1,139 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// EnvPrefix 环境变量覆盖前缀
+// 字段路径按大写并以下划线连接，如 tls.cert_cache_ttl 对应 HACKMITM_TLS_CERT_CACHE_TTL
+const EnvPrefix = "HACKMITM_"
+
+// envField 可通过环境变量覆盖的字段
+type envField struct {
+	path []string
+	typ  reflect.Type
+}
+
+// envFields 枚举配置中所有可覆盖的字段，键为环境变量名
+func envFields() map[string]envField {
+	fields := make(map[string]envField)
+	collectEnvFields(reflect.TypeOf((*Config)(nil)).Elem(), nil, fields)
+	return fields
+}
+
+// collectEnvFields 递归收集结构体字段，非结构体字段（包括列表和映射）作为整体覆盖
+func collectEnvFields(t reflect.Type, path []string, fields map[string]envField) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name, ok := jsonFieldName(field)
+		if !ok {
+			continue
+		}
+
+		fieldPath := append(append([]string(nil), path...), name)
+		if field.Type.Kind() == reflect.Struct && field.Type != durationType {
+			collectEnvFields(field.Type, fieldPath, fields)
+			continue
+		}
+
+		envName := EnvPrefix + strings.ToUpper(strings.Join(fieldPath, "_"))
+		fields[envName] = envField{path: fieldPath, typ: field.Type}
+	}
+}
+
+// applyEnvOverrides 将 HACKMITM_* 环境变量写入通用文档，返回被覆盖的字段路径
+func applyEnvOverrides(doc map[string]interface{}, environ []string) ([]string, error) {
+	fields := envFields()
+	var applied []string
+
+	for _, kv := range environ {
+		name, raw, ok := strings.Cut(kv, "=")
+		if !ok || !strings.HasPrefix(name, EnvPrefix) {
+			continue
+		}
+		field, exists := fields[name]
+		if !exists {
+			continue
+		}
+
+		value, err := parseEnvValue(field.typ, raw)
+		if err != nil {
+			return nil, fmt.Errorf("环境变量 %s: %w", name, err)
+		}
+		setDocumentValue(doc, field.path, value)
+		applied = append(applied, strings.Join(field.path, "."))
+	}
+
+	sort.Strings(applied)
+	return applied, nil
+}
+
+// parseEnvValue 按字段类型解析环境变量值
+// 字符串列表支持逗号分隔，其他复合类型使用JSON
+func parseEnvValue(t reflect.Type, raw string) (interface{}, error) {
+	if t == durationType {
+		// 同时接受 "30s" 和纳秒整数，由 normalizeDurations 统一转换
+		if _, err := strconv.ParseInt(raw, 10, 64); err == nil {
+			return json.Number(raw), nil
+		}
+		return raw, nil
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return raw, nil
+	case reflect.Bool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return nil, fmt.Errorf("无效的布尔值 %q", raw)
+		}
+		return b, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if _, err := strconv.ParseInt(raw, 10, 64); err != nil {
+			return nil, fmt.Errorf("无效的整数 %q", raw)
+		}
+		return json.Number(raw), nil
+	case reflect.Float32, reflect.Float64:
+		if _, err := strconv.ParseFloat(raw, 64); err != nil {
+			return nil, fmt.Errorf("无效的数值 %q", raw)
+		}
+		return json.Number(raw), nil
+	case reflect.Slice:
+		trimmed := strings.TrimSpace(raw)
+		if t.Elem().Kind() == reflect.String && !strings.HasPrefix(trimmed, "[") {
+			list := []interface{}{}
+			for _, item := range strings.Split(raw, ",") {
+				if item = strings.TrimSpace(item); item != "" {
+					list = append(list, item)
+				}
+			}
+			return list, nil
+		}
+	}
+
+	var value interface{}
+	if err := json.Unmarshal([]byte(raw), &value); err != nil {
+		return nil, fmt.Errorf("需要JSON格式的值: %v", err)
+	}
+	return value, nil
+}
+
+// setDocumentValue 在通用文档中按路径设置值，缺失的中间对象会被创建
+func setDocumentValue(doc map[string]interface{}, path []string, value interface{}) {
+	current := doc
+	for _, key := range path[:len(path)-1] {
+		next, ok := toObject(current[key])
+		if !ok {
+			next = make(map[string]interface{})
+		}
+		current[key] = next
+		current = next
+	}
+	current[path[len(path)-1]] = value
+}
@@ -0,0 +1,325 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// 配置文件格式
+const (
+	FormatJSON = "json"
+	FormatYAML = "yaml"
+)
+
+// durationType time.Duration 的反射类型
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// formatFromPath 根据文件扩展名判断配置格式，默认JSON
+func formatFromPath(path string) string {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		return FormatYAML
+	default:
+		return FormatJSON
+	}
+}
+
+// decodeDocument 将配置文件内容解析为通用文档
+func decodeDocument(data []byte, format string) (map[string]interface{}, error) {
+	doc := make(map[string]interface{})
+
+	switch format {
+	case FormatYAML:
+		if err := yaml.Unmarshal(data, &doc); err != nil {
+			return nil, err
+		}
+	default:
+		// 使用 json.Number 避免纳秒级时长在 float64 中丢失精度
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.UseNumber()
+		if err := decoder.Decode(&doc); err != nil {
+			return nil, err
+		}
+	}
+
+	return doc, nil
+}
+
+// applyDocument 将通用文档应用到配置结构体（文档中未出现的字段保持原值）
+func (c *Config) applyDocument(doc map[string]interface{}) error {
+	normalized, err := normalizeDurations(reflect.TypeOf(c).Elem(), doc, "")
+	if err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(normalized)
+	if err != nil {
+		return err
+	}
+
+	// json.Unmarshal 会复用已有切片元素，文档中出现的列表需先清空，避免继承默认值
+	resetListedSlices(reflect.ValueOf(c).Elem(), doc)
+	return json.Unmarshal(data, c)
+}
+
+// resetListedSlices 将文档中出现的切片字段置空
+func resetListedSlices(v reflect.Value, doc map[string]interface{}) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		name, ok := jsonFieldName(t.Field(i))
+		if !ok {
+			continue
+		}
+		value, exists := doc[name]
+		if !exists {
+			continue
+		}
+
+		field := v.Field(i)
+		switch field.Kind() {
+		case reflect.Slice:
+			field.Set(reflect.Zero(field.Type()))
+		case reflect.Struct:
+			if obj, ok := toObject(value); ok {
+				resetListedSlices(field, obj)
+			}
+		}
+	}
+}
+
+// normalizeDurations 按目标类型遍历文档，将 "30s" 形式的时长字符串转换为纳秒整数
+func normalizeDurations(t reflect.Type, value interface{}, path string) (interface{}, error) {
+	if value == nil {
+		return nil, nil
+	}
+
+	if t == durationType {
+		s, ok := value.(string)
+		if !ok {
+			return value, nil
+		}
+		d, err := time.ParseDuration(strings.TrimSpace(s))
+		if err != nil {
+			return nil, fmt.Errorf("%s: 无效的时长 %q（示例: 30s, 5m, 24h）", path, s)
+		}
+		return int64(d), nil
+	}
+
+	switch t.Kind() {
+	case reflect.Ptr:
+		return normalizeDurations(t.Elem(), value, path)
+
+	case reflect.Struct:
+		obj, ok := toObject(value)
+		if !ok {
+			return value, nil
+		}
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			name, ok := jsonFieldName(field)
+			if !ok {
+				continue
+			}
+			fieldValue, exists := obj[name]
+			if !exists {
+				continue
+			}
+			normalized, err := normalizeDurations(field.Type, fieldValue, joinPath(path, name))
+			if err != nil {
+				return nil, err
+			}
+			obj[name] = normalized
+		}
+		return obj, nil
+
+	case reflect.Slice, reflect.Array:
+		list, ok := value.([]interface{})
+		if !ok {
+			return value, nil
+		}
+		for i, item := range list {
+			normalized, err := normalizeDurations(t.Elem(), item, fmt.Sprintf("%s[%d]", path, i))
+			if err != nil {
+				return nil, err
+			}
+			list[i] = normalized
+		}
+		return list, nil
+
+	case reflect.Map:
+		obj, ok := toObject(value)
+		if !ok || t.Elem().Kind() == reflect.Interface {
+			return value, nil
+		}
+		for key, item := range obj {
+			normalized, err := normalizeDurations(t.Elem(), item, joinPath(path, key))
+			if err != nil {
+				return nil, err
+			}
+			obj[key] = normalized
+		}
+		return obj, nil
+	}
+
+	return value, nil
+}
+
+// toObject 将YAML/JSON解析出的映射统一为 map[string]interface{}
+func toObject(value interface{}) (map[string]interface{}, bool) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		return v, true
+	case map[interface{}]interface{}:
+		obj := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			obj[fmt.Sprint(key)] = item
+		}
+		return obj, true
+	}
+	return nil, false
+}
+
+// jsonFieldName 获取结构体字段的JSON名称，未导出或忽略的字段返回false
+func jsonFieldName(field reflect.StructField) (string, bool) {
+	if !field.IsExported() {
+		return "", false
+	}
+	name := strings.Split(field.Tag.Get("json"), ",")[0]
+	if name == "-" {
+		return "", false
+	}
+	if name == "" {
+		name = field.Name
+	}
+	return name, true
+}
+
+// joinPath 拼接字段路径
+func joinPath(prefix, name string) string {
+	if prefix == "" {
+		return name
+	}
+	return prefix + "." + name
+}
+
+// encodeDocument 按指定格式序列化配置，时长输出为 "30s" 形式，字段顺序与结构体一致
+func (c *Config) encodeDocument(format string) ([]byte, error) {
+	ordered := orderedValue(reflect.ValueOf(c).Elem())
+
+	switch format {
+	case FormatYAML:
+		return yaml.Marshal(ordered)
+	default:
+		data, err := json.MarshalIndent(ordered, "", "  ")
+		if err != nil {
+			return nil, err
+		}
+		return append(data, '\n'), nil
+	}
+}
+
+// orderedField 有序对象字段
+type orderedField struct {
+	name  string
+	value interface{}
+}
+
+// orderedObject 保持字段顺序的对象，用于输出可读的配置文件
+type orderedObject []orderedField
+
+// MarshalJSON 按字段顺序输出JSON对象
+func (o orderedObject) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, field := range o {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		key, err := json.Marshal(field.name)
+		if err != nil {
+			return nil, err
+		}
+		value, err := json.Marshal(field.value)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(key)
+		buf.WriteByte(':')
+		buf.Write(value)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// MarshalYAML 按字段顺序输出YAML映射
+func (o orderedObject) MarshalYAML() (interface{}, error) {
+	node := &yaml.Node{Kind: yaml.MappingNode}
+	for _, field := range o {
+		value := &yaml.Node{}
+		if err := value.Encode(field.value); err != nil {
+			return nil, err
+		}
+		node.Content = append(node.Content,
+			&yaml.Node{Kind: yaml.ScalarNode, Value: field.name},
+			value,
+		)
+	}
+	return node, nil
+}
+
+// orderedValue 将配置值转换为可序列化的有序结构
+func orderedValue(v reflect.Value) interface{} {
+	if v.Type() == durationType {
+		return time.Duration(v.Int()).String()
+	}
+
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			return nil
+		}
+		return orderedValue(v.Elem())
+
+	case reflect.Struct:
+		t := v.Type()
+		obj := make(orderedObject, 0, t.NumField())
+		for i := 0; i < t.NumField(); i++ {
+			name, ok := jsonFieldName(t.Field(i))
+			if !ok {
+				continue
+			}
+			obj = append(obj, orderedField{name: name, value: orderedValue(v.Field(i))})
+		}
+		return obj
+
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && v.IsNil() {
+			return []interface{}{}
+		}
+		list := make([]interface{}, v.Len())
+		for i := range list {
+			list[i] = orderedValue(v.Index(i))
+		}
+		return list
+
+	case reflect.Map:
+		if v.IsNil() {
+			return map[string]interface{}{}
+		}
+		obj := make(map[string]interface{}, v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			obj[fmt.Sprint(iter.Key().Interface())] = orderedValue(iter.Value())
+		}
+		return obj
+	}
+
+	return v.Interface()
+}
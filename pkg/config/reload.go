@@ -0,0 +1,252 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"hackmitm/pkg/logger"
+)
+
+// 配置段名称，与JSON顶层字段一致
+const (
+	SectionServer             = "server"
+	SectionTLS                = "tls"
+	SectionProxy              = "proxy"
+	SectionSecurity           = "security"
+	SectionMonitoring         = "monitoring"
+	SectionPlugins            = "plugins"
+	SectionLogging            = "logging"
+	SectionPerformance        = "performance"
+	SectionPatternRecognition = "pattern_recognition"
+	SectionFingerprint        = "fingerprint"
+	SectionScope              = "scope"
+	SectionAudit              = "audit"
+	SectionFlows              = "flows"
+	SectionPolicies           = "policies"
+	// SectionAll 订阅任意配置段的变更
+	SectionAll = "*"
+)
+
+// restartRequiredFields 修改后需要重启才能生效的字段（按路径前缀匹配）
+var restartRequiredFields = []string{
+	"server",
+	"tls.cert_dir",
+	"tls.ca_key_file",
+	"tls.ca_cert_file",
+	"tls.enable_cert_cache",
+	"tls.cert_cache_ttl",
+	"tls.leaf_validity",
+	"tls.leaf_backdate",
+	"tls.ca_expiry_warning",
+	"tls.wildcard_certs",
+	"tls.exact_match_domains",
+	"tls.key_log_file",
+	"tls.key_log_per_run",
+	"tls.key_log_max_size_mb",
+	"proxy",
+	"monitoring",
+	"plugins.base_path",
+	"logging",
+	"performance",
+}
+
+// ChangeHandler 配置段变更回调，old 为变更前的配置快照，current 为生效后的配置
+type ChangeHandler func(old, current *Config) error
+
+// ReloadResult 配置重新加载结果
+type ReloadResult struct {
+	// Changed 发生变化的字段路径，如 security.whitelist
+	Changed []string
+	// RestartRequired 需要重启才能生效的已变化字段
+	RestartRequired []string
+}
+
+// Subscribe 订阅指定配置段的变更
+// Subscribe registers a handler called when the given section changes on reload
+func (c *Config) Subscribe(section string, handler ChangeHandler) {
+	c.subMu.Lock()
+	defer c.subMu.Unlock()
+
+	if c.subscribers == nil {
+		c.subscribers = make(map[string][]ChangeHandler)
+	}
+	c.subscribers[section] = append(c.subscribers[section], handler)
+}
+
+// Reload 重新加载配置（文件未修改时跳过）
+// Reload reloads the configuration if the file has been modified
+func (c *Config) Reload() error {
+	_, err := c.reload(false)
+	return err
+}
+
+// ForceReload 无论文件是否修改都重新加载配置，用于 SIGHUP
+// ForceReload reloads the configuration unconditionally
+func (c *Config) ForceReload() (*ReloadResult, error) {
+	return c.reload(true)
+}
+
+// reload 加载新配置、替换各配置段并通知订阅者
+func (c *Config) reload(force bool) (*ReloadResult, error) {
+	c.reloadMu.Lock()
+	defer c.reloadMu.Unlock()
+
+	c.mu.RLock()
+	filePath, lastMod, profile, builtinPlugin := c.filePath, c.lastMod, c.profile, c.builtinPlugin
+	sources := c.sources
+	c.mu.RUnlock()
+
+	if filePath == "" {
+		return nil, fmt.Errorf("配置文件路径为空")
+	}
+	if len(sources) == 0 {
+		sources = []string{filePath}
+	}
+
+	modTime, err := latestModTime(sources)
+	if err != nil {
+		return nil, fmt.Errorf("获取配置文件状态失败: %w", err)
+	}
+
+	// 检查主文件及 include 的文件是否已修改
+	if !force && !modTime.After(lastMod) {
+		return &ReloadResult{}, nil
+	}
+
+	newConfig, err := LoadConfigWithOptions(filePath, LoadOptions{Profile: profile, BuiltinPlugin: builtinPlugin})
+	if err != nil {
+		return nil, fmt.Errorf("重新加载配置失败: %w", err)
+	}
+
+	// 保留旧配置快照并替换配置段（不复制锁）
+	c.mu.Lock()
+	old := c.snapshot()
+	c.assign(newConfig)
+	c.sources = newConfig.sources
+	c.lastMod = newConfig.lastMod
+	c.mu.Unlock()
+
+	result := &ReloadResult{Changed: diffConfig(old, newConfig)}
+	for _, path := range result.Changed {
+		if requiresRestart(path) {
+			result.RestartRequired = append(result.RestartRequired, path)
+		}
+	}
+
+	if len(result.Changed) == 0 {
+		logger.Info("配置已重新加载，无变化")
+		return result, nil
+	}
+
+	logger.Infof("配置已重新加载，变化字段: %s", strings.Join(result.Changed, ", "))
+	if len(result.RestartRequired) > 0 {
+		logger.Warnf("以下配置需要重启后生效: %s", strings.Join(result.RestartRequired, ", "))
+	}
+
+	c.notify(old, result.Changed)
+	return result, nil
+}
+
+// notify 通知发生变化的配置段订阅者
+func (c *Config) notify(old *Config, changed []string) {
+	sections := make(map[string]bool)
+	for _, path := range changed {
+		sections[strings.SplitN(path, ".", 2)[0]] = true
+	}
+
+	c.subMu.Lock()
+	handlers := make(map[string][]ChangeHandler, len(sections)+1)
+	for section := range sections {
+		handlers[section] = append([]ChangeHandler(nil), c.subscribers[section]...)
+	}
+	handlers[SectionAll] = append([]ChangeHandler(nil), c.subscribers[SectionAll]...)
+	c.subMu.Unlock()
+
+	for section, list := range handlers {
+		for _, handler := range list {
+			if err := handler(old, c); err != nil {
+				logger.Errorf("应用配置段 %s 失败: %v", section, err)
+			}
+		}
+	}
+}
+
+// snapshot 复制当前配置段（调用方需持有锁）
+func (c *Config) snapshot() *Config {
+	s := &Config{
+		filePath: c.filePath,
+		lastMod:  c.lastMod,
+		format:   c.format,
+		profile:  c.profile,
+		sources:  c.sources,
+
+		builtinPlugin: c.builtinPlugin,
+	}
+	s.assign(c)
+	return s
+}
+
+// assign 复制配置段，不复制锁和订阅者
+func (c *Config) assign(other *Config) {
+	c.Server = other.Server
+	c.TLS = other.TLS
+	c.Proxy = other.Proxy
+	c.Security = other.Security
+	c.Monitoring = other.Monitoring
+	c.Plugins = other.Plugins
+	c.Logging = other.Logging
+	c.Performance = other.Performance
+	c.PatternRecognition = other.PatternRecognition
+	c.Fingerprint = other.Fingerprint
+	c.Scope = other.Scope
+	c.Audit = other.Audit
+	c.Flows = other.Flows
+	c.Policies = other.Policies
+}
+
+// requiresRestart 检查字段是否需要重启才能生效
+func requiresRestart(path string) bool {
+	for _, prefix := range restartRequiredFields {
+		if path == prefix || strings.HasPrefix(path, prefix+".") {
+			return true
+		}
+	}
+	return false
+}
+
+// Diff 返回两份配置之间发生变化的字段路径
+func Diff(old, current *Config) []string {
+	return diffConfig(old, current)
+}
+
+// diffConfig 比较两份配置，返回发生变化的字段路径
+func diffConfig(old, current *Config) []string {
+	var changed []string
+	diffStruct(reflect.ValueOf(old).Elem(), reflect.ValueOf(current).Elem(), "", &changed)
+	sort.Strings(changed)
+	return changed
+}
+
+// diffStruct 按JSON字段名递归比较结构体，非结构体字段整体比较
+func diffStruct(a, b reflect.Value, prefix string, changed *[]string) {
+	t := a.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name, ok := jsonFieldName(field)
+		if !ok {
+			continue
+		}
+		name = joinPath(prefix, name)
+
+		fa, fb := a.Field(i), b.Field(i)
+		if field.Type.Kind() == reflect.Struct {
+			diffStruct(fa, fb, name, changed)
+			continue
+		}
+		if !reflect.DeepEqual(fa.Interface(), fb.Interface()) {
+			*changed = append(*changed, name)
+		}
+	}
+}
@@ -0,0 +1,153 @@
+package config
+
+import (
+	"encoding/json"
+	"reflect"
+)
+
+// schemaDraft 生成的JSON Schema版本
+const schemaDraft = "http://json-schema.org/draft-07/schema#"
+
+// durationPattern 时长字符串格式，与 time.ParseDuration 一致
+const durationPattern = `^-?([0-9]+(\.[0-9]+)?(ns|us|µs|ms|s|m|h))+$`
+
+// GenerateSchema 根据配置结构体生成JSON Schema，用于编辑器补全和校验
+// GenerateSchema builds a JSON Schema document from the Config structs.
+// Defaults come from the built-in default configuration and bounds from the validation rules.
+func GenerateSchema() ([]byte, error) {
+	defaults := orderedValue(reflect.ValueOf(getDefaultConfig()).Elem())
+
+	root := schemaFor(reflect.TypeOf((*Config)(nil)).Elem(), "", defaults)
+	if properties, ok := root.get("properties").(orderedObject); ok {
+		root.set("properties", append(properties, compositionSchema()...))
+	}
+	root = append(orderedObject{
+		{name: "$schema", value: schemaDraft},
+		{name: "title", value: "HackMITM 配置"},
+	}, root...)
+
+	data, err := json.MarshalIndent(root, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
+
+// schemaFor 生成指定类型的Schema，pattern 为约束表中的字段路径模式
+func schemaFor(t reflect.Type, pattern string, defaultValue interface{}) orderedObject {
+	var schema orderedObject
+
+	switch {
+	case t == durationType:
+		schema = orderedObject{{name: "oneOf", value: []interface{}{
+			orderedObject{{name: "type", value: "string"}, {name: "pattern", value: durationPattern}},
+			orderedObject{{name: "type", value: "integer"}, {name: "description", value: "纳秒"}},
+		}}}
+
+	case t.Kind() == reflect.Ptr:
+		return schemaFor(t.Elem(), pattern, defaultValue)
+
+	case t.Kind() == reflect.Struct:
+		defaults, _ := defaultValue.(orderedObject)
+		properties := make(orderedObject, 0, t.NumField())
+		for i := 0; i < t.NumField(); i++ {
+			name, ok := jsonFieldName(t.Field(i))
+			if !ok {
+				continue
+			}
+			properties = append(properties, orderedField{
+				name:  name,
+				value: schemaFor(t.Field(i).Type, joinPath(pattern, name), defaults.get(name)),
+			})
+		}
+		// 对象本身不输出默认值，默认值已体现在各字段上
+		return orderedObject{
+			{name: "type", value: "object"},
+			{name: "properties", value: properties},
+			{name: "additionalProperties", value: false},
+		}
+
+	case t.Kind() == reflect.Slice || t.Kind() == reflect.Array:
+		schema = orderedObject{
+			{name: "type", value: "array"},
+			{name: "items", value: schemaFor(t.Elem(), pattern+"[]", nil)},
+		}
+
+	case t.Kind() == reflect.Map:
+		schema = orderedObject{{name: "type", value: "object"}}
+
+	case t.Kind() == reflect.Bool:
+		schema = orderedObject{{name: "type", value: "boolean"}}
+
+	case t.Kind() == reflect.String:
+		schema = orderedObject{{name: "type", value: "string"}}
+
+	case t.Kind() >= reflect.Int && t.Kind() <= reflect.Uint64:
+		schema = orderedObject{{name: "type", value: "integer"}}
+
+	case t.Kind() == reflect.Float32 || t.Kind() == reflect.Float64:
+		schema = orderedObject{{name: "type", value: "number"}}
+
+	default:
+		schema = orderedObject{}
+	}
+
+	if rule, exists := fieldRules[pattern]; exists {
+		if len(rule.enum) > 0 {
+			schema = append(schema, orderedField{name: "enum", value: rule.enum})
+		}
+		// 时长字段的上下限以纳秒表示，仅对数值型字段输出
+		if t != durationType {
+			if rule.min != nil {
+				schema = append(schema, orderedField{name: "minimum", value: *rule.min})
+			}
+			if rule.max != nil {
+				schema = append(schema, orderedField{name: "maximum", value: *rule.max})
+			}
+		}
+	}
+
+	if defaultValue != nil {
+		schema = append(schema, orderedField{name: "default", value: defaultValue})
+	}
+	return schema
+}
+
+// compositionSchema 顶层 include 与 profiles 字段的Schema
+func compositionSchema() orderedObject {
+	stringType := orderedObject{{name: "type", value: "string"}}
+	return orderedObject{
+		{name: includeKey, value: orderedObject{
+			{name: "description", value: "引用的其他配置文件，相对路径基于当前文件所在目录"},
+			{name: "oneOf", value: []interface{}{
+				stringType,
+				orderedObject{{name: "type", value: "array"}, {name: "items", value: stringType}},
+			}},
+		}},
+		{name: profilesKey, value: orderedObject{
+			{name: "description", value: "命名配置档，通过 --profile 选用并覆盖在主配置之上"},
+			{name: "type", value: "object"},
+			{name: "additionalProperties", value: orderedObject{{name: "type", value: "object"}}},
+		}},
+	}
+}
+
+// set 按字段名设置有序对象中的值
+func (o orderedObject) set(name string, value interface{}) {
+	for i := range o {
+		if o[i].name == name {
+			o[i].value = value
+			return
+		}
+	}
+}
+
+// get 按字段名获取有序对象中的值
+func (o orderedObject) get(name string) interface{} {
+	for _, field := range o {
+		if field.name == name {
+			return field.value
+		}
+	}
+	return nil
+}
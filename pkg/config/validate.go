@@ -0,0 +1,624 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ValidationIssue 配置校验问题，Path 为字段路径，如 plugins.plugins[2].priority
+type ValidationIssue struct {
+	Path    string `json:"path"`
+	Message string `json:"message"`
+}
+
+// String 返回 "路径: 信息" 形式的描述
+func (i ValidationIssue) String() string {
+	if i.Path == "" {
+		return i.Message
+	}
+	return i.Path + ": " + i.Message
+}
+
+// ValidationReport 配置校验报告
+type ValidationReport struct {
+	// Errors 导致配置无法使用的错误
+	Errors []ValidationIssue `json:"errors"`
+	// Warnings 不影响加载的警告（如未知字段）
+	Warnings []ValidationIssue `json:"warnings"`
+}
+
+// addError 添加错误
+func (r *ValidationReport) addError(path, format string, args ...interface{}) {
+	r.Errors = append(r.Errors, ValidationIssue{Path: path, Message: fmt.Sprintf(format, args...)})
+}
+
+// addWarning 添加警告
+func (r *ValidationReport) addWarning(path, format string, args ...interface{}) {
+	r.Warnings = append(r.Warnings, ValidationIssue{Path: path, Message: fmt.Sprintf(format, args...)})
+}
+
+// Err 将错误列表转换为 error，无错误时返回nil
+func (r *ValidationReport) Err() error {
+	if len(r.Errors) == 0 {
+		return nil
+	}
+	return ValidationErrors(r.Errors)
+}
+
+// ValidationErrors 配置校验错误列表
+type ValidationErrors []ValidationIssue
+
+// Error 实现 error 接口，每行一个问题
+func (e ValidationErrors) Error() string {
+	lines := make([]string, len(e))
+	for i, issue := range e {
+		lines[i] = issue.String()
+	}
+	return "配置校验失败:\n  " + strings.Join(lines, "\n  ")
+}
+
+// fieldRule 字段取值约束，键为字段路径模式（列表元素写作 []），同时用于生成JSON Schema
+type fieldRule struct {
+	min  *float64
+	max  *float64
+	enum []string
+}
+
+// bound 返回约束值指针
+func bound(v float64) *float64 {
+	return &v
+}
+
+// fieldRules 字段取值约束表
+var fieldRules = map[string]fieldRule{
+	"server.listen_port":                       {min: bound(1), max: bound(65535)},
+	"server.read_timeout":                      {min: bound(0)},
+	"server.write_timeout":                     {min: bound(0)},
+	"server.tls.client_auth":                   {enum: []string{"none", "optional", "require"}},
+	"security.client_cert.username_field":      {enum: []string{"cn", "email", "dns", "subject"}},
+	"tls.cert_cache_ttl":                       {min: bound(0)},
+	"tls.leaf_validity":                        {min: bound(0), max: bound(float64(398 * 24 * time.Hour))},
+	"tls.ca_expiry_warning":                    {min: bound(0)},
+	"tls.key_log_max_size_mb":                  {min: bound(0)},
+	"proxy.upstream_timeout":                   {min: bound(0)},
+	"proxy.max_idle_conns":                     {min: bound(0)},
+	"security.rate_limit.max_requests":         {min: bound(0)},
+	"security.rate_limit.window":               {min: bound(0)},
+	"security.rate_limit.burst":                {min: bound(0)},
+	"security.rate_limit.rules[].key[]":        {enum: []string{"client_ip", "user", "host"}},
+	"security.rate_limit.rules[].requests":     {min: bound(1)},
+	"security.rate_limit.rules[].window":       {min: bound(0)},
+	"security.rate_limit.rules[].burst":        {min: bound(0)},
+	"security.auto_ban.find_time":              {min: bound(0)},
+	"security.auto_ban.max_auth_failures":      {min: bound(0)},
+	"security.auto_ban.max_rate_limit_hits":    {min: bound(0)},
+	"security.auto_ban.max_filter_denials":     {min: bound(0)},
+	"security.auto_ban.ban_time":               {min: bound(0)},
+	"security.auto_ban.ban_multiplier":         {min: bound(1)},
+	"security.auto_ban.max_ban_time":           {min: bound(0)},
+	"monitoring.port":                          {min: bound(0), max: bound(65535)},
+	"monitoring.health_checks.memory_limit_mb": {min: bound(0)},
+	"monitoring.health_checks.max_goroutines":  {min: bound(0)},
+	"logging.level":                            {enum: []string{"debug", "info", "warn", "warning", "error", "fatal", "panic"}},
+	"logging.format":                           {enum: []string{"text", "json"}},
+	"performance.max_goroutines":               {min: bound(0)},
+	"performance.buffer_size":                  {min: bound(0)},
+	"performance.pprof_port":                   {min: bound(0), max: bound(65535)},
+	"pattern_recognition.confidence_threshold": {min: bound(0), max: bound(1)},
+	"pattern_recognition.cache_size":           {min: bound(0)},
+	"pattern_recognition.cache_ttl":            {min: bound(0)},
+	"fingerprint.cache_size":                   {min: bound(0)},
+	"fingerprint.cache_ttl":                    {min: bound(0)},
+	"fingerprint.favicon_timeout":              {min: bound(0)},
+	"fingerprint.max_matches":                  {min: bound(0)},
+	"plugins.plugins[].priority":               {min: bound(0)},
+	"scope.out_of_scope":                       {enum: []string{"block", "passthrough"}},
+	"flows.max_flows":                          {min: bound(1)},
+	"flows.max_body_size":                      {min: bound(0)},
+	"policies[].rate_limit[].key[]":            {enum: []string{"client_ip", "user", "host"}},
+	"policies[].rate_limit[].requests":         {min: bound(1)},
+	"policies[].rate_limit[].window":           {min: bound(0)},
+	"policies[].rate_limit[].burst":            {min: bound(0)},
+}
+
+// Validate 校验配置取值，返回包含所有问题的报告
+// Validate checks all configuration values and returns a report with path-qualified issues
+func (c *Config) Validate() *ValidationReport {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	report := &ValidationReport{}
+	checkFieldRules(reflect.ValueOf(c).Elem(), "", "", report)
+	c.validateSemantics(report)
+	return report
+}
+
+// checkFieldRules 遍历配置值并应用约束表
+func checkFieldRules(v reflect.Value, path, pattern string, report *ValidationReport) {
+	switch v.Kind() {
+	case reflect.Struct:
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			name, ok := jsonFieldName(t.Field(i))
+			if !ok {
+				continue
+			}
+			checkFieldRules(v.Field(i), joinPath(path, name), joinPath(pattern, name), report)
+		}
+		return
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			checkFieldRules(v.Index(i), fmt.Sprintf("%s[%d]", path, i), pattern+"[]", report)
+		}
+		return
+	}
+
+	rule, exists := fieldRules[pattern]
+	if !exists {
+		return
+	}
+
+	var number float64
+	isDuration := v.Type() == durationType
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		number = float64(v.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		number = float64(v.Uint())
+	case reflect.Float32, reflect.Float64:
+		number = v.Float()
+	case reflect.String:
+		if len(rule.enum) > 0 && !containsString(rule.enum, strings.ToLower(v.String())) {
+			report.addError(path, "必须是 %s 之一，当前为 %q", strings.Join(rule.enum, ", "), v.String())
+		}
+		return
+	default:
+		return
+	}
+
+	format := func(n float64) string {
+		if isDuration {
+			return time.Duration(n).String()
+		}
+		return fmt.Sprint(n)
+	}
+	if rule.min != nil && number < *rule.min {
+		report.addError(path, "必须 >= %s，当前为 %s", format(*rule.min), format(number))
+	}
+	if rule.max != nil && number > *rule.max {
+		report.addError(path, "必须 <= %s，当前为 %s", format(*rule.max), format(number))
+	}
+}
+
+// validateSemantics 校验字段间关系及外部资源
+func (c *Config) validateSemantics(report *ValidationReport) {
+	if strings.TrimSpace(c.TLS.CertDir) == "" {
+		report.addError("tls.cert_dir", "不能为空")
+	}
+	for i, domain := range c.TLS.ExactMatchDomains {
+		if strings.TrimSpace(domain) == "" {
+			report.addError(fmt.Sprintf("tls.exact_match_domains[%d]", i), "不能为空")
+		}
+	}
+
+	// 安全配置
+	if c.Security.EnableAuth {
+		hasLegacy := c.Security.Username != "" || c.Security.Password != ""
+		if hasLegacy && (c.Security.Username == "" || c.Security.Password == "") {
+			report.addError("security.username", "username 和 password 必须同时设置")
+		}
+		if !hasLegacy && len(c.Security.Users) == 0 && c.Security.HtpasswdFile == "" {
+			report.addError("security.users", "启用认证时必须配置 users、htpasswd_file 或 username/password")
+		}
+		if c.Security.Password != "" && !isPasswordHash(c.Security.Password) {
+			report.addWarning("security.password", "使用明文密码，建议改为 bcrypt/argon2id 哈希")
+		}
+	}
+	users := make(map[string]int)
+	for i, user := range c.Security.Users {
+		path := fmt.Sprintf("security.users[%d]", i)
+		if user.Username == "" {
+			report.addError(path+".username", "不能为空")
+		} else if strings.Contains(user.Username, ":") {
+			report.addError(path+".username", "不能包含冒号")
+		} else if first, exists := users[user.Username]; exists {
+			report.addError(path+".username", "与 security.users[%d] 重名: %s", first, user.Username)
+		} else {
+			users[user.Username] = i
+		}
+		if !isPasswordHash(user.PasswordHash) {
+			report.addError(path+".password_hash", "必须是 bcrypt ($2y$...) 或 argon2id ($argon2id$...) 哈希")
+		}
+	}
+	if c.Security.HtpasswdFile != "" {
+		if _, err := os.Stat(c.Security.HtpasswdFile); err != nil {
+			report.addError("security.htpasswd_file", "文件不存在: %s", c.Security.HtpasswdFile)
+		}
+	}
+	if listenerTLS := c.Server.TLS; listenerTLS.Enabled {
+		if (listenerTLS.CertFile == "") != (listenerTLS.KeyFile == "") {
+			report.addError("server.tls", "cert_file 和 key_file 必须同时配置")
+		}
+		if listenerTLS.ClientAuth != "none" && listenerTLS.ClientCAFile == "" {
+			report.addError("server.tls.client_ca_file", "client_auth 为 %s 时不能为空", listenerTLS.ClientAuth)
+		}
+		for _, file := range []struct{ path, value string }{
+			{"server.tls.cert_file", listenerTLS.CertFile},
+			{"server.tls.key_file", listenerTLS.KeyFile},
+			{"server.tls.client_ca_file", listenerTLS.ClientCAFile},
+			{"server.tls.crl_file", listenerTLS.CRLFile},
+		} {
+			if file.value == "" {
+				continue
+			}
+			if _, err := os.Stat(file.value); err != nil {
+				report.addError(file.path, "文件不存在: %s", file.value)
+			}
+		}
+	}
+	for i, user := range c.Security.ClientCert.Users {
+		path := fmt.Sprintf("security.client_cert.users[%d]", i)
+		if strings.TrimSpace(user.Subject) == "" {
+			report.addError(path+".subject", "不能为空")
+		}
+		if strings.TrimSpace(user.Username) == "" {
+			report.addError(path+".username", "不能为空")
+		}
+	}
+	validateAddressList(report, "security.whitelist", c.Security.Whitelist)
+	validateAddressList(report, "security.blacklist", c.Security.Blacklist)
+	validateAddressList(report, "security.trusted_proxies", c.Security.TrustedProxies)
+	validateFileList(report, "security.whitelist_files", c.Security.WhitelistFiles)
+	validateFileList(report, "security.blacklist_files", c.Security.BlacklistFiles)
+	if autoBan := c.Security.AutoBan; autoBan.Enabled {
+		if autoBan.FindTime <= 0 {
+			report.addError("security.auto_ban.find_time", "启用自动封禁时必须 > 0")
+		}
+		if autoBan.BanTime <= 0 {
+			report.addError("security.auto_ban.ban_time", "启用自动封禁时必须 > 0")
+		}
+		if autoBan.MaxBanTime < autoBan.BanTime {
+			report.addError("security.auto_ban.max_ban_time", "不能小于 ban_time")
+		}
+		if autoBan.MaxAuthFailures == 0 && autoBan.MaxRateLimitHits == 0 && autoBan.MaxFilterDenials == 0 {
+			report.addWarning("security.auto_ban", "所有阈值均为 0，不会触发自动封禁")
+		}
+	}
+	validateAddressList(report, "security.auto_ban.ignore", c.Security.AutoBan.Ignore)
+	validateAddressList(report, "security.dial_guard.block", c.Security.DialGuard.Block)
+	validateAddressList(report, "security.dial_guard.allow", c.Security.DialGuard.Allow)
+	for i, host := range c.Security.DialGuard.AllowHosts {
+		if strings.TrimSpace(host) == "" {
+			report.addError(fmt.Sprintf("security.dial_guard.allow_hosts[%d]", i), "不能为空")
+		}
+	}
+
+	ruleNames := make(map[string]bool)
+	for i, rule := range c.Security.RateLimit.Rules {
+		path := fmt.Sprintf("security.rate_limit.rules[%d]", i)
+		if len(rule.Key) == 0 {
+			report.addError(path+".key", "至少需要一个限流维度")
+		}
+		if rule.Window <= 0 {
+			report.addError(path+".window", "必须 > 0")
+		}
+		if rule.Name != "" {
+			if ruleNames[rule.Name] {
+				report.addError(path+".name", "规则名称重复: %s", rule.Name)
+			}
+			ruleNames[rule.Name] = true
+		}
+	}
+	if c.Security.RateLimit.Enabled && len(c.Security.RateLimit.Rules) == 0 {
+		if c.Security.RateLimit.MaxRequests <= 0 {
+			report.addError("security.rate_limit.max_requests", "启用限流时必须 > 0")
+		}
+		if c.Security.RateLimit.Window <= 0 {
+			report.addError("security.rate_limit.window", "启用限流时必须 > 0")
+		}
+	}
+
+	// 监控与性能分析端口
+	if c.Monitoring.Enabled {
+		if c.Monitoring.Port <= 0 {
+			report.addError("monitoring.port", "启用监控时必须在 1-65535 之间")
+		} else if c.Monitoring.Port == c.Server.ListenPort {
+			report.addError("monitoring.port", "不能与 server.listen_port 相同 (%d)", c.Server.ListenPort)
+		}
+	}
+	if c.Performance.EnablePProf && c.Performance.PProfPort <= 0 {
+		report.addError("performance.pprof_port", "启用pprof时必须在 1-65535 之间")
+	}
+
+	// 指纹库
+	if c.Fingerprint.Enabled {
+		if c.Fingerprint.FingerprintPath == "" {
+			report.addError("fingerprint.fingerprint_path", "启用指纹识别时不能为空")
+		} else if _, err := os.Stat(c.Fingerprint.FingerprintPath); err != nil {
+			// 指纹库缺失时代理仍可运行（仅禁用指纹识别），因此只作为警告
+			report.addWarning("fingerprint.fingerprint_path", "文件不存在，指纹识别将不可用: %s", c.Fingerprint.FingerprintPath)
+		}
+	}
+
+	// 插件
+	names := make(map[string]int)
+	for i, p := range c.Plugins.Plugins {
+		path := fmt.Sprintf("plugins.plugins[%d]", i)
+		if strings.TrimSpace(p.Name) == "" {
+			report.addError(path+".name", "不能为空")
+		} else if first, exists := names[p.Name]; exists {
+			report.addError(path+".name", "与 plugins.plugins[%d] 重名: %s", first, p.Name)
+		} else {
+			names[p.Name] = i
+		}
+
+		switch p.Runtime {
+		case "", "native", "process", "wasm", "builtin":
+		default:
+			report.addError(path+".runtime", "必须是 native、process、wasm 或 builtin，当前为 %q", p.Runtime)
+		}
+		switch p.Process.Transport {
+		case "", "stdio", "unix":
+		default:
+			report.addError(path+".process.transport", "必须是 stdio 或 unix，当前为 %q", p.Process.Transport)
+		}
+		if p.Process.CallTimeout < 0 || p.Process.HealthInterval < 0 || p.Process.MaxBodySize < 0 {
+			report.addError(path+".process", "call_timeout、health_interval 和 max_body_size 不能为负数")
+		}
+		if p.Wasm.MaxMemory < 0 || p.Wasm.CallTimeout < 0 || p.Wasm.MaxBodySize < 0 {
+			report.addError(path+".wasm", "max_memory、call_timeout 和 max_body_size 不能为负数")
+		}
+		if p.Isolation.ErrorThreshold < 0 || p.Isolation.ErrorThreshold > 1 {
+			report.addError(path+".isolation.error_threshold", "必须在 0-1 之间，当前为 %v", p.Isolation.ErrorThreshold)
+		}
+		if p.Isolation.OpenDuration < 0 {
+			report.addError(path+".isolation.open_duration", "不能为负数")
+		}
+
+		if !p.Enabled || !c.Plugins.Enabled {
+			continue
+		}
+		if c.isBuiltinPlugin(p) {
+			continue
+		}
+		if p.Runtime == "builtin" {
+			if c.builtinPlugin != nil {
+				report.addError(path+".name", "未找到内置插件: %s", p.Name)
+			}
+			continue
+		}
+		if p.Path == "" {
+			report.addError(path+".path", "启用的插件必须指定路径")
+			continue
+		}
+		pluginPath := p.Path
+		if !filepath.IsAbs(pluginPath) {
+			pluginPath = filepath.Join(c.Plugins.BasePath, pluginPath)
+		}
+		if _, err := os.Stat(pluginPath); err != nil {
+			report.addWarning(path+".path", "插件文件不存在: %s", pluginPath)
+		}
+	}
+
+	for i, rule := range c.Scope.Include {
+		validateScopeRule(report, fmt.Sprintf("scope.include[%d]", i), rule)
+	}
+	for i, rule := range c.Scope.Exclude {
+		validateScopeRule(report, fmt.Sprintf("scope.exclude[%d]", i), rule)
+	}
+	validateFileList(report, "scope.files", c.Scope.Files)
+	if c.Scope.Enabled && len(c.Scope.Include) == 0 && len(c.Scope.Files) == 0 {
+		report.addWarning("scope.include", "启用范围控制但未配置 include，除 exclude 外的所有目标都在范围内")
+	}
+
+	c.validatePolicies(report)
+
+	if c.Audit.Enabled {
+		if c.Audit.File == "" {
+			report.addError("audit.file", "启用审计日志时不能为空")
+		}
+		if !c.Audit.HashChain {
+			report.addWarning("audit.hash_chain", "未启用哈希链，无法检测审计日志被篡改")
+		}
+	}
+}
+
+// validatePolicies 校验用户策略
+func (c *Config) validatePolicies(report *ValidationReport) {
+	names := make(map[string]int)
+	for i, policy := range c.Policies {
+		base := fmt.Sprintf("policies[%d]", i)
+		if strings.TrimSpace(policy.Name) == "" {
+			report.addError(base+".name", "不能为空")
+		} else if first, exists := names[policy.Name]; exists {
+			report.addError(base+".name", "与 policies[%d] 重名: %s", first, policy.Name)
+		} else {
+			names[policy.Name] = i
+		}
+
+		if len(policy.Users) == 0 {
+			report.addError(base+".users", "至少需要一个用户")
+		}
+		for _, list := range []struct {
+			field    string
+			patterns []string
+		}{
+			{"users", policy.Users},
+			{"plugins", policy.Plugins},
+			{"exclude_plugins", policy.ExcludePlugins},
+		} {
+			for j, pattern := range list.patterns {
+				if _, err := path.Match(pattern, ""); err != nil || pattern == "" {
+					report.addError(fmt.Sprintf("%s.%s[%d]", base, list.field, j), "无效的匹配模式: %q", pattern)
+				}
+			}
+		}
+
+		for j, rule := range policy.Scope.Include {
+			validateScopeRule(report, fmt.Sprintf("%s.scope.include[%d]", base, j), rule)
+		}
+		for j, rule := range policy.Scope.Exclude {
+			validateScopeRule(report, fmt.Sprintf("%s.scope.exclude[%d]", base, j), rule)
+		}
+		validateFileList(report, base+".scope.files", policy.Scope.Files)
+
+		for j, rule := range policy.RateLimit {
+			if rule.Window <= 0 {
+				report.addError(fmt.Sprintf("%s.rate_limit[%d].window", base, j), "必须大于0")
+			}
+		}
+	}
+}
+
+// isBuiltinPlugin 插件是否按名称或路径解析为内置插件，判断函数来自 LoadOptions.BuiltinPlugin
+func (c *Config) isBuiltinPlugin(p ConfigPluginConfig) bool {
+	switch p.Runtime {
+	case "", "native", "builtin":
+	default:
+		return false
+	}
+	if c.builtinPlugin == nil {
+		return false
+	}
+	return c.builtinPlugin(p.Name) || (p.Path != "" && c.builtinPlugin(p.Path))
+}
+
+// scopePortPattern 范围规则端口格式：80、80,443、8000-9000
+var scopePortPattern = regexp.MustCompile(`^\d+(-\d+)?(,\d+(-\d+)?)*$`)
+
+// validateScopeRule 校验范围规则
+func validateScopeRule(report *ValidationReport, path string, rule ScopeRule) {
+	if rule == (ScopeRule{}) {
+		report.addError(path, "规则至少需要一个字段")
+		return
+	}
+	for _, field := range [][2]string{{"host", rule.Host}, {"path", rule.Path}} {
+		if expr, ok := strings.CutPrefix(field[1], "re:"); ok {
+			if _, err := regexp.Compile(expr); err != nil {
+				report.addError(path+"."+field[0], "无效的正则表达式: %v", err)
+			}
+		}
+	}
+	if port := strings.ReplaceAll(rule.Port, " ", ""); port != "" && !scopePortPattern.MatchString(port) {
+		report.addError(path+".port", "无效的端口 %q（示例: 443、80,443、8000-9000）", rule.Port)
+	}
+	for _, scheme := range strings.Split(rule.Scheme, ",") {
+		if scheme = strings.ToLower(strings.TrimSpace(scheme)); scheme != "" && !containsString([]string{"http", "https", "ws", "wss"}, scheme) {
+			report.addError(path+".scheme", "必须是 http, https, ws, wss 之一，当前为 %q", scheme)
+		}
+	}
+}
+
+// validateAddressList 校验IP、CIDR或IP范围列表
+func validateAddressList(report *ValidationReport, path string, list []string) {
+	for i, entry := range list {
+		entry = strings.TrimSpace(entry)
+		if start, end, ok := strings.Cut(entry, "-"); ok {
+			if net.ParseIP(strings.TrimSpace(start)) != nil && net.ParseIP(strings.TrimSpace(end)) != nil {
+				continue
+			}
+		} else if net.ParseIP(entry) != nil {
+			continue
+		} else if _, _, err := net.ParseCIDR(entry); err == nil {
+			continue
+		}
+		report.addError(fmt.Sprintf("%s[%d]", path, i), "无效的IP地址、CIDR或范围: %q", entry)
+	}
+}
+
+// validateFileList 校验文件列表中的文件是否存在
+func validateFileList(report *ValidationReport, path string, files []string) {
+	for i, file := range files {
+		if _, err := os.Stat(file); err != nil {
+			report.addError(fmt.Sprintf("%s[%d]", path, i), "文件不存在: %s", file)
+		}
+	}
+}
+
+// checkUnknownFields 检查文档中不属于配置结构体的字段
+func checkUnknownFields(t reflect.Type, value interface{}, path string, report *ValidationReport) {
+	switch t.Kind() {
+	case reflect.Ptr:
+		checkUnknownFields(t.Elem(), value, path, report)
+
+	case reflect.Struct:
+		if t == durationType {
+			return
+		}
+		obj, ok := toObject(value)
+		if !ok {
+			return
+		}
+		known := make(map[string]reflect.Type, t.NumField())
+		for i := 0; i < t.NumField(); i++ {
+			if name, ok := jsonFieldName(t.Field(i)); ok {
+				known[name] = t.Field(i).Type
+			}
+		}
+		keys := make([]string, 0, len(obj))
+		for key := range obj {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			fieldType, exists := known[key]
+			if !exists && path == "" && key == "$schema" {
+				// 允许在配置文件中引用JSON Schema
+				continue
+			}
+			if !exists {
+				report.addWarning(joinPath(path, key), "未知字段，将被忽略")
+				continue
+			}
+			checkUnknownFields(fieldType, obj[key], joinPath(path, key), report)
+		}
+
+	case reflect.Slice, reflect.Array:
+		list, ok := value.([]interface{})
+		if !ok {
+			return
+		}
+		for i, item := range list {
+			checkUnknownFields(t.Elem(), item, fmt.Sprintf("%s[%d]", path, i), report)
+		}
+	}
+}
+
+// describeDecodeError 将JSON解码错误转换为带字段路径的描述
+func describeDecodeError(err error) error {
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) && typeErr.Field != "" {
+		return fmt.Errorf("%s: 类型错误，期望 %s，实际为 %s", typeErr.Field, typeErr.Type, typeErr.Value)
+	}
+	return err
+}
+
+// isPasswordHash 检查是否为支持的密码哈希格式（与 security.IsPasswordHash 保持一致）
+func isPasswordHash(s string) bool {
+	for _, prefix := range []string{"$2a$", "$2b$", "$2y$", "$argon2id$", "$apr1$", "{SHA}"} {
+		if strings.HasPrefix(s, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// containsString 检查字符串是否在列表中
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
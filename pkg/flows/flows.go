@@ -0,0 +1,341 @@
+// Package flows 按用户隔离的内存流量记录
+// Package flows keeps recently proxied request/response pairs in memory, partitioned by user
+package flows
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"hackmitm/pkg/config"
+)
+
+// Flow 一次请求及其响应
+type Flow struct {
+	// ID 流量ID
+	ID string `json:"id"`
+	// Time 请求开始时间
+	Time time.Time `json:"time"`
+	// DurationMS 请求耗时（毫秒）
+	DurationMS float64 `json:"duration_ms"`
+	// User 认证用户名，未认证时为空
+	User string `json:"user,omitempty"`
+	// Policy 适用的用户策略
+	Policy string `json:"policy,omitempty"`
+	// ClientIP 客户端IP
+	ClientIP string `json:"client_ip"`
+	// Method 请求方法
+	Method string `json:"method"`
+	// URL 请求URL
+	URL string `json:"url"`
+	// StatusCode 响应状态码，请求失败时为0
+	StatusCode int `json:"status_code"`
+	// RequestHeaders 请求头
+	RequestHeaders http.Header `json:"request_headers,omitempty"`
+	// RequestBody 请求正文（最多 max_body_size 字节，JSON 中为 Base64）
+	RequestBody []byte `json:"request_body,omitempty"`
+	// RequestSize 请求正文实际大小
+	RequestSize int64 `json:"request_size"`
+	// ResponseHeaders 响应头
+	ResponseHeaders http.Header `json:"response_headers,omitempty"`
+	// ResponseBody 响应正文（最多 max_body_size 字节，JSON 中为 Base64）
+	ResponseBody []byte `json:"response_body,omitempty"`
+	// ResponseSize 响应正文实际大小
+	ResponseSize int64 `json:"response_size"`
+	// Truncated 请求或响应正文被截断
+	Truncated bool `json:"truncated,omitempty"`
+	// Error 请求失败原因
+	Error string `json:"error,omitempty"`
+	// Analysis 分析插件对请求和响应的分析结果
+	Analysis []Analysis `json:"analysis,omitempty"`
+
+	// seq 记录顺序
+	seq uint64
+}
+
+// Analysis 分析插件的一条分析结果
+type Analysis struct {
+	// Plugin 插件名称
+	Plugin string `json:"plugin"`
+	// Phase 分析的阶段（request 或 response）
+	Phase       string                 `json:"phase"`
+	Threat      bool                   `json:"threat"`
+	ThreatLevel string                 `json:"threat_level,omitempty"`
+	Description string                 `json:"description,omitempty"`
+	Confidence  float64                `json:"confidence"`
+	Metadata    map[string]interface{} `json:"metadata,omitempty"`
+	Timestamp   time.Time              `json:"timestamp"`
+}
+
+// Summary 流量摘要，列表接口不返回请求头和正文
+type Summary struct {
+	ID           string    `json:"id"`
+	Time         time.Time `json:"time"`
+	DurationMS   float64   `json:"duration_ms"`
+	User         string    `json:"user,omitempty"`
+	Method       string    `json:"method"`
+	URL          string    `json:"url"`
+	StatusCode   int       `json:"status_code"`
+	ResponseSize int64     `json:"response_size"`
+	Error        string    `json:"error,omitempty"`
+	// Threat 分析插件认为存在威胁
+	Threat bool `json:"threat,omitempty"`
+}
+
+// summary 生成摘要
+func (f *Flow) summary() Summary {
+	return Summary{
+		ID:           f.ID,
+		Time:         f.Time,
+		DurationMS:   f.DurationMS,
+		User:         f.User,
+		Method:       f.Method,
+		URL:          f.URL,
+		StatusCode:   f.StatusCode,
+		ResponseSize: f.ResponseSize,
+		Error:        f.Error,
+		Threat:       f.threat(),
+	}
+}
+
+// threat 任一分析结果认为存在威胁
+func (f *Flow) threat() bool {
+	for _, analysis := range f.Analysis {
+		if analysis.Threat {
+			return true
+		}
+	}
+	return false
+}
+
+// Store 流量存储，每个用户保留最近的 max_flows 条
+// Store is an in-memory ring buffer of flows per user
+type Store struct {
+	// config 流量记录配置
+	config config.FlowsConfig
+	// users 按用户名分组的流量，未认证的请求使用空用户名
+	users map[string]*userFlows
+	// byID 流量ID索引
+	byID map[string]*Flow
+	// seq 流量序号
+	seq uint64
+	// recorded 记录的流量总数
+	recorded int64
+	// mutex 保护并发访问
+	mutex sync.RWMutex
+}
+
+// userFlows 单个用户的流量环形缓冲区
+type userFlows struct {
+	flows []*Flow
+	next  int
+}
+
+// NewStore 创建流量存储
+func NewStore(flowsConfig config.FlowsConfig) *Store {
+	s := &Store{
+		users: make(map[string]*userFlows),
+		byID:  make(map[string]*Flow),
+	}
+	s.Configure(flowsConfig)
+	return s
+}
+
+// Configure 应用配置，max_flows 变小时丢弃各用户最旧的流量
+func (s *Store) Configure(flowsConfig config.FlowsConfig) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if flowsConfig.MaxFlows <= 0 {
+		flowsConfig.MaxFlows = 500
+	}
+	if flowsConfig.MaxFlows != s.config.MaxFlows {
+		for user, uf := range s.users {
+			ordered := uf.ordered()
+			if drop := len(ordered) - flowsConfig.MaxFlows; drop > 0 {
+				for _, flow := range ordered[:drop] {
+					delete(s.byID, flow.ID)
+				}
+				ordered = ordered[drop:]
+			}
+			s.users[user] = &userFlows{flows: ordered}
+		}
+	}
+	s.config = flowsConfig
+}
+
+// RecordByDefault 未配置用户策略时是否记录流量
+func (s *Store) RecordByDefault() bool {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.config.Enabled
+}
+
+// MaxBodySize 记录的最大正文字节数
+func (s *Store) MaxBodySize() int {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.config.MaxBodySize
+}
+
+// Add 保存流量并分配ID，用户的流量数超过上限时覆盖最旧的一条
+func (s *Store) Add(flow *Flow) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.seq++
+	flow.seq = s.seq
+	flow.ID = strconv.FormatUint(s.seq, 10)
+
+	uf := s.users[flow.User]
+	if uf == nil {
+		uf = &userFlows{}
+		s.users[flow.User] = uf
+	}
+	if len(uf.flows) < s.config.MaxFlows {
+		uf.flows = append(uf.flows, flow)
+	} else {
+		delete(s.byID, uf.flows[uf.next].ID)
+		uf.flows[uf.next] = flow
+		uf.next = (uf.next + 1) % len(uf.flows)
+	}
+	s.byID[flow.ID] = flow
+	atomic.AddInt64(&s.recorded, 1)
+}
+
+// ordered 按时间从旧到新返回流量
+func (uf *userFlows) ordered() []*Flow {
+	ordered := make([]*Flow, 0, len(uf.flows))
+	ordered = append(ordered, uf.flows[uf.next:]...)
+	return append(ordered, uf.flows[:uf.next]...)
+}
+
+// List 返回用户最近的流量摘要（从新到旧），limit <= 0 时返回全部
+func (s *Store) List(user string, limit int) []Summary {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	uf := s.users[user]
+	if uf == nil {
+		return []Summary{}
+	}
+	return newestFirst(uf.ordered(), limit)
+}
+
+// ListAll 返回所有用户最近的流量摘要（从新到旧），仅供管理员使用
+func (s *Store) ListAll(limit int) []Summary {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	all := make([]*Flow, 0, len(s.byID))
+	for _, uf := range s.users {
+		all = append(all, uf.flows...)
+	}
+	sort.Slice(all, func(i, j int) bool {
+		return all[i].seq < all[j].seq
+	})
+	return newestFirst(all, limit)
+}
+
+// newestFirst 取最后 limit 条并按从新到旧排列
+func newestFirst(ordered []*Flow, limit int) []Summary {
+	if limit <= 0 || limit > len(ordered) {
+		limit = len(ordered)
+	}
+	summaries := make([]Summary, 0, limit)
+	for i := len(ordered) - 1; i >= len(ordered)-limit; i-- {
+		summaries = append(summaries, ordered[i].summary())
+	}
+	return summaries
+}
+
+// Get 按ID获取流量
+func (s *Store) Get(id string) (*Flow, bool) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	flow, exists := s.byID[id]
+	return flow, exists
+}
+
+// Clear 删除用户的全部流量，返回删除的条数
+func (s *Store) Clear(user string) int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	uf := s.users[user]
+	if uf == nil {
+		return 0
+	}
+	for _, flow := range uf.flows {
+		delete(s.byID, flow.ID)
+	}
+	delete(s.users, user)
+	return len(uf.flows)
+}
+
+// ClearAll 删除所有用户的流量，返回删除的条数
+func (s *Store) ClearAll() int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	count := len(s.byID)
+	s.users = make(map[string]*userFlows)
+	s.byID = make(map[string]*Flow)
+	return count
+}
+
+// GetStats 获取统计信息
+func (s *Store) GetStats() map[string]interface{} {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	return map[string]interface{}{
+		"enabled":  s.config.Enabled,
+		"users":    len(s.users),
+		"stored":   len(s.byID),
+		"recorded": atomic.LoadInt64(&s.recorded),
+	}
+}
+
+// Capture 记录正文的前 limit 字节并统计实际大小，可作为 io.TeeReader 的写入端
+type Capture struct {
+	limit int
+	data  []byte
+	size  int64
+}
+
+// NewCapture 创建正文记录器
+func NewCapture(limit int) *Capture {
+	return &Capture{limit: limit}
+}
+
+// Write 实现 io.Writer，超出上限的部分只计入大小
+func (c *Capture) Write(p []byte) (int, error) {
+	n := len(p)
+	c.size += int64(n)
+	if room := c.limit - len(c.data); room > 0 {
+		if len(p) > room {
+			p = p[:room]
+		}
+		c.data = append(c.data, p...)
+	}
+	return n, nil
+}
+
+// Bytes 返回记录的正文
+func (c *Capture) Bytes() []byte {
+	return c.data
+}
+
+// Size 返回正文实际大小
+func (c *Capture) Size() int64 {
+	return c.size
+}
+
+// Truncated 正文是否被截断
+func (c *Capture) Truncated() bool {
+	return c.size > int64(len(c.data))
+}
@@ -0,0 +1,142 @@
+package flows
+
+import (
+	"testing"
+
+	"hackmitm/pkg/config"
+)
+
+// urls 摘要中的URL
+func urls(summaries []Summary) []string {
+	list := make([]string, len(summaries))
+	for i, summary := range summaries {
+		list[i] = summary.URL
+	}
+	return list
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestStoreIsolatesUsers(t *testing.T) {
+	s := NewStore(config.FlowsConfig{Enabled: true, MaxFlows: 10})
+	for _, flow := range []*Flow{
+		{User: "alice", URL: "a1"},
+		{User: "bob", URL: "b1"},
+		{User: "alice", URL: "a2"},
+		{URL: "anonymous"},
+		{User: "bob", URL: "b2"},
+	} {
+		s.Add(flow)
+	}
+
+	tests := []struct {
+		name  string
+		user  string
+		limit int
+		want  []string
+	}{
+		{name: "只返回本用户的流量", user: "alice", want: []string{"a2", "a1"}},
+		{name: "limit取最新的流量", user: "bob", limit: 1, want: []string{"b2"}},
+		{name: "未认证的流量单独存放", user: "", want: []string{"anonymous"}},
+		{name: "没有流量的用户", user: "carol", want: []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := urls(s.List(tt.user, tt.limit)); !equalStrings(got, tt.want) {
+				t.Errorf("List(%q) = %v, want %v", tt.user, got, tt.want)
+			}
+		})
+	}
+
+	if got, want := urls(s.ListAll(0)), []string{"b2", "anonymous", "a2", "b1", "a1"}; !equalStrings(got, want) {
+		t.Errorf("ListAll() = %v, want %v", got, want)
+	}
+
+	// 删除一个用户的流量不影响其他用户
+	aliceFlow := s.List("alice", 1)[0].ID
+	if removed := s.Clear("alice"); removed != 2 {
+		t.Errorf("Clear(alice) = %d, want 2", removed)
+	}
+	if _, exists := s.Get(aliceFlow); exists {
+		t.Error("删除后仍可按ID获取流量")
+	}
+	if got := urls(s.List("bob", 0)); !equalStrings(got, []string{"b2", "b1"}) {
+		t.Errorf("删除 alice 后 List(bob) = %v", got)
+	}
+	if removed := s.ClearAll(); removed != 3 || len(s.ListAll(0)) != 0 {
+		t.Errorf("ClearAll() = %d, 剩余 %d", removed, len(s.ListAll(0)))
+	}
+}
+
+func TestStoreMaxFlowsPerUser(t *testing.T) {
+	s := NewStore(config.FlowsConfig{Enabled: true, MaxFlows: 2})
+	var first *Flow
+	for i, url := range []string{"a1", "a2", "a3"} {
+		flow := &Flow{User: "alice", URL: url}
+		if i == 0 {
+			first = flow
+		}
+		s.Add(flow)
+	}
+	s.Add(&Flow{User: "bob", URL: "b1"})
+
+	if got := urls(s.List("alice", 0)); !equalStrings(got, []string{"a3", "a2"}) {
+		t.Errorf("超过上限后 List(alice) = %v", got)
+	}
+	if _, exists := s.Get(first.ID); exists {
+		t.Error("被覆盖的流量仍可按ID获取")
+	}
+	// 上限按用户计算，其他用户的流量不会挤掉本用户的
+	if got := urls(s.List("bob", 0)); !equalStrings(got, []string{"b1"}) {
+		t.Errorf("List(bob) = %v", got)
+	}
+
+	s.Configure(config.FlowsConfig{Enabled: true, MaxFlows: 1})
+	if got := urls(s.List("alice", 0)); !equalStrings(got, []string{"a3"}) {
+		t.Errorf("调小上限后 List(alice) = %v", got)
+	}
+	s.Add(&Flow{User: "alice", URL: "a4"})
+	if got := urls(s.List("alice", 0)); !equalStrings(got, []string{"a4"}) {
+		t.Errorf("调小上限后再添加 List(alice) = %v", got)
+	}
+}
+
+func TestCapture(t *testing.T) {
+	tests := []struct {
+		name          string
+		limit         int
+		writes        []string
+		want          string
+		wantTruncated bool
+	}{
+		{name: "未超过上限", limit: 10, writes: []string{"hello", " go"}, want: "hello go"},
+		{name: "跨写入截断", limit: 6, writes: []string{"hello", " world"}, want: "hello ", wantTruncated: true},
+		{name: "上限为0只统计大小", limit: 0, writes: []string{"abc"}, wantTruncated: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewCapture(tt.limit)
+			size := 0
+			for _, w := range tt.writes {
+				if n, err := c.Write([]byte(w)); n != len(w) || err != nil {
+					t.Fatalf("Write() = %d, %v", n, err)
+				}
+				size += len(w)
+			}
+			if string(c.Bytes()) != tt.want || c.Size() != int64(size) || c.Truncated() != tt.wantTruncated {
+				t.Errorf("Bytes() = %q, Size() = %d, Truncated() = %v", c.Bytes(), c.Size(), c.Truncated())
+			}
+		})
+	}
+}
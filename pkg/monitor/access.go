@@ -0,0 +1,243 @@
+package monitor
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"hackmitm/pkg/logger"
+	"hackmitm/pkg/security"
+)
+
+// AccessListProvider 访问列表（白名单/黑名单）管理提供者接口
+type AccessListProvider interface {
+	ListAccessEntries(list string) ([]security.IPListEntry, error)
+	AddAccessEntry(list, value string, ttl time.Duration, comment string) (*security.IPListEntry, error)
+	RemoveAccessEntry(list, value string) error
+}
+
+// BanProvider 自动封禁管理提供者接口
+type BanProvider interface {
+	ListBans() []security.Ban
+	BanIP(ip string, duration time.Duration) (*security.Ban, error)
+	UnbanIP(ip string) error
+}
+
+// SetAccessListProvider 设置访问列表管理提供者，需在 Start 之前调用
+func (ms *MonitorServer) SetAccessListProvider(provider AccessListProvider) {
+	ms.accessListProvider = provider
+}
+
+// SetBanProvider 设置封禁管理提供者，需在 Start 之前调用
+func (ms *MonitorServer) SetBanProvider(provider BanProvider) {
+	ms.banProvider = provider
+}
+
+// SetAPIToken 设置监控API的访问令牌，需在 Start 之前调用
+// 未设置令牌时，除 /health 与代理用户查看自己的流量外，监控API均不可用
+func (ms *MonitorServer) SetAPIToken(token string) {
+	ms.apiToken = token
+}
+
+// handleAccessList 处理访问列表请求
+//
+//	GET    /access/{whitelist|blacklist}          列出条目
+//	POST   /access/{whitelist|blacklist}          添加条目 {"value":"10.0.0.0/8","ttl":"10m","comment":""}
+//	DELETE /access/{whitelist|blacklist}?value=x  删除运行时添加的条目
+func (ms *MonitorServer) handleAccessList(w http.ResponseWriter, r *http.Request) {
+	list := strings.TrimPrefix(r.URL.Path, "/access/")
+	if list != security.ListWhitelist && list != security.ListBlacklist {
+		writeJSONError(w, http.StatusNotFound, "未知的访问列表: "+list)
+		return
+	}
+	if ms.accessListProvider == nil {
+		writeJSONError(w, http.StatusServiceUnavailable, "访问列表管理不可用")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		entries, err := ms.accessListProvider.ListAccessEntries(list)
+		if err != nil {
+			writeJSONError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"list":    list,
+			"count":   len(entries),
+			"entries": entries,
+		})
+
+	case http.MethodPost:
+		var request struct {
+			Value   string `json:"value"`
+			TTL     string `json:"ttl"`
+			Comment string `json:"comment"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			writeJSONError(w, http.StatusBadRequest, "无效的JSON")
+			return
+		}
+		if request.Value == "" {
+			writeJSONError(w, http.StatusBadRequest, "value 不能为空")
+			return
+		}
+
+		var ttl time.Duration
+		if request.TTL != "" {
+			var err error
+			ttl, err = time.ParseDuration(request.TTL)
+			if err != nil || ttl < 0 {
+				writeJSONError(w, http.StatusBadRequest, "无效的ttl（示例: 30s, 10m, 24h）")
+				return
+			}
+		}
+
+		entry, err := ms.accessListProvider.AddAccessEntry(list, request.Value, ttl, request.Comment)
+		if err != nil {
+			writeJSONError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		logger.Infof("监控API添加%s条目: %s (来自 %s)", list, entry.Value, r.RemoteAddr)
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(entry)
+
+	case http.MethodDelete:
+		value := r.URL.Query().Get("value")
+		if value == "" {
+			writeJSONError(w, http.StatusBadRequest, "缺少 value 参数")
+			return
+		}
+
+		err := ms.accessListProvider.RemoveAccessEntry(list, value)
+		switch {
+		case err == nil:
+			logger.Infof("监控API删除%s条目: %s (来自 %s)", list, value, r.RemoteAddr)
+			w.WriteHeader(http.StatusNoContent)
+		case errors.Is(err, security.ErrIPListEntryNotFound):
+			writeJSONError(w, http.StatusNotFound, err.Error())
+		case errors.Is(err, security.ErrIPListEntryReadOnly):
+			writeJSONError(w, http.StatusConflict, err.Error())
+		default:
+			writeJSONError(w, http.StatusBadRequest, err.Error())
+		}
+
+	default:
+		w.Header().Set("Allow", "GET, POST, DELETE")
+		writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed")
+	}
+}
+
+// handleBans 处理封禁请求
+//
+//	GET    /bans                                   列出生效中的封禁
+//	POST   /bans     {"ip":"203.0.113.7","duration":"1h"}  手动封禁，duration 省略时按递增规则计算
+//	DELETE /bans?ip=203.0.113.7                    解除封禁
+func (ms *MonitorServer) handleBans(w http.ResponseWriter, r *http.Request) {
+	if ms.banProvider == nil {
+		writeJSONError(w, http.StatusServiceUnavailable, "封禁管理不可用")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		bans := ms.banProvider.ListBans()
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"count": len(bans),
+			"bans":  bans,
+		})
+
+	case http.MethodPost:
+		var request struct {
+			IP       string `json:"ip"`
+			Duration string `json:"duration"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			writeJSONError(w, http.StatusBadRequest, "无效的JSON")
+			return
+		}
+
+		var duration time.Duration
+		if request.Duration != "" {
+			var err error
+			duration, err = time.ParseDuration(request.Duration)
+			if err != nil || duration < 0 {
+				writeJSONError(w, http.StatusBadRequest, "无效的duration（示例: 30m, 24h）")
+				return
+			}
+		}
+
+		ban, err := ms.banProvider.BanIP(request.IP, duration)
+		if err != nil {
+			writeJSONError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		logger.Infof("监控API封禁 %s (来自 %s)", ban.IP, r.RemoteAddr)
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(ban)
+
+	case http.MethodDelete:
+		ip := r.URL.Query().Get("ip")
+		if ip == "" {
+			writeJSONError(w, http.StatusBadRequest, "缺少 ip 参数")
+			return
+		}
+
+		if err := ms.banProvider.UnbanIP(ip); err != nil {
+			if errors.Is(err, security.ErrBanNotFound) {
+				writeJSONError(w, http.StatusNotFound, err.Error())
+			} else {
+				writeJSONError(w, http.StatusBadRequest, err.Error())
+			}
+			return
+		}
+		logger.Infof("监控API解除封禁 %s (来自 %s)", ip, r.RemoteAddr)
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		w.Header().Set("Allow", "GET, POST, DELETE")
+		writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed")
+	}
+}
+
+// requireToken 要求请求携带API令牌后再交给 handler 处理
+func (ms *MonitorServer) requireToken(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if ms.authorizeAPI(w, r) {
+			handler(w, r)
+		}
+	}
+}
+
+// authorizeAPI 校验监控API请求，要求 Bearer 令牌；未配置令牌时拒绝所有请求。
+// 不按来源地址放行：经代理访问监控端口的请求同样来自本机回环地址
+func (ms *MonitorServer) authorizeAPI(w http.ResponseWriter, r *http.Request) bool {
+	if ms.apiToken == "" {
+		writeJSONError(w, http.StatusForbidden, "未配置 monitoring.api_token，监控API不可用")
+		return false
+	}
+
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if subtle.ConstantTimeCompare([]byte(token), []byte(ms.apiToken)) == 1 {
+		return true
+	}
+	w.Header().Set("WWW-Authenticate", `Bearer realm="hackmitm"`)
+	writeJSONError(w, http.StatusUnauthorized, "无效的API令牌")
+	return false
+}
+
+// writeJSONError 输出JSON格式的错误
+func writeJSONError(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"error": message})
+}
@@ -0,0 +1,62 @@
+package monitor
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"hackmitm/pkg/security"
+)
+
+// fakeBanProvider 不含封禁记录的封禁管理提供者
+type fakeBanProvider struct{}
+
+func (fakeBanProvider) ListBans() []security.Ban { return nil }
+
+func (fakeBanProvider) BanIP(ip string, duration time.Duration) (*security.Ban, error) {
+	return &security.Ban{IP: ip}, nil
+}
+
+func (fakeBanProvider) UnbanIP(ip string) error { return security.ErrBanNotFound }
+
+func TestMonitorAPIRequiresToken(t *testing.T) {
+	tests := []struct {
+		name          string
+		token         string
+		method        string
+		path          string
+		authorization string
+		want          int
+	}{
+		{name: "health无需令牌", method: "GET", path: "/health", want: 200},
+		{name: "未配置令牌时拒绝查询", method: "GET", path: "/status", want: 403},
+		{name: "未配置令牌时拒绝查看封禁", method: "GET", path: "/bans", want: 403},
+		{name: "未配置令牌时本机地址同样拒绝", method: "GET", path: "/metrics", authorization: "Bearer ", want: 403},
+		{name: "缺少令牌", token: "secret", method: "GET", path: "/status", want: 401},
+		{name: "令牌错误", token: "secret", method: "GET", path: "/bans", authorization: "Bearer wrong", want: 401},
+		{name: "令牌正确", token: "secret", method: "GET", path: "/bans", authorization: "Bearer secret", want: 200},
+		{name: "查看指纹统计需要令牌", token: "secret", method: "GET", path: "/fingerprint/stats", want: 401},
+		{name: "修改需要令牌", token: "secret", method: "POST", path: "/bans", want: 401},
+		{name: "令牌正确时可以修改", token: "secret", method: "DELETE", path: "/bans?ip=192.0.2.1", authorization: "Bearer secret", want: 404},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ms := NewMonitorServer("127.0.0.1", 0, NewMetrics(), NewHealthChecker())
+			ms.SetBanProvider(fakeBanProvider{})
+			ms.SetAPIToken(tt.token)
+
+			r := httptest.NewRequest(tt.method, tt.path, nil)
+			r.RemoteAddr = "127.0.0.1:50000"
+			if tt.authorization != "" {
+				r.Header.Set("Authorization", tt.authorization)
+			}
+			w := httptest.NewRecorder()
+			ms.handler().ServeHTTP(w, r)
+
+			if w.Code != tt.want {
+				t.Errorf("%s %s = %d, want %d (%s)", tt.method, tt.path, w.Code, tt.want, w.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,118 @@
+package monitor
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"hackmitm/pkg/flows"
+	"hackmitm/pkg/logger"
+)
+
+// FlowProvider 按用户隔离的流量记录提供者接口
+type FlowProvider interface {
+	AuthenticateFlowUser(r *http.Request) (string, error)
+	ListFlows(user string, limit int) []flows.Summary
+	ListAllFlows(limit int) []flows.Summary
+	GetFlow(id string) (*flows.Flow, bool)
+	ClearFlows(user string) int
+	ClearAllFlows() int
+}
+
+// SetFlowProvider 设置流量记录提供者，需在 Start 之前调用
+func (ms *MonitorServer) SetFlowProvider(provider FlowProvider) {
+	ms.flowProvider = provider
+}
+
+// handleFlows 处理流量记录请求
+//
+// 使用代理账号（Authorization: Basic）访问时只能看到和删除自己的流量；
+// 使用API令牌时为管理员，可查看所有用户的流量
+//
+//	GET    /flows?limit=100[&user=alice]  列出最近的流量摘要（user 仅管理员可用）
+//	GET    /flows/{id}                    获取流量详情（含请求/响应头和正文）
+//	DELETE /flows[?user=alice]            删除流量（管理员不带 user 时删除全部）
+func (ms *MonitorServer) handleFlows(w http.ResponseWriter, r *http.Request) {
+	if ms.flowProvider == nil {
+		writeJSONError(w, http.StatusServiceUnavailable, "流量记录不可用")
+		return
+	}
+
+	user, admin, ok := ms.authorizeFlows(w, r)
+	if !ok {
+		return
+	}
+	if admin {
+		user = r.URL.Query().Get("user")
+	}
+
+	id := strings.Trim(strings.TrimPrefix(r.URL.Path, "/flows"), "/")
+	switch {
+	case r.Method == http.MethodGet && id != "":
+		flow, exists := ms.flowProvider.GetFlow(id)
+		// 其他用户的流量与不存在的流量返回相同结果，不泄露其存在
+		if !exists || (!admin && flow.User != user) {
+			writeJSONError(w, http.StatusNotFound, "流量不存在: "+id)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(flow)
+
+	case r.Method == http.MethodGet:
+		limit := 100
+		if value := r.URL.Query().Get("limit"); value != "" {
+			parsed, err := strconv.Atoi(value)
+			if err != nil || parsed < 0 {
+				writeJSONError(w, http.StatusBadRequest, "无效的limit")
+				return
+			}
+			limit = parsed
+		}
+
+		var summaries []flows.Summary
+		if admin && user == "" {
+			summaries = ms.flowProvider.ListAllFlows(limit)
+		} else {
+			summaries = ms.flowProvider.ListFlows(user, limit)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"count": len(summaries),
+			"flows": summaries,
+		})
+
+	case r.Method == http.MethodDelete && id == "":
+		var removed int
+		if admin && user == "" {
+			removed = ms.flowProvider.ClearAllFlows()
+		} else {
+			removed = ms.flowProvider.ClearFlows(user)
+		}
+		logger.Infof("监控API删除 %d 条流量记录 (来自 %s)", removed, r.RemoteAddr)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{"removed": removed})
+
+	default:
+		w.Header().Set("Allow", "GET, DELETE")
+		writeJSONError(w, http.StatusMethodNotAllowed, "Method not allowed")
+	}
+}
+
+// authorizeFlows 校验流量记录请求，返回代理用户名或管理员身份
+func (ms *MonitorServer) authorizeFlows(w http.ResponseWriter, r *http.Request) (string, bool, bool) {
+	if strings.HasPrefix(r.Header.Get("Authorization"), "Basic ") {
+		user, err := ms.flowProvider.AuthenticateFlowUser(r)
+		if err != nil {
+			logger.Debugf("流量API认证失败: %v", err)
+			w.Header().Set("WWW-Authenticate", `Basic realm="hackmitm"`)
+			writeJSONError(w, http.StatusUnauthorized, "用户名或密码错误")
+			return "", false, false
+		}
+		return user, false, true
+	}
+	if !ms.authorizeAPI(w, r) {
+		return "", false, false
+	}
+	return "", true, true
+}
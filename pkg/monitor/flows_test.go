@@ -0,0 +1,123 @@
+package monitor
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"hackmitm/pkg/config"
+	"hackmitm/pkg/flows"
+)
+
+// fakeFlowProvider 使用内存流量存储与固定密码的流量记录提供者
+type fakeFlowProvider struct {
+	*flows.Store
+	passwords map[string]string
+}
+
+func (p *fakeFlowProvider) AuthenticateFlowUser(r *http.Request) (string, error) {
+	username, password, ok := r.BasicAuth()
+	if !ok || p.passwords[username] == "" || p.passwords[username] != password {
+		return "", errors.New("用户名或密码错误")
+	}
+	return username, nil
+}
+
+func (p *fakeFlowProvider) ListFlows(user string, limit int) []flows.Summary {
+	return p.List(user, limit)
+}
+
+func (p *fakeFlowProvider) ListAllFlows(limit int) []flows.Summary { return p.ListAll(limit) }
+
+func (p *fakeFlowProvider) GetFlow(id string) (*flows.Flow, bool) { return p.Get(id) }
+
+func (p *fakeFlowProvider) ClearFlows(user string) int { return p.Clear(user) }
+
+func (p *fakeFlowProvider) ClearAllFlows() int { return p.ClearAll() }
+
+func TestHandleFlowsIsolatesUsers(t *testing.T) {
+	tests := []struct {
+		name string
+		// as 使用的身份：代理用户名、"admin"（API令牌）或 "bad"（错误密码），为空时不认证
+		as     string
+		method string
+		// path 路径，{alice}、{bob} 替换为对应用户第一条流量的ID
+		path     string
+		want     int
+		wantURLs []string
+		// wantLeft 请求后剩余的流量数，按 alice、bob 顺序，nil 表示不检查
+		wantLeft []int
+	}{
+		{name: "用户只能列出自己的流量", as: "alice", method: "GET", path: "/flows", want: 200, wantURLs: []string{"a2", "a1"}},
+		{name: "用户不能通过user参数查看他人流量", as: "alice", method: "GET", path: "/flows?user=bob", want: 200, wantURLs: []string{"a2", "a1"}},
+		{name: "用户可以查看自己的流量详情", as: "alice", method: "GET", path: "/flows/{alice}", want: 200},
+		{name: "他人的流量与不存在的流量相同", as: "alice", method: "GET", path: "/flows/{bob}", want: 404},
+		{name: "用户只删除自己的流量", as: "bob", method: "DELETE", path: "/flows?user=alice", want: 200, wantLeft: []int{2, 0}},
+		{name: "密码错误", as: "bad", method: "GET", path: "/flows", want: 401},
+		{name: "未认证", method: "GET", path: "/flows", want: 401},
+		{name: "管理员列出所有流量", as: "admin", method: "GET", path: "/flows", want: 200, wantURLs: []string{"b1", "a2", "a1"}},
+		{name: "管理员按用户筛选", as: "admin", method: "GET", path: "/flows?user=bob", want: 200, wantURLs: []string{"b1"}},
+		{name: "管理员查看任意流量", as: "admin", method: "GET", path: "/flows/{bob}", want: 200},
+		{name: "管理员删除指定用户的流量", as: "admin", method: "DELETE", path: "/flows?user=alice", want: 200, wantLeft: []int{0, 1}},
+		{name: "管理员删除全部流量", as: "admin", method: "DELETE", path: "/flows", want: 200, wantLeft: []int{0, 0}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := flows.NewStore(config.FlowsConfig{Enabled: true})
+			for _, flow := range []*flows.Flow{{User: "alice", URL: "a1"}, {User: "alice", URL: "a2"}, {User: "bob", URL: "b1"}} {
+				store.Add(flow)
+			}
+			path := strings.NewReplacer("{alice}", store.List("alice", 0)[1].ID, "{bob}", store.List("bob", 0)[0].ID).Replace(tt.path)
+
+			ms := NewMonitorServer("127.0.0.1", 0, NewMetrics(), NewHealthChecker())
+			ms.SetAPIToken("secret")
+			ms.SetFlowProvider(&fakeFlowProvider{Store: store, passwords: map[string]string{"alice": "pa", "bob": "pb"}})
+
+			r := httptest.NewRequest(tt.method, path, nil)
+			switch tt.as {
+			case "":
+			case "admin":
+				r.Header.Set("Authorization", "Bearer secret")
+			case "bad":
+				r.SetBasicAuth("alice", "wrong")
+			default:
+				r.SetBasicAuth(tt.as, map[string]string{"alice": "pa", "bob": "pb"}[tt.as])
+			}
+			w := httptest.NewRecorder()
+			ms.handler().ServeHTTP(w, r)
+
+			if w.Code != tt.want {
+				t.Fatalf("%s %s = %d, want %d (%s)", tt.method, path, w.Code, tt.want, w.Body.String())
+			}
+			if tt.wantURLs != nil {
+				var body struct {
+					Flows []flows.Summary `json:"flows"`
+				}
+				if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+					t.Fatal(err)
+				}
+				var got []string
+				for _, summary := range body.Flows {
+					got = append(got, summary.URL)
+				}
+				if len(got) != len(tt.wantURLs) {
+					t.Fatalf("流量 = %v, want %v", got, tt.wantURLs)
+				}
+				for i := range got {
+					if got[i] != tt.wantURLs[i] {
+						t.Fatalf("流量 = %v, want %v", got, tt.wantURLs)
+					}
+				}
+			}
+			if tt.wantLeft != nil {
+				if left := []int{len(store.List("alice", 0)), len(store.List("bob", 0))}; left[0] != tt.wantLeft[0] || left[1] != tt.wantLeft[1] {
+					t.Errorf("剩余流量 = %v, want %v", left, tt.wantLeft)
+				}
+			}
+		})
+	}
+}
@@ -4,9 +4,12 @@ package monitor
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
+	"net"
 	"net/http"
 	"runtime"
+	"strconv"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -65,6 +68,22 @@ type HealthCheck interface {
 	Name() string
 }
 
+// HealthWarning 健康检查告警，不影响整体可用性
+// 检查返回该类型错误时整体状态为 degraded 而非 unhealthy，/health 仍返回 200
+type HealthWarning struct {
+	Message string
+}
+
+// Error 实现 error 接口
+func (w *HealthWarning) Error() string {
+	return w.Message
+}
+
+// NewHealthWarning 创建健康检查告警
+func NewHealthWarning(format string, args ...interface{}) *HealthWarning {
+	return &HealthWarning{Message: fmt.Sprintf(format, args...)}
+}
+
 // HealthStatus 健康状态
 type HealthStatus struct {
 	Status    string            `json:"status"`
@@ -79,7 +98,17 @@ type MonitorServer struct {
 	metrics       *Metrics
 	healthChecker *HealthChecker
 	server        *http.Server
+	listenAddr    string
 	port          int
+
+	// accessListProvider 访问列表管理提供者
+	accessListProvider AccessListProvider
+	// banProvider 封禁管理提供者
+	banProvider BanProvider
+	// flowProvider 流量记录提供者
+	flowProvider FlowProvider
+	// apiToken 监控API的访问令牌，为空时只有 /health 可用
+	apiToken string
 }
 
 // NewMetrics 创建指标收集器
@@ -99,11 +128,12 @@ func NewHealthChecker() *HealthChecker {
 	}
 }
 
-// NewMonitorServer 创建监控服务器
-func NewMonitorServer(port int, metrics *Metrics, healthChecker *HealthChecker) *MonitorServer {
+// NewMonitorServer 创建监控服务器，listenAddr 为空时监听所有地址
+func NewMonitorServer(listenAddr string, port int, metrics *Metrics, healthChecker *HealthChecker) *MonitorServer {
 	return &MonitorServer{
 		metrics:       metrics,
 		healthChecker: healthChecker,
+		listenAddr:    listenAddr,
 		port:          port,
 	}
 }
@@ -264,7 +294,14 @@ func (hc *HealthChecker) CheckHealth() HealthStatus {
 	checks := make(map[string]string)
 
 	for name, check := range hc.checks {
-		if err := check.Check(); err != nil {
+		err := check.Check()
+		var warning *HealthWarning
+		if errors.As(err, &warning) {
+			if status == "healthy" {
+				status = "degraded"
+			}
+			checks[name] = fmt.Sprintf("WARN: %v", err)
+		} else if err != nil {
 			status = "unhealthy"
 			checks[name] = fmt.Sprintf("FAIL: %v", err)
 		} else {
@@ -282,27 +319,35 @@ func (hc *HealthChecker) CheckHealth() HealthStatus {
 
 // Start 启动监控服务器
 func (ms *MonitorServer) Start() error {
-	mux := http.NewServeMux()
-
-	// 注册路由
-	mux.HandleFunc("/metrics", ms.handleMetrics)
-	mux.HandleFunc("/health", ms.handleHealth)
-	mux.HandleFunc("/status", ms.handleStatus)
-	mux.HandleFunc("/patterns", ms.handlePatterns)
-	mux.HandleFunc("/patterns/stats", ms.handlePatternStats)
-	mux.HandleFunc("/fingerprint", ms.handleFingerprint)
-	mux.HandleFunc("/fingerprint/stats", ms.handleFingerprintStats)
-	mux.HandleFunc("/fingerprint/identify", ms.handleFingerprintIdentify)
-
 	ms.server = &http.Server{
-		Addr:    fmt.Sprintf(":%d", ms.port),
-		Handler: mux,
+		Addr:    net.JoinHostPort(ms.listenAddr, strconv.Itoa(ms.port)),
+		Handler: ms.handler(),
 	}
 
-	logger.Infof("监控服务器启动在端口: %d", ms.port)
+	logger.Infof("监控服务器启动在: %s", ms.server.Addr)
 	return ms.server.ListenAndServe()
 }
 
+// handler 注册监控API路由
+func (ms *MonitorServer) handler() http.Handler {
+	mux := http.NewServeMux()
+
+	// 注册路由：/health 供探活使用无需认证，流量API自行区分代理用户与管理员，其余均需API令牌
+	mux.HandleFunc("/health", ms.handleHealth)
+	mux.HandleFunc("/metrics", ms.requireToken(ms.handleMetrics))
+	mux.HandleFunc("/status", ms.requireToken(ms.handleStatus))
+	mux.HandleFunc("/patterns", ms.requireToken(ms.handlePatterns))
+	mux.HandleFunc("/patterns/stats", ms.requireToken(ms.handlePatternStats))
+	mux.HandleFunc("/fingerprint", ms.requireToken(ms.handleFingerprint))
+	mux.HandleFunc("/fingerprint/stats", ms.requireToken(ms.handleFingerprintStats))
+	mux.HandleFunc("/fingerprint/identify", ms.requireToken(ms.handleFingerprintIdentify))
+	mux.HandleFunc("/access/", ms.requireToken(ms.handleAccessList))
+	mux.HandleFunc("/bans", ms.requireToken(ms.handleBans))
+	mux.HandleFunc("/flows", ms.handleFlows)
+	mux.HandleFunc("/flows/", ms.handleFlows)
+	return mux
+}
+
 // Stop 停止监控服务器
 func (ms *MonitorServer) Stop() error {
 	if ms.server != nil {
@@ -323,7 +368,8 @@ func (ms *MonitorServer) handleHealth(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	health := ms.healthChecker.CheckHealth()
 
-	if health.Status != "healthy" {
+	// degraded（如CA即将过期）时代理仍可正常工作，返回 200，只有 unhealthy 返回 503
+	if health.Status == "unhealthy" {
 		w.WriteHeader(http.StatusServiceUnavailable)
 	}
 
@@ -602,3 +648,41 @@ func (bpc *BufferPoolCheck) Check() error {
 
 	return nil
 }
+
+// CAExpiryProvider 提供CA证书过期时间
+type CAExpiryProvider interface {
+	CANotAfter() time.Time
+}
+
+// CAExpiryCheck CA证书到期检查
+type CAExpiryCheck struct {
+	provider   CAExpiryProvider
+	warnBefore time.Duration
+}
+
+// NewCAExpiryCheck 创建CA证书到期检查，到期前 warnBefore 内告警，过期后失败
+func NewCAExpiryCheck(provider CAExpiryProvider, warnBefore time.Duration) *CAExpiryCheck {
+	return &CAExpiryCheck{
+		provider:   provider,
+		warnBefore: warnBefore,
+	}
+}
+
+func (cc *CAExpiryCheck) Name() string {
+	return "ca_expiry"
+}
+
+func (cc *CAExpiryCheck) Check() error {
+	notAfter := cc.provider.CANotAfter()
+	remaining := time.Until(notAfter)
+
+	if remaining <= 0 {
+		return fmt.Errorf("CA证书已于 %s 过期", notAfter.Format(time.RFC3339))
+	}
+	if remaining <= cc.warnBefore {
+		return NewHealthWarning("CA证书将于 %s 过期（剩余 %d 天）",
+			notAfter.Format(time.RFC3339), int(remaining.Hours()/24))
+	}
+
+	return nil
+}
@@ -0,0 +1,58 @@
+package monitor
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http/httptest"
+	"testing"
+)
+
+// staticCheck 返回固定结果的健康检查
+type staticCheck struct {
+	name string
+	err  error
+}
+
+func (c staticCheck) Check() error { return c.err }
+
+func (c staticCheck) Name() string { return c.name }
+
+func TestHandleHealthStatusCode(t *testing.T) {
+	tests := []struct {
+		name       string
+		checks     []HealthCheck
+		wantStatus string
+		wantCode   int
+	}{
+		{name: "全部通过", checks: []HealthCheck{staticCheck{name: "memory"}}, wantStatus: "healthy", wantCode: 200},
+		{name: "告警不影响可用性", checks: []HealthCheck{
+			staticCheck{name: "memory"},
+			staticCheck{name: "ca_expiry", err: NewHealthWarning("CA证书将在 %d 天后过期", 10)},
+		}, wantStatus: "degraded", wantCode: 200},
+		{name: "失败优先于告警", checks: []HealthCheck{
+			staticCheck{name: "memory", err: errors.New("内存超限")},
+			staticCheck{name: "ca_expiry", err: NewHealthWarning("CA证书将在 %d 天后过期", 10)},
+		}, wantStatus: "unhealthy", wantCode: 503},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			healthChecker := NewHealthChecker()
+			for _, check := range tt.checks {
+				healthChecker.AddCheck(check)
+			}
+			ms := NewMonitorServer("127.0.0.1", 0, NewMetrics(), healthChecker)
+
+			w := httptest.NewRecorder()
+			ms.handler().ServeHTTP(w, httptest.NewRequest("GET", "/health", nil))
+
+			var health HealthStatus
+			if err := json.NewDecoder(w.Body).Decode(&health); err != nil {
+				t.Fatal(err)
+			}
+			if w.Code != tt.wantCode || health.Status != tt.wantStatus {
+				t.Errorf("/health = %d %s, want %d %s", w.Code, health.Status, tt.wantCode, tt.wantStatus)
+			}
+		})
+	}
+}
@@ -2,8 +2,12 @@
 package plugin
 
 import (
+	"bytes"
 	"context"
 	"fmt"
+	"io"
+	"net/http"
+	"strconv"
 	"time"
 
 	"hackmitm/pkg/logger"
@@ -127,3 +131,23 @@ func (bp *BasePlugin) IsStarted() bool {
 func (bp *BasePlugin) GetStartTime() time.Time {
 	return bp.startTime
 }
+
+// NewResponse 创建由插件直接返回给客户端的响应，用于 RequestContext.Response 和 FilterContext.Response；
+// header 可以为nil，会自动设置 Content-Length
+func NewResponse(req *http.Request, statusCode int, header http.Header, body []byte) *http.Response {
+	if header == nil {
+		header = make(http.Header)
+	}
+	header.Set("Content-Length", strconv.Itoa(len(body)))
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", statusCode, http.StatusText(statusCode)),
+		StatusCode:    statusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}
+}
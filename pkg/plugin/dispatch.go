@@ -0,0 +1,292 @@
+// Package plugin 修改器、日志和分析插件链
+package plugin
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"hackmitm/pkg/logger"
+)
+
+// 分析结果所属的阶段
+const (
+	PhaseRequest  = "request"
+	PhaseResponse = "response"
+)
+
+// ErrorContext.ErrorType 的取值，表示代理在哪个处理阶段出错
+const (
+	ErrorTypeFilterPlugin      = "filter_plugin"
+	ErrorTypeRequestPlugin     = "request_plugin"
+	ErrorTypeRequestProcessor  = "request_processor"
+	ErrorTypeUpstream          = "upstream"
+	ErrorTypeResponsePlugin    = "response_plugin"
+	ErrorTypeResponseProcessor = "response_processor"
+	ErrorTypeResponseCopy      = "response_copy"
+	ErrorTypeTLS               = "tls"
+	ErrorTypeWebSocket         = "websocket"
+)
+
+// PluginAnalysis 分析插件对一次请求或响应的分析结果
+type PluginAnalysis struct {
+	// Plugin 插件名称
+	Plugin string `json:"plugin"`
+	// Phase 分析的阶段（request 或 response）
+	Phase string `json:"phase"`
+	AnalysisResult
+}
+
+// analysisCounters 分析结果统计
+type analysisCounters struct {
+	results int64
+	threats int64
+}
+
+// pluginsOfType 复制指定类型的插件列表，返回列表和当前的插件选择器
+func (m *Manager) pluginsOfType(pluginType PluginType) ([]*PluginWrapper, PluginSelector) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	plugins := make([]*PluginWrapper, len(m.pluginsByType[pluginType]))
+	copy(plugins, m.pluginsByType[pluginType])
+	return plugins, m.selector
+}
+
+// active 插件已启动、对用户生效且未被熔断，返回 true 后必须通过 invoke 调用插件
+func (w *PluginWrapper) active(selector PluginSelector, username string) bool {
+	return w.Status == StatusStarted && selected(selector, w, username) && w.isolation.allow()
+}
+
+// ModifyRequest 执行修改器插件链的请求修改，任一插件出错或设置了 ctx.Response 时停止
+func (m *Manager) ModifyRequest(req *http.Request, ctx *RequestContext) error {
+	plugins, selector := m.pluginsOfType(TypeModifier)
+	for _, wrapper := range plugins {
+		modifierPlugin, ok := wrapper.Plugin.(ModifierPlugin)
+		if !ok || !wrapper.active(selector, ctx.Username) {
+			continue
+		}
+		err := wrapper.invoke(func(context.Context) error {
+			return modifierPlugin.ModifyRequest(req, ctx)
+		})
+		if err != nil {
+			logger.Errorf("修改器插件 %s 修改请求失败: %v", wrapper.Info.Name, err)
+			return err
+		}
+		if ctx.Response != nil {
+			logger.Debugf("修改器插件 %s 直接返回响应: %d", wrapper.Info.Name, ctx.Response.StatusCode)
+			return nil
+		}
+	}
+	return nil
+}
+
+// ModifyResponse 执行修改器插件链的响应修改，任一插件出错时停止并返回错误
+func (m *Manager) ModifyResponse(resp *http.Response, req *http.Request, ctx *ResponseContext) error {
+	plugins, selector := m.pluginsOfType(TypeModifier)
+	for _, wrapper := range plugins {
+		modifierPlugin, ok := wrapper.Plugin.(ModifierPlugin)
+		if !ok || !wrapper.active(selector, ctx.Username) {
+			continue
+		}
+		err := wrapper.invoke(func(context.Context) error {
+			return modifierPlugin.ModifyResponse(resp, req, ctx)
+		})
+		if err != nil {
+			logger.Errorf("修改器插件 %s 修改响应失败: %v", wrapper.Info.Name, err)
+			return err
+		}
+	}
+	return nil
+}
+
+// LogRequest 将即将转发的请求交给日志插件，日志插件的错误只记录不影响请求
+func (m *Manager) LogRequest(req *http.Request, ctx *RequestContext) {
+	plugins, selector := m.pluginsOfType(TypeLogger)
+	if len(plugins) == 0 {
+		return
+	}
+	body := bufferRequestBody(req)
+	for _, wrapper := range plugins {
+		loggerPlugin, ok := wrapper.Plugin.(LoggerPlugin)
+		if !ok || !wrapper.active(selector, ctx.Username) {
+			continue
+		}
+		err := wrapper.invoke(func(hookCtx context.Context) error {
+			return loggerPlugin.LogRequest(observedRequest(hookCtx, req, body), ctx.snapshot())
+		})
+		if err != nil {
+			logger.Errorf("日志插件 %s 记录请求失败: %v", wrapper.Info.Name, err)
+		}
+	}
+}
+
+// LogResponse 将已发送给客户端的响应交给日志插件
+func (m *Manager) LogResponse(resp *http.Response, req *http.Request, ctx *ResponseContext) {
+	plugins, selector := m.pluginsOfType(TypeLogger)
+	for _, wrapper := range plugins {
+		loggerPlugin, ok := wrapper.Plugin.(LoggerPlugin)
+		if !ok || !wrapper.active(selector, ctx.Username) {
+			continue
+		}
+		err := wrapper.invoke(func(hookCtx context.Context) error {
+			observed := observedRequest(hookCtx, req, nil)
+			return loggerPlugin.LogResponse(observedResponse(resp, observed), observed, ctx.snapshot())
+		})
+		if err != nil {
+			logger.Errorf("日志插件 %s 记录响应失败: %v", wrapper.Info.Name, err)
+		}
+	}
+}
+
+// LogError 将代理处理请求时的错误交给日志插件，req 可能为nil
+func (m *Manager) LogError(err error, req *http.Request, ctx *ErrorContext) {
+	if ctx.Timestamp.IsZero() {
+		ctx.Timestamp = time.Now()
+	}
+	if ctx.ErrorMessage == "" && err != nil {
+		ctx.ErrorMessage = err.Error()
+	}
+
+	plugins, selector := m.pluginsOfType(TypeLogger)
+	for _, wrapper := range plugins {
+		loggerPlugin, ok := wrapper.Plugin.(LoggerPlugin)
+		if !ok || !wrapper.active(selector, ctx.Username) {
+			continue
+		}
+		logErr := wrapper.invoke(func(hookCtx context.Context) error {
+			return loggerPlugin.LogError(err, observedRequest(hookCtx, req, nil), ctx.snapshot())
+		})
+		if logErr != nil {
+			logger.Errorf("日志插件 %s 记录错误失败: %v", wrapper.Info.Name, logErr)
+		}
+	}
+}
+
+// AnalyzeRequest 执行分析插件链，返回所有插件的分析结果；分析插件的错误只记录不影响请求
+func (m *Manager) AnalyzeRequest(req *http.Request, ctx *RequestContext) []*PluginAnalysis {
+	plugins, selector := m.pluginsOfType(TypeAnalytics)
+	if len(plugins) == 0 {
+		return nil
+	}
+	body := bufferRequestBody(req)
+	var results []*PluginAnalysis
+	for _, wrapper := range plugins {
+		analyticsPlugin, ok := wrapper.Plugin.(AnalyticsPlugin)
+		if !ok || !wrapper.active(selector, ctx.Username) {
+			continue
+		}
+		var result *AnalysisResult
+		err := wrapper.invoke(func(hookCtx context.Context) (err error) {
+			result, err = analyticsPlugin.AnalyzeRequest(observedRequest(hookCtx, req, body), ctx.snapshot())
+			return err
+		})
+		if err != nil {
+			logger.Errorf("分析插件 %s 分析请求失败: %v", wrapper.Info.Name, err)
+			continue
+		}
+		if analysis := m.collectAnalysis(wrapper, PhaseRequest, result); analysis != nil {
+			results = append(results, analysis)
+		}
+	}
+	return results
+}
+
+// AnalyzeResponse 执行分析插件链，返回所有插件对响应的分析结果
+func (m *Manager) AnalyzeResponse(resp *http.Response, req *http.Request, ctx *ResponseContext) []*PluginAnalysis {
+	plugins, selector := m.pluginsOfType(TypeAnalytics)
+	var results []*PluginAnalysis
+	for _, wrapper := range plugins {
+		analyticsPlugin, ok := wrapper.Plugin.(AnalyticsPlugin)
+		if !ok || !wrapper.active(selector, ctx.Username) {
+			continue
+		}
+		var result *AnalysisResult
+		err := wrapper.invoke(func(hookCtx context.Context) (err error) {
+			observed := observedRequest(hookCtx, req, nil)
+			result, err = analyticsPlugin.AnalyzeResponse(observedResponse(resp, observed), observed, ctx.snapshot())
+			return err
+		})
+		if err != nil {
+			logger.Errorf("分析插件 %s 分析响应失败: %v", wrapper.Info.Name, err)
+			continue
+		}
+		if analysis := m.collectAnalysis(wrapper, PhaseResponse, result); analysis != nil {
+			results = append(results, analysis)
+		}
+	}
+	return results
+}
+
+// bufferRequestBody 读出即将转发的请求正文并换成可重复读取的副本，
+// 供日志和分析插件在各自的请求副本中读取；读取失败时插件看不到正文
+func bufferRequestBody(req *http.Request) []byte {
+	if req == nil || req.Body == nil || req.Body == http.NoBody {
+		return nil
+	}
+	body, err := io.ReadAll(req.Body)
+	req.Body.Close()
+	req.Body = io.NopCloser(bytes.NewReader(body))
+	if err != nil {
+		logger.Errorf("读取请求正文失败: %v", err)
+		return nil
+	}
+	return body
+}
+
+// observedRequest 交给日志和分析插件的请求副本，不与代理转发的请求共享请求头、URL和正文，
+// 正文为 body 的只读副本（nil表示没有正文）；ctx 在插件调用超时后取消
+func observedRequest(ctx context.Context, req *http.Request, body []byte) *http.Request {
+	if req == nil {
+		return nil
+	}
+	clone := req.Clone(ctx)
+	clone.GetBody = nil
+	clone.Body = http.NoBody
+	if body != nil {
+		clone.Body = io.NopCloser(bytes.NewReader(body))
+	}
+	return clone
+}
+
+// observedResponse 交给日志和分析插件的响应副本：响应头独立，正文仍在发送给客户端，副本没有正文
+func observedResponse(resp *http.Response, req *http.Request) *http.Response {
+	if resp == nil {
+		return nil
+	}
+	clone := *resp
+	clone.Header = resp.Header.Clone()
+	clone.Trailer = resp.Trailer.Clone()
+	clone.Body = http.NoBody
+	clone.Request = req
+	return &clone
+}
+
+// collectAnalysis 统计分析结果并附上插件名称，插件未返回结果时为nil
+func (m *Manager) collectAnalysis(wrapper *PluginWrapper, phase string, result *AnalysisResult) *PluginAnalysis {
+	if result == nil {
+		return nil
+	}
+	analysis := &PluginAnalysis{Plugin: wrapper.Info.Name, Phase: phase, AnalysisResult: *result}
+	if analysis.Timestamp.IsZero() {
+		analysis.Timestamp = time.Now()
+	}
+
+	atomic.AddInt64(&m.analysis.results, 1)
+	if analysis.Threat {
+		atomic.AddInt64(&m.analysis.threats, 1)
+		logger.Warnf("分析插件 %s 发现威胁（%s，置信度 %.2f）: %s",
+			analysis.Plugin, analysis.ThreatLevel, analysis.Confidence, analysis.Description)
+	}
+	return analysis
+}
+
+// analysisStats 分析结果统计
+func (m *Manager) analysisStats() map[string]interface{} {
+	return map[string]interface{}{
+		"results": atomic.LoadInt64(&m.analysis.results),
+		"threats": atomic.LoadInt64(&m.analysis.threats),
+	}
+}
@@ -57,7 +57,8 @@ type FilterPlugin interface {
 	Priority() int
 }
 
-// LoggerPlugin 日志插件接口
+// LoggerPlugin 日志插件接口，收到的请求、响应和上下文都是副本，修改不影响代理；
+// 响应副本没有正文（正文可能仍在发送给客户端）
 // LoggerPlugin interface for logging plugins
 type LoggerPlugin interface {
 	Plugin
@@ -81,7 +82,7 @@ type ModifierPlugin interface {
 	Priority() int
 }
 
-// AnalyticsPlugin 分析插件接口
+// AnalyticsPlugin 分析插件接口，与日志插件一样只收到请求、响应和上下文的副本
 // AnalyticsPlugin interface for analytics plugins
 type AnalyticsPlugin interface {
 	Plugin
@@ -97,16 +98,27 @@ type AnalyticsPlugin interface {
 type RequestContext struct {
 	StartTime time.Time
 	ClientIP  string
+	// Username 代理认证的用户名，未启用认证时为空
+	Username string
+	// Policy 适用的用户策略名称，没有匹配的策略时为空
+	Policy    string
 	UserAgent string
 	Method    string
 	URL       string
 	Headers   map[string]string
 	Body      []byte
 	Metadata  map[string]interface{}
+	// Response 请求插件或修改器插件设置后不再执行后续插件，也不转发请求，
+	// 该响应代替上游响应继续经过响应插件链并发送给客户端，可用 NewResponse 创建
+	Response *http.Response `json:"-"`
 }
 
 // ResponseContext 响应上下文
 type ResponseContext struct {
+	// Username 代理认证的用户名，未启用认证时为空
+	Username string
+	// Policy 适用的用户策略名称
+	Policy     string
 	StatusCode int
 	Headers    map[string]string
 	Body       []byte
@@ -117,15 +129,27 @@ type ResponseContext struct {
 
 // FilterContext 过滤上下文
 type FilterContext struct {
-	ClientIP     string
+	ClientIP string
+	// Username 代理认证的用户名，未启用认证时为空
+	Username string
+	// Policy 适用的用户策略名称
+	Policy       string
 	UserAgent    string
 	RequestCount int64
 	LastRequest  time.Time
 	Metadata     map[string]interface{}
+	// Response 过滤插件设置后不再执行后续过滤插件，直接将该响应发送给客户端：
+	// 拒绝请求时作为拦截页面，允许请求时代替转发（如认证质询、模拟接口）
+	Response *http.Response `json:"-"`
 }
 
 // ErrorContext 错误上下文
 type ErrorContext struct {
+	// Username 代理认证的用户名，未启用认证时为空
+	Username string
+	// Policy 适用的用户策略名称
+	Policy string
+	// ErrorType 出错的处理阶段，如 upstream、request_plugin、response_copy
 	ErrorType    string
 	ErrorMessage string
 	StackTrace   string
@@ -133,6 +157,52 @@ type ErrorContext struct {
 	Metadata     map[string]interface{}
 }
 
+// snapshot 交给日志和分析插件的上下文副本，Headers 和 Metadata 不与代理共享，
+// 插件对副本的修改不影响代理（Body 与原上下文共享，只读）
+func (c *RequestContext) snapshot() *RequestContext {
+	clone := *c
+	clone.Headers = cloneStrings(c.Headers)
+	clone.Metadata = cloneMetadata(c.Metadata)
+	return &clone
+}
+
+// snapshot 交给日志和分析插件的响应上下文副本
+func (c *ResponseContext) snapshot() *ResponseContext {
+	clone := *c
+	clone.Headers = cloneStrings(c.Headers)
+	clone.Metadata = cloneMetadata(c.Metadata)
+	return &clone
+}
+
+// snapshot 交给日志插件的错误上下文副本
+func (c *ErrorContext) snapshot() *ErrorContext {
+	clone := *c
+	clone.Metadata = cloneMetadata(c.Metadata)
+	return &clone
+}
+
+func cloneStrings(m map[string]string) map[string]string {
+	if m == nil {
+		return nil
+	}
+	clone := make(map[string]string, len(m))
+	for k, v := range m {
+		clone[k] = v
+	}
+	return clone
+}
+
+func cloneMetadata(m map[string]interface{}) map[string]interface{} {
+	if m == nil {
+		return nil
+	}
+	clone := make(map[string]interface{}, len(m))
+	for k, v := range m {
+		clone[k] = v
+	}
+	return clone
+}
+
 // AnalysisResult 分析结果
 type AnalysisResult struct {
 	Threat      bool                   `json:"threat"`
@@ -164,6 +234,66 @@ type PluginConfig struct {
 	Path     string                 `json:"path"`
 	Config   map[string]interface{} `json:"config"`
 	Priority int                    `json:"priority"`
+	// Runtime 插件运行方式，见 Runtime* 常量，为空时为 native
+	Runtime string `json:"runtime"`
+	// Process 进程外插件选项
+	Process ProcessOptions `json:"process"`
+	// Wasm WebAssembly 插件选项
+	Wasm WasmOptions `json:"wasm"`
+	// Isolation 调用隔离选项
+	Isolation IsolationOptions `json:"isolation"`
+}
+
+// 插件运行方式
+const (
+	// RuntimeNative Go plugin（.so），与代理在同一进程中运行
+	RuntimeNative = "native"
+	// RuntimeProcess 独立的可执行文件，通过 JSON-RPC 与代理通信
+	RuntimeProcess = "process"
+	// RuntimeWasm WebAssembly 模块（.wasm），在代理进程内的沙箱中运行
+	RuntimeWasm = "wasm"
+	// RuntimeBuiltin 通过 Register 编译进二进制文件的插件，按名称或路径查找
+	RuntimeBuiltin = "builtin"
+)
+
+// ProcessOptions 进程外插件选项，零值字段使用默认值
+type ProcessOptions struct {
+	// Args 启动参数
+	Args []string `json:"args"`
+	// Env 额外的环境变量
+	Env map[string]string `json:"env"`
+	// Transport 通信方式：stdio（默认）或 unix
+	Transport string `json:"transport"`
+	// CallTimeout 单次调用超时，默认5秒
+	CallTimeout time.Duration `json:"call_timeout"`
+	// HealthInterval 健康检查间隔，默认10秒
+	HealthInterval time.Duration `json:"health_interval"`
+	// MaxRestarts 连续重启次数上限，超过后不再重启；默认5，负数表示不限制
+	MaxRestarts int `json:"max_restarts"`
+	// MaxBodySize 发送给插件的最大正文字节数，超过时不发送正文；默认1MB
+	MaxBodySize int `json:"max_body_size"`
+}
+
+// WasmOptions WebAssembly 插件选项，零值字段使用默认值
+type WasmOptions struct {
+	// MaxMemory 每个实例的最大内存字节数，默认64MB
+	MaxMemory int `json:"max_memory"`
+	// CallTimeout 单次钩子调用的最长执行时间，默认1秒
+	CallTimeout time.Duration `json:"call_timeout"`
+	// MaxBodySize 插件可读取和修改的最大正文字节数，默认1MB
+	MaxBodySize int `json:"max_body_size"`
+}
+
+// IsolationOptions 插件调用隔离选项，零值字段使用默认值
+type IsolationOptions struct {
+	// CallTimeout 单次钩子调用超时，默认5秒，负数表示不限制
+	CallTimeout time.Duration `json:"call_timeout"`
+	// ErrorThreshold 触发熔断的错误率（0-1），默认0.5
+	ErrorThreshold float64 `json:"error_threshold"`
+	// Window 计算错误率的最近调用次数，默认20，负数表示不熔断
+	Window int `json:"window"`
+	// OpenDuration 熔断后暂停调用的时间，之后放行一次试探调用，默认30秒
+	OpenDuration time.Duration `json:"open_duration"`
 }
 
 // PluginStatus 插件状态
@@ -190,6 +320,17 @@ const (
 	TypeAnalytics PluginType = "analytics"
 )
 
+// HookProvider 声明插件实际处理的钩子类型，实现该接口的插件只加入声明的类型分组
+// 用于同时实现所有钩子方法的代理插件（如进程外插件）
+type HookProvider interface {
+	Hooks() []PluginType
+}
+
+// RuntimeStatsProvider 提供运行时统计信息的插件，统计信息出现在插件管理器的 runtime 字段中
+type RuntimeStatsProvider interface {
+	RuntimeStats() map[string]interface{}
+}
+
 // LoaderFunc 插件加载器函数类型
 type LoaderFunc func() Plugin
 
@@ -0,0 +1,312 @@
+// Package plugin 插件调用隔离：超时、panic恢复和熔断
+package plugin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"runtime/debug"
+	"sort"
+	"sync"
+	"time"
+
+	"hackmitm/pkg/audit"
+	"hackmitm/pkg/logger"
+)
+
+// 熔断器状态
+const (
+	// CircuitClosed 正常调用插件
+	CircuitClosed = "closed"
+	// CircuitOpen 错误率超过阈值，暂停调用插件
+	CircuitOpen = "open"
+	// CircuitHalfOpen 暂停时间已过，放行一次试探调用
+	CircuitHalfOpen = "half_open"
+)
+
+// latencySamples 每个插件保留的最近调用耗时样本数，用于计算延迟分位数
+const latencySamples = 1024
+
+// errPluginTimeout 插件调用超时
+var errPluginTimeout = errors.New("插件调用超时")
+
+// errPluginPanic 插件调用发生panic
+var errPluginPanic = errors.New("插件调用发生panic")
+
+// withDefaults 返回填充默认值后的选项
+func (o IsolationOptions) withDefaults() IsolationOptions {
+	if o.CallTimeout == 0 {
+		o.CallTimeout = 5 * time.Second
+	}
+	if o.ErrorThreshold <= 0 {
+		o.ErrorThreshold = 0.5
+	}
+	if o.Window == 0 {
+		o.Window = 20
+	}
+	if o.OpenDuration <= 0 {
+		o.OpenDuration = 30 * time.Second
+	}
+	return o
+}
+
+// pluginIsolation 插件调用隔离状态：调用结果窗口、熔断器和耗时样本
+type pluginIsolation struct {
+	// options 隔离选项
+	options IsolationOptions
+	mutex   sync.Mutex
+	// state 熔断器状态
+	state string
+	// outcomes 最近调用是否失败的环形缓冲区
+	outcomes []bool
+	// outcomeNext 下一个写入位置
+	outcomeNext int
+	// outcomeCount 窗口中的调用数
+	outcomeCount int
+	// failures 窗口中的失败数
+	failures int
+	// openedAt 熔断器打开的时间
+	openedAt time.Time
+	// probing 半开状态下的试探调用正在进行
+	probing bool
+	// trips 熔断次数
+	trips int64
+	// timeouts 超时次数
+	timeouts int64
+	// panics panic次数
+	panics int64
+	// latencies 最近调用耗时的环形缓冲区
+	latencies []time.Duration
+	// latencyNext 下一个写入位置
+	latencyNext int
+}
+
+// newPluginIsolation 创建插件调用隔离状态
+func newPluginIsolation(options IsolationOptions) *pluginIsolation {
+	options = options.withDefaults()
+	isolation := &pluginIsolation{
+		options:   options,
+		state:     CircuitClosed,
+		latencies: make([]time.Duration, 0, latencySamples),
+	}
+	if options.Window > 0 {
+		isolation.outcomes = make([]bool, options.Window)
+	}
+	return isolation
+}
+
+// allow 熔断器是否放行本次调用；打开状态超过暂停时间后转为半开并放行一次试探调用。
+// 返回 true 后必须调用 record，否则半开状态无法结束
+func (i *pluginIsolation) allow() bool {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+
+	switch i.state {
+	case CircuitOpen:
+		if time.Since(i.openedAt) < i.options.OpenDuration {
+			return false
+		}
+		i.state = CircuitHalfOpen
+		i.probing = true
+		return true
+	case CircuitHalfOpen:
+		if i.probing {
+			return false
+		}
+		i.probing = true
+		return true
+	}
+	return true
+}
+
+// call 调用插件钩子：恢复panic，超过调用超时后取消 ctx 并放弃等待。
+// 超时的钩子仍在后台运行直到返回，其结果被丢弃。因此可修改流量的钩子（请求、响应、修改器、过滤）
+// 超时后请求按失败处理不再转发；日志和分析钩子只收到请求和响应的副本（见 observedRequest），
+// 代理继续处理时不与仍在运行的钩子共享状态
+func (i *pluginIsolation) call(hook func(ctx context.Context) error) error {
+	timeout := i.options.CallTimeout
+	if timeout < 0 {
+		return recoverCall(context.Background(), hook)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	done := make(chan error, 1)
+	go func() {
+		done <- recoverCall(ctx, hook)
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return fmt.Errorf("%w: 超过 %v", errPluginTimeout, timeout)
+	}
+}
+
+// recoverCall 调用钩子并将panic转换为错误
+func recoverCall(ctx context.Context, hook func(ctx context.Context) error) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			logger.Errorf("插件调用发生panic: %v\n%s", r, debug.Stack())
+			err = fmt.Errorf("%w: %v", errPluginPanic, r)
+		}
+	}()
+	return hook(ctx)
+}
+
+// record 记录调用结果和耗时，返回熔断器是否因本次失败的调用打开或从半开恢复
+func (i *pluginIsolation) record(err error, elapsed time.Duration) (opened, recovered bool) {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+
+	if len(i.latencies) < latencySamples {
+		i.latencies = append(i.latencies, elapsed)
+	} else {
+		i.latencies[i.latencyNext] = elapsed
+	}
+	i.latencyNext = (i.latencyNext + 1) % latencySamples
+
+	if errors.Is(err, errPluginTimeout) {
+		i.timeouts++
+	} else if errors.Is(err, errPluginPanic) {
+		i.panics++
+	}
+
+	if i.state == CircuitHalfOpen {
+		i.probing = false
+		if err != nil {
+			i.open()
+			return true, false
+		}
+		i.state = CircuitClosed
+		i.resetWindow()
+		return false, true
+	}
+	if i.outcomes == nil {
+		return false, false
+	}
+
+	failed := err != nil
+	if i.outcomeCount == len(i.outcomes) {
+		if i.outcomes[i.outcomeNext] {
+			i.failures--
+		}
+	} else {
+		i.outcomeCount++
+	}
+	i.outcomes[i.outcomeNext] = failed
+	i.outcomeNext = (i.outcomeNext + 1) % len(i.outcomes)
+	if failed {
+		i.failures++
+	}
+
+	// 窗口填满后才判断错误率，避免刚启动时少量错误就触发熔断
+	if failed && i.outcomeCount == len(i.outcomes) &&
+		float64(i.failures)/float64(i.outcomeCount) >= i.options.ErrorThreshold {
+		i.open()
+		return true, false
+	}
+	return false, false
+}
+
+// open 打开熔断器（调用方持有锁）
+func (i *pluginIsolation) open() {
+	i.state = CircuitOpen
+	i.openedAt = time.Now()
+	i.trips++
+	i.resetWindow()
+}
+
+// resetWindow 清空调用结果窗口（调用方持有锁）
+func (i *pluginIsolation) resetWindow() {
+	for j := range i.outcomes {
+		i.outcomes[j] = false
+	}
+	i.outcomeNext = 0
+	i.outcomeCount = 0
+	i.failures = 0
+}
+
+// reset 关闭熔断器，插件重新启动时调用
+func (i *pluginIsolation) reset() {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+	i.state = CircuitClosed
+	i.probing = false
+	i.resetWindow()
+}
+
+// stats 隔离统计：熔断器状态、超时和panic次数以及延迟分位数
+func (i *pluginIsolation) stats() map[string]interface{} {
+	i.mutex.Lock()
+	samples := make([]time.Duration, len(i.latencies))
+	copy(samples, i.latencies)
+	stats := map[string]interface{}{
+		"circuit":       i.state,
+		"circuit_trips": i.trips,
+		"timeouts":      i.timeouts,
+		"panics":        i.panics,
+	}
+	if i.state == CircuitOpen {
+		stats["retry_at"] = i.openedAt.Add(i.options.OpenDuration).Format(time.RFC3339)
+	}
+	i.mutex.Unlock()
+
+	sort.Slice(samples, func(a, b int) bool { return samples[a] < samples[b] })
+	stats["latency"] = map[string]interface{}{
+		"samples": len(samples),
+		"p50_ms":  percentileMillis(samples, 0.50),
+		"p90_ms":  percentileMillis(samples, 0.90),
+		"p99_ms":  percentileMillis(samples, 0.99),
+		"max_ms":  percentileMillis(samples, 1),
+	}
+	return stats
+}
+
+// percentileMillis 已排序样本的分位数（毫秒），无样本时为0
+func percentileMillis(sorted []time.Duration, p float64) float64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+	index := int(math.Ceil(p*float64(len(sorted)))) - 1
+	if index < 0 {
+		index = 0
+	}
+	return float64(sorted[index].Microseconds()) / 1000
+}
+
+// invoke 在隔离下调用插件钩子并记录结果，ctx 在调用超时后取消；
+// panic和超时记入 Error，错误率超过阈值时打开熔断器暂停调用该插件
+func (w *PluginWrapper) invoke(hook func(ctx context.Context) error) error {
+	start := time.Now()
+	err := w.isolation.call(hook)
+	opened, recovered := w.isolation.record(err, time.Since(start))
+
+	w.mutex.Lock()
+	w.CallCount++
+	if err != nil {
+		w.ErrorCount++
+		if errors.Is(err, errPluginTimeout) || errors.Is(err, errPluginPanic) {
+			w.Error = err
+		}
+	}
+	if opened {
+		w.Error = fmt.Errorf("错误率超过阈值，暂停调用 %v: %w", w.isolation.options.OpenDuration, err)
+	} else if recovered {
+		w.Error = nil
+	}
+	w.mutex.Unlock()
+
+	if recovered {
+		logger.Infof("插件 %s 试探调用成功，恢复调用", w.Info.Name)
+	}
+	if opened {
+		logger.Warnf("插件 %s 错误率超过阈值，暂停调用 %v", w.Info.Name, w.isolation.options.OpenDuration)
+		audit.Record(audit.Event{Type: audit.TypePlugin, Action: "circuit_open", Target: w.Config.Name,
+			Reason: err.Error()})
+	}
+	return err
+}
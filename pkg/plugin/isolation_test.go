@@ -0,0 +1,178 @@
+package plugin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestIsolationCall(t *testing.T) {
+	hookErr := errors.New("插件返回错误")
+	tests := []struct {
+		name    string
+		timeout time.Duration
+		hook    func(ctx context.Context) error
+		want    error
+	}{
+		{name: "调用成功", hook: func(context.Context) error { return nil }},
+		{name: "插件错误原样返回", hook: func(context.Context) error { return hookErr }, want: hookErr},
+		{name: "panic转换为错误", hook: func(context.Context) error { panic("boom") }, want: errPluginPanic},
+		{
+			name:    "超时",
+			timeout: 20 * time.Millisecond,
+			hook: func(ctx context.Context) error {
+				<-ctx.Done()
+				return nil
+			},
+			want: errPluginTimeout,
+		},
+		{
+			name:    "超时为负数时不限制",
+			timeout: -1,
+			hook: func(ctx context.Context) error {
+				time.Sleep(30 * time.Millisecond)
+				return ctx.Err()
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			isolation := newPluginIsolation(IsolationOptions{CallTimeout: tt.timeout})
+			if err := isolation.call(tt.hook); !errors.Is(err, tt.want) {
+				t.Errorf("call() error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsolationTimeoutCancelsContext(t *testing.T) {
+	isolation := newPluginIsolation(IsolationOptions{CallTimeout: 20 * time.Millisecond})
+	cancelled := make(chan struct{})
+	release := make(chan struct{})
+	defer close(release)
+
+	err := isolation.call(func(ctx context.Context) error {
+		<-ctx.Done()
+		close(cancelled)
+		<-release
+		return nil
+	})
+	if !errors.Is(err, errPluginTimeout) {
+		t.Fatalf("call() error = %v, want errPluginTimeout", err)
+	}
+	select {
+	case <-cancelled:
+	case <-time.After(time.Second):
+		t.Fatal("超时后未取消钩子的 ctx")
+	}
+}
+
+func TestIsolationCircuitBreaker(t *testing.T) {
+	failed := errors.New("失败")
+	isolation := newPluginIsolation(IsolationOptions{Window: 4, ErrorThreshold: 0.5, OpenDuration: 30 * time.Millisecond})
+
+	// 窗口未填满时不打开
+	for _, err := range []error{nil, nil, failed} {
+		if opened, _ := isolation.record(err, time.Millisecond); opened {
+			t.Fatal("窗口未填满时打开了熔断器")
+		}
+	}
+	if opened, _ := isolation.record(fmt.Errorf("%w: 超过 1s", errPluginTimeout), time.Second); !opened {
+		t.Fatal("错误率达到阈值时未打开熔断器")
+	}
+	if isolation.allow() {
+		t.Fatal("熔断器打开时放行了调用")
+	}
+
+	// 暂停时间过后放行一次试探调用，试探失败重新打开
+	time.Sleep(40 * time.Millisecond)
+	if !isolation.allow() {
+		t.Fatal("暂停时间过后未放行试探调用")
+	}
+	if isolation.allow() {
+		t.Fatal("半开状态放行了第二次调用")
+	}
+	if opened, _ := isolation.record(failed, time.Millisecond); !opened {
+		t.Fatal("试探调用失败时未重新打开熔断器")
+	}
+
+	// 试探成功后关闭
+	time.Sleep(40 * time.Millisecond)
+	if !isolation.allow() {
+		t.Fatal("暂停时间过后未放行试探调用")
+	}
+	if _, recovered := isolation.record(nil, time.Millisecond); !recovered {
+		t.Fatal("试探调用成功时未恢复")
+	}
+	if !isolation.allow() || !isolation.allow() {
+		t.Fatal("恢复后未放行调用")
+	}
+
+	stats := isolation.stats()
+	if stats["circuit"] != CircuitClosed || stats["circuit_trips"] != int64(2) || stats["timeouts"] != int64(1) {
+		t.Errorf("stats() = %v", stats)
+	}
+}
+
+// hangingLogger 修改收到的请求和上下文并一直阻塞的日志插件
+type hangingLogger struct {
+	BasePlugin
+	release chan struct{}
+	// body 插件读到的请求正文
+	body chan string
+}
+
+func (l *hangingLogger) LogRequest(req *http.Request, ctx *RequestContext) error {
+	data, _ := io.ReadAll(req.Body)
+	req.Header.Set("X-Logger", "1")
+	req.URL.Path = "/changed"
+	ctx.Metadata["logger"] = true
+	l.body <- string(data)
+	<-l.release
+	return nil
+}
+
+func (l *hangingLogger) LogResponse(resp *http.Response, req *http.Request, ctx *ResponseContext) error {
+	return nil
+}
+
+func (l *hangingLogger) LogError(err error, req *http.Request, ctx *ErrorContext) error {
+	return nil
+}
+
+func TestLogRequestTimeoutDoesNotShareRequest(t *testing.T) {
+	hung := &hangingLogger{release: make(chan struct{}), body: make(chan string, 1)}
+	defer close(hung.release)
+
+	wrapper := &PluginWrapper{
+		Plugin:    hung,
+		Info:      &PluginInfo{Name: "hanging"},
+		Config:    &PluginConfig{Name: "hanging"},
+		Status:    StatusStarted,
+		isolation: newPluginIsolation(IsolationOptions{CallTimeout: 20 * time.Millisecond}),
+	}
+	m := NewManager(t.TempDir())
+	m.pluginsByType[TypeLogger] = []*PluginWrapper{wrapper}
+
+	req := httptest.NewRequest("POST", "http://example.test/a", strings.NewReader("payload"))
+	ctx := &RequestContext{Metadata: map[string]interface{}{}}
+	m.LogRequest(req, ctx)
+
+	if got := <-hung.body; got != "payload" {
+		t.Errorf("插件读到的正文 = %q, want payload", got)
+	}
+	body, _ := io.ReadAll(req.Body)
+	if string(body) != "payload" || req.Header.Get("X-Logger") != "" || req.URL.Path != "/a" || ctx.Metadata["logger"] != nil {
+		t.Errorf("插件修改了代理转发的请求: path %s, header %v, body %q, metadata %v", req.URL.Path, req.Header, body, ctx.Metadata)
+	}
+	if wrapper.ErrorCount != 1 || !errors.Is(wrapper.Error, errPluginTimeout) {
+		t.Errorf("ErrorCount = %d, Error = %v", wrapper.ErrorCount, wrapper.Error)
+	}
+}
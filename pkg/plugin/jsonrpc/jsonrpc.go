@@ -0,0 +1,238 @@
+// Package jsonrpc 进程外插件使用的 JSON-RPC 2.0 连接，消息为逐行的 JSON 对象
+// Package jsonrpc implements a bidirectional, newline-delimited JSON-RPC 2.0 connection
+package jsonrpc
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"sync"
+)
+
+// Version JSON-RPC 协议版本
+const Version = "2.0"
+
+// 标准错误码
+const (
+	CodeParseError     = -32700
+	CodeInvalidRequest = -32600
+	CodeMethodNotFound = -32601
+	CodeInvalidParams  = -32602
+	CodeInternalError  = -32603
+)
+
+// ErrClosed 连接已关闭
+var ErrClosed = errors.New("JSON-RPC 连接已关闭")
+
+// maxMessageSize 单条消息的最大字节数
+const maxMessageSize = 64 * 1024 * 1024
+
+// Message JSON-RPC 请求、通知或响应
+type Message struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method,omitempty"`
+	Params  json.RawMessage `json:"params,omitempty"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *Error          `json:"error,omitempty"`
+}
+
+// Error JSON-RPC 错误对象
+type Error struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// Error 实现 error 接口
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s (code %d)", e.Message, e.Code)
+}
+
+// Handler 处理对端发来的请求，返回的 *Error 原样发送，其他错误作为内部错误发送
+type Handler func(ctx context.Context, method string, params json.RawMessage) (interface{}, error)
+
+// Conn 双向 JSON-RPC 连接，两端都可以发起调用
+type Conn struct {
+	rwc     io.ReadWriteCloser
+	handler Handler
+
+	writeMutex sync.Mutex
+	encoder    *json.Encoder
+
+	mutex   sync.Mutex
+	nextID  uint64
+	pending map[string]chan *Message
+	err     error
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// NewConn 创建连接并开始读取消息，handler 为nil时拒绝对端的所有调用
+func NewConn(rwc io.ReadWriteCloser, handler Handler) *Conn {
+	ctx, cancel := context.WithCancel(context.Background())
+	c := &Conn{
+		rwc:     rwc,
+		handler: handler,
+		encoder: json.NewEncoder(rwc),
+		pending: make(map[string]chan *Message),
+		ctx:     ctx,
+		cancel:  cancel,
+		done:    make(chan struct{}),
+	}
+	go c.readLoop()
+	return c
+}
+
+// Call 调用对端方法并等待结果，ctx 结束时返回 ctx 的错误
+func (c *Conn) Call(ctx context.Context, method string, params, result interface{}) error {
+	rawParams, err := json.Marshal(params)
+	if err != nil {
+		return fmt.Errorf("编码 %s 参数失败: %w", method, err)
+	}
+
+	c.mutex.Lock()
+	if c.err != nil {
+		c.mutex.Unlock()
+		return c.err
+	}
+	c.nextID++
+	id := strconv.FormatUint(c.nextID, 10)
+	reply := make(chan *Message, 1)
+	c.pending[id] = reply
+	c.mutex.Unlock()
+
+	defer func() {
+		c.mutex.Lock()
+		delete(c.pending, id)
+		c.mutex.Unlock()
+	}()
+
+	if err := c.write(&Message{JSONRPC: Version, ID: json.RawMessage(id), Method: method, Params: rawParams}); err != nil {
+		return err
+	}
+
+	select {
+	case msg := <-reply:
+		if msg.Error != nil {
+			return msg.Error
+		}
+		if result != nil && len(msg.Result) > 0 {
+			if err := json.Unmarshal(msg.Result, result); err != nil {
+				return fmt.Errorf("解码 %s 结果失败: %w", method, err)
+			}
+		}
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("调用 %s: %w", method, ctx.Err())
+	case <-c.done:
+		return c.Err()
+	}
+}
+
+// Done 连接关闭时关闭的通道
+func (c *Conn) Done() <-chan struct{} {
+	return c.done
+}
+
+// Err 连接关闭的原因，连接未关闭时为nil
+func (c *Conn) Err() error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.err
+}
+
+// Close 关闭连接
+func (c *Conn) Close() error {
+	err := c.rwc.Close()
+	<-c.done
+	return err
+}
+
+// write 发送一条消息
+func (c *Conn) write(msg *Message) error {
+	c.writeMutex.Lock()
+	defer c.writeMutex.Unlock()
+	if err := c.encoder.Encode(msg); err != nil {
+		return fmt.Errorf("发送JSON-RPC消息失败: %w", err)
+	}
+	return nil
+}
+
+// readLoop 读取消息：响应交给等待的调用，请求交给 handler 并发处理
+func (c *Conn) readLoop() {
+	scanner := bufio.NewScanner(c.rwc)
+	scanner.Buffer(make([]byte, 64*1024), maxMessageSize)
+
+	var err error
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if len(line) == 0 {
+			continue
+		}
+
+		var msg Message
+		if jsonErr := json.Unmarshal(line, &msg); jsonErr != nil {
+			c.write(&Message{JSONRPC: Version, ID: json.RawMessage("null"),
+				Error: &Error{Code: CodeParseError, Message: jsonErr.Error()}})
+			continue
+		}
+
+		if msg.Method == "" {
+			c.mutex.Lock()
+			reply := c.pending[string(msg.ID)]
+			c.mutex.Unlock()
+			if reply != nil {
+				reply <- &msg
+			}
+			continue
+		}
+		go c.handle(&msg)
+	}
+	if err = scanner.Err(); err == nil {
+		err = io.EOF
+	}
+
+	c.mutex.Lock()
+	c.err = fmt.Errorf("%w: %v", ErrClosed, err)
+	c.mutex.Unlock()
+	c.cancel()
+	close(c.done)
+}
+
+// handle 处理对端的请求，没有ID的通知不发送响应
+func (c *Conn) handle(msg *Message) {
+	var result interface{}
+	var err error
+	if c.handler == nil {
+		err = &Error{Code: CodeMethodNotFound, Message: "不支持的方法: " + msg.Method}
+	} else {
+		result, err = c.handler(c.ctx, msg.Method, msg.Params)
+	}
+
+	if len(msg.ID) == 0 {
+		return
+	}
+
+	reply := &Message{JSONRPC: Version, ID: msg.ID}
+	if err != nil {
+		var rpcErr *Error
+		if !errors.As(err, &rpcErr) {
+			rpcErr = &Error{Code: CodeInternalError, Message: err.Error()}
+		}
+		reply.Error = rpcErr
+	} else {
+		raw, marshalErr := json.Marshal(result)
+		if marshalErr != nil {
+			reply.Error = &Error{Code: CodeInternalError, Message: marshalErr.Error()}
+		} else {
+			reply.Result = raw
+		}
+	}
+	c.write(reply)
+}
@@ -0,0 +1,262 @@
+package jsonrpc
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newPeer 创建连接及直接读写原始行的对端
+func newPeer(t *testing.T, handler Handler) (*Conn, net.Conn, *bufio.Reader) {
+	t.Helper()
+	local, peer := net.Pipe()
+	peer.SetDeadline(time.Now().Add(5 * time.Second))
+	conn := NewConn(local, handler)
+	t.Cleanup(func() {
+		peer.Close()
+		conn.Close()
+	})
+	return conn, peer, bufio.NewReader(peer)
+}
+
+// writeLine 对端发送一行原始消息
+func writeLine(t *testing.T, peer net.Conn, line string) {
+	t.Helper()
+	if _, err := peer.Write([]byte(line + "\n")); err != nil {
+		t.Fatalf("写入 %s 失败: %v", line, err)
+	}
+}
+
+// readLine 对端读取一行原始消息
+func readLine(t *testing.T, reader *bufio.Reader) string {
+	t.Helper()
+	line, err := reader.ReadString('\n')
+	if err != nil {
+		t.Fatalf("读取消息失败: %v", err)
+	}
+	return strings.TrimSuffix(line, "\n")
+}
+
+func TestConnServesRequests(t *testing.T) {
+	handler := func(ctx context.Context, method string, params json.RawMessage) (interface{}, error) {
+		switch method {
+		case "echo":
+			return params, nil
+		case "rpc_error":
+			return nil, &Error{Code: CodeInvalidParams, Message: "参数无效"}
+		case "fail":
+			return nil, errors.New("内部失败")
+		case "nothing":
+			return nil, nil
+		}
+		return nil, &Error{Code: CodeMethodNotFound, Message: "不支持的方法: " + method}
+	}
+
+	tests := []struct {
+		name string
+		// noHandler 不设置 handler
+		noHandler bool
+		request   string
+		// want 期望的完整响应行，为空时比较 wantPrefix
+		want       string
+		wantPrefix string
+	}{
+		{
+			name:    "数字ID原样返回",
+			request: `{"jsonrpc":"2.0","id":7,"method":"echo","params":{"a":1}}`,
+			want:    `{"jsonrpc":"2.0","id":7,"result":{"a":1}}`,
+		},
+		{
+			name:    "字符串ID原样返回",
+			request: `{"jsonrpc":"2.0","id":"req-1","method":"echo","params":[1,"x"]}`,
+			want:    `{"jsonrpc":"2.0","id":"req-1","result":[1,"x"]}`,
+		},
+		{
+			name:    "空结果编码为null",
+			request: `{"jsonrpc":"2.0","id":1,"method":"nothing"}`,
+			want:    `{"jsonrpc":"2.0","id":1,"result":null}`,
+		},
+		{
+			name:    "handler返回的JSON-RPC错误原样发送",
+			request: `{"jsonrpc":"2.0","id":2,"method":"rpc_error"}`,
+			want:    `{"jsonrpc":"2.0","id":2,"error":{"code":-32602,"message":"参数无效"}}`,
+		},
+		{
+			name:    "其他错误作为内部错误发送",
+			request: `{"jsonrpc":"2.0","id":3,"method":"fail"}`,
+			want:    `{"jsonrpc":"2.0","id":3,"error":{"code":-32603,"message":"内部失败"}}`,
+		},
+		{
+			name:      "没有handler时拒绝调用",
+			noHandler: true,
+			request:   `{"jsonrpc":"2.0","id":4,"method":"echo"}`,
+			want:      `{"jsonrpc":"2.0","id":4,"error":{"code":-32601,"message":"不支持的方法: echo"}}`,
+		},
+		{
+			name:       "无法解析的消息返回解析错误",
+			request:    `{"jsonrpc":"2.0","id":5,`,
+			wantPrefix: `{"jsonrpc":"2.0","id":null,"error":{"code":-32700,`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := Handler(handler)
+			if tt.noHandler {
+				h = nil
+			}
+			_, peer, reader := newPeer(t, h)
+
+			writeLine(t, peer, tt.request)
+			got := readLine(t, reader)
+			if tt.want != "" && got != tt.want {
+				t.Errorf("响应 = %s, want %s", got, tt.want)
+			}
+			if tt.wantPrefix != "" && !strings.HasPrefix(got, tt.wantPrefix) {
+				t.Errorf("响应 = %s, want prefix %s", got, tt.wantPrefix)
+			}
+		})
+	}
+}
+
+func TestConnNotificationHasNoResponse(t *testing.T) {
+	notified := make(chan string, 1)
+	handler := func(ctx context.Context, method string, params json.RawMessage) (interface{}, error) {
+		if method == "notify" {
+			notified <- string(params)
+			return "ignored", nil
+		}
+		return "ok", nil
+	}
+	_, peer, reader := newPeer(t, handler)
+
+	writeLine(t, peer, `{"jsonrpc":"2.0","method":"notify","params":{"n":1}}`)
+	select {
+	case params := <-notified:
+		if params != `{"n":1}` {
+			t.Errorf("通知参数 = %s", params)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("通知未交给 handler")
+	}
+
+	// 通知没有响应，下一行应是后续请求的响应
+	writeLine(t, peer, `{"jsonrpc":"2.0","id":9,"method":"ping"}`)
+	if got, want := readLine(t, reader), `{"jsonrpc":"2.0","id":9,"result":"ok"}`; got != want {
+		t.Errorf("响应 = %s, want %s", got, want)
+	}
+}
+
+func TestConnCall(t *testing.T) {
+	tests := []struct {
+		name    string
+		params  interface{}
+		want    string
+		reply   string
+		wantErr *Error
+		result  string
+	}{
+		{
+			name:   "结果解码",
+			params: map[string]int{"a": 1},
+			want:   `{"jsonrpc":"2.0","id":1,"method":"plugin.info","params":{"a":1}}`,
+			reply:  `{"jsonrpc":"2.0","id":1,"result":"done"}`,
+			result: "done",
+		},
+		{
+			name:   "nil参数编码为null",
+			want:   `{"jsonrpc":"2.0","id":1,"method":"plugin.info","params":null}`,
+			reply:  `{"jsonrpc":"2.0","id":1,"result":"done"}`,
+			result: "done",
+		},
+		{
+			name:    "错误响应",
+			params:  []int{1},
+			want:    `{"jsonrpc":"2.0","id":1,"method":"plugin.info","params":[1]}`,
+			reply:   `{"jsonrpc":"2.0","id":1,"error":{"code":-32601,"message":"插件未实现"}}`,
+			wantErr: &Error{Code: CodeMethodNotFound, Message: "插件未实现"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn, peer, reader := newPeer(t, nil)
+
+			type callResult struct {
+				result string
+				err    error
+			}
+			done := make(chan callResult, 1)
+			go func() {
+				var result string
+				err := conn.Call(context.Background(), "plugin.info", tt.params, &result)
+				done <- callResult{result, err}
+			}()
+
+			if got := readLine(t, reader); got != tt.want {
+				t.Errorf("请求 = %s, want %s", got, tt.want)
+			}
+			// 无关ID的响应被忽略
+			writeLine(t, peer, `{"jsonrpc":"2.0","id":99,"result":"stray"}`)
+			writeLine(t, peer, tt.reply)
+
+			got := <-done
+			if tt.wantErr != nil {
+				var rpcErr *Error
+				if !errors.As(got.err, &rpcErr) || *rpcErr != *tt.wantErr {
+					t.Fatalf("Call() error = %v, want %v", got.err, tt.wantErr)
+				}
+				return
+			}
+			if got.err != nil {
+				t.Fatalf("Call() error = %v", got.err)
+			}
+			if got.result != tt.result {
+				t.Errorf("Call() result = %q, want %q", got.result, tt.result)
+			}
+		})
+	}
+}
+
+func TestConnCallIDsIncrease(t *testing.T) {
+	conn, peer, reader := newPeer(t, nil)
+
+	for i, want := range []string{"1", "2"} {
+		done := make(chan error, 1)
+		go func() { done <- conn.Call(context.Background(), "plugin.health", nil, nil) }()
+
+		var msg Message
+		if err := json.Unmarshal([]byte(readLine(t, reader)), &msg); err != nil {
+			t.Fatal(err)
+		}
+		if string(msg.ID) != want {
+			t.Errorf("第 %d 次调用 ID = %s, want %s", i+1, msg.ID, want)
+		}
+		writeLine(t, peer, `{"jsonrpc":"2.0","id":`+string(msg.ID)+`,"result":null}`)
+		if err := <-done; err != nil {
+			t.Fatalf("Call() error = %v", err)
+		}
+	}
+}
+
+func TestConnCallAfterPeerClosed(t *testing.T) {
+	conn, peer, reader := newPeer(t, nil)
+
+	done := make(chan error, 1)
+	go func() { done <- conn.Call(context.Background(), "plugin.start", nil, nil) }()
+	readLine(t, reader)
+	peer.Close()
+
+	if err := <-done; !errors.Is(err, ErrClosed) {
+		t.Fatalf("对端关闭时 Call() error = %v, want ErrClosed", err)
+	}
+	<-conn.Done()
+	if err := conn.Call(context.Background(), "plugin.stop", nil, nil); !errors.Is(err, ErrClosed) {
+		t.Errorf("关闭后 Call() error = %v, want ErrClosed", err)
+	}
+}
@@ -7,11 +7,13 @@ import (
 	"net/http"
 	"path/filepath"
 	"plugin"
+	"reflect"
 	"sort"
 	"strings"
 	"sync"
 	"time"
 
+	"hackmitm/pkg/audit"
 	"hackmitm/pkg/logger"
 )
 
@@ -33,8 +35,15 @@ type Manager struct {
 	basePath string
 	// watchers 文件监视器
 	watchers map[string]*FileWatcher
+	// selector 按用户选择生效的插件，为nil时所有插件生效
+	selector PluginSelector
+	// analysis 分析插件结果统计
+	analysis analysisCounters
 }
 
+// PluginSelector 判断插件（按配置中的名称）是否对用户生效，用于按用户的插件策略
+type PluginSelector func(username, pluginName string) bool
+
 // PluginWrapper 插件包装器
 type PluginWrapper struct {
 	Plugin     Plugin
@@ -48,6 +57,8 @@ type PluginWrapper struct {
 	CallCount  int64
 	ErrorCount int64
 	mutex      sync.RWMutex
+	// isolation 调用隔离状态
+	isolation *pluginIsolation
 }
 
 // FileWatcher 文件监视器
@@ -74,6 +85,18 @@ func NewManager(basePath string) *Manager {
 	}
 }
 
+// SetPluginSelector 设置按用户的插件选择器
+func (m *Manager) SetPluginSelector(selector PluginSelector) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.selector = selector
+}
+
+// selected 插件是否对用户生效
+func selected(selector PluginSelector, wrapper *PluginWrapper, username string) bool {
+	return selector == nil || selector(username, wrapper.Config.Name)
+}
+
 // LoadPlugin 加载插件
 func (m *Manager) LoadPlugin(config *PluginConfig) error {
 	m.mutex.Lock()
@@ -84,6 +107,19 @@ func (m *Manager) LoadPlugin(config *PluginConfig) error {
 		return nil
 	}
 
+	err := m.loadPlugin(config)
+	event := audit.Event{Type: audit.TypePlugin, Action: "load", Target: config.Name,
+		Details: map[string]interface{}{"path": config.Path}}
+	if err != nil {
+		event.Action = "load_failed"
+		event.Reason = err.Error()
+	}
+	audit.Record(event)
+	return err
+}
+
+// loadPlugin 内部加载插件方法（不加锁）
+func (m *Manager) loadPlugin(config *PluginConfig) error {
 	// 检查插件是否已加载
 	if wrapper, exists := m.plugins[config.Name]; exists {
 		if wrapper.Status != StatusError {
@@ -101,10 +137,49 @@ func (m *Manager) LoadPlugin(config *PluginConfig) error {
 		pluginPath = filepath.Join(m.basePath, pluginPath)
 	}
 
+	var pluginInstance Plugin
+	var err error
+	runtime := config.Runtime
+	if runtime == "" && strings.EqualFold(filepath.Ext(pluginPath), ".wasm") {
+		runtime = RuntimeWasm
+	}
+	switch runtime {
+	case "", RuntimeNative:
+		// 优先使用编译进二进制文件的插件，其次加载 .so 文件
+		if registeredName, factory, ok := registeredFactory(config); ok {
+			logger.Infof("使用内置插件: %s", registeredName)
+			pluginInstance, err = newBuiltinPlugin(config, factory)
+			pluginPath = builtinPluginPath(registeredName)
+		} else {
+			pluginInstance, err = loadNativePlugin(config, pluginPath)
+		}
+	case RuntimeBuiltin:
+		registeredName, factory, ok := registeredFactory(config)
+		if !ok {
+			return fmt.Errorf("未找到内置插件 %s，已注册的插件: %v", config.Name, RegisteredPlugins())
+		}
+		pluginInstance, err = newBuiltinPlugin(config, factory)
+		pluginPath = builtinPluginPath(registeredName)
+	case RuntimeProcess:
+		pluginInstance, err = newProcessPlugin(config, pluginPath)
+	case RuntimeWasm:
+		pluginInstance, err = newWasmPlugin(config, pluginPath)
+	default:
+		err = fmt.Errorf("不支持的插件运行方式: %s", config.Runtime)
+	}
+	if err != nil {
+		return err
+	}
+
+	return m.initializePlugin(config, pluginInstance, pluginPath)
+}
+
+// loadNativePlugin 使用 Go plugin 加载 .so 插件并创建实例
+func loadNativePlugin(config *PluginConfig, pluginPath string) (Plugin, error) {
 	// 加载插件文件
 	p, err := plugin.Open(pluginPath)
 	if err != nil {
-		return fmt.Errorf("加载插件文件失败: %w", err)
+		return nil, fmt.Errorf("加载插件文件失败: %w", err)
 	}
 
 	// 查找插件工厂函数
@@ -113,41 +188,40 @@ func (m *Manager) LoadPlugin(config *PluginConfig) error {
 		// 尝试查找加载器函数
 		loaderSymbol, err := p.Lookup("LoadPlugin")
 		if err != nil {
-			return fmt.Errorf("未找到插件入口函数 NewPlugin 或 LoadPlugin: %w", err)
+			return nil, fmt.Errorf("未找到插件入口函数 NewPlugin 或 LoadPlugin: %w", err)
 		}
 
 		// 使用加载器函数
 		loader, ok := loaderSymbol.(func() Plugin)
 		if !ok {
-			return fmt.Errorf("LoadPlugin 函数签名不正确")
+			return nil, fmt.Errorf("LoadPlugin 函数签名不正确")
 		}
 
-		pluginInstance := loader()
-		return m.initializePlugin(config, pluginInstance, pluginPath)
+		return loader(), nil
 	}
 
 	// 使用工厂函数
 	factory, ok := factorySymbol.(func(map[string]interface{}) (Plugin, error))
 	if !ok {
-		return fmt.Errorf("NewPlugin 函数签名不正确")
+		return nil, fmt.Errorf("NewPlugin 函数签名不正确")
 	}
 
 	pluginInstance, err := factory(config.Config)
 	if err != nil {
-		return fmt.Errorf("创建插件实例失败: %w", err)
+		return nil, fmt.Errorf("创建插件实例失败: %w", err)
 	}
-
-	return m.initializePlugin(config, pluginInstance, pluginPath)
+	return pluginInstance, nil
 }
 
 // initializePlugin 初始化插件
 func (m *Manager) initializePlugin(config *PluginConfig, pluginInstance Plugin, pluginPath string) error {
 	// 创建插件包装器
 	wrapper := &PluginWrapper{
-		Plugin:   pluginInstance,
-		Config:   config,
-		Status:   StatusLoaded,
-		LoadTime: time.Now(),
+		Plugin:    pluginInstance,
+		Config:    config,
+		Status:    StatusLoaded,
+		LoadTime:  time.Now(),
+		isolation: newPluginIsolation(config.Isolation),
 		Info: &PluginInfo{
 			Name:        pluginInstance.Name(),
 			Version:     pluginInstance.Version(),
@@ -180,6 +254,17 @@ func (m *Manager) initializePlugin(config *PluginConfig, pluginInstance Plugin,
 
 // addToTypeGroup 将插件添加到类型分组中
 func (m *Manager) addToTypeGroup(wrapper *PluginWrapper) {
+	// 声明了钩子的插件只加入声明的分组
+	if hookProvider, ok := wrapper.Plugin.(HookProvider); ok {
+		for _, pluginType := range hookProvider.Hooks() {
+			if implementsType(wrapper.Plugin, pluginType) {
+				m.pluginsByType[pluginType] = append(m.pluginsByType[pluginType], wrapper)
+			}
+		}
+		m.sortPluginsByPriority()
+		return
+	}
+
 	// 检测插件类型并添加到对应分组
 	if _, ok := wrapper.Plugin.(RequestPlugin); ok {
 		m.pluginsByType[TypeRequest] = append(m.pluginsByType[TypeRequest], wrapper)
@@ -204,6 +289,26 @@ func (m *Manager) addToTypeGroup(wrapper *PluginWrapper) {
 	m.sortPluginsByPriority()
 }
 
+// implementsType 插件是否实现指定类型的接口
+func implementsType(p Plugin, pluginType PluginType) bool {
+	var ok bool
+	switch pluginType {
+	case TypeRequest:
+		_, ok = p.(RequestPlugin)
+	case TypeResponse:
+		_, ok = p.(ResponsePlugin)
+	case TypeFilter:
+		_, ok = p.(FilterPlugin)
+	case TypeLogger:
+		_, ok = p.(LoggerPlugin)
+	case TypeModifier:
+		_, ok = p.(ModifierPlugin)
+	case TypeAnalytics:
+		_, ok = p.(AnalyticsPlugin)
+	}
+	return ok
+}
+
 // sortPluginsByPriority 按优先级排序插件
 func (m *Manager) sortPluginsByPriority() {
 	for pluginType := range m.pluginsByType {
@@ -270,6 +375,7 @@ func (m *Manager) StartPlugin(name string) error {
 	wrapper.Status = StatusStarted
 	wrapper.StartTime = time.Now()
 	wrapper.Error = nil
+	wrapper.isolation.reset()
 
 	logger.Infof("插件启动成功: %s", name)
 	return nil
@@ -279,7 +385,11 @@ func (m *Manager) StartPlugin(name string) error {
 func (m *Manager) StopPlugin(name string) error {
 	m.mutex.Lock()
 	defer m.mutex.Unlock()
+	return m.stopPlugin(name)
+}
 
+// stopPlugin 内部停止插件方法（不加锁）
+func (m *Manager) stopPlugin(name string) error {
 	wrapper, exists := m.plugins[name]
 	if !exists {
 		return fmt.Errorf("插件 %s 未找到", name)
@@ -340,6 +450,7 @@ func (m *Manager) unloadPlugin(name string) error {
 
 	wrapper.Status = StatusUnloaded
 
+	audit.Record(audit.Event{Type: audit.TypePlugin, Action: "unload", Target: name})
 	logger.Infof("插件卸载成功: %s", name)
 	return nil
 }
@@ -376,31 +487,81 @@ func (m *Manager) ReloadPlugin(name string) error {
 	return m.LoadPlugin(config)
 }
 
-// ProcessRequest 处理请求插件链
-func (m *Manager) ProcessRequest(req *http.Request, ctx *RequestContext) error {
+// ApplyConfig 按新的插件配置列表增量调整已加载插件
+// 已移除或禁用的插件被卸载，新增的插件被加载并启动，
+// 路径、优先级或配置发生变化的插件会被重新加载
+func (m *Manager) ApplyConfig(configs []*PluginConfig) error {
+	desired := make(map[string]*PluginConfig, len(configs))
+	for _, cfg := range configs {
+		if cfg.Enabled {
+			desired[cfg.Name] = cfg
+		}
+	}
+
 	m.mutex.RLock()
-	plugins := make([]*PluginWrapper, len(m.pluginsByType[TypeRequest]))
-	copy(plugins, m.pluginsByType[TypeRequest])
+	current := make(map[string]*PluginConfig, len(m.config))
+	for name, cfg := range m.config {
+		current[name] = cfg
+	}
 	m.mutex.RUnlock()
 
-	for _, wrapper := range plugins {
-		if wrapper.Status != StatusStarted {
+	var errs []string
+
+	// 卸载已移除、已禁用或配置变化的插件
+	for name, cfg := range current {
+		if want, ok := desired[name]; ok && reflect.DeepEqual(want, cfg) {
+			delete(desired, name)
+			continue
+		}
+		if err := m.UnloadPlugin(name); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+
+	// 按优先级加载新增或变化的插件
+	pending := make([]*PluginConfig, 0, len(desired))
+	for _, cfg := range desired {
+		pending = append(pending, cfg)
+	}
+	sort.Slice(pending, func(i, j int) bool {
+		return pending[i].Priority < pending[j].Priority
+	})
+
+	for _, cfg := range pending {
+		if err := m.LoadPlugin(cfg); err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %v", cfg.Name, err))
 			continue
 		}
+		if err := m.StartPlugin(cfg.Name); err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %v", cfg.Name, err))
+		}
+	}
 
-		if requestPlugin, ok := wrapper.Plugin.(RequestPlugin); ok {
-			wrapper.mutex.Lock()
-			wrapper.CallCount++
-			wrapper.mutex.Unlock()
+	if len(errs) > 0 {
+		return fmt.Errorf("应用插件配置失败: %s", strings.Join(errs, "; "))
+	}
+	return nil
+}
 
-			if err := requestPlugin.ProcessRequest(req, ctx); err != nil {
-				wrapper.mutex.Lock()
-				wrapper.ErrorCount++
-				wrapper.mutex.Unlock()
+// ProcessRequest 处理请求插件链
+func (m *Manager) ProcessRequest(req *http.Request, ctx *RequestContext) error {
+	plugins, selector := m.pluginsOfType(TypeRequest)
+	for _, wrapper := range plugins {
+		requestPlugin, ok := wrapper.Plugin.(RequestPlugin)
+		if !ok || !wrapper.active(selector, ctx.Username) {
+			continue
+		}
 
-				logger.Errorf("请求插件 %s 处理失败: %v", wrapper.Info.Name, err)
-				return err
-			}
+		err := wrapper.invoke(func(context.Context) error {
+			return requestPlugin.ProcessRequest(req, ctx)
+		})
+		if err != nil {
+			logger.Errorf("请求插件 %s 处理失败: %v", wrapper.Info.Name, err)
+			return err
+		}
+		if ctx.Response != nil {
+			logger.Debugf("请求插件 %s 直接返回响应: %d", wrapper.Info.Name, ctx.Response.StatusCode)
+			return nil
 		}
 	}
 
@@ -409,29 +570,19 @@ func (m *Manager) ProcessRequest(req *http.Request, ctx *RequestContext) error {
 
 // ProcessResponse 处理响应插件链
 func (m *Manager) ProcessResponse(resp *http.Response, req *http.Request, ctx *ResponseContext) error {
-	m.mutex.RLock()
-	plugins := make([]*PluginWrapper, len(m.pluginsByType[TypeResponse]))
-	copy(plugins, m.pluginsByType[TypeResponse])
-	m.mutex.RUnlock()
-
+	plugins, selector := m.pluginsOfType(TypeResponse)
 	for _, wrapper := range plugins {
-		if wrapper.Status != StatusStarted {
+		responsePlugin, ok := wrapper.Plugin.(ResponsePlugin)
+		if !ok || !wrapper.active(selector, ctx.Username) {
 			continue
 		}
 
-		if responsePlugin, ok := wrapper.Plugin.(ResponsePlugin); ok {
-			wrapper.mutex.Lock()
-			wrapper.CallCount++
-			wrapper.mutex.Unlock()
-
-			if err := responsePlugin.ProcessResponse(resp, req, ctx); err != nil {
-				wrapper.mutex.Lock()
-				wrapper.ErrorCount++
-				wrapper.mutex.Unlock()
-
-				logger.Errorf("响应插件 %s 处理失败: %v", wrapper.Info.Name, err)
-				return err
-			}
+		err := wrapper.invoke(func(context.Context) error {
+			return responsePlugin.ProcessResponse(resp, req, ctx)
+		})
+		if err != nil {
+			logger.Errorf("响应插件 %s 处理失败: %v", wrapper.Info.Name, err)
+			return err
 		}
 	}
 
@@ -440,38 +591,35 @@ func (m *Manager) ProcessResponse(resp *http.Response, req *http.Request, ctx *R
 
 // ShouldAllow 执行过滤插件链
 func (m *Manager) ShouldAllow(req *http.Request, ctx *FilterContext) (bool, error) {
-	m.mutex.RLock()
-	plugins := make([]*PluginWrapper, len(m.pluginsByType[TypeFilter]))
-	copy(plugins, m.pluginsByType[TypeFilter])
-	m.mutex.RUnlock()
+	allowed, _, err := m.FilterRequest(req, ctx)
+	return allowed, err
+}
 
+// FilterRequest 执行过滤插件链，拒绝、出错或插件设置了 ctx.Response 时同时返回作出决定的插件名称
+func (m *Manager) FilterRequest(req *http.Request, ctx *FilterContext) (bool, string, error) {
+	plugins, selector := m.pluginsOfType(TypeFilter)
 	for _, wrapper := range plugins {
-		if wrapper.Status != StatusStarted {
+		filterPlugin, ok := wrapper.Plugin.(FilterPlugin)
+		if !ok || !wrapper.active(selector, ctx.Username) {
 			continue
 		}
 
-		if filterPlugin, ok := wrapper.Plugin.(FilterPlugin); ok {
-			wrapper.mutex.Lock()
-			wrapper.CallCount++
-			wrapper.mutex.Unlock()
-
-			allowed, err := filterPlugin.ShouldAllow(req, ctx)
-			if err != nil {
-				wrapper.mutex.Lock()
-				wrapper.ErrorCount++
-				wrapper.mutex.Unlock()
-
-				logger.Errorf("过滤插件 %s 处理失败: %v", wrapper.Info.Name, err)
-				return false, err
-			}
+		var allowed bool
+		err := wrapper.invoke(func(context.Context) (err error) {
+			allowed, err = filterPlugin.ShouldAllow(req, ctx)
+			return err
+		})
+		if err != nil {
+			logger.Errorf("过滤插件 %s 处理失败: %v", wrapper.Info.Name, err)
+			return false, wrapper.Info.Name, err
+		}
 
-			if !allowed {
-				return false, nil
-			}
+		if !allowed || ctx.Response != nil {
+			return allowed, wrapper.Info.Name, nil
 		}
 	}
 
-	return true, nil
+	return true, "", nil
 }
 
 // GetPluginInfo 获取插件信息
@@ -512,14 +660,25 @@ func (m *Manager) GetStats() map[string]interface{} {
 
 	for name, wrapper := range m.plugins {
 		wrapper.mutex.RLock()
-		pluginStats[name] = map[string]interface{}{
+		entry := map[string]interface{}{
 			"status":      string(wrapper.Status),
 			"call_count":  wrapper.CallCount,
 			"error_count": wrapper.ErrorCount,
 			"load_time":   wrapper.LoadTime.Format(time.RFC3339),
 			"start_time":  wrapper.StartTime.Format(time.RFC3339),
 		}
+		if wrapper.Error != nil {
+			entry["error"] = wrapper.Error.Error()
+		}
 		wrapper.mutex.RUnlock()
+		entry["isolation"] = wrapper.isolation.stats()
+		if runtimeStats, ok := wrapper.Plugin.(RuntimeStatsProvider); ok {
+			entry["runtime"] = runtimeStats.RuntimeStats()
+		}
+		if analyticsPlugin, ok := wrapper.Plugin.(AnalyticsPlugin); ok && wrapper.Status == StatusStarted {
+			entry["statistics"] = analyticsPlugin.GetStatistics()
+		}
+		pluginStats[name] = entry
 	}
 
 	stats["plugins"] = pluginStats
@@ -531,6 +690,7 @@ func (m *Manager) GetStats() map[string]interface{} {
 		typeStats[string(pluginType)] = len(plugins)
 	}
 	stats["plugins_by_type"] = typeStats
+	stats["analysis"] = m.analysisStats()
 
 	return stats
 }
@@ -556,6 +716,7 @@ func (m *Manager) StartAll() error {
 			wrapper.Status = StatusStarted
 			wrapper.StartTime = time.Now()
 			wrapper.Error = nil
+			wrapper.isolation.reset()
 			logger.Infof("插件 %s 启动成功", name)
 		}
 	}
@@ -574,8 +735,11 @@ func (m *Manager) StopAll() error {
 	defer m.mutex.Unlock()
 
 	var errors []string
-	for name := range m.plugins {
-		if err := m.StopPlugin(name); err != nil {
+	for name, wrapper := range m.plugins {
+		if wrapper.Status != StatusStarted {
+			continue
+		}
+		if err := m.stopPlugin(name); err != nil {
 			errors = append(errors, fmt.Sprintf("%s: %v", name, err))
 		}
 	}
@@ -0,0 +1,681 @@
+// Package plugin 进程外插件宿主端实现
+package plugin
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"hackmitm/pkg/logger"
+	"hackmitm/pkg/plugin/jsonrpc"
+)
+
+// 传给插件进程的环境变量
+const (
+	// EnvPluginProtocol 协议版本，插件进程据此判断由宿主启动
+	EnvPluginProtocol = "HACKMITM_PLUGIN_PROTOCOL"
+	// EnvPluginName 插件在配置中的名称
+	EnvPluginName = "HACKMITM_PLUGIN_NAME"
+	// EnvPluginSocket unix 通信方式下插件进程需要监听的套接字路径
+	EnvPluginSocket = "HACKMITM_PLUGIN_SOCKET"
+)
+
+// 进程外插件通信方式
+const (
+	TransportStdio = "stdio"
+	TransportUnix  = "unix"
+)
+
+const (
+	// processStartTimeout 插件进程启动并完成握手的超时
+	processStartTimeout = 10 * time.Second
+	// processStopTimeout 关闭插件进程时等待其退出的时间
+	processStopTimeout = 5 * time.Second
+	// maxHealthFailures 连续健康检查失败次数达到后重启插件进程
+	maxHealthFailures = 3
+	// maxRestartBackoff 重启间隔上限
+	maxRestartBackoff = 30 * time.Second
+)
+
+// errProcessUnavailable 插件进程未运行（重启中或已超过重启上限）
+var errProcessUnavailable = errors.New("插件进程不可用")
+
+// withDefaults 返回填充默认值后的选项
+func (o ProcessOptions) withDefaults() ProcessOptions {
+	if o.Transport == "" {
+		o.Transport = TransportStdio
+	}
+	if o.CallTimeout <= 0 {
+		o.CallTimeout = 5 * time.Second
+	}
+	if o.HealthInterval <= 0 {
+		o.HealthInterval = 10 * time.Second
+	}
+	if o.MaxRestarts == 0 {
+		o.MaxRestarts = 5
+	}
+	if o.MaxBodySize == 0 {
+		o.MaxBodySize = 1024 * 1024
+	}
+	return o
+}
+
+// processPlugin 进程外插件在代理中的代理对象，实现全部钩子接口，
+// 按握手时声明的钩子加入类型分组；插件进程崩溃或健康检查失败时自动重启
+type processPlugin struct {
+	// name 配置中的插件名称
+	name string
+	// path 可执行文件路径
+	path string
+	// options 进程选项
+	options ProcessOptions
+	// priority 优先级
+	priority int
+	// info 握手信息
+	info ProcessInfo
+
+	// mutex 保护以下字段
+	mutex sync.RWMutex
+	// proc 当前运行的插件进程，重启期间为nil
+	proc *pluginProcess
+	// config 初始化配置，重启后重新发送
+	config map[string]interface{}
+	// initialized 已初始化
+	initialized bool
+	// started 已启动，重启后重新启动
+	started bool
+	// closed 已清理，不再重启
+	closed bool
+	// restarts 连续重启次数，健康检查通过后清零
+	restarts int
+	// lastError 最近一次进程错误
+	lastError string
+
+	// totalRestarts 累计重启次数
+	totalRestarts int64
+	// stop 停止监控
+	stop chan struct{}
+}
+
+// pluginProcess 一个运行中的插件进程
+type pluginProcess struct {
+	cmd       *exec.Cmd
+	conn      *jsonrpc.Conn
+	socketDir string
+	// exited 进程退出时关闭
+	exited chan struct{}
+	// waitErr 进程退出状态
+	waitErr error
+}
+
+// newProcessPlugin 启动插件进程并完成握手
+func newProcessPlugin(config *PluginConfig, path string) (*processPlugin, error) {
+	p := &processPlugin{
+		name:     config.Name,
+		path:     path,
+		options:  config.Process.withDefaults(),
+		priority: config.Priority,
+		stop:     make(chan struct{}),
+	}
+	if p.options.Transport != TransportStdio && p.options.Transport != TransportUnix {
+		return nil, fmt.Errorf("不支持的通信方式: %s", p.options.Transport)
+	}
+
+	proc, info, err := p.launch()
+	if err != nil {
+		return nil, err
+	}
+	p.proc = proc
+	p.info = info
+
+	go p.supervise()
+	return p, nil
+}
+
+// launch 启动插件进程、建立连接并握手
+func (p *processPlugin) launch() (*pluginProcess, ProcessInfo, error) {
+	var info ProcessInfo
+
+	cmd := exec.Command(p.path, p.options.Args...)
+	cmd.Env = append(os.Environ(),
+		fmt.Sprintf("%s=%d", EnvPluginProtocol, ProcessProtocolVersion),
+		EnvPluginName+"="+p.name,
+	)
+	for key, value := range p.options.Env {
+		cmd.Env = append(cmd.Env, key+"="+value)
+	}
+	cmd.Stderr = newProcessLogWriter(p.name)
+
+	proc := &pluginProcess{cmd: cmd, exited: make(chan struct{})}
+
+	var rwc io.ReadWriteCloser
+	var childEnds []io.Closer
+	switch p.options.Transport {
+	case TransportUnix:
+		dir, err := os.MkdirTemp("", "hackmitm-plugin-")
+		if err != nil {
+			return nil, info, fmt.Errorf("创建套接字目录失败: %w", err)
+		}
+		proc.socketDir = dir
+		cmd.Env = append(cmd.Env, EnvPluginSocket+"="+filepath.Join(dir, "plugin.sock"))
+		cmd.Stdout = cmd.Stderr
+	default:
+		stdinR, stdinW, err := os.Pipe()
+		if err != nil {
+			return nil, info, err
+		}
+		stdoutR, stdoutW, err := os.Pipe()
+		if err != nil {
+			stdinR.Close()
+			stdinW.Close()
+			return nil, info, err
+		}
+		cmd.Stdin, cmd.Stdout = stdinR, stdoutW
+		childEnds = []io.Closer{stdinR, stdoutW}
+		rwc = &stdioConn{Reader: stdoutR, Writer: stdinW, closers: []io.Closer{stdinW, stdoutR}}
+	}
+
+	if err := cmd.Start(); err != nil {
+		for _, c := range childEnds {
+			c.Close()
+		}
+		if rwc != nil {
+			rwc.Close()
+		}
+		proc.cleanup()
+		return nil, info, fmt.Errorf("启动插件进程失败: %w", err)
+	}
+	// 子进程已继承管道的另一端，父进程关闭后子进程退出时读取端才能收到EOF
+	for _, c := range childEnds {
+		c.Close()
+	}
+	go func() {
+		proc.waitErr = cmd.Wait()
+		close(proc.exited)
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), processStartTimeout)
+	defer cancel()
+
+	if p.options.Transport == TransportUnix {
+		conn, err := dialPluginSocket(ctx, filepath.Join(proc.socketDir, "plugin.sock"), proc.exited)
+		if err != nil {
+			proc.kill()
+			return nil, info, err
+		}
+		rwc = conn
+	}
+	proc.conn = jsonrpc.NewConn(rwc, nil)
+
+	if err := proc.conn.Call(ctx, MethodInfo, struct{}{}, &info); err != nil {
+		proc.kill()
+		return nil, info, fmt.Errorf("插件握手失败: %w", err)
+	}
+	if info.Protocol != ProcessProtocolVersion {
+		proc.kill()
+		return nil, info, fmt.Errorf("插件协议版本 %d 与代理 %d 不一致", info.Protocol, ProcessProtocolVersion)
+	}
+
+	logger.Infof("插件进程已启动: %s (pid %d, %s)", p.name, cmd.Process.Pid, p.options.Transport)
+	return proc, info, nil
+}
+
+// dialPluginSocket 等待插件进程创建套接字并连接
+func dialPluginSocket(ctx context.Context, socketPath string, exited <-chan struct{}) (net.Conn, error) {
+	var dialer net.Dialer
+	for {
+		conn, err := dialer.DialContext(ctx, "unix", socketPath)
+		if err == nil {
+			return conn, nil
+		}
+		select {
+		case <-exited:
+			return nil, fmt.Errorf("插件进程在建立连接前退出")
+		case <-ctx.Done():
+			return nil, fmt.Errorf("连接插件套接字超时: %w", err)
+		case <-time.After(50 * time.Millisecond):
+		}
+	}
+}
+
+// supervise 监控插件进程：进程退出或连续健康检查失败时重启
+func (p *processPlugin) supervise() {
+	ticker := time.NewTicker(p.options.HealthInterval)
+	defer ticker.Stop()
+
+	healthFailures := 0
+	for {
+		p.mutex.RLock()
+		proc := p.proc
+		p.mutex.RUnlock()
+		if proc == nil {
+			return
+		}
+
+		select {
+		case <-p.stop:
+			return
+
+		case <-proc.exited:
+			p.handleExit(proc, fmt.Errorf("进程退出: %v", proc.waitErr))
+			healthFailures = 0
+
+		case <-proc.conn.Done():
+			p.handleExit(proc, proc.conn.Err())
+			healthFailures = 0
+
+		case <-ticker.C:
+			if err := p.call(MethodHealth, struct{}{}, nil); err != nil {
+				healthFailures++
+				logger.Warnf("插件 %s 健康检查失败 (%d/%d): %v", p.name, healthFailures, maxHealthFailures, err)
+				if healthFailures >= maxHealthFailures {
+					p.handleExit(proc, fmt.Errorf("连续 %d 次健康检查失败", healthFailures))
+					healthFailures = 0
+				}
+				continue
+			}
+			healthFailures = 0
+			p.mutex.Lock()
+			p.restarts = 0
+			p.mutex.Unlock()
+		}
+	}
+}
+
+// handleExit 结束异常的插件进程并按退避间隔重启
+func (p *processPlugin) handleExit(proc *pluginProcess, cause error) {
+	p.mutex.Lock()
+	if p.closed {
+		p.mutex.Unlock()
+		return
+	}
+	p.proc = nil
+	p.lastError = cause.Error()
+	p.mutex.Unlock()
+
+	logger.Warnf("插件进程 %s 异常: %v", p.name, cause)
+	proc.kill()
+
+	for {
+		p.mutex.Lock()
+		p.restarts++
+		restarts := p.restarts
+		p.mutex.Unlock()
+
+		if p.options.MaxRestarts > 0 && restarts > p.options.MaxRestarts {
+			logger.Errorf("插件进程 %s 连续重启超过 %d 次，不再重启", p.name, p.options.MaxRestarts)
+			return
+		}
+
+		backoff := maxRestartBackoff
+		if restarts <= 5 {
+			backoff = time.Second << uint(restarts-1)
+		}
+		if backoff > maxRestartBackoff {
+			backoff = maxRestartBackoff
+		}
+		select {
+		case <-p.stop:
+			return
+		case <-time.After(backoff):
+		}
+
+		newProc, err := p.relaunch()
+		if err != nil {
+			p.mutex.Lock()
+			p.lastError = err.Error()
+			p.mutex.Unlock()
+			logger.Errorf("重启插件进程 %s 失败: %v", p.name, err)
+			continue
+		}
+
+		p.mutex.Lock()
+		if p.closed {
+			p.mutex.Unlock()
+			newProc.terminate()
+			return
+		}
+		p.proc = newProc
+		p.mutex.Unlock()
+		atomic.AddInt64(&p.totalRestarts, 1)
+		logger.Infof("插件进程 %s 已重启（第 %d 次）", p.name, restarts)
+		return
+	}
+}
+
+// relaunch 启动新进程并恢复初始化和启动状态
+func (p *processPlugin) relaunch() (*pluginProcess, error) {
+	proc, _, err := p.launch()
+	if err != nil {
+		return nil, err
+	}
+
+	p.mutex.RLock()
+	config, initialized, started := p.config, p.initialized, p.started
+	p.mutex.RUnlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), p.options.CallTimeout)
+	defer cancel()
+	if initialized {
+		if err := proc.conn.Call(ctx, MethodInitialize, InitializeParams{Config: config}, nil); err != nil {
+			proc.terminate()
+			return nil, fmt.Errorf("重新初始化失败: %w", err)
+		}
+	}
+	if started {
+		if err := proc.conn.Call(ctx, MethodStart, struct{}{}, nil); err != nil {
+			proc.terminate()
+			return nil, fmt.Errorf("重新启动失败: %w", err)
+		}
+	}
+	return proc, nil
+}
+
+// call 调用当前插件进程的方法
+func (p *processPlugin) call(method string, params, result interface{}) error {
+	p.mutex.RLock()
+	proc := p.proc
+	p.mutex.RUnlock()
+	if proc == nil {
+		return fmt.Errorf("%w: %s", errProcessUnavailable, p.name)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), p.options.CallTimeout)
+	defer cancel()
+	return proc.conn.Call(ctx, method, params, result)
+}
+
+// Name 返回插件名称
+func (p *processPlugin) Name() string {
+	if p.info.Name != "" {
+		return p.info.Name
+	}
+	return p.name
+}
+
+// Version 返回插件版本
+func (p *processPlugin) Version() string {
+	return p.info.Version
+}
+
+// Description 返回插件描述
+func (p *processPlugin) Description() string {
+	return p.info.Description
+}
+
+// Hooks 返回插件声明的钩子类型
+func (p *processPlugin) Hooks() []PluginType {
+	return p.info.Hooks
+}
+
+// Priority 返回配置中的优先级
+func (p *processPlugin) Priority() int {
+	return p.priority
+}
+
+// Initialize 初始化插件
+func (p *processPlugin) Initialize(config map[string]interface{}) error {
+	if err := p.call(MethodInitialize, InitializeParams{Config: config}, nil); err != nil {
+		return err
+	}
+	p.mutex.Lock()
+	p.config = config
+	p.initialized = true
+	p.mutex.Unlock()
+	return nil
+}
+
+// Start 启动插件
+func (p *processPlugin) Start(ctx context.Context) error {
+	if err := p.call(MethodStart, struct{}{}, nil); err != nil {
+		return err
+	}
+	p.mutex.Lock()
+	p.started = true
+	p.mutex.Unlock()
+	return nil
+}
+
+// Stop 停止插件
+func (p *processPlugin) Stop(ctx context.Context) error {
+	p.mutex.Lock()
+	p.started = false
+	p.mutex.Unlock()
+	return p.call(MethodStop, struct{}{}, nil)
+}
+
+// Cleanup 结束插件进程
+func (p *processPlugin) Cleanup() error {
+	p.mutex.Lock()
+	if p.closed {
+		p.mutex.Unlock()
+		return nil
+	}
+	p.closed = true
+	proc := p.proc
+	p.proc = nil
+	p.mutex.Unlock()
+
+	close(p.stop)
+	if proc != nil {
+		proc.terminate()
+	}
+	return nil
+}
+
+// ProcessRequest 实现 RequestPlugin
+func (p *processPlugin) ProcessRequest(req *http.Request, ctx *RequestContext) error {
+	return p.callRequest(MethodProcessRequest, req, ctx)
+}
+
+// ModifyRequest 实现 ModifierPlugin
+func (p *processPlugin) ModifyRequest(req *http.Request, ctx *RequestContext) error {
+	return p.callRequest(MethodModifyRequest, req, ctx)
+}
+
+// ProcessResponse 实现 ResponsePlugin
+func (p *processPlugin) ProcessResponse(resp *http.Response, req *http.Request, ctx *ResponseContext) error {
+	return p.callResponse(MethodProcessResponse, resp, req, ctx)
+}
+
+// ModifyResponse 实现 ModifierPlugin
+func (p *processPlugin) ModifyResponse(resp *http.Response, req *http.Request, ctx *ResponseContext) error {
+	return p.callResponse(MethodModifyResponse, resp, req, ctx)
+}
+
+// ShouldAllow 实现 FilterPlugin
+func (p *processPlugin) ShouldAllow(req *http.Request, ctx *FilterContext) (bool, error) {
+	wire, err := EncodeRequest(req, p.options.MaxBodySize)
+	if err != nil {
+		return false, err
+	}
+
+	var result FilterResult
+	if err := p.call(MethodShouldAllow, FilterParams{Request: wire, Context: ctx}, &result); err != nil {
+		return false, err
+	}
+	ctx.Metadata = mergeMetadata(ctx.Metadata, result.Metadata)
+	if result.Response != nil {
+		ctx.Response = NewResponseFromWire(result.Response, req)
+	}
+	return result.Allow, nil
+}
+
+// callRequest 发送请求给插件并应用插件的修改
+func (p *processPlugin) callRequest(method string, req *http.Request, ctx *RequestContext) error {
+	wire, err := EncodeRequest(req, p.options.MaxBodySize)
+	if err != nil {
+		return err
+	}
+
+	var result RequestResult
+	if err := p.call(method, RequestParams{Request: wire, Context: ctx}, &result); err != nil {
+		return err
+	}
+	ctx.Metadata = mergeMetadata(ctx.Metadata, result.Metadata)
+	if err := ApplyRequest(req, result.Request); err != nil {
+		return err
+	}
+	if result.Response != nil {
+		ctx.Response = NewResponseFromWire(result.Response, req)
+	}
+	return nil
+}
+
+// callResponse 发送响应给插件并应用插件的修改
+func (p *processPlugin) callResponse(method string, resp *http.Response, req *http.Request, ctx *ResponseContext) error {
+	wire, err := EncodeResponse(resp, p.options.MaxBodySize)
+	if err != nil {
+		return err
+	}
+	// 响应钩子只需要请求行和请求头
+	wireReq, err := EncodeRequest(req, -1)
+	if err != nil {
+		return err
+	}
+
+	var result ResponseResult
+	if err := p.call(method, ResponseParams{Response: wire, Request: wireReq, Context: ctx}, &result); err != nil {
+		return err
+	}
+	ctx.Metadata = mergeMetadata(ctx.Metadata, result.Metadata)
+	ApplyResponse(resp, result.Response)
+	return nil
+}
+
+// mergeMetadata 合并插件返回的元数据
+func mergeMetadata(metadata, added map[string]interface{}) map[string]interface{} {
+	if len(added) == 0 {
+		return metadata
+	}
+	if metadata == nil {
+		metadata = make(map[string]interface{}, len(added))
+	}
+	for key, value := range added {
+		metadata[key] = value
+	}
+	return metadata
+}
+
+// RuntimeStats 返回插件进程状态
+func (p *processPlugin) RuntimeStats() map[string]interface{} {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+
+	stats := map[string]interface{}{
+		"runtime":   RuntimeProcess,
+		"transport": p.options.Transport,
+		"running":   p.proc != nil,
+		"restarts":  atomic.LoadInt64(&p.totalRestarts),
+	}
+	if p.proc != nil && p.proc.cmd.Process != nil {
+		stats["pid"] = p.proc.cmd.Process.Pid
+	}
+	if p.lastError != "" {
+		stats["last_error"] = p.lastError
+	}
+	return stats
+}
+
+// terminate 关闭连接并等待进程退出，超时后强制结束
+func (proc *pluginProcess) terminate() {
+	if proc.conn != nil {
+		proc.conn.Close()
+	}
+	select {
+	case <-proc.exited:
+	case <-time.After(processStopTimeout):
+		proc.cmd.Process.Kill()
+		<-proc.exited
+	}
+	proc.cleanup()
+}
+
+// kill 立即结束进程
+func (proc *pluginProcess) kill() {
+	if proc.cmd.Process != nil {
+		proc.cmd.Process.Kill()
+		<-proc.exited
+	}
+	if proc.conn != nil {
+		proc.conn.Close()
+	}
+	proc.cleanup()
+}
+
+// cleanup 删除套接字目录
+func (proc *pluginProcess) cleanup() {
+	if proc.socketDir != "" {
+		os.RemoveAll(proc.socketDir)
+	}
+}
+
+// stdioConn 由插件进程的 stdout（读）和 stdin（写）组成的连接
+type stdioConn struct {
+	io.Reader
+	io.Writer
+	closers []io.Closer
+}
+
+// Close 关闭两个管道
+func (c *stdioConn) Close() error {
+	var firstErr error
+	for _, closer := range c.closers {
+		if err := closer.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// processLogWriter 将插件进程的 stderr 按行写入日志
+type processLogWriter struct {
+	name   string
+	mutex  sync.Mutex
+	buffer []byte
+}
+
+// newProcessLogWriter 创建插件进程日志写入器
+func newProcessLogWriter(name string) *processLogWriter {
+	return &processLogWriter{name: name}
+}
+
+// Write 实现 io.Writer
+func (w *processLogWriter) Write(p []byte) (int, error) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	w.buffer = append(w.buffer, p...)
+	for {
+		i := bytes.IndexByte(w.buffer, '\n')
+		if i < 0 {
+			break
+		}
+		w.log(w.buffer[:i])
+		w.buffer = w.buffer[i+1:]
+	}
+	// 长时间不换行的输出直接写出，避免缓冲区无限增长
+	if len(w.buffer) > 64*1024 {
+		w.log(w.buffer)
+		w.buffer = nil
+	}
+	return len(p), nil
+}
+
+// log 输出一行插件日志
+func (w *processLogWriter) log(line []byte) {
+	if text := strings.TrimRight(string(line), "\r"); text != "" {
+		logger.Infof("[插件 %s] %s", w.name, text)
+	}
+}
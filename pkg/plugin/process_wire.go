@@ -0,0 +1,279 @@
+// Package plugin 进程外插件协议
+package plugin
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+// ProcessProtocolVersion 进程外插件协议版本，握手时双方必须一致
+const ProcessProtocolVersion = 1
+
+// 进程外插件的 JSON-RPC 方法，均由宿主调用插件进程
+const (
+	// MethodInfo 握手，返回 ProcessInfo
+	MethodInfo = "plugin.info"
+	// MethodInitialize 初始化，参数为 InitializeParams
+	MethodInitialize = "plugin.initialize"
+	// MethodStart 启动
+	MethodStart = "plugin.start"
+	// MethodStop 停止
+	MethodStop = "plugin.stop"
+	// MethodHealth 健康检查，返回错误表示不健康
+	MethodHealth = "plugin.health"
+	// MethodProcessRequest RequestPlugin.ProcessRequest，参数 RequestParams，结果 RequestResult
+	MethodProcessRequest = "request.process"
+	// MethodProcessResponse ResponsePlugin.ProcessResponse，参数 ResponseParams，结果 ResponseResult
+	MethodProcessResponse = "response.process"
+	// MethodShouldAllow FilterPlugin.ShouldAllow，参数 FilterParams，结果 FilterResult
+	MethodShouldAllow = "filter.should_allow"
+	// MethodModifyRequest ModifierPlugin.ModifyRequest，参数 RequestParams，结果 RequestResult
+	MethodModifyRequest = "modifier.modify_request"
+	// MethodModifyResponse ModifierPlugin.ModifyResponse，参数 ResponseParams，结果 ResponseResult
+	MethodModifyResponse = "modifier.modify_response"
+)
+
+// ProcessInfo 插件进程握手信息
+type ProcessInfo struct {
+	// Protocol 协议版本
+	Protocol    int    `json:"protocol"`
+	Name        string `json:"name"`
+	Version     string `json:"version"`
+	Description string `json:"description"`
+	// Hooks 插件实现的钩子类型（request、response、filter、modifier）
+	Hooks []PluginType `json:"hooks"`
+}
+
+// InitializeParams plugin.initialize 参数
+type InitializeParams struct {
+	Config map[string]interface{} `json:"config"`
+}
+
+// WireRequest 传输中的HTTP请求
+type WireRequest struct {
+	Method     string      `json:"method"`
+	URL        string      `json:"url"`
+	Proto      string      `json:"proto,omitempty"`
+	Host       string      `json:"host,omitempty"`
+	RemoteAddr string      `json:"remote_addr,omitempty"`
+	Header     http.Header `json:"header"`
+	// Body 请求正文（JSON 中为 Base64）
+	Body []byte `json:"body,omitempty"`
+	// BodyOmitted 正文超过 max_body_size 未发送，插件对正文的修改不会生效
+	BodyOmitted bool `json:"body_omitted,omitempty"`
+}
+
+// WireResponse 传输中的HTTP响应
+type WireResponse struct {
+	StatusCode int         `json:"status_code"`
+	Header     http.Header `json:"header"`
+	// Body 响应正文（JSON 中为 Base64，为上游返回的原始内容）
+	Body []byte `json:"body,omitempty"`
+	// BodyOmitted 正文超过 max_body_size 未发送，插件对正文的修改不会生效
+	BodyOmitted bool `json:"body_omitted,omitempty"`
+}
+
+// RequestParams request.process 和 modifier.modify_request 参数
+type RequestParams struct {
+	Request *WireRequest    `json:"request"`
+	Context *RequestContext `json:"context"`
+}
+
+// RequestResult 插件处理后的请求及新增的元数据
+type RequestResult struct {
+	Request  *WireRequest           `json:"request,omitempty"`
+	Metadata map[string]interface{} `json:"metadata,omitempty"`
+	// Response 插件直接返回的响应，设置后代理不再转发请求，见 RequestContext.Response
+	Response *WireResponse `json:"response,omitempty"`
+}
+
+// ResponseParams response.process 和 modifier.modify_response 参数，请求不含正文
+type ResponseParams struct {
+	Response *WireResponse    `json:"response"`
+	Request  *WireRequest     `json:"request"`
+	Context  *ResponseContext `json:"context"`
+}
+
+// ResponseResult 插件处理后的响应及新增的元数据
+type ResponseResult struct {
+	Response *WireResponse          `json:"response,omitempty"`
+	Metadata map[string]interface{} `json:"metadata,omitempty"`
+}
+
+// FilterParams filter.should_allow 参数
+type FilterParams struct {
+	Request *WireRequest   `json:"request"`
+	Context *FilterContext `json:"context"`
+}
+
+// FilterResult 过滤结果
+type FilterResult struct {
+	Allow    bool                   `json:"allow"`
+	Metadata map[string]interface{} `json:"metadata,omitempty"`
+	// Response 直接发送给客户端的响应（拦截页面、认证质询等），见 FilterContext.Response
+	Response *WireResponse `json:"response,omitempty"`
+}
+
+// EncodeRequest 序列化请求，正文超过 maxBody 字节时不发送正文；读取后的正文会重新设置到请求上
+// maxBody < 0 时不发送正文
+func EncodeRequest(req *http.Request, maxBody int) (*WireRequest, error) {
+	wire := &WireRequest{
+		Method:     req.Method,
+		URL:        req.URL.String(),
+		Proto:      req.Proto,
+		Host:       req.Host,
+		RemoteAddr: req.RemoteAddr,
+		Header:     req.Header.Clone(),
+	}
+	body, omitted, err := peekBody(&req.Body, maxBody)
+	if err != nil {
+		return nil, fmt.Errorf("读取请求正文失败: %w", err)
+	}
+	wire.Body, wire.BodyOmitted = body, omitted
+	return wire, nil
+}
+
+// ApplyRequest 将插件返回的请求写回原请求
+func ApplyRequest(req *http.Request, wire *WireRequest) error {
+	if wire == nil {
+		return nil
+	}
+	if wire.URL != "" {
+		u, err := url.Parse(wire.URL)
+		if err != nil {
+			return fmt.Errorf("插件返回的URL无效: %w", err)
+		}
+		req.URL = u
+	}
+	if wire.Method != "" {
+		req.Method = wire.Method
+	}
+	if wire.Host != "" {
+		req.Host = wire.Host
+	}
+	if wire.Header != nil {
+		req.Header = wire.Header
+	}
+	if !wire.BodyOmitted {
+		req.Body = io.NopCloser(bytes.NewReader(wire.Body))
+		req.ContentLength = int64(len(wire.Body))
+		if req.Header.Get("Content-Length") != "" {
+			req.Header.Set("Content-Length", strconv.Itoa(len(wire.Body)))
+		}
+	}
+	return nil
+}
+
+// NewRequestFromWire 在插件进程中还原请求
+func NewRequestFromWire(wire *WireRequest) (*http.Request, error) {
+	if wire == nil {
+		return nil, fmt.Errorf("缺少请求")
+	}
+	req, err := http.NewRequest(wire.Method, wire.URL, bytes.NewReader(wire.Body))
+	if err != nil {
+		return nil, err
+	}
+	if wire.Header != nil {
+		req.Header = wire.Header
+	}
+	if wire.Proto != "" {
+		req.Proto = wire.Proto
+	}
+	req.Host = wire.Host
+	req.RemoteAddr = wire.RemoteAddr
+	return req, nil
+}
+
+// EncodeResponse 序列化响应，正文超过 maxBody 字节时不发送正文；读取后的正文会重新设置到响应上
+func EncodeResponse(resp *http.Response, maxBody int) (*WireResponse, error) {
+	wire := &WireResponse{
+		StatusCode: resp.StatusCode,
+		Header:     resp.Header.Clone(),
+	}
+	body, omitted, err := peekBody(&resp.Body, maxBody)
+	if err != nil {
+		return nil, fmt.Errorf("读取响应正文失败: %w", err)
+	}
+	wire.Body, wire.BodyOmitted = body, omitted
+	return wire, nil
+}
+
+// ApplyResponse 将插件返回的响应写回原响应
+func ApplyResponse(resp *http.Response, wire *WireResponse) {
+	if wire == nil {
+		return
+	}
+	if wire.StatusCode != 0 && wire.StatusCode != resp.StatusCode {
+		resp.StatusCode = wire.StatusCode
+		resp.Status = fmt.Sprintf("%d %s", wire.StatusCode, http.StatusText(wire.StatusCode))
+	}
+	if wire.Header != nil {
+		// 代理按 resp.Header 复制响应头，原地替换内容
+		for name := range resp.Header {
+			delete(resp.Header, name)
+		}
+		for name, values := range wire.Header {
+			resp.Header[name] = values
+		}
+	}
+	if !wire.BodyOmitted {
+		resp.Body = io.NopCloser(bytes.NewReader(wire.Body))
+		resp.ContentLength = int64(len(wire.Body))
+		if resp.Header.Get("Content-Length") != "" {
+			resp.Header.Set("Content-Length", strconv.Itoa(len(wire.Body)))
+		}
+	}
+}
+
+// NewResponseFromWire 在插件进程中还原响应
+func NewResponseFromWire(wire *WireResponse, req *http.Request) *http.Response {
+	header := wire.Header
+	if header == nil {
+		header = make(http.Header)
+	}
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", wire.StatusCode, http.StatusText(wire.StatusCode)),
+		StatusCode:    wire.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(bytes.NewReader(wire.Body)),
+		ContentLength: int64(len(wire.Body)),
+		Request:       req,
+	}
+}
+
+// peekBody 读取不超过 maxBody 字节的正文，超过时返回 omitted；
+// 无论是否超过，body 都被替换为可从头读取的完整正文
+func peekBody(body *io.ReadCloser, maxBody int) ([]byte, bool, error) {
+	if *body == nil || *body == http.NoBody {
+		return nil, false, nil
+	}
+	if maxBody < 0 {
+		return nil, true, nil
+	}
+
+	original := *body
+	data, err := io.ReadAll(io.LimitReader(original, int64(maxBody)+1))
+	if err != nil {
+		return nil, false, err
+	}
+	if len(data) > maxBody {
+		*body = readCloser{io.MultiReader(bytes.NewReader(data), original), original}
+		return nil, true, nil
+	}
+	original.Close()
+	*body = io.NopCloser(bytes.NewReader(data))
+	return data, false, nil
+}
+
+// readCloser 组合读取器与原正文的关闭方法
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
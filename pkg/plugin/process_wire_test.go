@@ -0,0 +1,189 @@
+package plugin
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestEncodeRequestBody(t *testing.T) {
+	tests := []struct {
+		name        string
+		body        string
+		maxBody     int
+		wantBody    string
+		wantOmitted bool
+	}{
+		{name: "正文未超过上限", body: "hello", maxBody: 5, wantBody: "hello"},
+		{name: "正文超过上限不发送", body: "hello!", maxBody: 5, wantOmitted: true},
+		{name: "maxBody为负数时不发送", body: "hello", maxBody: -1, wantOmitted: true},
+		{name: "没有正文", maxBody: 5},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var body io.Reader
+			if tt.body != "" {
+				body = strings.NewReader(tt.body)
+			}
+			req := httptest.NewRequest("POST", "http://example.test/a?b=1", body)
+
+			wire, err := EncodeRequest(req, tt.maxBody)
+			if err != nil {
+				t.Fatalf("EncodeRequest() error = %v", err)
+			}
+			if string(wire.Body) != tt.wantBody || wire.BodyOmitted != tt.wantOmitted {
+				t.Errorf("Body = %q, BodyOmitted = %v, want %q, %v", wire.Body, wire.BodyOmitted, tt.wantBody, tt.wantOmitted)
+			}
+
+			// 无论是否发送，原请求的正文都必须完整可读
+			rest, err := io.ReadAll(req.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(rest) != tt.body {
+				t.Errorf("编码后原请求正文 = %q, want %q", rest, tt.body)
+			}
+		})
+	}
+}
+
+func TestWireRequestJSON(t *testing.T) {
+	req := httptest.NewRequest("POST", "http://example.test/login", strings.NewReader("a=1"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	wire, err := EncodeRequest(req, 1024)
+	if err != nil {
+		t.Fatalf("EncodeRequest() error = %v", err)
+	}
+
+	data, err := json.Marshal(wire)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"method":"POST","url":"http://example.test/login","proto":"HTTP/1.1","host":"example.test",` +
+		`"remote_addr":"192.0.2.1:1234","header":{"Content-Type":["application/x-www-form-urlencoded"]},"body":"YT0x"}`
+	if string(data) != want {
+		t.Errorf("JSON = %s\nwant   %s", data, want)
+	}
+
+	var decoded WireRequest
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	restored, err := NewRequestFromWire(&decoded)
+	if err != nil {
+		t.Fatalf("NewRequestFromWire() error = %v", err)
+	}
+	body, _ := io.ReadAll(restored.Body)
+	if restored.Method != "POST" || restored.URL.String() != wire.URL || restored.Host != "example.test" ||
+		restored.RemoteAddr != "192.0.2.1:1234" || string(body) != "a=1" ||
+		restored.Header.Get("Content-Type") != "application/x-www-form-urlencoded" {
+		t.Errorf("还原的请求与原请求不一致: %+v, body %q", restored, body)
+	}
+}
+
+func TestWireResponseJSON(t *testing.T) {
+	data, err := json.Marshal(&WireResponse{StatusCode: 204, Header: http.Header{}, BodyOmitted: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `{"status_code":204,"header":{},"body_omitted":true}`; string(data) != want {
+		t.Errorf("JSON = %s, want %s", data, want)
+	}
+}
+
+func TestApplyRequest(t *testing.T) {
+	tests := []struct {
+		name     string
+		wire     *WireRequest
+		wantURL  string
+		wantBody string
+		// wantLength Content-Length 请求头，空表示不检查
+		wantLength string
+		wantErr    bool
+	}{
+		{
+			name:     "nil不修改请求",
+			wantURL:  "http://example.test/a",
+			wantBody: "original",
+		},
+		{
+			name:       "替换URL与正文并更新Content-Length",
+			wire:       &WireRequest{URL: "http://other.test/b", Header: http.Header{"Content-Length": {"8"}}, Body: []byte("changed!!")},
+			wantURL:    "http://other.test/b",
+			wantBody:   "changed!!",
+			wantLength: "9",
+		},
+		{
+			name:     "未发送正文时保留原正文",
+			wire:     &WireRequest{Method: "PUT", BodyOmitted: true},
+			wantURL:  "http://example.test/a",
+			wantBody: "original",
+		},
+		{
+			name:    "无效URL",
+			wire:    &WireRequest{URL: "http://[::1"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "http://example.test/a", strings.NewReader("original"))
+			err := ApplyRequest(req, tt.wire)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("ApplyRequest() 未返回错误")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ApplyRequest() error = %v", err)
+			}
+
+			body, _ := io.ReadAll(req.Body)
+			if req.URL.String() != tt.wantURL || string(body) != tt.wantBody {
+				t.Errorf("URL = %s, body = %q, want %s, %q", req.URL, body, tt.wantURL, tt.wantBody)
+			}
+			if tt.wire != nil && tt.wire.Method != "" && req.Method != tt.wire.Method {
+				t.Errorf("Method = %s, want %s", req.Method, tt.wire.Method)
+			}
+			if tt.wantLength != "" {
+				if got := req.Header.Get("Content-Length"); got != tt.wantLength || req.ContentLength != int64(len(tt.wantBody)) {
+					t.Errorf("Content-Length = %s (%d), want %s", got, req.ContentLength, tt.wantLength)
+				}
+			}
+		})
+	}
+}
+
+func TestApplyResponse(t *testing.T) {
+	resp := &http.Response{
+		StatusCode: 200,
+		Status:     "200 OK",
+		Header:     http.Header{"Content-Length": {"2"}, "X-Old": {"1"}},
+		Body:       io.NopCloser(strings.NewReader("ok")),
+	}
+	header := resp.Header
+
+	ApplyResponse(resp, &WireResponse{
+		StatusCode: 403,
+		Header:     http.Header{"Content-Length": {"2"}, "X-New": {"1"}},
+		Body:       []byte("denied"),
+	})
+
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != 403 || resp.Status != "403 Forbidden" || string(body) != "denied" {
+		t.Errorf("响应 = %d %q, body %q", resp.StatusCode, resp.Status, body)
+	}
+	if resp.Header.Get("X-Old") != "" || resp.Header.Get("X-New") != "1" || resp.Header.Get("Content-Length") != "6" {
+		t.Errorf("响应头 = %v", resp.Header)
+	}
+	// 代理持有原 Header 的引用，必须原地修改
+	if header.Get("X-New") != "1" {
+		t.Error("响应头未原地替换")
+	}
+}
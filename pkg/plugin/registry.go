@@ -0,0 +1,92 @@
+// Package plugin 编译进二进制文件的插件注册表
+package plugin
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// registry 已注册的插件工厂
+var registry = struct {
+	sync.RWMutex
+	factories map[string]Factory
+}{factories: make(map[string]Factory)}
+
+// Register 注册编译进二进制文件的插件，通常在插件包的 init 函数中调用；
+// 配置中名称（或路径）与注册名称相同的插件直接使用工厂函数创建，无需 .so 文件。
+// 名称为空、工厂为nil或名称重复时 panic
+//
+// Register makes a compiled-in plugin available to the manager under name.
+func Register(name string, factory Factory) {
+	if name == "" {
+		panic("plugin: 注册的插件名称不能为空")
+	}
+	if factory == nil {
+		panic("plugin: 插件 " + name + " 的工厂函数为nil")
+	}
+
+	registry.Lock()
+	defer registry.Unlock()
+	if _, exists := registry.factories[name]; exists {
+		panic(fmt.Sprintf("plugin: 插件 %s 重复注册", name))
+	}
+	registry.factories[name] = factory
+}
+
+// LookupFactory 查找已注册的插件工厂
+func LookupFactory(name string) (Factory, bool) {
+	registry.RLock()
+	defer registry.RUnlock()
+	factory, exists := registry.factories[name]
+	return factory, exists
+}
+
+// IsRegistered 名称是否为已注册的插件，可用作 config.LoadOptions.BuiltinPlugin
+func IsRegistered(name string) bool {
+	_, exists := LookupFactory(name)
+	return exists
+}
+
+// RegisteredPlugins 返回已注册的插件名称（已排序）
+func RegisteredPlugins() []string {
+	registry.RLock()
+	defer registry.RUnlock()
+
+	names := make([]string, 0, len(registry.factories))
+	for name := range registry.factories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// registeredFactory 按插件名称、其次按配置中的路径查找已注册的插件工厂
+func registeredFactory(config *PluginConfig) (string, Factory, bool) {
+	if factory, ok := LookupFactory(config.Name); ok {
+		return config.Name, factory, true
+	}
+	if config.Path != "" {
+		if factory, ok := LookupFactory(config.Path); ok {
+			return config.Path, factory, true
+		}
+	}
+	return "", nil, false
+}
+
+// builtinPluginPath 内置插件在插件信息中显示的路径
+func builtinPluginPath(name string) string {
+	return "builtin:" + name
+}
+
+// newBuiltinPlugin 使用注册的工厂函数创建插件实例
+func newBuiltinPlugin(config *PluginConfig, factory Factory) (Plugin, error) {
+	pluginInstance, err := factory(config.Config)
+	if err != nil {
+		return nil, fmt.Errorf("创建插件实例失败: %w", err)
+	}
+	if pluginInstance == nil {
+		return nil, fmt.Errorf("插件工厂返回了nil")
+	}
+	return pluginInstance, nil
+}
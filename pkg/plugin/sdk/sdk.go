@@ -0,0 +1,357 @@
+// Package sdk 进程外插件开发包：将实现 plugin 包接口的插件作为独立进程运行
+// Package sdk runs a plugin implementing the plugin package interfaces as an out-of-process plugin
+//
+// 插件进程由代理按配置（runtime 为 process）启动，通过 stdio 或 unix 套接字使用 JSON-RPC 2.0 通信：
+//
+//	func main() {
+//		sdk.Main(NewMyPlugin())
+//	}
+//
+// 插件实现 plugin.RequestPlugin、ResponsePlugin、FilterPlugin、ModifierPlugin 中的任意几个，
+// 代理只调用插件实际实现的钩子；实现 HealthChecker 的插件可自定义健康检查。
+// 使用 stdio 通信时 os.Stdout 被重定向到 stderr，插件的输出和日志都会出现在代理日志中。
+package sdk
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+
+	"hackmitm/pkg/logger"
+	"hackmitm/pkg/plugin"
+	"hackmitm/pkg/plugin/jsonrpc"
+)
+
+// ErrNotLaunched 插件进程不是由代理启动的
+var ErrNotLaunched = errors.New("进程外插件需要由 hackmitm 按配置启动（runtime: process）")
+
+// maxBodySize 插件返回的最大正文字节数
+const maxBodySize = 64 * 1024 * 1024
+
+// HealthChecker 自定义健康检查，返回错误时代理计为一次健康检查失败
+type HealthChecker interface {
+	HealthCheck() error
+}
+
+// Main 运行插件，出错时输出到 stderr 并以退出码 1 结束，可直接在 main 函数中调用
+func Main(p plugin.Plugin) {
+	if err := Serve(p); err != nil {
+		fmt.Fprintf(os.Stderr, "插件 %s 退出: %v\n", p.Name(), err)
+		os.Exit(1)
+	}
+}
+
+// Serve 运行插件直到代理断开连接，随后停止并清理插件
+func Serve(p plugin.Plugin) error {
+	if os.Getenv(plugin.EnvPluginProtocol) == "" {
+		return ErrNotLaunched
+	}
+
+	s := &server{plugin: p}
+	defer s.shutdown()
+
+	if socketPath := os.Getenv(plugin.EnvPluginSocket); socketPath != "" {
+		return s.serveUnix(socketPath)
+	}
+	return s.serveStdio()
+}
+
+// server 插件进程端的请求处理
+type server struct {
+	plugin  plugin.Plugin
+	mutex   sync.Mutex
+	started bool
+}
+
+// serveStdio 通过 stdin/stdout 通信，stdout 只用于协议消息
+func (s *server) serveStdio() error {
+	protocolOut := os.Stdout
+	os.Stdout = os.Stderr
+	logger.DefaultLogger.SetOutput(os.Stderr)
+
+	conn := jsonrpc.NewConn(stdio{Reader: os.Stdin, Writer: protocolOut}, s.handle)
+	<-conn.Done()
+	return nil
+}
+
+// serveUnix 监听代理指定的套接字，服务第一个连接直到其断开
+func (s *server) serveUnix(socketPath string) error {
+	listener, err := net.Listen("unix", socketPath)
+	if err != nil {
+		return fmt.Errorf("监听插件套接字失败: %w", err)
+	}
+	defer listener.Close()
+
+	netConn, err := listener.Accept()
+	if err != nil {
+		return fmt.Errorf("接受代理连接失败: %w", err)
+	}
+	conn := jsonrpc.NewConn(netConn, s.handle)
+	<-conn.Done()
+	return nil
+}
+
+// shutdown 代理断开后停止并清理插件
+func (s *server) shutdown() {
+	s.mutex.Lock()
+	started := s.started
+	s.started = false
+	s.mutex.Unlock()
+
+	if started {
+		s.plugin.Stop(context.Background())
+	}
+	s.plugin.Cleanup()
+}
+
+// hooks 插件实现的钩子类型
+func (s *server) hooks() []plugin.PluginType {
+	if hookProvider, ok := s.plugin.(plugin.HookProvider); ok {
+		return hookProvider.Hooks()
+	}
+
+	hooks := []plugin.PluginType{}
+	if _, ok := s.plugin.(plugin.RequestPlugin); ok {
+		hooks = append(hooks, plugin.TypeRequest)
+	}
+	if _, ok := s.plugin.(plugin.ResponsePlugin); ok {
+		hooks = append(hooks, plugin.TypeResponse)
+	}
+	if _, ok := s.plugin.(plugin.FilterPlugin); ok {
+		hooks = append(hooks, plugin.TypeFilter)
+	}
+	if _, ok := s.plugin.(plugin.ModifierPlugin); ok {
+		hooks = append(hooks, plugin.TypeModifier)
+	}
+	return hooks
+}
+
+// handle 分发代理的调用
+func (s *server) handle(ctx context.Context, method string, params json.RawMessage) (interface{}, error) {
+	switch method {
+	case plugin.MethodInfo:
+		return plugin.ProcessInfo{
+			Protocol:    plugin.ProcessProtocolVersion,
+			Name:        s.plugin.Name(),
+			Version:     s.plugin.Version(),
+			Description: s.plugin.Description(),
+			Hooks:       s.hooks(),
+		}, nil
+
+	case plugin.MethodInitialize:
+		var init plugin.InitializeParams
+		if err := decode(params, &init); err != nil {
+			return nil, err
+		}
+		return struct{}{}, s.plugin.Initialize(init.Config)
+
+	case plugin.MethodStart:
+		if err := s.plugin.Start(ctx); err != nil {
+			return nil, err
+		}
+		s.mutex.Lock()
+		s.started = true
+		s.mutex.Unlock()
+		return struct{}{}, nil
+
+	case plugin.MethodStop:
+		s.mutex.Lock()
+		s.started = false
+		s.mutex.Unlock()
+		return struct{}{}, s.plugin.Stop(ctx)
+
+	case plugin.MethodHealth:
+		if healthChecker, ok := s.plugin.(HealthChecker); ok {
+			if err := healthChecker.HealthCheck(); err != nil {
+				return nil, err
+			}
+		}
+		return map[string]string{"status": "ok"}, nil
+
+	case plugin.MethodProcessRequest:
+		requestPlugin, ok := s.plugin.(plugin.RequestPlugin)
+		if !ok {
+			return nil, methodNotFound(method)
+		}
+		return s.handleRequest(params, requestPlugin.ProcessRequest)
+
+	case plugin.MethodModifyRequest:
+		modifierPlugin, ok := s.plugin.(plugin.ModifierPlugin)
+		if !ok {
+			return nil, methodNotFound(method)
+		}
+		return s.handleRequest(params, modifierPlugin.ModifyRequest)
+
+	case plugin.MethodProcessResponse:
+		responsePlugin, ok := s.plugin.(plugin.ResponsePlugin)
+		if !ok {
+			return nil, methodNotFound(method)
+		}
+		return s.handleResponse(params, responsePlugin.ProcessResponse)
+
+	case plugin.MethodModifyResponse:
+		modifierPlugin, ok := s.plugin.(plugin.ModifierPlugin)
+		if !ok {
+			return nil, methodNotFound(method)
+		}
+		return s.handleResponse(params, modifierPlugin.ModifyResponse)
+
+	case plugin.MethodShouldAllow:
+		filterPlugin, ok := s.plugin.(plugin.FilterPlugin)
+		if !ok {
+			return nil, methodNotFound(method)
+		}
+		var call plugin.FilterParams
+		if err := decode(params, &call); err != nil {
+			return nil, err
+		}
+		req, err := plugin.NewRequestFromWire(call.Request)
+		if err != nil {
+			return nil, invalidParams(err)
+		}
+		filterCtx := call.Context
+		if filterCtx == nil {
+			filterCtx = &plugin.FilterContext{}
+		}
+		if filterCtx.Metadata == nil {
+			filterCtx.Metadata = make(map[string]interface{})
+		}
+		allowed, err := filterPlugin.ShouldAllow(req, filterCtx)
+		if err != nil {
+			return nil, err
+		}
+		respond, err := encodePluginResponse(filterCtx.Response)
+		if err != nil {
+			return nil, err
+		}
+		return plugin.FilterResult{Allow: allowed, Metadata: filterCtx.Metadata, Response: respond}, nil
+
+	default:
+		return nil, methodNotFound(method)
+	}
+}
+
+// handleRequest 还原请求、调用请求钩子并返回修改后的请求
+func (s *server) handleRequest(params json.RawMessage, hook func(*http.Request, *plugin.RequestContext) error) (interface{}, error) {
+	var call plugin.RequestParams
+	if err := decode(params, &call); err != nil {
+		return nil, err
+	}
+	req, err := plugin.NewRequestFromWire(call.Request)
+	if err != nil {
+		return nil, invalidParams(err)
+	}
+	requestCtx := call.Context
+	if requestCtx == nil {
+		requestCtx = &plugin.RequestContext{}
+	}
+	if requestCtx.Metadata == nil {
+		requestCtx.Metadata = make(map[string]interface{})
+	}
+
+	if err := hook(req, requestCtx); err != nil {
+		return nil, err
+	}
+
+	// 代理未发送正文时插件无法修改正文，返回时同样不带正文
+	limit := maxBodySize
+	if call.Request.BodyOmitted {
+		limit = -1
+	}
+	wire, err := plugin.EncodeRequest(req, limit)
+	if err != nil {
+		return nil, err
+	}
+	respond, err := encodePluginResponse(requestCtx.Response)
+	if err != nil {
+		return nil, err
+	}
+	return plugin.RequestResult{Request: wire, Metadata: requestCtx.Metadata, Response: respond}, nil
+}
+
+// encodePluginResponse 序列化插件通过上下文直接返回的响应，未设置时为nil
+func encodePluginResponse(resp *http.Response) (*plugin.WireResponse, error) {
+	if resp == nil {
+		return nil, nil
+	}
+	wire, err := plugin.EncodeResponse(resp, maxBodySize)
+	if err != nil {
+		return nil, err
+	}
+	if wire.BodyOmitted {
+		return nil, fmt.Errorf("插件返回的响应正文超过 %d 字节", maxBodySize)
+	}
+	return wire, nil
+}
+
+// handleResponse 还原响应、调用响应钩子并返回修改后的响应
+func (s *server) handleResponse(params json.RawMessage, hook func(*http.Response, *http.Request, *plugin.ResponseContext) error) (interface{}, error) {
+	var call plugin.ResponseParams
+	if err := decode(params, &call); err != nil {
+		return nil, err
+	}
+	if call.Response == nil || call.Request == nil {
+		return nil, invalidParams(errors.New("缺少 response 或 request"))
+	}
+	req, err := plugin.NewRequestFromWire(call.Request)
+	if err != nil {
+		return nil, invalidParams(err)
+	}
+	resp := plugin.NewResponseFromWire(call.Response, req)
+	responseCtx := call.Context
+	if responseCtx == nil {
+		responseCtx = &plugin.ResponseContext{}
+	}
+	if responseCtx.Metadata == nil {
+		responseCtx.Metadata = make(map[string]interface{})
+	}
+
+	if err := hook(resp, req, responseCtx); err != nil {
+		return nil, err
+	}
+
+	limit := maxBodySize
+	if call.Response.BodyOmitted {
+		limit = -1
+	}
+	wire, err := plugin.EncodeResponse(resp, limit)
+	if err != nil {
+		return nil, err
+	}
+	return plugin.ResponseResult{Response: wire, Metadata: responseCtx.Metadata}, nil
+}
+
+// decode 解码调用参数
+func decode(params json.RawMessage, v interface{}) error {
+	if err := json.Unmarshal(params, v); err != nil {
+		return invalidParams(err)
+	}
+	return nil
+}
+
+// invalidParams 参数错误
+func invalidParams(err error) error {
+	return &jsonrpc.Error{Code: jsonrpc.CodeInvalidParams, Message: err.Error()}
+}
+
+// methodNotFound 插件未实现的方法
+func methodNotFound(method string) error {
+	return &jsonrpc.Error{Code: jsonrpc.CodeMethodNotFound, Message: "插件未实现: " + method}
+}
+
+// stdio 由 stdin 和 stdout 组成的连接
+type stdio struct {
+	io.Reader
+	io.Writer
+}
+
+// Close 关闭 stdin 结束读取
+func (stdio) Close() error {
+	return os.Stdin.Close()
+}
@@ -7,13 +7,14 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
-	"net"
 	"net/http"
 	"net/url"
 	"regexp"
 	"strconv"
 	"strings"
 	"time"
+
+	"hackmitm/pkg/security"
 )
 
 // RequestUtils 请求工具
@@ -25,29 +26,9 @@ func NewRequestUtils() *RequestUtils {
 }
 
 // GetClientIP 获取客户端IP
+// 返回代理服务器按 security.trusted_proxies 解析的地址，不直接采信请求中的转发头
 func (ru *RequestUtils) GetClientIP(req *http.Request) string {
-	// 检查 X-Forwarded-For 头
-	if xff := req.Header.Get("X-Forwarded-For"); xff != "" {
-		ips := strings.Split(xff, ",")
-		if len(ips) > 0 {
-			return strings.TrimSpace(ips[0])
-		}
-	}
-
-	// 检查 X-Real-IP 头
-	if xri := req.Header.Get("X-Real-IP"); xri != "" {
-		return strings.TrimSpace(xri)
-	}
-
-	// 使用 RemoteAddr
-	if req.RemoteAddr != "" {
-		if host, _, err := net.SplitHostPort(req.RemoteAddr); err == nil {
-			return host
-		}
-		return req.RemoteAddr
-	}
-
-	return "unknown"
+	return security.ClientIP(req)
 }
 
 // GetUserAgent 获取用户代理
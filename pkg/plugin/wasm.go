@@ -0,0 +1,760 @@
+// Package plugin WebAssembly 插件运行时
+package plugin
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/tetratelabs/wazero"
+	"github.com/tetratelabs/wazero/api"
+	"github.com/tetratelabs/wazero/imports/wasi_snapshot_preview1"
+
+	"hackmitm/pkg/logger"
+)
+
+// WasmHostModule WASM 插件导入宿主函数使用的模块名
+const WasmHostModule = "hackmitm"
+
+// WASM 插件导出的钩子函数，均无参数并返回 i32
+const (
+	// WasmExportOnRequest 对应 RequestPlugin.ProcessRequest，返回0表示成功，其他值表示错误
+	WasmExportOnRequest = "hackmitm_on_request"
+	// WasmExportOnResponse 对应 ResponsePlugin.ProcessResponse，返回0表示成功，其他值表示错误
+	WasmExportOnResponse = "hackmitm_on_response"
+	// WasmExportShouldAllow 对应 FilterPlugin.ShouldAllow，返回1允许、0拒绝，负数表示错误
+	WasmExportShouldAllow = "hackmitm_should_allow"
+)
+
+// 宿主函数中 kind 参数的取值
+const (
+	wasmKindRequest  = 0
+	wasmKindResponse = 1
+)
+
+const (
+	// wasmPageSize WebAssembly 内存页大小
+	wasmPageSize = 64 * 1024
+	// maxIdleWasmInstances 每个插件保留的空闲实例数
+	maxIdleWasmInstances = 16
+)
+
+// withDefaults 返回填充默认值后的选项
+func (o WasmOptions) withDefaults() WasmOptions {
+	if o.MaxMemory <= 0 {
+		o.MaxMemory = 64 * 1024 * 1024
+	}
+	if o.CallTimeout <= 0 {
+		o.CallTimeout = time.Second
+	}
+	if o.MaxBodySize == 0 {
+		o.MaxBodySize = 1024 * 1024
+	}
+	return o
+}
+
+// wasmPlugin WebAssembly 插件，按模块导出的钩子函数加入类型分组
+// 每次调用独占一个模块实例，实例在调用出错或超时后丢弃，因此插件不应依赖调用之间的状态
+type wasmPlugin struct {
+	// name 配置中的插件名称
+	name string
+	// path .wasm 文件路径
+	path string
+	// options 运行选项
+	options WasmOptions
+	// priority 优先级
+	priority int
+	// hooks 模块导出的钩子
+	hooks []PluginType
+
+	runtime  wazero.Runtime
+	compiled wazero.CompiledModule
+	stdout   *processLogWriter
+
+	// config 插件配置（JSON），通过 get_config 提供给模块
+	config []byte
+
+	// idle 空闲实例
+	idle chan api.Module
+	// closed 已清理
+	closed atomic.Bool
+
+	calls     int64
+	failures  int64
+	timeouts  int64
+	instances int64
+}
+
+// wasmCall 一次钩子调用的状态，通过 context 传给宿主函数
+type wasmCall struct {
+	plugin   *wasmPlugin
+	req      *http.Request
+	resp     *http.Response
+	metadata map[string]interface{}
+	// username、policy、clientIP 通过 get_property 提供
+	username string
+	policy   string
+	clientIP string
+	// requestReadOnly 响应阶段请求已发出，不能再修改
+	requestReadOnly bool
+
+	bodies [2]wasmBody
+}
+
+// wasmBody 按需读取的正文
+type wasmBody struct {
+	loaded  bool
+	data    []byte
+	omitted bool
+}
+
+// wasmCallKey context 中 wasmCall 的键
+type wasmCallKey struct{}
+
+// newWasmPlugin 编译 WASM 模块
+func newWasmPlugin(config *PluginConfig, path string) (*wasmPlugin, error) {
+	code, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("读取WASM插件失败: %w", err)
+	}
+
+	p := &wasmPlugin{
+		name:     config.Name,
+		path:     path,
+		options:  config.Wasm.withDefaults(),
+		priority: config.Priority,
+		stdout:   newProcessLogWriter(config.Name),
+		idle:     make(chan api.Module, maxIdleWasmInstances),
+	}
+
+	ctx := context.Background()
+	pages := uint32((p.options.MaxMemory + wasmPageSize - 1) / wasmPageSize)
+	p.runtime = wazero.NewRuntimeWithConfig(ctx, wazero.NewRuntimeConfig().
+		WithMemoryLimitPages(pages).
+		WithCloseOnContextDone(true))
+
+	if _, err := wasi_snapshot_preview1.Instantiate(ctx, p.runtime); err != nil {
+		p.runtime.Close(ctx)
+		return nil, fmt.Errorf("初始化WASI失败: %w", err)
+	}
+	if err := p.instantiateHostModule(ctx); err != nil {
+		p.runtime.Close(ctx)
+		return nil, fmt.Errorf("注册宿主函数失败: %w", err)
+	}
+
+	p.compiled, err = p.runtime.CompileModule(ctx, code)
+	if err != nil {
+		p.runtime.Close(ctx)
+		return nil, fmt.Errorf("编译WASM插件失败: %w", err)
+	}
+	if err := p.inspectExports(); err != nil {
+		p.runtime.Close(ctx)
+		return nil, err
+	}
+	return p, nil
+}
+
+// inspectExports 检查模块导出的内存和钩子函数
+func (p *wasmPlugin) inspectExports() error {
+	if len(p.compiled.ExportedMemories()) == 0 {
+		return fmt.Errorf("WASM插件未导出内存")
+	}
+
+	exports := p.compiled.ExportedFunctions()
+	hookExports := []struct {
+		name string
+		hook PluginType
+	}{
+		{WasmExportOnRequest, TypeRequest},
+		{WasmExportOnResponse, TypeResponse},
+		{WasmExportShouldAllow, TypeFilter},
+	}
+	for _, export := range hookExports {
+		definition, ok := exports[export.name]
+		if !ok {
+			continue
+		}
+		results := definition.ResultTypes()
+		if len(definition.ParamTypes()) != 0 || len(results) != 1 || results[0] != api.ValueTypeI32 {
+			return fmt.Errorf("WASM插件导出函数 %s 的签名必须是 () -> i32", export.name)
+		}
+		p.hooks = append(p.hooks, export.hook)
+	}
+	if len(p.hooks) == 0 {
+		return fmt.Errorf("WASM插件未导出任何钩子函数（%s、%s、%s）",
+			WasmExportOnRequest, WasmExportOnResponse, WasmExportShouldAllow)
+	}
+	return nil
+}
+
+// Name 实现 Plugin
+func (p *wasmPlugin) Name() string {
+	return p.name
+}
+
+// Version 实现 Plugin
+func (p *wasmPlugin) Version() string {
+	return "wasm"
+}
+
+// Description 实现 Plugin
+func (p *wasmPlugin) Description() string {
+	return "WebAssembly 插件: " + p.path
+}
+
+// Hooks 实现 HookProvider
+func (p *wasmPlugin) Hooks() []PluginType {
+	return p.hooks
+}
+
+// Priority 返回配置的优先级
+func (p *wasmPlugin) Priority() int {
+	return p.priority
+}
+
+// Initialize 保存插件配置并创建第一个实例，确认模块可以实例化
+func (p *wasmPlugin) Initialize(config map[string]interface{}) error {
+	if config == nil {
+		config = map[string]interface{}{}
+	}
+	data, err := json.Marshal(config)
+	if err != nil {
+		return fmt.Errorf("编码插件配置失败: %w", err)
+	}
+	p.config = data
+
+	instance, err := p.instantiate(context.Background())
+	if err != nil {
+		return err
+	}
+	p.release(instance)
+	return nil
+}
+
+// Start 实现 Plugin
+func (p *wasmPlugin) Start(ctx context.Context) error {
+	return nil
+}
+
+// Stop 实现 Plugin
+func (p *wasmPlugin) Stop(ctx context.Context) error {
+	return nil
+}
+
+// Cleanup 关闭运行时，释放所有实例
+func (p *wasmPlugin) Cleanup() error {
+	if !p.closed.CompareAndSwap(false, true) {
+		return nil
+	}
+	return p.runtime.Close(context.Background())
+}
+
+// ProcessRequest 实现 RequestPlugin
+func (p *wasmPlugin) ProcessRequest(req *http.Request, ctx *RequestContext) error {
+	call := &wasmCall{
+		plugin:   p,
+		req:      req,
+		metadata: ctx.Metadata,
+		username: ctx.Username,
+		policy:   ctx.Policy,
+		clientIP: ctx.ClientIP,
+	}
+	result, err := p.invoke(WasmExportOnRequest, call)
+	ctx.Metadata = call.metadata
+	if err != nil {
+		return err
+	}
+	if result != 0 {
+		return fmt.Errorf("WASM插件 %s 返回错误码 %d", WasmExportOnRequest, result)
+	}
+	if call.resp != nil {
+		ctx.Response = call.resp
+	}
+	return nil
+}
+
+// ProcessResponse 实现 ResponsePlugin
+func (p *wasmPlugin) ProcessResponse(resp *http.Response, req *http.Request, ctx *ResponseContext) error {
+	call := &wasmCall{
+		plugin:          p,
+		req:             req,
+		resp:            resp,
+		metadata:        ctx.Metadata,
+		username:        ctx.Username,
+		policy:          ctx.Policy,
+		requestReadOnly: true,
+	}
+	result, err := p.invoke(WasmExportOnResponse, call)
+	ctx.Metadata = call.metadata
+	if err != nil {
+		return err
+	}
+	if result != 0 {
+		return fmt.Errorf("WASM插件 %s 返回错误码 %d", WasmExportOnResponse, result)
+	}
+	return nil
+}
+
+// ShouldAllow 实现 FilterPlugin
+func (p *wasmPlugin) ShouldAllow(req *http.Request, ctx *FilterContext) (bool, error) {
+	call := &wasmCall{
+		plugin:   p,
+		req:      req,
+		metadata: ctx.Metadata,
+		username: ctx.Username,
+		policy:   ctx.Policy,
+		clientIP: ctx.ClientIP,
+	}
+	result, err := p.invoke(WasmExportShouldAllow, call)
+	ctx.Metadata = call.metadata
+	if err != nil {
+		return false, err
+	}
+	if result < 0 {
+		return false, fmt.Errorf("WASM插件 %s 返回错误码 %d", WasmExportShouldAllow, result)
+	}
+	if call.resp != nil {
+		ctx.Response = call.resp
+	}
+	return result == 1, nil
+}
+
+// invoke 取一个实例调用导出函数，超过 call_timeout 时中止执行
+func (p *wasmPlugin) invoke(export string, call *wasmCall) (int32, error) {
+	if p.closed.Load() {
+		return 0, fmt.Errorf("WASM插件已关闭")
+	}
+	atomic.AddInt64(&p.calls, 1)
+
+	ctx, cancel := context.WithTimeout(context.WithValue(context.Background(), wasmCallKey{}, call), p.options.CallTimeout)
+	defer cancel()
+
+	instance, err := p.acquire(ctx)
+	if err != nil {
+		atomic.AddInt64(&p.failures, 1)
+		return 0, err
+	}
+
+	results, err := instance.ExportedFunction(export).Call(ctx)
+	if err != nil {
+		// 实例状态不再可信，直接丢弃
+		p.discard(instance)
+		atomic.AddInt64(&p.failures, 1)
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			atomic.AddInt64(&p.timeouts, 1)
+			return 0, fmt.Errorf("WASM插件执行超过 %v", p.options.CallTimeout)
+		}
+		return 0, fmt.Errorf("WASM插件执行失败: %w", err)
+	}
+	p.release(instance)
+	return int32(results[0]), nil
+}
+
+// acquire 取出空闲实例，没有时创建新实例
+func (p *wasmPlugin) acquire(ctx context.Context) (api.Module, error) {
+	select {
+	case instance := <-p.idle:
+		return instance, nil
+	default:
+		return p.instantiate(ctx)
+	}
+}
+
+// instantiate 创建模块实例，运行 _initialize（如果导出）
+func (p *wasmPlugin) instantiate(ctx context.Context) (api.Module, error) {
+	moduleConfig := wazero.NewModuleConfig().
+		WithName("").
+		WithStartFunctions("_initialize").
+		WithStdout(p.stdout).
+		WithStderr(p.stdout).
+		WithSysWalltime().
+		WithSysNanotime().
+		WithRandSource(rand.Reader).
+		WithArgs(p.name)
+	instance, err := p.runtime.InstantiateModule(ctx, p.compiled, moduleConfig)
+	if err != nil {
+		return nil, fmt.Errorf("实例化WASM插件失败: %w", err)
+	}
+	atomic.AddInt64(&p.instances, 1)
+	return instance, nil
+}
+
+// release 归还实例，空闲实例过多时关闭
+func (p *wasmPlugin) release(instance api.Module) {
+	if !p.closed.Load() {
+		select {
+		case p.idle <- instance:
+			return
+		default:
+		}
+	}
+	p.discard(instance)
+}
+
+// discard 关闭实例
+func (p *wasmPlugin) discard(instance api.Module) {
+	instance.Close(context.Background())
+	atomic.AddInt64(&p.instances, -1)
+}
+
+// RuntimeStats 返回 WASM 运行时统计
+func (p *wasmPlugin) RuntimeStats() map[string]interface{} {
+	return map[string]interface{}{
+		"runtime":      RuntimeWasm,
+		"calls":        atomic.LoadInt64(&p.calls),
+		"failures":     atomic.LoadInt64(&p.failures),
+		"timeouts":     atomic.LoadInt64(&p.timeouts),
+		"instances":    atomic.LoadInt64(&p.instances),
+		"max_memory":   p.options.MaxMemory,
+		"call_timeout": p.options.CallTimeout.String(),
+	}
+}
+
+// instantiateHostModule 注册供 WASM 插件导入的宿主函数
+//
+// 取值函数将结果复制到 (buf, cap) 指向的缓冲区并返回结果的实际长度，
+// 长度大于 cap 时只复制前 cap 字节，插件可按返回的长度重新分配后再次调用；值不存在时返回 -1。
+// 设置函数成功返回0，失败（如响应阶段修改请求、正文超过 max_body_size）返回 -1。
+func (p *wasmPlugin) instantiateHostModule(ctx context.Context) error {
+	_, err := p.runtime.NewHostModuleBuilder(WasmHostModule).
+		NewFunctionBuilder().WithFunc(hostLog).Export("log").
+		NewFunctionBuilder().WithFunc(hostGetConfig).Export("get_config").
+		NewFunctionBuilder().WithFunc(hostGetProperty).Export("get_property").
+		NewFunctionBuilder().WithFunc(hostGetMethod).Export("get_method").
+		NewFunctionBuilder().WithFunc(hostGetURL).Export("get_url").
+		NewFunctionBuilder().WithFunc(hostSetURL).Export("set_url").
+		NewFunctionBuilder().WithFunc(hostGetStatus).Export("get_status").
+		NewFunctionBuilder().WithFunc(hostSetStatus).Export("set_status").
+		NewFunctionBuilder().WithFunc(hostRespond).Export("respond").
+		NewFunctionBuilder().WithFunc(hostGetHeader).Export("get_header").
+		NewFunctionBuilder().WithFunc(hostSetHeader).Export("set_header").
+		NewFunctionBuilder().WithFunc(hostRemoveHeader).Export("remove_header").
+		NewFunctionBuilder().WithFunc(hostGetBody).Export("get_body").
+		NewFunctionBuilder().WithFunc(hostSetBody).Export("set_body").
+		NewFunctionBuilder().WithFunc(hostGetMetadata).Export("get_metadata").
+		NewFunctionBuilder().WithFunc(hostSetMetadata).Export("set_metadata").
+		Instantiate(ctx)
+	return err
+}
+
+// callFromContext 取出当前调用，模块初始化期间调用宿主函数时为nil
+func callFromContext(ctx context.Context) *wasmCall {
+	call, _ := ctx.Value(wasmCallKey{}).(*wasmCall)
+	return call
+}
+
+// readString 读取模块内存中的字符串，越界时中止模块执行
+func readString(m api.Module, ptr, size uint32) string {
+	data, ok := m.Memory().Read(ptr, size)
+	if !ok {
+		panic(fmt.Errorf("内存越界: offset=%d size=%d", ptr, size))
+	}
+	return string(data)
+}
+
+// readBytes 复制模块内存中的数据
+func readBytes(m api.Module, ptr, size uint32) []byte {
+	data, ok := m.Memory().Read(ptr, size)
+	if !ok {
+		panic(fmt.Errorf("内存越界: offset=%d size=%d", ptr, size))
+	}
+	return append([]byte(nil), data...)
+}
+
+// writeResult 将结果写入模块缓冲区，返回结果的实际长度
+func writeResult(m api.Module, buf, capacity uint32, value []byte) int32 {
+	n := uint32(len(value))
+	if n > capacity {
+		n = capacity
+	}
+	if n > 0 && !m.Memory().Write(buf, value[:n]) {
+		panic(fmt.Errorf("内存越界: offset=%d size=%d", buf, n))
+	}
+	return int32(len(value))
+}
+
+// hostLog log(level, ptr, len)：level 0 调试、1 信息、2 警告、3 错误
+func hostLog(ctx context.Context, m api.Module, level, ptr, size uint32) {
+	name := "wasm"
+	if call := callFromContext(ctx); call != nil {
+		name = call.plugin.name
+	}
+	message := readString(m, ptr, size)
+	switch level {
+	case 0:
+		logger.Debugf("[插件 %s] %s", name, message)
+	case 2:
+		logger.Warnf("[插件 %s] %s", name, message)
+	case 3:
+		logger.Errorf("[插件 %s] %s", name, message)
+	default:
+		logger.Infof("[插件 %s] %s", name, message)
+	}
+}
+
+// hostGetConfig get_config(buf, cap)：插件配置（JSON 对象）
+func hostGetConfig(ctx context.Context, m api.Module, buf, capacity uint32) int32 {
+	call := callFromContext(ctx)
+	if call == nil {
+		return -1
+	}
+	return writeResult(m, buf, capacity, call.plugin.config)
+}
+
+// hostGetProperty get_property(name, name_len, buf, cap)：client_ip、username、policy、host
+func hostGetProperty(ctx context.Context, m api.Module, namePtr, nameLen, buf, capacity uint32) int32 {
+	call := callFromContext(ctx)
+	if call == nil {
+		return -1
+	}
+	var value string
+	switch readString(m, namePtr, nameLen) {
+	case "client_ip":
+		value = call.clientIP
+	case "username":
+		value = call.username
+	case "policy":
+		value = call.policy
+	case "host":
+		value = call.req.Host
+	default:
+		return -1
+	}
+	return writeResult(m, buf, capacity, []byte(value))
+}
+
+// hostGetMethod get_method(buf, cap)：请求方法
+func hostGetMethod(ctx context.Context, m api.Module, buf, capacity uint32) int32 {
+	call := callFromContext(ctx)
+	if call == nil {
+		return -1
+	}
+	return writeResult(m, buf, capacity, []byte(call.req.Method))
+}
+
+// hostGetURL get_url(buf, cap)：请求URL
+func hostGetURL(ctx context.Context, m api.Module, buf, capacity uint32) int32 {
+	call := callFromContext(ctx)
+	if call == nil {
+		return -1
+	}
+	return writeResult(m, buf, capacity, []byte(call.req.URL.String()))
+}
+
+// hostSetURL set_url(ptr, len)：修改请求URL，包含主机时同时修改 Host
+func hostSetURL(ctx context.Context, m api.Module, ptr, size uint32) int32 {
+	call := callFromContext(ctx)
+	if call == nil || call.requestReadOnly {
+		return -1
+	}
+	u, err := url.Parse(readString(m, ptr, size))
+	if err != nil {
+		return -1
+	}
+	call.req.URL = u
+	if u.Host != "" {
+		call.req.Host = u.Host
+	}
+	return 0
+}
+
+// hostGetStatus get_status()：响应状态码，请求阶段未调用 respond 时返回 -1
+func hostGetStatus(ctx context.Context, m api.Module) int32 {
+	call := callFromContext(ctx)
+	if call == nil || call.resp == nil {
+		return -1
+	}
+	return int32(call.resp.StatusCode)
+}
+
+// hostSetStatus set_status(code)：修改响应状态码
+func hostSetStatus(ctx context.Context, m api.Module, code uint32) int32 {
+	call := callFromContext(ctx)
+	if call == nil || call.resp == nil || code < 100 || code > 999 {
+		return -1
+	}
+	call.resp.StatusCode = int(code)
+	call.resp.Status = fmt.Sprintf("%d %s", code, http.StatusText(int(code)))
+	return 0
+}
+
+// hostRespond respond(code)：请求阶段创建直接返回给客户端的响应，代理不再转发请求；
+// 之后可通过 kind 为响应的 set_header、set_body 设置响应头和正文
+func hostRespond(ctx context.Context, m api.Module, code uint32) int32 {
+	call := callFromContext(ctx)
+	if call == nil || call.requestReadOnly || code < 100 || code > 999 {
+		return -1
+	}
+	if call.resp == nil {
+		call.resp = NewResponse(call.req, int(code), nil, nil)
+		return 0
+	}
+	call.resp.StatusCode = int(code)
+	call.resp.Status = fmt.Sprintf("%d %s", code, http.StatusText(int(code)))
+	return 0
+}
+
+// header 按 kind 取请求头或响应头，writable 为 true 时要求可修改
+func (call *wasmCall) header(kind uint32, writable bool) http.Header {
+	switch kind {
+	case wasmKindRequest:
+		if writable && call.requestReadOnly {
+			return nil
+		}
+		return call.req.Header
+	case wasmKindResponse:
+		if call.resp == nil {
+			return nil
+		}
+		return call.resp.Header
+	}
+	return nil
+}
+
+// hostGetHeader get_header(kind, name, name_len, buf, cap)：头部的第一个值
+func hostGetHeader(ctx context.Context, m api.Module, kind, namePtr, nameLen, buf, capacity uint32) int32 {
+	call := callFromContext(ctx)
+	if call == nil {
+		return -1
+	}
+	header := call.header(kind, false)
+	if header == nil {
+		return -1
+	}
+	values := header.Values(readString(m, namePtr, nameLen))
+	if len(values) == 0 {
+		return -1
+	}
+	return writeResult(m, buf, capacity, []byte(values[0]))
+}
+
+// hostSetHeader set_header(kind, name, name_len, value, value_len)：替换头部
+func hostSetHeader(ctx context.Context, m api.Module, kind, namePtr, nameLen, valuePtr, valueLen uint32) int32 {
+	call := callFromContext(ctx)
+	if call == nil {
+		return -1
+	}
+	header := call.header(kind, true)
+	if header == nil {
+		return -1
+	}
+	header.Set(readString(m, namePtr, nameLen), readString(m, valuePtr, valueLen))
+	return 0
+}
+
+// hostRemoveHeader remove_header(kind, name, name_len)：删除头部
+func hostRemoveHeader(ctx context.Context, m api.Module, kind, namePtr, nameLen uint32) int32 {
+	call := callFromContext(ctx)
+	if call == nil {
+		return -1
+	}
+	header := call.header(kind, true)
+	if header == nil {
+		return -1
+	}
+	header.Del(readString(m, namePtr, nameLen))
+	return 0
+}
+
+// body 读取请求或响应正文，超过 max_body_size 时 omitted 为 true
+func (call *wasmCall) body(kind uint32) (*wasmBody, error) {
+	if kind > wasmKindResponse || (kind == wasmKindResponse && call.resp == nil) {
+		return nil, errors.New("无效的正文类型")
+	}
+	body := &call.bodies[kind]
+	if body.loaded {
+		return body, nil
+	}
+
+	var err error
+	if kind == wasmKindRequest {
+		body.data, body.omitted, err = peekBody(&call.req.Body, call.plugin.options.MaxBodySize)
+	} else {
+		body.data, body.omitted, err = peekBody(&call.resp.Body, call.plugin.options.MaxBodySize)
+	}
+	if err != nil {
+		return nil, err
+	}
+	body.loaded = true
+	return body, nil
+}
+
+// hostGetBody get_body(kind, buf, cap)：正文，超过 max_body_size 时返回 -1
+func hostGetBody(ctx context.Context, m api.Module, kind, buf, capacity uint32) int32 {
+	call := callFromContext(ctx)
+	if call == nil {
+		return -1
+	}
+	body, err := call.body(kind)
+	if err != nil || body.omitted {
+		return -1
+	}
+	return writeResult(m, buf, capacity, body.data)
+}
+
+// hostSetBody set_body(kind, ptr, len)：替换正文并更新 Content-Length
+func hostSetBody(ctx context.Context, m api.Module, kind, ptr, size uint32) int32 {
+	call := callFromContext(ctx)
+	if call == nil || (kind == wasmKindRequest && call.requestReadOnly) {
+		return -1
+	}
+	body, err := call.body(kind)
+	if err != nil || body.omitted {
+		return -1
+	}
+	data := readBytes(m, ptr, size)
+	body.data = data
+
+	header := call.header(kind, true)
+	if kind == wasmKindRequest {
+		call.req.Body, call.req.ContentLength = io.NopCloser(bytes.NewReader(data)), int64(len(data))
+	} else {
+		call.resp.Body, call.resp.ContentLength = io.NopCloser(bytes.NewReader(data)), int64(len(data))
+	}
+	if header.Get("Content-Length") != "" {
+		header.Set("Content-Length", strconv.Itoa(len(data)))
+	}
+	return 0
+}
+
+// hostGetMetadata get_metadata(key, key_len, buf, cap)：元数据，非字符串的值以 JSON 返回
+func hostGetMetadata(ctx context.Context, m api.Module, keyPtr, keyLen, buf, capacity uint32) int32 {
+	call := callFromContext(ctx)
+	if call == nil {
+		return -1
+	}
+	value, exists := call.metadata[readString(m, keyPtr, keyLen)]
+	if !exists {
+		return -1
+	}
+	if text, ok := value.(string); ok {
+		return writeResult(m, buf, capacity, []byte(text))
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return -1
+	}
+	return writeResult(m, buf, capacity, data)
+}
+
+// hostSetMetadata set_metadata(key, key_len, value, value_len)：设置字符串元数据
+func hostSetMetadata(ctx context.Context, m api.Module, keyPtr, keyLen, valuePtr, valueLen uint32) int32 {
+	call := callFromContext(ctx)
+	if call == nil {
+		return -1
+	}
+	call.metadata = mergeMetadata(call.metadata, map[string]interface{}{
+		readString(m, keyPtr, keyLen): readString(m, valuePtr, valueLen),
+	})
+	return 0
+}
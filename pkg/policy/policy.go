@@ -0,0 +1,248 @@
+// Package policy 按用户（或用户组）应用的策略：生效插件、额外的测试范围、限流和流量记录
+// Package policy resolves per-user policies for plugins, scope, rate limits and flow recording
+package policy
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"path"
+	"sync/atomic"
+
+	"hackmitm/pkg/config"
+	"hackmitm/pkg/logger"
+	"hackmitm/pkg/scope"
+	"hackmitm/pkg/security"
+)
+
+// Policy 编译后的用户策略
+type Policy struct {
+	// Name 策略名称
+	Name string
+	// users 用户名匹配模式
+	users []string
+	// plugins 生效的插件匹配模式，为空时所有插件生效
+	plugins []string
+	// excludePlugins 禁用的插件匹配模式
+	excludePlugins []string
+	// scope 额外的范围规则，未配置时为nil
+	scope *scope.Scope
+	// limiter 额外的限流规则，未配置时为nil
+	limiter *security.RateLimiter
+	// record 是否记录流量，nil 表示使用全局设置
+	record *bool
+}
+
+// Engine 用户策略集合，配置重新加载时整体替换
+// Engine holds the compiled policies and looks them up by username
+type Engine struct {
+	// policies 当前策略列表
+	policies atomic.Pointer[[]*Policy]
+}
+
+// NewEngine 创建策略集合
+func NewEngine(policyConfigs []config.PolicyConfig) (*Engine, error) {
+	e := &Engine{}
+	if err := e.Configure(policyConfigs); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// Configure 编译并应用策略，出错时保留原策略
+func (e *Engine) Configure(policyConfigs []config.PolicyConfig) error {
+	policies := make([]*Policy, 0, len(policyConfigs))
+	for i, pc := range policyConfigs {
+		policy, err := compile(pc)
+		if err != nil {
+			stopAll(policies)
+			return fmt.Errorf("policies[%d] (%s): %w", i, pc.Name, err)
+		}
+		policies = append(policies, policy)
+	}
+
+	if old := e.policies.Swap(&policies); old != nil {
+		stopAll(*old)
+	}
+	if len(policies) > 0 {
+		logger.Infof("已加载 %d 条用户策略", len(policies))
+	}
+	return nil
+}
+
+// compile 编译单条策略
+func compile(pc config.PolicyConfig) (*Policy, error) {
+	policy := &Policy{
+		Name:           pc.Name,
+		users:          pc.Users,
+		plugins:        pc.Plugins,
+		excludePlugins: pc.ExcludePlugins,
+		record:         pc.Record,
+	}
+
+	if len(pc.Scope.Include) > 0 || len(pc.Scope.Exclude) > 0 || len(pc.Scope.Files) > 0 {
+		policyScope, err := scope.NewScope(config.ScopeConfig{
+			Enabled: true,
+			Include: pc.Scope.Include,
+			Exclude: pc.Scope.Exclude,
+			Files:   pc.Scope.Files,
+		})
+		if err != nil {
+			return nil, err
+		}
+		policy.scope = policyScope
+	}
+
+	if len(pc.RateLimit) > 0 {
+		rules := make([]config.RateLimitRule, len(pc.RateLimit))
+		for i, rule := range pc.RateLimit {
+			if len(rule.Key) == 0 {
+				rule.Key = []string{security.RateKeyUser}
+			}
+			if rule.Name == "" {
+				rule.Name = fmt.Sprintf("rule-%d", i)
+			}
+			// 规则名带上策略名，便于从限流错误和审计日志中区分
+			rule.Name = pc.Name + "/" + rule.Name
+			rules[i] = rule
+		}
+		policy.limiter = security.NewRateLimiter(config.RateLimitConfig{Enabled: true, Rules: rules})
+	}
+
+	return policy, nil
+}
+
+// stopAll 停止策略的后台任务
+func stopAll(policies []*Policy) {
+	for _, policy := range policies {
+		if policy.limiter != nil {
+			policy.limiter.Stop()
+		}
+	}
+}
+
+// Stop 停止所有策略的后台任务
+func (e *Engine) Stop() {
+	if policies := e.policies.Load(); policies != nil {
+		stopAll(*policies)
+	}
+}
+
+// Lookup 返回适用于用户的第一条策略，未认证或没有匹配策略时返回nil
+func (e *Engine) Lookup(username string) *Policy {
+	if username == "" {
+		return nil
+	}
+	policies := e.policies.Load()
+	if policies == nil {
+		return nil
+	}
+	for _, policy := range *policies {
+		if matchAny(policy.users, username) {
+			return policy
+		}
+	}
+	return nil
+}
+
+// PluginEnabled 插件是否对用户生效，可用作插件管理器的插件选择器
+func (e *Engine) PluginEnabled(username, pluginName string) bool {
+	return e.Lookup(username).PluginEnabled(pluginName)
+}
+
+// Len 策略数量
+func (e *Engine) Len() int {
+	if policies := e.policies.Load(); policies != nil {
+		return len(*policies)
+	}
+	return 0
+}
+
+// PluginEnabled 插件是否在策略中生效，nil 策略时所有插件生效
+func (p *Policy) PluginEnabled(pluginName string) bool {
+	if p == nil {
+		return true
+	}
+	if matchAny(p.excludePlugins, pluginName) {
+		return false
+	}
+	return len(p.plugins) == 0 || matchAny(p.plugins, pluginName)
+}
+
+// InScope 目标是否在策略的范围内，CONNECT 请求只按主机判断；nil 策略或未配置范围时返回 true
+func (p *Policy) InScope(target scope.Target, connect bool) bool {
+	if p == nil || p.scope == nil {
+		return true
+	}
+	if connect {
+		return p.scope.HostInScope(target)
+	}
+	return p.scope.InScope(target)
+}
+
+// Allow 检查策略的限流规则，超出时返回 *security.RateLimitError
+func (p *Policy) Allow(r *http.Request, clientIP, username string) error {
+	if p == nil || p.limiter == nil {
+		return nil
+	}
+	return p.limiter.Allow(r, clientIP, username)
+}
+
+// Record 是否记录流量，策略未设置时返回 defaultRecord
+func (p *Policy) Record(defaultRecord bool) bool {
+	if p == nil || p.record == nil {
+		return defaultRecord
+	}
+	return *p.record
+}
+
+// PolicyName 返回策略名称，nil 策略时为空字符串
+func (p *Policy) PolicyName() string {
+	if p == nil {
+		return ""
+	}
+	return p.Name
+}
+
+// matchAny 检查名称是否匹配任一模式（支持 * 通配符）
+func matchAny(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if matched, _ := path.Match(pattern, name); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// GetStats 获取统计信息
+func (e *Engine) GetStats() map[string]interface{} {
+	stats := map[string]interface{}{
+		"policies": e.Len(),
+	}
+	if policies := e.policies.Load(); policies != nil {
+		limiters := make(map[string]interface{})
+		for _, policy := range *policies {
+			if policy.limiter != nil {
+				limiters[policy.Name] = policy.limiter.GetStats()
+			}
+		}
+		if len(limiters) > 0 {
+			stats["rate_limit"] = limiters
+		}
+	}
+	return stats
+}
+
+// policyKey 请求上下文中保存策略的键
+type policyKey struct{}
+
+// WithPolicy 将用户策略附加到请求上下文
+func WithPolicy(ctx context.Context, policy *Policy) context.Context {
+	return context.WithValue(ctx, policyKey{}, policy)
+}
+
+// FromContext 返回请求上下文中的用户策略，没有时返回nil
+func FromContext(ctx context.Context) *Policy {
+	policy, _ := ctx.Value(policyKey{}).(*Policy)
+	return policy
+}
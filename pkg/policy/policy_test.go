@@ -0,0 +1,203 @@
+package policy
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"hackmitm/pkg/config"
+	"hackmitm/pkg/scope"
+	"hackmitm/pkg/security"
+)
+
+func newTestEngine(t *testing.T, policyConfigs []config.PolicyConfig) *Engine {
+	t.Helper()
+	e, err := NewEngine(policyConfigs)
+	if err != nil {
+		t.Fatalf("NewEngine() error = %v", err)
+	}
+	t.Cleanup(e.Stop)
+	return e
+}
+
+func TestEngineLookup(t *testing.T) {
+	e := newTestEngine(t, []config.PolicyConfig{
+		{Name: "admins", Users: []string{"alice", "ops-*"}},
+		{Name: "testers", Users: []string{"bob", "carol"}},
+		{Name: "everyone", Users: []string{"*"}},
+	})
+
+	tests := []struct {
+		username string
+		want     string
+	}{
+		{username: "alice", want: "admins"},
+		{username: "ops-dave", want: "admins"},
+		{username: "carol", want: "testers"},
+		// 按配置顺序取第一条匹配的策略
+		{username: "erin", want: "everyone"},
+		// 未认证的请求不适用任何策略
+		{username: "", want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.username, func(t *testing.T) {
+			if got := e.Lookup(tt.username).PolicyName(); got != tt.want {
+				t.Errorf("Lookup(%q) = %q, want %q", tt.username, got, tt.want)
+			}
+		})
+	}
+
+	if got := newTestEngine(t, nil).Lookup("alice"); got != nil {
+		t.Errorf("没有策略时 Lookup() = %v, want nil", got)
+	}
+}
+
+func TestEnginePluginEnabled(t *testing.T) {
+	e := newTestEngine(t, []config.PolicyConfig{
+		{Name: "readonly", Users: []string{"alice"}, Plugins: []string{"logger*", "analytics"}},
+		{Name: "quiet", Users: []string{"bob"}, ExcludePlugins: []string{"logger-*"}},
+		{Name: "mixed", Users: []string{"carol"}, Plugins: []string{"logger*"}, ExcludePlugins: []string{"logger-debug"}},
+	})
+
+	tests := []struct {
+		name     string
+		username string
+		plugin   string
+		want     bool
+	}{
+		{name: "plugins列表内", username: "alice", plugin: "logger-json", want: true},
+		{name: "plugins列表外", username: "alice", plugin: "modifier"},
+		{name: "只排除部分插件", username: "bob", plugin: "modifier", want: true},
+		{name: "被排除的插件", username: "bob", plugin: "logger-json"},
+		{name: "exclude优先于plugins", username: "carol", plugin: "logger-debug"},
+		{name: "没有匹配策略的用户", username: "dave", plugin: "modifier", want: true},
+		{name: "未认证的请求", plugin: "modifier", want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := e.PluginEnabled(tt.username, tt.plugin); got != tt.want {
+				t.Errorf("PluginEnabled(%q, %q) = %v, want %v", tt.username, tt.plugin, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPolicyInScope(t *testing.T) {
+	e := newTestEngine(t, []config.PolicyConfig{{
+		Name:  "scoped",
+		Users: []string{"alice"},
+		Scope: config.PolicyScopeConfig{
+			Include: []config.ScopeRule{{Host: "*.example.com"}},
+			Exclude: []config.ScopeRule{{Host: "admin.example.com"}, {Host: "api.example.com", Path: "/internal/*"}},
+		},
+	}})
+	scoped := e.Lookup("alice")
+
+	tests := []struct {
+		name    string
+		policy  *Policy
+		target  scope.Target
+		connect bool
+		want    bool
+	}{
+		{name: "范围内", policy: scoped, target: scope.Target{Scheme: "https", Host: "api.example.com", Port: 443, Path: "/v1"}, want: true},
+		{name: "范围外的主机", policy: scoped, target: scope.Target{Scheme: "https", Host: "other.test", Port: 443, Path: "/"}},
+		{name: "排除的主机", policy: scoped, target: scope.Target{Scheme: "https", Host: "admin.example.com", Port: 443, Path: "/"}},
+		{name: "排除的路径", policy: scoped, target: scope.Target{Scheme: "https", Host: "api.example.com", Port: 443, Path: "/internal/keys"}},
+		// CONNECT 时路径未知，只排除整个主机的规则生效
+		{name: "CONNECT忽略路径排除", policy: scoped, target: scope.Target{Host: "api.example.com", Port: 443}, connect: true, want: true},
+		{name: "CONNECT排除的主机", policy: scoped, target: scope.Target{Host: "admin.example.com", Port: 443}, connect: true},
+		{name: "没有策略时不限制", target: scope.Target{Scheme: "https", Host: "other.test", Port: 443, Path: "/"}, want: true},
+		{name: "策略未配置范围时不限制", policy: &Policy{Name: "plain"}, target: scope.Target{Host: "other.test", Port: 443}, connect: true, want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.policy.InScope(tt.target, tt.connect); got != tt.want {
+				t.Errorf("InScope(%s, %v) = %v, want %v", tt.target, tt.connect, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPolicyAllowLimitsPerUser(t *testing.T) {
+	e := newTestEngine(t, []config.PolicyConfig{{
+		Name:      "limited",
+		Users:     []string{"alice", "bob"},
+		RateLimit: []config.RateLimitRule{{Requests: 1, Window: time.Minute}},
+	}})
+	r := httptest.NewRequest("GET", "http://example.test/", nil)
+
+	alice := e.Lookup("alice")
+	if err := alice.Allow(r, "192.0.2.1", "alice"); err != nil {
+		t.Fatalf("第一次请求 Allow() error = %v", err)
+	}
+	err := alice.Allow(r, "192.0.2.1", "alice")
+	var limitErr *security.RateLimitError
+	if !errors.As(err, &limitErr) || limitErr.Rule != "limited/rule-0" {
+		t.Fatalf("超出限制时 Allow() error = %v, want 规则 limited/rule-0", err)
+	}
+
+	// 未设置 key 的规则按用户限流，同一策略下的其他用户不受影响
+	if err := e.Lookup("bob").Allow(r, "192.0.2.1", "bob"); err != nil {
+		t.Errorf("其他用户 Allow() error = %v", err)
+	}
+	if err := e.Lookup("carol").Allow(r, "192.0.2.1", "carol"); err != nil {
+		t.Errorf("没有策略时 Allow() error = %v", err)
+	}
+}
+
+func TestPolicyRecord(t *testing.T) {
+	off := false
+	e := newTestEngine(t, []config.PolicyConfig{
+		{Name: "private", Users: []string{"alice"}, Record: &off},
+		{Name: "default", Users: []string{"bob"}},
+	})
+
+	tests := []struct {
+		username      string
+		defaultRecord bool
+		want          bool
+	}{
+		{username: "alice", defaultRecord: true, want: false},
+		{username: "bob", defaultRecord: true, want: true},
+		{username: "bob", defaultRecord: false, want: false},
+		{username: "carol", defaultRecord: true, want: true},
+	}
+	for _, tt := range tests {
+		if got := e.Lookup(tt.username).Record(tt.defaultRecord); got != tt.want {
+			t.Errorf("Lookup(%q).Record(%v) = %v, want %v", tt.username, tt.defaultRecord, got, tt.want)
+		}
+	}
+}
+
+func TestEngineConfigureKeepsPoliciesOnError(t *testing.T) {
+	e := newTestEngine(t, []config.PolicyConfig{{Name: "old", Users: []string{"alice"}}})
+
+	err := e.Configure([]config.PolicyConfig{
+		{Name: "new", Users: []string{"alice"}},
+		{Name: "broken", Users: []string{"bob"}, Scope: config.PolicyScopeConfig{Include: []config.ScopeRule{{Host: "re:("}}}},
+	})
+	if err == nil {
+		t.Fatal("无效的范围规则未返回错误")
+	}
+	if got := e.Lookup("alice").PolicyName(); got != "old" || e.Len() != 1 {
+		t.Errorf("出错后 Lookup() = %q, Len() = %d, 应保留原策略", got, e.Len())
+	}
+}
+
+func TestPolicyContext(t *testing.T) {
+	e := newTestEngine(t, []config.PolicyConfig{{Name: "p", Users: []string{"alice"}}})
+
+	ctx := WithPolicy(context.Background(), e.Lookup("alice"))
+	if got := FromContext(ctx).PolicyName(); got != "p" {
+		t.Errorf("FromContext() = %q, want p", got)
+	}
+	if got := FromContext(context.Background()); got != nil {
+		t.Errorf("没有策略时 FromContext() = %v, want nil", got)
+	}
+}
@@ -0,0 +1,24 @@
+// Package proxy 访问决策审计
+package proxy
+
+import (
+	"net/http"
+
+	"hackmitm/pkg/audit"
+	"hackmitm/pkg/scope"
+	"hackmitm/pkg/security"
+)
+
+// auditAccess 记录访问决策：谁、从哪里、访问什么、由哪条规则或哪个插件决定以及原因
+func (s *Server) auditAccess(r *http.Request, action, rule, reason string) {
+	audit.Record(audit.Event{
+		Type:     audit.TypeAccess,
+		Action:   action,
+		User:     security.UsernameFromContext(r.Context()),
+		ClientIP: s.getClientIP(r),
+		Method:   r.Method,
+		Target:   scope.TargetFromRequest(r).String(),
+		Rule:     rule,
+		Reason:   reason,
+	})
+}
@@ -0,0 +1,141 @@
+// Package proxy CA证书下载页面
+package proxy
+
+import (
+	"html/template"
+	"net"
+	"net/http"
+	"strings"
+
+	"hackmitm/pkg/logger"
+)
+
+// caPortalTemplate CA证书下载页面模板
+var caPortalTemplate = template.Must(template.New("ca_portal").Parse(`<!DOCTYPE html>
+<html lang="zh-CN">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>HackMITM CA 证书安装</title>
+<style>
+body { font-family: -apple-system, "Segoe UI", Helvetica, Arial, sans-serif; max-width: 760px; margin: 2em auto; padding: 0 1em; color: #222; }
+h1 { font-size: 1.6em; }
+h2 { font-size: 1.2em; margin-top: 1.6em; border-bottom: 1px solid #ddd; padding-bottom: .2em; }
+code, .fp { font-family: Menlo, Consolas, monospace; font-size: .9em; }
+.fp { word-break: break-all; background: #f4f4f4; padding: .6em; border-radius: 4px; }
+.downloads a { display: inline-block; margin: .3em .6em .3em 0; padding: .5em 1em; background: #2b6cb0; color: #fff; border-radius: 4px; text-decoration: none; }
+ol li { margin: .3em 0; }
+</style>
+</head>
+<body>
+<h1>HackMITM CA 证书</h1>
+<p>安装并信任以下 CA 证书后，即可通过本代理解密 HTTPS 流量。请仅在授权测试的设备上安装。</p>
+<p><strong>{{.CommonName}}</strong></p>
+<p>SHA-256 指纹:</p>
+<div class="fp">{{.Fingerprint}}</div>
+
+<h2>下载</h2>
+<div class="downloads">
+<a href="/cert.pem">PEM (.pem)</a>
+<a href="/cert.crt">DER (.crt)</a>
+<a href="/cert.cer">DER (.cer)</a>
+<a href="/hackmitm.mobileconfig">iOS / macOS (.mobileconfig)</a>
+</div>
+
+<h2>iOS / iPadOS</h2>
+<ol>
+<li>使用 Safari 下载 <code>.mobileconfig</code> 描述文件并允许安装。</li>
+<li>打开 设置 → 通用 → VPN与设备管理，安装 "{{.CommonName}}" 描述文件。</li>
+<li>打开 设置 → 通用 → 关于本机 → 证书信任设置，为该根证书启用完全信任。</li>
+</ol>
+
+<h2>macOS</h2>
+<ol>
+<li>下载 <code>.mobileconfig</code> 或 <code>.cer</code> 文件并双击导入钥匙串。</li>
+<li>在"钥匙串访问"中打开该证书，将"信任"设置为"始终信任"。</li>
+<li>或使用命令: <code>sudo security add-trusted-cert -d -r trustRoot -k /Library/Keychains/System.keychain hackmitm-ca.pem</code></li>
+</ol>
+
+<h2>Android</h2>
+<ol>
+<li>下载 <code>.crt</code> 文件。</li>
+<li>打开 设置 → 安全 → 加密与凭据 → 安装证书 → CA 证书，选择下载的文件。</li>
+<li>注意: Android 7+ 的应用默认不信任用户 CA，需要应用配置 <code>network_security_config</code> 或将证书安装为系统证书。</li>
+</ol>
+
+<h2>Windows</h2>
+<ol>
+<li>下载 <code>.cer</code> 文件并双击打开，选择"安装证书"。</li>
+<li>存储位置选择"本地计算机"，证书存储选择"受信任的根证书颁发机构"。</li>
+<li>或使用命令: <code>certutil -addstore -f Root hackmitm-ca.cer</code></li>
+</ol>
+
+<h2>Linux</h2>
+<ol>
+<li>Debian/Ubuntu: <code>sudo cp hackmitm-ca.pem /usr/local/share/ca-certificates/hackmitm.crt &amp;&amp; sudo update-ca-certificates</code></li>
+<li>RHEL/Fedora: <code>sudo cp hackmitm-ca.pem /etc/pki/ca-trust/source/anchors/ &amp;&amp; sudo update-ca-trust</code></li>
+<li>Firefox 使用独立的证书存储，需在 设置 → 隐私与安全 → 证书 中单独导入。</li>
+</ol>
+</body>
+</html>
+`))
+
+// isCAPortalRequest 检查请求是否访问CA证书下载页面
+func (s *Server) isCAPortalRequest(r *http.Request) bool {
+	portalHost := s.config.GetTLS().CAPortalHost
+	if portalHost == "" || r.Method == http.MethodConnect {
+		return false
+	}
+
+	host := r.URL.Host
+	if host == "" {
+		host = r.Host
+	}
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+
+	return strings.EqualFold(host, portalHost)
+}
+
+// serveCAPortal 提供CA证书下载页面及各格式证书
+func (s *Server) serveCAPortal(w http.ResponseWriter, r *http.Request) {
+	logger.Debugf("处理CA证书下载请求: %s", r.URL.Path)
+
+	w.Header().Set("Cache-Control", "no-store")
+
+	switch r.URL.Path {
+	case "", "/":
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		data := struct {
+			CommonName  string
+			Fingerprint string
+		}{
+			CommonName:  s.certManager.GetCACommonName(),
+			Fingerprint: s.certManager.GetCAFingerprint(),
+		}
+		if err := caPortalTemplate.Execute(w, data); err != nil {
+			logger.Errorf("渲染CA证书下载页面失败: %v", err)
+		}
+	case "/cert.pem":
+		s.writeCAFile(w, "application/x-pem-file", "hackmitm-ca.pem", s.certManager.GetCACert())
+	case "/cert.crt":
+		s.writeCAFile(w, "application/x-x509-ca-cert", "hackmitm-ca.crt", s.certManager.GetCACertDER())
+	case "/cert.cer":
+		s.writeCAFile(w, "application/pkix-cert", "hackmitm-ca.cer", s.certManager.GetCACertDER())
+	case "/hackmitm.mobileconfig":
+		s.writeCAFile(w, "application/x-apple-aspen-config", "hackmitm.mobileconfig", s.certManager.GetMobileConfig())
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// writeCAFile 以附件形式输出证书文件
+func (s *Server) writeCAFile(w http.ResponseWriter, contentType, filename string, data []byte) {
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`"`)
+	w.WriteHeader(http.StatusOK)
+	if _, err := w.Write(data); err != nil {
+		logger.Debugf("输出CA证书失败: %v", err)
+	}
+}
@@ -0,0 +1,131 @@
+// Package proxy 按用户隔离的流量记录
+package proxy
+
+import (
+	"io"
+	"net/http"
+	"time"
+
+	"hackmitm/pkg/flows"
+	"hackmitm/pkg/plugin"
+	"hackmitm/pkg/policy"
+	"hackmitm/pkg/security"
+)
+
+// flowRecorder 记录单次请求的流量，请求不需要记录时为nil（方法均可在nil上调用）
+type flowRecorder struct {
+	// store 流量存储
+	store *flows.Store
+	// flow 正在记录的流量
+	flow *flows.Flow
+	// response 响应正文记录器
+	response *flows.Capture
+}
+
+// newFlowRecorder 按用户策略（未匹配策略时按 flows.enabled）决定是否记录请求
+// body 为已读取的请求正文，r 为经过插件和处理器修改、即将转发给上游的请求
+func (s *Server) newFlowRecorder(r *http.Request, body []byte, startTime time.Time) *flowRecorder {
+	userPolicy := policy.FromContext(r.Context())
+	if !userPolicy.Record(s.flows.RecordByDefault()) {
+		return nil
+	}
+
+	limit := s.flows.MaxBodySize()
+	flow := &flows.Flow{
+		Time:           startTime,
+		User:           security.UsernameFromContext(r.Context()),
+		Policy:         userPolicy.PolicyName(),
+		ClientIP:       s.getClientIP(r),
+		Method:         r.Method,
+		URL:            r.URL.String(),
+		RequestHeaders: r.Header.Clone(),
+		RequestSize:    int64(len(body)),
+	}
+	if len(body) > limit {
+		body = body[:limit]
+		flow.Truncated = true
+	}
+	flow.RequestBody = append([]byte(nil), body...)
+
+	return &flowRecorder{
+		store:    s.flows,
+		flow:     flow,
+		response: flows.NewCapture(limit),
+	}
+}
+
+// wrapBody 返回在转发给客户端时同时记录正文的响应体读取器
+func (fr *flowRecorder) wrapBody(body io.Reader) io.Reader {
+	if fr == nil {
+		return body
+	}
+	return io.TeeReader(body, fr.response)
+}
+
+// addAnalysis 记录分析插件的结果
+func (fr *flowRecorder) addAnalysis(results []*plugin.PluginAnalysis) {
+	if fr == nil {
+		return
+	}
+	for _, result := range results {
+		fr.flow.Analysis = append(fr.flow.Analysis, flows.Analysis{
+			Plugin:      result.Plugin,
+			Phase:       result.Phase,
+			Threat:      result.Threat,
+			ThreatLevel: result.ThreatLevel,
+			Description: result.Description,
+			Confidence:  result.Confidence,
+			Metadata:    result.Metadata,
+			Timestamp:   result.Timestamp,
+		})
+	}
+}
+
+// finish 保存流量，resp 为nil时记录上游错误
+func (fr *flowRecorder) finish(resp *http.Response, err error) {
+	if fr == nil {
+		return
+	}
+	fr.flow.DurationMS = float64(time.Since(fr.flow.Time).Microseconds()) / 1000
+	if err != nil {
+		fr.flow.Error = err.Error()
+	}
+	if resp != nil {
+		fr.flow.StatusCode = resp.StatusCode
+		fr.flow.ResponseHeaders = resp.Header.Clone()
+		fr.flow.ResponseBody = fr.response.Bytes()
+		fr.flow.ResponseSize = fr.response.Size()
+		fr.flow.Truncated = fr.flow.Truncated || fr.response.Truncated()
+	}
+	fr.store.Add(fr.flow)
+}
+
+// AuthenticateFlowUser 使用代理账号认证监控API的流量查询请求，返回用户名
+func (s *Server) AuthenticateFlowUser(r *http.Request) (string, error) {
+	return s.accessController.AuthenticateAPI(r)
+}
+
+// ListFlows 返回用户最近的流量摘要
+func (s *Server) ListFlows(user string, limit int) []flows.Summary {
+	return s.flows.List(user, limit)
+}
+
+// ListAllFlows 返回所有用户最近的流量摘要
+func (s *Server) ListAllFlows(limit int) []flows.Summary {
+	return s.flows.ListAll(limit)
+}
+
+// GetFlow 按ID获取流量
+func (s *Server) GetFlow(id string) (*flows.Flow, bool) {
+	return s.flows.Get(id)
+}
+
+// ClearFlows 删除用户的全部流量
+func (s *Server) ClearFlows(user string) int {
+	return s.flows.Clear(user)
+}
+
+// ClearAllFlows 删除所有用户的流量
+func (s *Server) ClearAllFlows() int {
+	return s.flows.ClearAll()
+}
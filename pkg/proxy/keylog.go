@@ -0,0 +1,177 @@
+package proxy
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"hackmitm/pkg/config"
+	"hackmitm/pkg/logger"
+)
+
+// keyLogFileMode 密钥日志文件权限，仅所有者可读写
+const keyLogFileMode = 0600
+
+// keyLogRotateRetry 轮换失败后再次尝试的间隔
+const keyLogRotateRetry = time.Minute
+
+// keyLogWriter NSS格式TLS密钥日志写入器（SSLKEYLOGFILE），供Wireshark解密抓包使用
+// 同时被客户端侧 tls.Server 和上游 Transport 共享，写入是并发安全的
+type keyLogWriter struct {
+	// path 当前写入的文件路径
+	path string
+	// basePath 配置的文件路径
+	basePath string
+	// maxSize 单个文件最大字节数，超过后轮换（0表示不限制）
+	maxSize int64
+	// file 当前文件
+	file *os.File
+	// size 当前文件大小
+	size int64
+	// rotateFailures 轮换失败次数
+	rotateFailures int64
+	// rotateErr 最近一次轮换失败的错误，轮换成功后清除
+	rotateErr error
+	// rotateRetryAt 轮换失败后下次尝试的时间
+	rotateRetryAt time.Time
+	// mutex 写入锁
+	mutex sync.Mutex
+}
+
+// newKeyLogWriter 根据配置创建密钥日志写入器，未配置时返回nil
+// 配置为空时回退到 SSLKEYLOGFILE 环境变量
+func newKeyLogWriter(tlsConfig config.TLSConfig) (*keyLogWriter, error) {
+	basePath := tlsConfig.KeyLogFile
+	if basePath == "" {
+		basePath = os.Getenv("SSLKEYLOGFILE")
+	}
+	if basePath == "" {
+		return nil, nil
+	}
+
+	w := &keyLogWriter{
+		basePath: basePath,
+		maxSize:  int64(tlsConfig.KeyLogMaxSizeMB) * 1024 * 1024,
+	}
+
+	path := basePath
+	if tlsConfig.KeyLogPerRun {
+		path = w.sessionPath()
+	}
+	if err := w.open(path); err != nil {
+		return nil, err
+	}
+
+	logger.Warnf("TLS密钥日志已启用: %s（文件包含会话密钥，请妥善保管）", w.path)
+	return w, nil
+}
+
+// sessionPath 生成带时间戳的文件路径，如 keys-20240115-150405.000.log
+func (w *keyLogWriter) sessionPath() string {
+	ext := filepath.Ext(w.basePath)
+	stem := strings.TrimSuffix(w.basePath, ext)
+	return fmt.Sprintf("%s-%s%s", stem, time.Now().Format("20060102-150405.000"), ext)
+}
+
+// open 以追加模式打开文件并确保权限为0600
+func (w *keyLogWriter) open(path string) error {
+	if dir := filepath.Dir(path); dir != "" {
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			return fmt.Errorf("创建密钥日志目录失败: %w", err)
+		}
+	}
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, keyLogFileMode)
+	if err != nil {
+		return fmt.Errorf("打开密钥日志文件失败: %w", err)
+	}
+
+	// 已存在的文件可能权限过宽
+	if err := file.Chmod(keyLogFileMode); err != nil {
+		file.Close()
+		return fmt.Errorf("设置密钥日志文件权限失败: %w", err)
+	}
+
+	stat, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("读取密钥日志文件信息失败: %w", err)
+	}
+
+	w.file = file
+	w.path = path
+	w.size = stat.Size()
+	return nil
+}
+
+// Write 写入一行密钥日志（实现 io.Writer，供 tls.Config.KeyLogWriter 使用）
+func (w *keyLogWriter) Write(p []byte) (int, error) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if w.file == nil {
+		return 0, os.ErrClosed
+	}
+
+	// 轮换失败时继续写入当前文件（丢失密钥比文件超限更糟），记录错误并在统计中报告，
+	// 间隔 keyLogRotateRetry 后重试，避免每次写入都尝试并刷屏
+	if w.maxSize > 0 && w.size > 0 && w.size+int64(len(p)) > w.maxSize && time.Now().After(w.rotateRetryAt) {
+		if err := w.rotate(); err != nil {
+			w.rotateFailures++
+			w.rotateErr = err
+			w.rotateRetryAt = time.Now().Add(keyLogRotateRetry)
+			logger.Errorf("轮换TLS密钥日志失败，继续写入超出大小限制的 %s，%v 后重试: %v", w.path, keyLogRotateRetry, err)
+		} else {
+			w.rotateErr = nil
+		}
+	}
+
+	n, err := w.file.Write(p)
+	w.size += int64(n)
+	return n, err
+}
+
+// rotate 切换到新的带时间戳文件
+func (w *keyLogWriter) rotate() error {
+	old := w.file
+	if err := w.open(w.sessionPath()); err != nil {
+		return err
+	}
+	old.Close()
+
+	logger.Infof("TLS密钥日志已轮换: %s", w.path)
+	return nil
+}
+
+// GetStats 获取密钥日志统计信息，rotate_error 为最近一次未恢复的轮换失败
+func (w *keyLogWriter) GetStats() map[string]interface{} {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	stats := map[string]interface{}{
+		"path":            w.path,
+		"size":            w.size,
+		"max_size":        w.maxSize,
+		"rotate_failures": w.rotateFailures,
+	}
+	if w.rotateErr != nil {
+		stats["rotate_error"] = w.rotateErr.Error()
+	}
+	return stats
+}
+
+// Close 关闭密钥日志文件
+func (w *keyLogWriter) Close() error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if w.file == nil {
+		return nil
+	}
+	err := w.file.Close()
+	w.file = nil
+	return err
+}
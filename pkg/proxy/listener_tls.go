@@ -0,0 +1,91 @@
+// Package proxy 代理监听端口TLS与客户端证书认证
+package proxy
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"os"
+
+	"hackmitm/pkg/config"
+	"hackmitm/pkg/logger"
+	"hackmitm/pkg/security"
+)
+
+// listenerTLSConfig 创建代理监听端口的TLS配置
+// 未配置证书文件时使用 CA 按客户端请求的主机名（或监听IP）签发证书
+func (s *Server) listenerTLSConfig(listenerConfig config.ListenerTLSConfig) (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		// CONNECT 需要劫持连接，监听端口只使用 HTTP/1.1
+		NextProtos: []string{"http/1.1"},
+	}
+
+	if listenerConfig.CertFile != "" {
+		certificate, err := tls.LoadX509KeyPair(listenerConfig.CertFile, listenerConfig.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("加载监听证书失败: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{certificate}
+	} else {
+		tlsConfig.GetCertificate = s.getListenerCertificate
+	}
+
+	switch listenerConfig.ClientAuth {
+	case "none", "":
+		tlsConfig.ClientAuth = tls.NoClientCert
+	case "optional":
+		tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+	default:
+		tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	if tlsConfig.ClientAuth != tls.NoClientCert {
+		data, err := os.ReadFile(listenerConfig.ClientCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("读取客户端CA失败: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(data) {
+			return nil, fmt.Errorf("客户端CA文件中没有有效的PEM证书: %s", listenerConfig.ClientCAFile)
+		}
+		tlsConfig.ClientCAs = pool
+
+		if listenerConfig.CRLFile != "" {
+			checker, err := security.NewRevocationChecker(listenerConfig.CRLFile)
+			if err != nil {
+				return nil, err
+			}
+			tlsConfig.VerifyConnection = checker.VerifyConnection
+		}
+	}
+
+	return tlsConfig, nil
+}
+
+// getListenerCertificate 为连接代理监听端口的客户端签发证书，无 SNI 时使用监听IP
+func (s *Server) getListenerCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	name := hello.ServerName
+	if name == "" && hello.Conn != nil {
+		if host, _, err := net.SplitHostPort(hello.Conn.LocalAddr().String()); err == nil {
+			name = host
+		}
+	}
+	return s.certManager.GetCertificate(name)
+}
+
+// wrapListenerTLS 按配置为监听器启用TLS
+func (s *Server) wrapListenerTLS(listener net.Listener) (net.Listener, error) {
+	listenerConfig := s.config.GetServer().TLS
+	if !listenerConfig.Enabled {
+		return listener, nil
+	}
+
+	tlsConfig, err := s.listenerTLSConfig(listenerConfig)
+	if err != nil {
+		return nil, err
+	}
+	logger.Infof("代理监听端口已启用TLS，客户端证书: %s", listenerConfig.ClientAuth)
+	return tls.NewListener(listener, tlsConfig), nil
+}
@@ -0,0 +1,50 @@
+// Package proxy 用户策略
+package proxy
+
+import (
+	"errors"
+	"net/http"
+
+	"hackmitm/pkg/audit"
+	"hackmitm/pkg/logger"
+	"hackmitm/pkg/policy"
+	"hackmitm/pkg/security"
+)
+
+// applyPolicy 查找认证用户的策略并附加到请求上下文，随后检查策略的限流规则
+// 被限流时写入 429 响应并返回 false；插件选择、范围检查和流量记录从上下文读取策略。
+// 与全局限流一致，CONNECT 请求不在此计费
+func (s *Server) applyPolicy(w http.ResponseWriter, r *http.Request) (*http.Request, bool) {
+	username := security.UsernameFromContext(r.Context())
+	userPolicy := s.policies.Lookup(username)
+	r = r.WithContext(policy.WithPolicy(r.Context(), userPolicy))
+
+	if r.Method == http.MethodConnect {
+		return r, true
+	}
+	return r, s.allowPolicy(w, r)
+}
+
+// allowPolicy 按上下文中的用户策略检查限流，被限流时写入响应并返回 false
+func (s *Server) allowPolicy(w http.ResponseWriter, r *http.Request) bool {
+	username := security.UsernameFromContext(r.Context())
+	clientIP := s.getClientIP(r)
+	if err := policy.FromContext(r.Context()).Allow(r, clientIP, username); err != nil {
+		s.auditAccess(r, audit.ActionDeny, security.DenyRule(err), err.Error())
+		s.accessController.ReportOffense(clientIP, security.OffenseRateLimit)
+		var rateErr *security.RateLimitError
+		if errors.As(err, &rateErr) {
+			s.writeRateLimited(w, rateErr)
+			return false
+		}
+		logger.Warnf("访问被拒绝: %v", err)
+		http.Error(w, "访问被拒绝", http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
+// policyStats 获取用户策略统计信息
+func (s *Server) policyStats() map[string]interface{} {
+	return s.policies.GetStats()
+}
@@ -0,0 +1,140 @@
+package proxy
+
+import (
+	"time"
+
+	"hackmitm/pkg/config"
+	"hackmitm/pkg/fingerprint"
+	"hackmitm/pkg/logger"
+	"hackmitm/pkg/plugin"
+	"hackmitm/pkg/traffic"
+)
+
+// subscribeConfig 订阅配置变更，各子系统在重新加载时应用各自配置段
+func (s *Server) subscribeConfig() {
+	s.config.Subscribe(config.SectionSecurity, func(old, current *config.Config) error {
+		s.accessController.UpdateConfig(current.GetSecurity())
+		s.dialGuard.Configure(current.GetSecurity().DialGuard)
+		return nil
+	})
+
+	s.config.Subscribe(config.SectionPatternRecognition, func(old, current *config.Config) error {
+		applyPatternConfig(s.patternHandler, current.GetPatternRecognition())
+		return nil
+	})
+
+	s.config.Subscribe(config.SectionFingerprint, func(old, current *config.Config) error {
+		s.setFingerprintHandler(newFingerprintHandler(current.GetFingerprint()))
+		return nil
+	})
+
+	s.config.Subscribe(config.SectionScope, func(old, current *config.Config) error {
+		return s.scope.Configure(current.GetScope())
+	})
+
+	s.config.Subscribe(config.SectionPolicies, func(old, current *config.Config) error {
+		return s.policies.Configure(current.GetPolicies())
+	})
+
+	s.config.Subscribe(config.SectionFlows, func(old, current *config.Config) error {
+		s.flows.Configure(current.GetFlows())
+		return nil
+	})
+
+	s.config.Subscribe(config.SectionPlugins, func(old, current *config.Config) error {
+		return s.pluginManager.ApplyConfig(pluginConfigs(current.GetPlugins()))
+	})
+}
+
+// applyPatternConfig 应用流量模式识别配置
+func applyPatternConfig(patternHandler *traffic.PatternHandler, patternConfig config.PatternRecognitionConfig) {
+	patternHandler.SetEnabled(patternConfig.Enabled)
+	if patternConfig.ConfidenceThreshold > 0 {
+		patternHandler.GetRecognizer().SetConfidenceThreshold(patternConfig.ConfidenceThreshold)
+	}
+	if patternConfig.CacheSize > 0 && patternConfig.CacheTTL > 0 {
+		patternHandler.SetCacheConfig(patternConfig.CacheSize, time.Duration(patternConfig.CacheTTL)*time.Second)
+	}
+}
+
+// newFingerprintHandler 根据配置创建指纹识别处理器，未启用或初始化失败时返回nil
+func newFingerprintHandler(fingerprintConfig config.FingerprintConfig) *fingerprint.FingerprintHandler {
+	if !fingerprintConfig.Enabled {
+		return nil
+	}
+
+	log := logger.NewLogger()
+	fingerprintHandler := fingerprint.NewFingerprintHandler(log.Logger)
+	if err := fingerprintHandler.InitializeWithAdvancedConfig(
+		fingerprintConfig.FingerprintPath,
+		fingerprintConfig.CacheSize,
+		fingerprintConfig.CacheTTL,
+		fingerprintConfig.UseLayeredIndex,
+		fingerprintConfig.MaxMatches,
+	); err != nil {
+		log.Warnf("Failed to initialize fingerprint handler: %v", err)
+		fingerprintHandler.Stop()
+		return nil
+	}
+
+	return fingerprintHandler
+}
+
+// setFingerprintHandler 替换指纹识别处理器并停止旧处理器
+// 指纹引擎本身不支持并发修改规则，因此整体替换而不是原地重新加载
+func (s *Server) setFingerprintHandler(fingerprintHandler *fingerprint.FingerprintHandler) {
+	s.mutex.Lock()
+	old := s.fingerprintHandler
+	s.fingerprintHandler = fingerprintHandler
+	s.mutex.Unlock()
+
+	if old != nil {
+		old.Stop()
+	}
+	logger.Infof("指纹识别处理器已更新，启用: %v", fingerprintHandler != nil)
+}
+
+// pluginConfigs 将配置文件中的插件列表转换为插件管理器配置，插件系统禁用时返回空列表
+func pluginConfigs(pluginsConfig config.PluginsConfig) []*plugin.PluginConfig {
+	if !pluginsConfig.Enabled {
+		return nil
+	}
+
+	configs := make([]*plugin.PluginConfig, 0, len(pluginsConfig.Plugins))
+	for _, pluginCfg := range pluginsConfig.Plugins {
+		configs = append(configs, NewPluginConfig(pluginCfg))
+	}
+	return configs
+}
+
+// NewPluginConfig 将配置文件中的插件配置转换为插件管理器使用的配置
+func NewPluginConfig(pluginCfg config.ConfigPluginConfig) *plugin.PluginConfig {
+	return &plugin.PluginConfig{
+		Name:     pluginCfg.Name,
+		Enabled:  pluginCfg.Enabled,
+		Path:     pluginCfg.Path,
+		Config:   pluginCfg.Config,
+		Priority: pluginCfg.Priority,
+		Runtime:  pluginCfg.Runtime,
+		Process: plugin.ProcessOptions{
+			Args:           pluginCfg.Process.Args,
+			Env:            pluginCfg.Process.Env,
+			Transport:      pluginCfg.Process.Transport,
+			CallTimeout:    pluginCfg.Process.CallTimeout,
+			HealthInterval: pluginCfg.Process.HealthInterval,
+			MaxRestarts:    pluginCfg.Process.MaxRestarts,
+			MaxBodySize:    pluginCfg.Process.MaxBodySize,
+		},
+		Wasm: plugin.WasmOptions{
+			MaxMemory:   pluginCfg.Wasm.MaxMemory,
+			CallTimeout: pluginCfg.Wasm.CallTimeout,
+			MaxBodySize: pluginCfg.Wasm.MaxBodySize,
+		},
+		Isolation: plugin.IsolationOptions{
+			CallTimeout:    pluginCfg.Isolation.CallTimeout,
+			ErrorThreshold: pluginCfg.Isolation.ErrorThreshold,
+			Window:         pluginCfg.Isolation.Window,
+			OpenDuration:   pluginCfg.Isolation.OpenDuration,
+		},
+	}
+}
@@ -0,0 +1,171 @@
+// Package proxy 测试范围控制
+package proxy
+
+import (
+	"context"
+	"html/template"
+	"io"
+	"net/http"
+	"sync/atomic"
+
+	"hackmitm/pkg/audit"
+	"hackmitm/pkg/logger"
+	"hackmitm/pkg/policy"
+	"hackmitm/pkg/scope"
+)
+
+// scopeBlockTemplate 范围外请求拦截页面模板
+var scopeBlockTemplate = template.Must(template.New("scope_block").Parse(`<!DOCTYPE html>
+<html lang="zh-CN">
+<head>
+<meta charset="utf-8">
+<title>目标不在测试范围内</title>
+<style>
+body { font-family: -apple-system, "Segoe UI", Helvetica, Arial, sans-serif; max-width: 760px; margin: 2em auto; padding: 0 1em; color: #222; }
+h1 { font-size: 1.6em; color: #c53030; }
+code { font-family: Menlo, Consolas, monospace; font-size: .9em; word-break: break-all; background: #f4f4f4; padding: .2em .4em; border-radius: 4px; }
+</style>
+</head>
+<body>
+<h1>目标不在授权测试范围内</h1>
+<p>HackMITM 已拦截此请求，未向目标发起任何连接。</p>
+<p>目标: <code>{{.}}</code></p>
+<p>如需测试该目标，请确认授权后修改配置中的 <code>scope</code> 规则。</p>
+</body>
+</html>
+`))
+
+// checkScope 检查请求目标是否在测试范围内，范围外的请求按配置拦截或透传并返回 false
+// 在发起任何上游连接之前调用；CONNECT 请求只能按主机判断，隧道内的请求再按完整URL判断
+func (s *Server) checkScope(w http.ResponseWriter, r *http.Request) bool {
+	target := scope.TargetFromRequest(r)
+
+	connect := r.Method == http.MethodConnect
+	var inScope bool
+	if connect {
+		inScope = s.scope.HostInScope(target)
+	} else {
+		inScope = s.scope.InScope(target)
+	}
+
+	// 用户策略的范围只能在全局范围内进一步收窄，范围外的处理方式与全局一致
+	rule := "scope"
+	if inScope {
+		userPolicy := policy.FromContext(r.Context())
+		if userPolicy.InScope(target, connect) {
+			return true
+		}
+		rule = "policy:" + userPolicy.PolicyName()
+	}
+
+	if s.scope.Action() == scope.ActionPassthrough {
+		atomic.AddInt64(&s.scopePassthrough, 1)
+		s.auditAccess(r, audit.ActionPassthrough, rule, "目标不在测试范围内")
+		logger.Debugf("范围外请求透传: %s", target)
+		s.passthrough(w, r)
+		return false
+	}
+
+	atomic.AddInt64(&s.scopeBlocked, 1)
+	s.auditAccess(r, audit.ActionDeny, rule, "目标不在测试范围内")
+	logger.Infof("范围外请求已拦截: %s %s", r.Method, target)
+	w.Header().Set("Cache-Control", "no-store")
+	if r.Method == http.MethodConnect {
+		http.Error(w, "目标不在授权测试范围内: "+target.String(), http.StatusForbidden)
+		return false
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(http.StatusForbidden)
+	if err := scopeBlockTemplate.Execute(w, target.String()); err != nil {
+		logger.Errorf("渲染范围拦截页面失败: %v", err)
+	}
+	return false
+}
+
+// passthrough 透传范围外请求：CONNECT 直接建立TCP隧道不解密，其他请求直接转发，均不经过插件和流量记录
+func (s *Server) passthrough(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodConnect {
+		s.passthroughConnect(w, r)
+		return
+	}
+	if s.isWebSocketUpgrade(r) {
+		s.handleWebSocket(w, r)
+		return
+	}
+
+	if r.URL.Scheme == "" {
+		r.URL.Scheme = "http"
+	}
+	if r.URL.Host == "" {
+		r.URL.Host = r.Host
+	}
+
+	newReq := r.Clone(r.Context())
+	newReq.RequestURI = ""
+	ctx, cancel := context.WithTimeout(r.Context(), s.config.GetProxy().UpstreamTimeout)
+	defer cancel()
+
+	resp, err := s.client.Do(newReq.WithContext(ctx))
+	if err != nil {
+		s.writeUpstreamError(w, r, "透传请求失败", err)
+		return
+	}
+	defer resp.Body.Close()
+
+	for name, values := range resp.Header {
+		for _, value := range values {
+			w.Header().Add(name, value)
+		}
+	}
+	w.WriteHeader(resp.StatusCode)
+
+	buffer := s.bufferPool.Get(32 * 1024)
+	defer s.bufferPool.Put(buffer)
+	if _, err := io.CopyBuffer(w, resp.Body, buffer.Bytes()); err != nil {
+		logger.Debugf("复制透传响应体失败: %v", err)
+	}
+}
+
+// passthroughConnect 为范围外的 CONNECT 请求建立不解密的TCP隧道。
+// 透传隧道内的请求不可见，隧道本身按一个请求计入全局和用户策略的限流
+func (s *Server) passthroughConnect(w http.ResponseWriter, r *http.Request) {
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, "不支持连接劫持", http.StatusInternalServerError)
+		return
+	}
+	if !s.checkRequest(w, r) || !s.allowPolicy(w, r) {
+		return
+	}
+
+	serverConn, err := s.dialGuard.Dial("tcp", r.Host, s.config.GetProxy().UpstreamTimeout)
+	if err != nil {
+		s.writeUpstreamError(w, r, "透传隧道连接目标失败", err)
+		return
+	}
+	defer serverConn.Close()
+
+	clientConn, _, err := hijacker.Hijack()
+	if err != nil {
+		logger.Errorf("劫持连接失败: %v", err)
+		return
+	}
+	defer clientConn.Close()
+
+	if _, err := clientConn.Write([]byte("HTTP/1.1 200 Connection Established\r\n\r\n")); err != nil {
+		return
+	}
+
+	go s.proxyWebSocketData(clientConn, serverConn, "client->server")
+	s.proxyWebSocketData(serverConn, clientConn, "server->client")
+}
+
+// scopeStats 测试范围统计信息
+func (s *Server) scopeStats() map[string]interface{} {
+	return map[string]interface{}{
+		"enabled":     s.scope.Enabled(),
+		"action":      s.scope.Action(),
+		"blocked":     atomic.LoadInt64(&s.scopeBlocked),
+		"passthrough": atomic.LoadInt64(&s.scopePassthrough),
+	}
+}
@@ -5,22 +5,28 @@ package proxy
 import (
 	"context"
 	"crypto/tls"
+	"errors"
 	"fmt"
 	"io"
 	"net"
 	"net/http"
 	"net/url"
+	"strconv"
 	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
 
+	"hackmitm/pkg/audit"
 	"hackmitm/pkg/cert"
 	"hackmitm/pkg/config"
 	"hackmitm/pkg/fingerprint"
+	"hackmitm/pkg/flows"
 	"hackmitm/pkg/logger"
 	"hackmitm/pkg/plugin"
+	"hackmitm/pkg/policy"
 	"hackmitm/pkg/pool"
+	"hackmitm/pkg/scope"
 	"hackmitm/pkg/security"
 	"hackmitm/pkg/traffic"
 )
@@ -42,16 +48,30 @@ type Server struct {
 	accessController *security.AccessController
 	// pluginManager 插件管理器
 	pluginManager *plugin.Manager
+	// dialGuard 上游连接地址限制
+	dialGuard *security.DialGuard
+	// scope 测试范围
+	scope *scope.Scope
+	// policies 用户策略
+	policies *policy.Engine
+	// flows 按用户隔离的流量记录
+	flows *flows.Store
 	// httpServer HTTP服务器
 	httpServer *http.Server
 	// client HTTP客户端
 	client *http.Client
 	// bufferPool 高效内存池
 	bufferPool *pool.BufferPool
+	// keyLog TLS密钥日志写入器（未启用时为nil）
+	keyLog *keyLogWriter
 	// activeConns 活跃连接数
 	activeConns int64
 	// totalRequests 总请求数
 	totalRequests int64
+	// scopeBlocked 被拦截的范围外请求数
+	scopeBlocked int64
+	// scopePassthrough 透传的范围外请求数
+	scopePassthrough int64
 	// startTime 启动时间
 	startTime time.Time
 	// mutex 互斥锁
@@ -81,31 +101,10 @@ func NewServer(cfg *config.Config, certMgr *cert.CertManager) (*Server, error) {
 
 	// 配置流量模式识别
 	patternConfig := cfg.GetPatternRecognition()
-	patternHandler.SetEnabled(patternConfig.Enabled)
-	if patternConfig.ConfidenceThreshold > 0 {
-		patternHandler.GetRecognizer().SetConfidenceThreshold(patternConfig.ConfidenceThreshold)
-	}
-	if patternConfig.CacheSize > 0 && patternConfig.CacheTTL > 0 {
-		patternHandler.SetCacheConfig(patternConfig.CacheSize, time.Duration(patternConfig.CacheTTL)*time.Second)
-	}
-
-	// 创建指纹识别处理器
-	log := logger.NewLogger()
-	fingerprintHandler := fingerprint.NewFingerprintHandler(log.Logger)
-
-	// 配置指纹识别
-	fingerprintConfig := cfg.GetFingerprint()
-	if fingerprintConfig.Enabled {
-		if err := fingerprintHandler.InitializeWithAdvancedConfig(
-			fingerprintConfig.FingerprintPath,
-			fingerprintConfig.CacheSize,
-			fingerprintConfig.CacheTTL,
-			fingerprintConfig.UseLayeredIndex,
-			fingerprintConfig.MaxMatches,
-		); err != nil {
-			log.Warnf("Failed to initialize fingerprint handler: %v", err)
-		}
-	}
+	applyPatternConfig(patternHandler, patternConfig)
+
+	// 创建指纹识别处理器（未启用时为nil）
+	fingerprintHandler := newFingerprintHandler(cfg.GetFingerprint())
 
 	// 添加默认处理器
 	processor.AddRequestHandler(&traffic.LoggingHandler{})
@@ -121,8 +120,35 @@ func NewServer(cfg *config.Config, certMgr *cert.CertManager) (*Server, error) {
 	// 创建插件管理器
 	pluginManager := plugin.NewManager("./plugins")
 
+	// 创建TLS密钥日志
+	keyLog, err := newKeyLogWriter(cfg.GetTLS())
+	if err != nil {
+		cancel()
+		return nil, fmt.Errorf("创建TLS密钥日志失败: %w", err)
+	}
+
+	// 创建测试范围
+	targetScope, err := scope.NewScope(cfg.GetScope())
+	if err != nil {
+		cancel()
+		return nil, fmt.Errorf("加载测试范围失败: %w", err)
+	}
+	go targetScope.Watch(ctx, 5*time.Second)
+
+	// 创建用户策略，插件管理器按策略为每个用户选择生效的插件
+	policies, err := policy.NewEngine(cfg.GetPolicies())
+	if err != nil {
+		cancel()
+		return nil, fmt.Errorf("加载用户策略失败: %w", err)
+	}
+	pluginManager.SetPluginSelector(policies.PluginEnabled)
+
+	// 创建上游连接守卫，所有上游连接都经过它检查目标地址
+	dialGuard := security.NewDialGuard(cfg.GetSecurity().DialGuard)
+
 	// 创建HTTP客户端
 	transport := &http.Transport{
+		DialContext:         dialGuard.DialContext,
 		MaxIdleConns:        cfg.GetProxy().MaxIdleConns,
 		MaxIdleConnsPerHost: 20,
 		IdleConnTimeout:     90 * time.Second,
@@ -134,6 +160,9 @@ func NewServer(cfg *config.Config, certMgr *cert.CertManager) (*Server, error) {
 		MaxConnsPerHost:   0, // 无限制
 		DisableKeepAlives: false,
 	}
+	if keyLog != nil {
+		transport.TLSClientConfig = &tls.Config{KeyLogWriter: keyLog}
+	}
 
 	client := &http.Client{
 		Timeout:   cfg.GetProxy().UpstreamTimeout,
@@ -155,8 +184,13 @@ func NewServer(cfg *config.Config, certMgr *cert.CertManager) (*Server, error) {
 		fingerprintHandler: fingerprintHandler,
 		accessController:   accessController,
 		pluginManager:      pluginManager,
+		scope:              targetScope,
+		policies:           policies,
+		flows:              flows.NewStore(cfg.GetFlows()),
+		dialGuard:          dialGuard,
 		client:             client,
 		bufferPool:         bufferPool,
+		keyLog:             keyLog,
 		activeConns:        0,
 		totalRequests:      0,
 		startTime:          time.Now(),
@@ -164,6 +198,9 @@ func NewServer(cfg *config.Config, certMgr *cert.CertManager) (*Server, error) {
 		cancel:             cancel,
 	}
 
+	// 订阅配置变更，运行时应用各子系统的配置
+	server.subscribeConfig()
+
 	return server, nil
 }
 
@@ -191,6 +228,12 @@ func (s *Server) Start() error {
 	if err != nil {
 		return fmt.Errorf("创建监听器失败: %w", err)
 	}
+	tlsListener, err := s.wrapListenerTLS(listener)
+	if err != nil {
+		listener.Close()
+		return fmt.Errorf("配置监听端口TLS失败: %w", err)
+	}
+	listener = tlsListener
 
 	// 创建启动完成通道
 	started := make(chan error, 1)
@@ -254,15 +297,28 @@ func (s *Server) Stop() error {
 	}
 
 	// 关闭指纹识别处理器
-	if s.fingerprintHandler != nil {
-		s.fingerprintHandler.Stop()
+	if fingerprintHandler := s.GetFingerprintHandler(); fingerprintHandler != nil {
+		fingerprintHandler.Stop()
 	}
 
+	// 停止用户策略的限流器
+	s.policies.Stop()
+
+	// 停止访问控制器的限流清理与访问列表清理协程
+	s.accessController.Stop()
+
 	// 关闭内存池
 	if s.bufferPool != nil {
 		s.bufferPool.Stop()
 	}
 
+	// 关闭TLS密钥日志
+	if s.keyLog != nil {
+		if err := s.keyLog.Close(); err != nil {
+			logger.Errorf("关闭TLS密钥日志失败: %v", err)
+		}
+	}
+
 	logger.Info("代理服务器已停止")
 	return nil
 }
@@ -278,23 +334,55 @@ func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		atomic.AddInt64(&s.activeConns, -1)
 	}()
 
+	// 解析客户端IP（仅采信可信代理的转发头），后续访问控制、插件和流量识别共用
+	r = r.WithContext(security.WithClientIP(r.Context(), s.accessController.ClientIP(r)))
+
 	// 访问控制检查
-	if err := s.accessController.IsAllowed(r); err != nil {
+	username, err := s.accessController.Authorize(r)
+	if err != nil {
+		s.auditAccess(r, audit.ActionDeny, security.DenyRule(err), err.Error())
+		if errors.Is(err, security.ErrProxyAuthRequired) {
+			logger.Debugf("要求代理认证: %v", err)
+			w.Header().Set("Proxy-Authenticate", s.accessController.AuthChallenge())
+			http.Error(w, "需要代理认证", http.StatusProxyAuthRequired)
+			return
+		}
+		var rateErr *security.RateLimitError
+		if errors.As(err, &rateErr) {
+			s.writeRateLimited(w, rateErr)
+			return
+		}
 		logger.Warnf("访问被拒绝: %v", err)
 		http.Error(w, "访问被拒绝", http.StatusForbidden)
 		return
 	}
 
-	// 插件过滤检查
-	if allowed, err := s.checkPluginFilters(r); err != nil {
-		logger.Errorf("插件过滤检查失败: %v", err)
-		http.Error(w, "内部错误", http.StatusInternalServerError)
+	// 代理凭据不转发给上游，认证用户名随请求上下文传递
+	r.Header.Del("Proxy-Authorization")
+	r = r.WithContext(security.WithUsername(r.Context(), username))
+
+	// 用户策略（限流、插件、范围和流量记录）
+	r, ok := s.applyPolicy(w, r)
+	if !ok {
 		return
-	} else if !allowed {
-		logger.Warnf("请求被插件过滤器阻止: %s %s", r.Method, r.URL.String())
-		http.Error(w, "请求被阻止", http.StatusForbidden)
+	}
+
+	// CA证书下载页面
+	if s.isCAPortalRequest(r) {
+		s.serveCAPortal(w, r)
+		return
+	}
+
+	// 测试范围检查，范围外的目标在建立上游连接前拦截或透传
+	if !s.checkScope(w, r) {
+		return
+	}
+
+	// 插件过滤检查
+	if !s.applyPluginFilters(w, r) {
 		return
 	}
+	s.auditAccess(r, audit.ActionAllow, "", "")
 
 	// 检查WebSocket升级
 	if s.isWebSocketUpgrade(r) {
@@ -312,6 +400,30 @@ func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	s.handleHTTP(w, r)
 }
 
+// writeRateLimited 返回 429 及 Retry-After
+func (s *Server) writeRateLimited(w http.ResponseWriter, rateErr *security.RateLimitError) {
+	logger.Debugf("请求被限流: %v", rateErr)
+	w.Header().Set("Retry-After", strconv.Itoa(rateErr.RetryAfterSeconds()))
+	http.Error(w, "请求过于频繁", http.StatusTooManyRequests)
+}
+
+// writeUpstreamError 根据上游错误类型返回 403（地址被禁止）、504（超时）或 502
+func (s *Server) writeUpstreamError(w http.ResponseWriter, r *http.Request, message string, err error) {
+	var blockedErr *security.DialBlockedError
+	if errors.As(err, &blockedErr) {
+		s.auditAccess(r, audit.ActionDeny, "dial_guard", blockedErr.Error())
+		http.Error(w, "目标地址禁止访问", http.StatusForbidden)
+		return
+	}
+	logger.Errorf("%s: %v", message, err)
+	s.reportError(r, plugin.ErrorTypeUpstream, err)
+	if strings.Contains(err.Error(), "timeout") {
+		http.Error(w, "请求超时", http.StatusGatewayTimeout)
+	} else {
+		http.Error(w, "转发请求失败", http.StatusBadGateway)
+	}
+}
+
 // isWebSocketUpgrade 检查是否为WebSocket升级请求
 func (s *Server) isWebSocketUpgrade(r *http.Request) bool {
 	return strings.ToLower(r.Header.Get("Connection")) == "upgrade" &&
@@ -349,9 +461,14 @@ func (s *Server) handleWebSocket(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// 创建到目标的连接
-	serverConn, err := net.Dial("tcp", targetURL.Host)
+	serverConn, err := s.dialGuard.Dial("tcp", targetURL.Host, s.config.GetProxy().UpstreamTimeout)
 	if err != nil {
+		var blockedErr *security.DialBlockedError
+		if errors.As(err, &blockedErr) {
+			s.auditAccess(r, audit.ActionDeny, "dial_guard", blockedErr.Error())
+		}
 		logger.Errorf("连接WebSocket目标失败: %v", err)
+		s.reportError(r, plugin.ErrorTypeWebSocket, err)
 		return
 	}
 	defer serverConn.Close()
@@ -359,6 +476,7 @@ func (s *Server) handleWebSocket(w http.ResponseWriter, r *http.Request) {
 	// 转发初始HTTP请求
 	if err := r.Write(serverConn); err != nil {
 		logger.Errorf("转发WebSocket握手失败: %v", err)
+		s.reportError(r, plugin.ErrorTypeWebSocket, err)
 		return
 	}
 
@@ -414,6 +532,7 @@ func (s *Server) handleConnect(w http.ResponseWriter, r *http.Request) {
 	certificate, err := s.certManager.GetCertificate(host)
 	if err != nil {
 		logger.Errorf("获取证书失败: %v", err)
+		s.reportError(r, plugin.ErrorTypeTLS, err)
 		return
 	}
 
@@ -422,21 +541,42 @@ func (s *Server) handleConnect(w http.ResponseWriter, r *http.Request) {
 		Certificates: []tls.Certificate{*certificate},
 		ServerName:   host,
 	}
+	if s.keyLog != nil {
+		tlsConfig.KeyLogWriter = s.keyLog
+	}
 
 	// 升级到TLS连接
 	tlsConn := tls.Server(clientConn, tlsConfig)
 	if err := tlsConn.Handshake(); err != nil {
 		logger.Errorf("TLS握手失败: %v", err)
+		s.reportError(r, plugin.ErrorTypeTLS, err)
 		return
 	}
 
 	// 处理HTTPS流量
-	s.handleHTTPS(tlsConn, r.Host)
+	s.handleHTTPS(tlsConn, r.Host, security.UsernameFromContext(r.Context()), security.ClientIP(r))
 }
 
-// handleHTTPS 处理HTTPS流量
+// checkRequest 对隧道内的请求或透传隧道检查封禁和全局限流，被拒绝时写入响应并返回 false
+func (s *Server) checkRequest(w http.ResponseWriter, r *http.Request) bool {
+	err := s.accessController.CheckRequest(r)
+	if err == nil {
+		return true
+	}
+	s.auditAccess(r, audit.ActionDeny, security.DenyRule(err), err.Error())
+	var rateErr *security.RateLimitError
+	if errors.As(err, &rateErr) {
+		s.writeRateLimited(w, rateErr)
+		return false
+	}
+	logger.Warnf("访问被拒绝: %v", err)
+	http.Error(w, "访问被拒绝", http.StatusForbidden)
+	return false
+}
+
+// handleHTTPS 处理HTTPS流量，username 和 clientIP 为 CONNECT 请求认证的用户名和解析出的客户端IP
 // handleHTTPS handles HTTPS traffic
-func (s *Server) handleHTTPS(clientConn *tls.Conn, targetHost string) {
+func (s *Server) handleHTTPS(clientConn *tls.Conn, targetHost, username, clientIP string) {
 	defer clientConn.Close()
 
 	logger.Debugf("开始处理HTTPS连接: %s", targetHost)
@@ -452,13 +592,34 @@ func (s *Server) handleHTTPS(clientConn *tls.Conn, targetHost string) {
 				r.URL.Host = targetHost
 			}
 
+			// 隧道内的请求继承 CONNECT 的认证用户和客户端IP，不再解析隧道内的转发头
+			ctx := security.WithUsername(r.Context(), username)
+			r = r.WithContext(security.WithClientIP(ctx, clientIP))
+
+			// 隧道内的每个请求同样检查封禁、限流（按目标主机限流依赖于此）和插件过滤器
+			if !s.checkRequest(w, r) {
+				return
+			}
+			r, ok := s.applyPolicy(w, r)
+			if !ok {
+				return
+			}
+			// CONNECT 只按主机判断范围，隧道内的请求再按完整URL检查
+			if !s.checkScope(w, r) {
+				return
+			}
+			if !s.applyPluginFilters(w, r) {
+				return
+			}
+			s.auditAccess(r, audit.ActionAllow, "", "")
+
 			// 处理HTTPS请求（类似handleHTTP）
 			s.handleHTTPSRequest(w, r)
 		}),
 	}
 
 	// 使用TLS连接作为HTTP服务器的监听器
-	listener := &singleConnListener{conn: clientConn}
+	listener := newSingleConnListener(clientConn)
 	if err := httpServer.Serve(listener); err != nil && err != http.ErrServerClosed {
 		logger.Debugf("HTTPS服务器错误: %v", err)
 	}
@@ -466,20 +627,28 @@ func (s *Server) handleHTTPS(clientConn *tls.Conn, targetHost string) {
 	logger.Debugf("HTTPS连接处理完成: %s", targetHost)
 }
 
-// singleConnListener 单连接监听器
+// singleConnListener 单连接监听器，连接关闭前 Accept 一直阻塞，
+// 避免 http.Server.Serve 在连接仍在处理请求时提前返回
 type singleConnListener struct {
 	conn net.Conn
 	once sync.Once
+	done chan struct{}
+}
+
+// newSingleConnListener 创建单连接监听器
+func newSingleConnListener(conn net.Conn) *singleConnListener {
+	return &singleConnListener{conn: conn, done: make(chan struct{})}
 }
 
 func (l *singleConnListener) Accept() (net.Conn, error) {
 	var conn net.Conn
 	l.once.Do(func() {
-		conn = l.conn
+		conn = &notifyCloseConn{Conn: l.conn, done: l.done}
 	})
 	if conn != nil {
 		return conn, nil
 	}
+	<-l.done
 	return nil, io.EOF
 }
 
@@ -491,17 +660,36 @@ func (l *singleConnListener) Addr() net.Addr {
 	return l.conn.LocalAddr()
 }
 
+// notifyCloseConn 关闭时通知监听器的连接
+type notifyCloseConn struct {
+	net.Conn
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+func (c *notifyCloseConn) Close() error {
+	c.closeOnce.Do(func() { close(c.done) })
+	return c.Conn.Close()
+}
+
 // handleHTTPSRequest 处理HTTPS请求（类似handleHTTP但针对HTTPS）
 func (s *Server) handleHTTPSRequest(w http.ResponseWriter, r *http.Request) {
 	startTime := time.Now()
 	logger.Debugf("处理HTTPS请求: %s %s", r.Method, r.URL.String())
 
+	// CA证书下载页面
+	if s.isCAPortalRequest(r) {
+		s.serveCAPortal(w, r)
+		return
+	}
+
 	// 创建请求上下文
 	requestCtx := s.buildRequestContext(r, startTime)
 
 	// 处理请求插件链
 	if err := s.processRequestPlugins(r, requestCtx); err != nil {
 		logger.Errorf("HTTPS请求插件处理失败: %v", err)
+		s.reportError(r, plugin.ErrorTypeRequestPlugin, err)
 		http.Error(w, "请求处理失败", http.StatusInternalServerError)
 		return
 	}
@@ -509,6 +697,7 @@ func (s *Server) handleHTTPSRequest(w http.ResponseWriter, r *http.Request) {
 	// 处理请求
 	if err := s.processor.ProcessRequest(r); err != nil {
 		logger.Errorf("处理HTTPS请求失败: %v", err)
+		s.reportError(r, plugin.ErrorTypeRequestProcessor, err)
 		http.Error(w, "请求处理失败", http.StatusInternalServerError)
 		return
 	}
@@ -522,25 +711,28 @@ func (s *Server) handleHTTPSRequest(w http.ResponseWriter, r *http.Request) {
 	defer cancel()
 	newReq = newReq.WithContext(ctx)
 
-	// 转发请求到目标服务器
-	resp, err := s.client.Do(newReq)
+	// 按用户策略记录流量
+	recorder := s.newFlowRecorder(r, requestCtx.Body, startTime)
+
+	// 分析和记录即将转发的请求
+	s.observeRequest(r, requestCtx, recorder)
+
+	// 转发请求到目标服务器，插件直接返回响应时不再转发
+	resp, err := s.forward(newReq, requestCtx)
 	if err != nil {
-		logger.Errorf("转发HTTPS请求失败: %v", err)
-		if strings.Contains(err.Error(), "timeout") {
-			http.Error(w, "请求超时", http.StatusGatewayTimeout)
-		} else {
-			http.Error(w, "转发请求失败", http.StatusBadGateway)
-		}
+		recorder.finish(nil, err)
+		s.writeUpstreamError(w, r, "转发HTTPS请求失败", err)
 		return
 	}
 	defer resp.Body.Close()
 
 	// 创建响应上下文
-	responseCtx := s.buildResponseContext(resp, time.Since(startTime))
+	responseCtx := s.buildResponseContext(resp, r, time.Since(startTime))
 
 	// 处理响应插件链
 	if err := s.processResponsePlugins(resp, r, responseCtx); err != nil {
 		logger.Errorf("HTTPS响应插件处理失败: %v", err)
+		s.reportError(r, plugin.ErrorTypeResponsePlugin, err)
 		http.Error(w, "响应处理失败", http.StatusInternalServerError)
 		return
 	}
@@ -548,10 +740,14 @@ func (s *Server) handleHTTPSRequest(w http.ResponseWriter, r *http.Request) {
 	// 处理响应
 	if err := s.processor.ProcessResponse(resp, r); err != nil {
 		logger.Errorf("处理HTTPS响应失败: %v", err)
+		s.reportError(r, plugin.ErrorTypeResponseProcessor, err)
 		http.Error(w, "响应处理失败", http.StatusInternalServerError)
 		return
 	}
 
+	// 分析即将发送给客户端的响应
+	s.analyzeResponse(resp, r, responseCtx, recorder)
+
 	// 复制响应头
 	for name, values := range resp.Header {
 		for _, value := range values {
@@ -568,21 +764,29 @@ func (s *Server) handleHTTPSRequest(w http.ResponseWriter, r *http.Request) {
 
 	// 读取响应体进行指纹识别
 	var bodyBuffer []byte
-	if s.fingerprintHandler != nil {
+	var written int64
+	var copyErr error
+	responseBody := recorder.wrapBody(resp.Body)
+	if fingerprintHandler := s.GetFingerprintHandler(); fingerprintHandler != nil {
 		bodyBuffer = make([]byte, 0, 1024*1024) // 1MB限制
-		teeReader := io.TeeReader(resp.Body, &bodyWriter{&bodyBuffer})
+		teeReader := io.TeeReader(responseBody, &bodyWriter{&bodyBuffer})
 
-		if _, err := io.CopyBuffer(w, teeReader, buffer.Bytes()); err != nil {
-			logger.Errorf("复制HTTPS响应体失败: %v", err)
+		if written, copyErr = io.CopyBuffer(w, teeReader, buffer.Bytes()); copyErr != nil {
+			logger.Errorf("复制HTTPS响应体失败: %v", copyErr)
 		}
 
 		// 执行指纹识别
-		go s.fingerprintHandler.HandleRequest(r, resp, bodyBuffer)
+		go fingerprintHandler.HandleRequest(r, resp, bodyBuffer)
 	} else {
-		if _, err := io.CopyBuffer(w, resp.Body, buffer.Bytes()); err != nil {
-			logger.Errorf("复制HTTPS响应体失败: %v", err)
+		if written, copyErr = io.CopyBuffer(w, responseBody, buffer.Bytes()); copyErr != nil {
+			logger.Errorf("复制HTTPS响应体失败: %v", copyErr)
 		}
 	}
+	recorder.finish(resp, copyErr)
+	s.reportError(r, plugin.ErrorTypeResponseCopy, copyErr)
+
+	// 记录已发送给客户端的响应
+	s.logResponse(resp, r, responseCtx, written, startTime)
 }
 
 // handleHTTP 处理HTTP请求（增强版，集成插件）
@@ -604,6 +808,7 @@ func (s *Server) handleHTTP(w http.ResponseWriter, r *http.Request) {
 	// 处理请求插件链
 	if err := s.processRequestPlugins(r, requestCtx); err != nil {
 		logger.Errorf("请求插件处理失败: %v", err)
+		s.reportError(r, plugin.ErrorTypeRequestPlugin, err)
 		http.Error(w, "请求处理失败", http.StatusInternalServerError)
 		return
 	}
@@ -611,6 +816,7 @@ func (s *Server) handleHTTP(w http.ResponseWriter, r *http.Request) {
 	// 处理请求
 	if err := s.processor.ProcessRequest(r); err != nil {
 		logger.Errorf("处理HTTP请求失败: %v", err)
+		s.reportError(r, plugin.ErrorTypeRequestProcessor, err)
 		http.Error(w, "请求处理失败", http.StatusInternalServerError)
 		return
 	}
@@ -624,25 +830,28 @@ func (s *Server) handleHTTP(w http.ResponseWriter, r *http.Request) {
 	defer cancel()
 	newReq = newReq.WithContext(ctx)
 
-	// 转发请求到目标服务器
-	resp, err := s.client.Do(newReq)
+	// 按用户策略记录流量
+	recorder := s.newFlowRecorder(r, requestCtx.Body, startTime)
+
+	// 分析和记录即将转发的请求
+	s.observeRequest(r, requestCtx, recorder)
+
+	// 转发请求到目标服务器，插件直接返回响应时不再转发
+	resp, err := s.forward(newReq, requestCtx)
 	if err != nil {
-		logger.Errorf("转发HTTP请求失败: %v", err)
-		if strings.Contains(err.Error(), "timeout") {
-			http.Error(w, "请求超时", http.StatusGatewayTimeout)
-		} else {
-			http.Error(w, "转发请求失败", http.StatusBadGateway)
-		}
+		recorder.finish(nil, err)
+		s.writeUpstreamError(w, r, "转发HTTP请求失败", err)
 		return
 	}
 	defer resp.Body.Close()
 
 	// 创建响应上下文
-	responseCtx := s.buildResponseContext(resp, time.Since(startTime))
+	responseCtx := s.buildResponseContext(resp, r, time.Since(startTime))
 
 	// 处理响应插件链
 	if err := s.processResponsePlugins(resp, r, responseCtx); err != nil {
 		logger.Errorf("响应插件处理失败: %v", err)
+		s.reportError(r, plugin.ErrorTypeResponsePlugin, err)
 		http.Error(w, "响应处理失败", http.StatusInternalServerError)
 		return
 	}
@@ -650,10 +859,14 @@ func (s *Server) handleHTTP(w http.ResponseWriter, r *http.Request) {
 	// 处理响应
 	if err := s.processor.ProcessResponse(resp, r); err != nil {
 		logger.Errorf("处理HTTP响应失败: %v", err)
+		s.reportError(r, plugin.ErrorTypeResponseProcessor, err)
 		http.Error(w, "响应处理失败", http.StatusInternalServerError)
 		return
 	}
 
+	// 分析即将发送给客户端的响应
+	s.analyzeResponse(resp, r, responseCtx, recorder)
+
 	// 复制响应头
 	for name, values := range resp.Header {
 		for _, value := range values {
@@ -670,21 +883,29 @@ func (s *Server) handleHTTP(w http.ResponseWriter, r *http.Request) {
 
 	// 读取响应体进行指纹识别
 	var bodyBuffer []byte
-	if s.fingerprintHandler != nil {
+	var written int64
+	var copyErr error
+	responseBody := recorder.wrapBody(resp.Body)
+	if fingerprintHandler := s.GetFingerprintHandler(); fingerprintHandler != nil {
 		bodyBuffer = make([]byte, 0, 1024*1024) // 1MB限制
-		teeReader := io.TeeReader(resp.Body, &bodyWriter{&bodyBuffer})
+		teeReader := io.TeeReader(responseBody, &bodyWriter{&bodyBuffer})
 
-		if _, err := io.CopyBuffer(w, teeReader, buffer.Bytes()); err != nil {
-			logger.Errorf("复制HTTP响应体失败: %v", err)
+		if written, copyErr = io.CopyBuffer(w, teeReader, buffer.Bytes()); copyErr != nil {
+			logger.Errorf("复制HTTP响应体失败: %v", copyErr)
 		}
 
 		// 执行指纹识别
-		go s.fingerprintHandler.HandleRequest(r, resp, bodyBuffer)
+		go fingerprintHandler.HandleRequest(r, resp, bodyBuffer)
 	} else {
-		if _, err := io.CopyBuffer(w, resp.Body, buffer.Bytes()); err != nil {
-			logger.Errorf("复制HTTP响应体失败: %v", err)
+		if written, copyErr = io.CopyBuffer(w, responseBody, buffer.Bytes()); copyErr != nil {
+			logger.Errorf("复制HTTP响应体失败: %v", copyErr)
 		}
 	}
+	recorder.finish(resp, copyErr)
+	s.reportError(r, plugin.ErrorTypeResponseCopy, copyErr)
+
+	// 记录已发送给客户端的响应
+	s.logResponse(resp, r, responseCtx, written, startTime)
 }
 
 // bodyWriter 用于收集响应体数据
@@ -720,6 +941,8 @@ func (s *Server) buildRequestContext(r *http.Request, startTime time.Time) *plug
 	return &plugin.RequestContext{
 		StartTime: startTime,
 		ClientIP:  s.getClientIP(r),
+		Username:  security.UsernameFromContext(r.Context()),
+		Policy:    policy.FromContext(r.Context()).PolicyName(),
 		UserAgent: r.UserAgent(),
 		Method:    r.Method,
 		URL:       r.URL.String(),
@@ -729,8 +952,8 @@ func (s *Server) buildRequestContext(r *http.Request, startTime time.Time) *plug
 	}
 }
 
-// buildResponseContext 构建响应上下文
-func (s *Server) buildResponseContext(resp *http.Response, duration time.Duration) *plugin.ResponseContext {
+// buildResponseContext 构建响应上下文，r 为发起请求的客户端请求
+func (s *Server) buildResponseContext(resp *http.Response, r *http.Request, duration time.Duration) *plugin.ResponseContext {
 	// 构建响应头映射
 	headers := make(map[string]string)
 	for name, values := range resp.Header {
@@ -745,26 +968,113 @@ func (s *Server) buildResponseContext(resp *http.Response, duration time.Duratio
 		Body:       nil, // 响应体在流式处理中，这里为空
 		Size:       resp.ContentLength,
 		Duration:   duration,
+		Username:   security.UsernameFromContext(r.Context()),
+		Policy:     policy.FromContext(r.Context()).PolicyName(),
 		Metadata:   make(map[string]interface{}),
 	}
 }
 
-// processRequestPlugins 处理请求插件链
+// processRequestPlugins 处理请求插件链，随后由修改器插件修改请求
 func (s *Server) processRequestPlugins(r *http.Request, ctx *plugin.RequestContext) error {
 	if s.pluginManager == nil {
 		return nil
 	}
 
-	return s.pluginManager.ProcessRequest(r, ctx)
+	if err := s.pluginManager.ProcessRequest(r, ctx); err != nil {
+		return err
+	}
+	if ctx.Response != nil {
+		return nil
+	}
+	return s.pluginManager.ModifyRequest(r, ctx)
 }
 
-// processResponsePlugins 处理响应插件链
+// forward 转发请求到目标服务器，请求插件设置了 ctx.Response 时直接使用该响应
+func (s *Server) forward(req *http.Request, ctx *plugin.RequestContext) (*http.Response, error) {
+	resp := ctx.Response
+	if resp == nil {
+		return s.client.Do(req)
+	}
+
+	logger.Debugf("使用插件返回的响应: %s %d", req.URL.String(), resp.StatusCode)
+	if resp.Body == nil {
+		resp.Body = http.NoBody
+	}
+	if resp.Header == nil {
+		resp.Header = make(http.Header)
+	}
+	resp.Request = req
+	return resp, nil
+}
+
+// processResponsePlugins 处理响应插件链，随后由修改器插件修改响应
 func (s *Server) processResponsePlugins(resp *http.Response, req *http.Request, ctx *plugin.ResponseContext) error {
 	if s.pluginManager == nil {
 		return nil
 	}
 
-	return s.pluginManager.ProcessResponse(resp, req, ctx)
+	if err := s.pluginManager.ProcessResponse(resp, req, ctx); err != nil {
+		return err
+	}
+	return s.pluginManager.ModifyResponse(resp, req, ctx)
+}
+
+// observeRequest 将即将转发的请求交给分析插件和日志插件，
+// 分析结果记入流量并以 analysis 键放入上下文元数据，日志插件可以读取
+func (s *Server) observeRequest(r *http.Request, ctx *plugin.RequestContext, recorder *flowRecorder) {
+	if s.pluginManager == nil {
+		return
+	}
+
+	if results := s.pluginManager.AnalyzeRequest(r, ctx); len(results) > 0 {
+		ctx.Metadata["analysis"] = results
+		recorder.addAnalysis(results)
+	}
+	s.pluginManager.LogRequest(r, ctx)
+}
+
+// analyzeResponse 将即将发送给客户端的响应交给分析插件，分析结果记入流量和上下文元数据
+func (s *Server) analyzeResponse(resp *http.Response, r *http.Request, ctx *plugin.ResponseContext, recorder *flowRecorder) {
+	if s.pluginManager == nil {
+		return
+	}
+
+	if results := s.pluginManager.AnalyzeResponse(resp, r, ctx); len(results) > 0 {
+		ctx.Metadata["analysis"] = results
+		recorder.addAnalysis(results)
+	}
+}
+
+// logResponse 响应发送完成后交给日志插件，Size 和 Duration 为实际发送的字节数和总耗时
+func (s *Server) logResponse(resp *http.Response, r *http.Request, ctx *plugin.ResponseContext, written int64, startTime time.Time) {
+	if s.pluginManager == nil {
+		return
+	}
+
+	ctx.Size = written
+	ctx.Duration = time.Since(startTime)
+	s.pluginManager.LogResponse(resp, r, ctx)
+}
+
+// reportError 将代理处理请求时的错误交给日志插件，err 为nil时忽略
+func (s *Server) reportError(r *http.Request, errorType string, err error) {
+	if s.pluginManager == nil || err == nil {
+		return
+	}
+
+	s.pluginManager.LogError(err, r, &plugin.ErrorContext{
+		Username:     security.UsernameFromContext(r.Context()),
+		Policy:       policy.FromContext(r.Context()).PolicyName(),
+		ErrorType:    errorType,
+		ErrorMessage: err.Error(),
+		Timestamp:    time.Now(),
+		Metadata: map[string]interface{}{
+			"method":    r.Method,
+			"url":       r.URL.String(),
+			"host":      r.Host,
+			"client_ip": s.getClientIP(r),
+		},
+	})
 }
 
 // getCertificate 获取TLS证书
@@ -844,27 +1154,29 @@ func (s *Server) GetPatternRecognitionStats() map[string]interface{} {
 	return map[string]interface{}{"enabled": false}
 }
 
-// GetFingerprintHandler 获取指纹识别处理器
+// GetFingerprintHandler 获取指纹识别处理器（未启用时为nil）
 func (s *Server) GetFingerprintHandler() *fingerprint.FingerprintHandler {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
 	return s.fingerprintHandler
 }
 
 // SetFingerprintEnabled 设置指纹识别是否启用
 func (s *Server) SetFingerprintEnabled(enabled bool) {
-	if s.fingerprintHandler == nil {
-		return
-	}
-	// 可以在这里添加启用/禁用逻辑
+	fingerprintConfig := s.config.GetFingerprint()
+	fingerprintConfig.Enabled = enabled
+	s.setFingerprintHandler(newFingerprintHandler(fingerprintConfig))
 }
 
 // GetFingerprintStats 获取指纹识别统计信息
 func (s *Server) GetFingerprintStats() map[string]interface{} {
-	if s.fingerprintHandler == nil {
+	fingerprintHandler := s.GetFingerprintHandler()
+	if fingerprintHandler == nil {
 		return map[string]interface{}{
 			"enabled": false,
 		}
 	}
-	return s.fingerprintHandler.GetStats()
+	return fingerprintHandler.GetStats()
 }
 
 // GetStats 获取服务器统计信息（增强版）
@@ -878,6 +1190,7 @@ func (s *Server) GetStats() map[string]interface{} {
 		"requests_per_second": float64(atomic.LoadInt64(&s.totalRequests)) / uptime.Seconds(),
 		"cert_cache_stats":    s.certManager.GetCacheStats(),
 		"access_control":      s.accessController.GetStats(),
+		"dial_guard":          s.dialGuard.GetStats(),
 		"start_time":          s.startTime.Format(time.RFC3339),
 	}
 
@@ -887,9 +1200,14 @@ func (s *Server) GetStats() map[string]interface{} {
 	}
 
 	// 添加指纹识别统计信息
-	if s.fingerprintHandler != nil {
-		stats["fingerprint"] = s.fingerprintHandler.GetStats()
-		stats["fingerprint_stats"] = s.fingerprintHandler.GetStats()
+	if fingerprintHandler := s.GetFingerprintHandler(); fingerprintHandler != nil {
+		stats["fingerprint"] = fingerprintHandler.GetStats()
+		stats["fingerprint_stats"] = fingerprintHandler.GetStats()
+	}
+
+	// 添加TLS密钥日志统计信息
+	if s.keyLog != nil {
+		stats["key_log"] = s.keyLog.GetStats()
 	}
 
 	// 添加插件统计信息
@@ -897,6 +1215,18 @@ func (s *Server) GetStats() map[string]interface{} {
 		stats["plugins"] = s.pluginManager.GetStats()
 	}
 
+	// 添加测试范围统计信息
+	stats["scope"] = s.scopeStats()
+
+	// 添加用户策略和流量记录统计信息
+	stats["policies"] = s.policyStats()
+	stats["flows"] = s.flows.GetStats()
+
+	// 添加审计日志统计信息
+	if auditLogger := audit.Default(); auditLogger != nil {
+		stats["audit"] = auditLogger.GetStats()
+	}
+
 	// 添加内存池统计信息
 	if s.bufferPool != nil {
 		stats["buffer_pool"] = s.bufferPool.GetStats()
@@ -917,16 +1247,29 @@ func (s *Server) SetUpstreamProxy(proxyURL string) error {
 		return fmt.Errorf("解析上游代理URL失败: %w", err)
 	}
 
+	// 经上游代理时 Transport 只连接代理本身，上游连接守卫改为在交给代理前检查请求的目标主机；
+	// 上游代理由运维配置，连接它时不再检查地址。WebSocket 和透传隧道不经上游代理，仍由守卫在连接时检查
 	transport := s.client.Transport.(*http.Transport)
-	transport.Proxy = http.ProxyURL(parsedURL)
+	transport.Proxy = func(req *http.Request) (*url.URL, error) {
+		if err := s.dialGuard.CheckHost(req.Context(), req.URL.Hostname()); err != nil {
+			return nil, err
+		}
+		return parsedURL, nil
+	}
+	transport.DialContext = (&net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}).DialContext
 
 	logger.Infof("设置上游代理: %s", proxyURL)
 	return nil
 }
 
-// SetAccessControl 设置访问控制
-func (s *Server) SetAccessControl(username, password string) {
-	s.accessController.SetAuth(username, password)
+// SetAccessControl 设置单用户访问认证，password 可以是明文或密码哈希
+func (s *Server) SetAccessControl(username, password string) error {
+	return s.accessController.SetAuth(username, password)
+}
+
+// GetAuthFailures 获取代理认证失败记录
+func (s *Server) GetAuthFailures() []security.AuthFailure {
+	return s.accessController.AuthFailures()
 }
 
 // AddToWhitelist 添加IP到白名单
@@ -939,43 +1282,110 @@ func (s *Server) AddToBlacklist(ip string) {
 	s.accessController.AddToBlacklist(ip)
 }
 
-// checkPluginFilters 检查插件过滤器
-func (s *Server) checkPluginFilters(r *http.Request) (bool, error) {
+// ListBans 获取生效中的自动封禁
+func (s *Server) ListBans() []security.Ban {
+	return s.accessController.Bans()
+}
+
+// BanIP 手动封禁IP，duration 为0时按递增规则计算时长
+func (s *Server) BanIP(ip string, duration time.Duration) (*security.Ban, error) {
+	return s.accessController.BanIP(ip, duration)
+}
+
+// UnbanIP 解除封禁
+func (s *Server) UnbanIP(ip string) error {
+	return s.accessController.UnbanIP(ip)
+}
+
+// ListAccessEntries 获取白名单或黑名单条目
+func (s *Server) ListAccessEntries(list string) ([]security.IPListEntry, error) {
+	return s.accessController.ListEntries(list)
+}
+
+// AddAccessEntry 运行时添加白名单或黑名单条目，ttl 为0表示永久
+func (s *Server) AddAccessEntry(list, value string, ttl time.Duration, comment string) (*security.IPListEntry, error) {
+	return s.accessController.AddListEntry(list, value, ttl, comment)
+}
+
+// RemoveAccessEntry 删除运行时添加的白名单或黑名单条目
+func (s *Server) RemoveAccessEntry(list, value string) error {
+	return s.accessController.RemoveListEntry(list, value)
+}
+
+// applyPluginFilters 执行插件过滤器，请求被拒绝时写入响应并返回 false
+// 被过滤器拒绝计为客户端违规，达到阈值时自动封禁
+func (s *Server) applyPluginFilters(w http.ResponseWriter, r *http.Request) bool {
+	allowed, pluginName, resp, err := s.checkPluginFilters(r)
+	if err != nil {
+		s.auditAccess(r, audit.ActionDeny, "plugin:"+pluginName, err.Error())
+		logger.Errorf("插件过滤检查失败: %v", err)
+		s.reportError(r, plugin.ErrorTypeFilterPlugin, err)
+		http.Error(w, "内部错误", http.StatusInternalServerError)
+		return false
+	}
+	if !allowed {
+		s.auditAccess(r, audit.ActionDeny, "plugin:"+pluginName, "过滤插件拒绝")
+		logger.Warnf("请求被插件过滤器阻止: %s %s", r.Method, r.URL.String())
+		s.accessController.ReportOffense(s.getClientIP(r), security.OffenseFilterDenial)
+		if resp != nil {
+			s.writePluginResponse(w, resp)
+		} else {
+			http.Error(w, "请求被阻止", http.StatusForbidden)
+		}
+		return false
+	}
+	if resp != nil {
+		s.auditAccess(r, audit.ActionAllow, "plugin:"+pluginName, fmt.Sprintf("过滤插件返回响应 %d", resp.StatusCode))
+		logger.Debugf("过滤插件 %s 直接返回响应: %s %s", pluginName, r.Method, r.URL.String())
+		s.writePluginResponse(w, resp)
+		return false
+	}
+	return true
+}
+
+// writePluginResponse 将过滤插件返回的响应发送给客户端
+func (s *Server) writePluginResponse(w http.ResponseWriter, resp *http.Response) {
+	if resp.Body != nil {
+		defer resp.Body.Close()
+	}
+	for name, values := range resp.Header {
+		for _, value := range values {
+			w.Header().Add(name, value)
+		}
+	}
+	w.WriteHeader(resp.StatusCode)
+	if resp.Body != nil {
+		if _, err := io.Copy(w, resp.Body); err != nil {
+			logger.Errorf("发送插件响应失败: %v", err)
+		}
+	}
+}
+
+// checkPluginFilters 检查插件过滤器，拒绝或插件返回响应时返回作出决定的插件名称和插件返回的响应
+func (s *Server) checkPluginFilters(r *http.Request) (bool, string, *http.Response, error) {
 	if s.pluginManager == nil {
-		return true, nil
+		return true, "", nil, nil
 	}
 
 	clientIP := s.getClientIP(r)
 	filterCtx := &plugin.FilterContext{
 		ClientIP:     clientIP,
+		Username:     security.UsernameFromContext(r.Context()),
+		Policy:       policy.FromContext(r.Context()).PolicyName(),
 		UserAgent:    r.UserAgent(),
 		RequestCount: atomic.LoadInt64(&s.totalRequests),
 		LastRequest:  time.Now(),
 		Metadata:     make(map[string]interface{}),
 	}
 
-	return s.pluginManager.ShouldAllow(r, filterCtx)
+	allowed, pluginName, err := s.pluginManager.FilterRequest(r, filterCtx)
+	if err != nil {
+		return false, pluginName, nil, err
+	}
+	return allowed, pluginName, filterCtx.Response, nil
 }
 
 // getClientIP 获取客户端IP
 func (s *Server) getClientIP(r *http.Request) string {
-	// 检查X-Forwarded-For头
-	xff := r.Header.Get("X-Forwarded-For")
-	if xff != "" {
-		ips := strings.Split(xff, ",")
-		return strings.TrimSpace(ips[0])
-	}
-
-	// 检查X-Real-IP头
-	xri := r.Header.Get("X-Real-IP")
-	if xri != "" {
-		return strings.TrimSpace(xri)
-	}
-
-	// 使用RemoteAddr
-	host, _, err := net.SplitHostPort(r.RemoteAddr)
-	if err != nil {
-		return r.RemoteAddr
-	}
-	return host
+	return s.accessController.ClientIP(r)
 }
@@ -0,0 +1,122 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"hackmitm/pkg/cert"
+	"hackmitm/pkg/config"
+	"hackmitm/pkg/security"
+)
+
+// securityGoroutines 统计运行在 security 包中的协程数（限流器与访问列表的清理协程）
+func securityGoroutines() int {
+	buf := make([]byte, 1<<20)
+	buf = buf[:runtime.Stack(buf, true)]
+	count := 0
+	for _, stack := range strings.Split(string(buf), "\n\n") {
+		if strings.Contains(stack, "hackmitm/pkg/security.") {
+			count++
+		}
+	}
+	return count
+}
+
+// testServerConfig 默认配置与使用临时目录的证书管理器
+func testServerConfig(t *testing.T) (*config.Config, *cert.CertManager) {
+	t.Helper()
+	dir := t.TempDir()
+	cfg, err := config.LoadConfig(filepath.Join(dir, "missing.json"))
+	if err != nil {
+		t.Fatalf("LoadConfig() error = %v", err)
+	}
+	certMgr, err := cert.NewCertManager(cert.CertOptions{CertDir: dir})
+	if err != nil {
+		t.Fatalf("NewCertManager() error = %v", err)
+	}
+	return cfg, certMgr
+}
+
+func TestServerStopEndsAccessControlGoroutines(t *testing.T) {
+	cfg, certMgr := testServerConfig(t)
+	cfg.Security.RateLimit.Enabled = true
+
+	before := securityGoroutines()
+	server, err := NewServer(cfg, certMgr)
+	if err != nil {
+		t.Fatalf("NewServer() error = %v", err)
+	}
+	if securityGoroutines() <= before {
+		t.Fatal("访问控制器未启动清理协程")
+	}
+
+	if err := server.Stop(); err != nil {
+		t.Fatalf("Stop() error = %v", err)
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for securityGoroutines() > before {
+		if time.Now().After(deadline) {
+			t.Fatalf("Stop() 后仍有 %d 个清理协程未退出", securityGoroutines()-before)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestSetUpstreamProxyChecksTargetHost(t *testing.T) {
+	cfg, certMgr := testServerConfig(t)
+	cfg.Security.DialGuard = config.DialGuardConfig{Enabled: true, BlockLoopback: true, BlockPrivate: true}
+	server, err := NewServer(cfg, certMgr)
+	if err != nil {
+		t.Fatalf("NewServer() error = %v", err)
+	}
+	defer server.Stop()
+
+	// 上游代理本身在回环地址上，连接它不受限制
+	upstream, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer upstream.Close()
+	if err := server.SetUpstreamProxy("http://" + upstream.Addr().String()); err != nil {
+		t.Fatalf("SetUpstreamProxy() error = %v", err)
+	}
+	transport := server.client.Transport.(*http.Transport)
+
+	tests := []struct {
+		name        string
+		url         string
+		wantBlocked bool
+	}{
+		{name: "回环目标", url: "http://127.0.0.1:8080/", wantBlocked: true},
+		{name: "私有地址目标", url: "https://10.0.0.1/", wantBlocked: true},
+		{name: "解析为回环地址的域名", url: "http://localhost/", wantBlocked: true},
+		{name: "公网目标交给上游代理", url: "http://93.184.216.34/"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", tt.url, nil)
+			proxyURL, err := transport.Proxy(req)
+			var blockedErr *security.DialBlockedError
+			if blocked := errors.As(err, &blockedErr); blocked != tt.wantBlocked {
+				t.Fatalf("Proxy(%s) error = %v, wantBlocked %v", tt.url, err, tt.wantBlocked)
+			}
+			if !tt.wantBlocked && (err != nil || proxyURL.Host != upstream.Addr().String()) {
+				t.Errorf("Proxy(%s) = %v, %v", tt.url, proxyURL, err)
+			}
+		})
+	}
+
+	conn, err := transport.DialContext(context.Background(), "tcp", upstream.Addr().String())
+	if err != nil {
+		t.Fatalf("连接回环地址上的上游代理失败: %v", err)
+	}
+	conn.Close()
+}
@@ -0,0 +1,502 @@
+// Package scope 提供测试范围控制，判断目标是否在授权测试范围内
+// Package scope decides whether a destination is within the authorized engagement scope
+package scope
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"hackmitm/pkg/config"
+	"hackmitm/pkg/logger"
+)
+
+// 范围外请求的处理方式
+const (
+	// ActionBlock 返回拦截页面
+	ActionBlock = "block"
+	// ActionPassthrough 透传，不解密、不记录、不经过插件
+	ActionPassthrough = "passthrough"
+)
+
+// Target 请求目标
+type Target struct {
+	Scheme string
+	Host   string
+	Port   int
+	Path   string
+}
+
+// String 返回目标的URL形式
+func (t Target) String() string {
+	host := t.Host
+	if strings.Contains(host, ":") {
+		host = "[" + host + "]"
+	}
+	return fmt.Sprintf("%s://%s:%d%s", t.Scheme, host, t.Port, t.Path)
+}
+
+// TargetFromRequest 从代理请求中提取目标，CONNECT 请求视为 https 且路径为空
+func TargetFromRequest(r *http.Request) Target {
+	t := Target{Scheme: strings.ToLower(r.URL.Scheme)}
+
+	hostport := r.URL.Host
+	if r.Method == http.MethodConnect || hostport == "" {
+		hostport = r.Host
+	}
+	if r.Method == http.MethodConnect {
+		t.Scheme = "https"
+	} else {
+		t.Path = r.URL.Path
+		if t.Path == "" {
+			t.Path = "/"
+		}
+	}
+	if t.Scheme == "" {
+		t.Scheme = "http"
+		if r.TLS != nil {
+			t.Scheme = "https"
+		}
+	}
+	if isWebSocketUpgrade(r) {
+		switch t.Scheme {
+		case "http":
+			t.Scheme = "ws"
+		case "https":
+			t.Scheme = "wss"
+		}
+	}
+
+	host, port, err := net.SplitHostPort(hostport)
+	if err != nil {
+		host = hostport
+	}
+	t.Host = strings.ToLower(strings.TrimSuffix(strings.Trim(host, "[]"), "."))
+	if t.Port, err = strconv.Atoi(port); err != nil || t.Port == 0 {
+		t.Port = defaultPort(t.Scheme)
+	}
+	return t
+}
+
+// isWebSocketUpgrade 检查是否为WebSocket升级请求
+func isWebSocketUpgrade(r *http.Request) bool {
+	return strings.EqualFold(r.Header.Get("Upgrade"), "websocket")
+}
+
+// defaultPort 返回协议默认端口
+func defaultPort(scheme string) int {
+	switch scheme {
+	case "https", "wss":
+		return 443
+	}
+	return 80
+}
+
+// Scope 测试范围
+// Scope holds compiled include/exclude rules; it is safe for concurrent use and can be reconfigured at runtime
+type Scope struct {
+	rules atomic.Pointer[ruleSet]
+	// config 当前范围配置，范围文件变化时用于重新编译
+	config config.ScopeConfig
+	// modTimes 范围文件的修改时间
+	modTimes map[string]time.Time
+	// mutex 保护 config 和 modTimes
+	mutex sync.Mutex
+}
+
+// ruleSet 一组已编译的范围规则
+type ruleSet struct {
+	enabled bool
+	action  string
+	include []*Rule
+	exclude []*Rule
+}
+
+// NewScope 根据配置创建测试范围
+func NewScope(scopeConfig config.ScopeConfig) (*Scope, error) {
+	s := &Scope{}
+	if err := s.Configure(scopeConfig); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Configure 编译并应用范围配置（包括重新读取范围文件），出错时保留原规则
+func (s *Scope) Configure(scopeConfig config.ScopeConfig) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.configureLocked(scopeConfig)
+}
+
+// configureLocked 编译并应用范围配置（调用方需持有锁）
+func (s *Scope) configureLocked(scopeConfig config.ScopeConfig) error {
+	set := &ruleSet{enabled: scopeConfig.Enabled, action: scopeConfig.OutOfScope}
+	if set.action == "" {
+		set.action = ActionBlock
+	}
+
+	for i, rc := range scopeConfig.Include {
+		rule, err := NewRule(rc)
+		if err != nil {
+			return fmt.Errorf("scope.include[%d]: %w", i, err)
+		}
+		set.include = append(set.include, rule)
+	}
+	for i, rc := range scopeConfig.Exclude {
+		rule, err := NewRule(rc)
+		if err != nil {
+			return fmt.Errorf("scope.exclude[%d]: %w", i, err)
+		}
+		set.exclude = append(set.exclude, rule)
+	}
+	modTimes := make(map[string]time.Time, len(scopeConfig.Files))
+	for _, path := range scopeConfig.Files {
+		if info, err := os.Stat(path); err == nil {
+			modTimes[path] = info.ModTime()
+		}
+		include, exclude, err := LoadFile(path)
+		if err != nil {
+			return err
+		}
+		set.include = append(set.include, include...)
+		set.exclude = append(set.exclude, exclude...)
+	}
+
+	s.config = scopeConfig
+	s.modTimes = modTimes
+	s.rules.Store(set)
+	if set.enabled {
+		logger.Infof("测试范围控制已启用: %d 条包含规则, %d 条排除规则, 范围外请求: %s",
+			len(set.include), len(set.exclude), set.action)
+	}
+	return nil
+}
+
+// Watch 定期检查范围文件，文件修改后重新加载规则，直到 ctx 结束
+func (s *Scope) Watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.reloadChangedFiles()
+		}
+	}
+}
+
+// reloadChangedFiles 范围文件修改时间变化时重新编译规则，失败时保留原规则
+func (s *Scope) reloadChangedFiles() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	changed := false
+	for _, path := range s.config.Files {
+		info, err := os.Stat(path)
+		if err != nil {
+			continue
+		}
+		if !info.ModTime().Equal(s.modTimes[path]) {
+			changed = true
+			break
+		}
+	}
+	if !changed {
+		return
+	}
+
+	if err := s.configureLocked(s.config); err != nil {
+		logger.Errorf("重新加载范围文件失败，继续使用原规则: %v", err)
+		return
+	}
+	logger.Info("范围文件已重新加载")
+}
+
+// Enabled 是否启用范围控制
+func (s *Scope) Enabled() bool {
+	return s.rules.Load().enabled
+}
+
+// Action 返回范围外请求的处理方式
+func (s *Scope) Action() string {
+	return s.rules.Load().action
+}
+
+// InScope 检查目标是否在范围内，未启用范围控制时始终返回 true
+func (s *Scope) InScope(t Target) bool {
+	set := s.rules.Load()
+	if !set.enabled {
+		return true
+	}
+	for _, rule := range set.exclude {
+		if rule.Match(t) {
+			return false
+		}
+	}
+	if len(set.include) == 0 {
+		return true
+	}
+	for _, rule := range set.include {
+		if rule.Match(t) {
+			return true
+		}
+	}
+	return false
+}
+
+// HostInScope 在路径未知时（如 CONNECT）检查目标主机是否可能在范围内
+// 忽略包含规则的路径条件，只有不限制路径的排除规则才会排除整个主机
+func (s *Scope) HostInScope(t Target) bool {
+	set := s.rules.Load()
+	if !set.enabled {
+		return true
+	}
+	for _, rule := range set.exclude {
+		if rule.path == nil && rule.matchHost(t) {
+			return false
+		}
+	}
+	if len(set.include) == 0 {
+		return true
+	}
+	for _, rule := range set.include {
+		if rule.matchHost(t) {
+			return true
+		}
+	}
+	return false
+}
+
+// Rule 已编译的范围规则
+type Rule struct {
+	// source 规则原文，用于日志
+	source  string
+	host    *regexp.Regexp
+	prefix  netip.Prefix
+	ports   [][2]int
+	schemes []string
+	path    *regexp.Regexp
+}
+
+// NewRule 编译范围规则
+func NewRule(rc config.ScopeRule) (*Rule, error) {
+	rule := &Rule{source: fmt.Sprintf("%+v", rc)}
+
+	if host := strings.ToLower(strings.TrimSpace(rc.Host)); host != "" {
+		if prefix, err := netip.ParsePrefix(host); err == nil {
+			rule.prefix = prefix.Masked()
+		} else if addr, err := netip.ParseAddr(strings.Trim(host, "[]")); err == nil {
+			rule.prefix = netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen())
+		} else {
+			re, err := compilePattern(host)
+			if err != nil {
+				return nil, fmt.Errorf("无效的主机规则 %q: %w", rc.Host, err)
+			}
+			rule.host = re
+		}
+	}
+
+	if port := strings.ReplaceAll(rc.Port, " ", ""); port != "" {
+		for _, part := range strings.Split(port, ",") {
+			low, high, isRange := strings.Cut(part, "-")
+			if !isRange {
+				high = low
+			}
+			lo, err1 := strconv.Atoi(low)
+			hi, err2 := strconv.Atoi(high)
+			if err1 != nil || err2 != nil || lo > hi {
+				return nil, fmt.Errorf("无效的端口规则: %q", rc.Port)
+			}
+			rule.ports = append(rule.ports, [2]int{lo, hi})
+		}
+	}
+
+	for _, scheme := range strings.Split(rc.Scheme, ",") {
+		if scheme = strings.ToLower(strings.TrimSpace(scheme)); scheme != "" {
+			rule.schemes = append(rule.schemes, scheme)
+		}
+	}
+
+	if rc.Path != "" {
+		re, err := compilePattern(rc.Path)
+		if err != nil {
+			return nil, fmt.Errorf("无效的路径规则 %q: %w", rc.Path, err)
+		}
+		rule.path = re
+	}
+	return rule, nil
+}
+
+// compilePattern 编译 re: 开头的正则或通配符（* 匹配任意字符，? 匹配单个字符）
+func compilePattern(pattern string) (*regexp.Regexp, error) {
+	if expr, ok := strings.CutPrefix(pattern, "re:"); ok {
+		return regexp.Compile(expr)
+	}
+
+	var b strings.Builder
+	b.WriteString("^")
+	for _, r := range pattern {
+		switch r {
+		case '*':
+			b.WriteString(".*")
+		case '?':
+			b.WriteString(".")
+		default:
+			b.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	b.WriteString("$")
+	return regexp.Compile(b.String())
+}
+
+// String 返回规则原文
+func (r *Rule) String() string {
+	return r.source
+}
+
+// Match 检查目标是否匹配规则的所有条件
+func (r *Rule) Match(t Target) bool {
+	if !r.matchHost(t) {
+		return false
+	}
+	return r.path == nil || r.path.MatchString(t.Path)
+}
+
+// matchHost 检查主机、端口和协议条件
+func (r *Rule) matchHost(t Target) bool {
+	if r.prefix.IsValid() {
+		addr, err := netip.ParseAddr(t.Host)
+		if err != nil || !r.prefix.Contains(addr.Unmap()) {
+			return false
+		}
+	} else if r.host != nil && !r.host.MatchString(t.Host) {
+		return false
+	}
+
+	if len(r.ports) > 0 {
+		matched := false
+		for _, p := range r.ports {
+			if t.Port >= p[0] && t.Port <= p[1] {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+
+	if len(r.schemes) > 0 {
+		matched := false
+		for _, scheme := range r.schemes {
+			if scheme == t.Scheme {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	return true
+}
+
+// LoadFile 读取范围文件，返回包含和排除规则
+//
+// 每行一条规则，# 之后为注释，以 - 或 ! 开头表示排除（+ 开头或无前缀表示包含）：
+//
+//	*.example.com
+//	https://app.example.com:8443/api/*
+//	10.0.0.0/8
+//	re:^api[0-9]+\.example\.com$
+//	- admin.example.com
+func LoadFile(path string) ([]*Rule, []*Rule, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("打开范围文件失败: %w", err)
+	}
+	defer file.Close()
+
+	var include, exclude []*Rule
+	scanner := bufio.NewScanner(file)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := scanner.Text()
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+
+		excluded := false
+		switch line[0] {
+		case '-', '!':
+			excluded = true
+			line = strings.TrimSpace(line[1:])
+		case '+':
+			line = strings.TrimSpace(line[1:])
+		}
+
+		rule, err := NewRule(ParseRuleLine(line))
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s:%d: %w", path, lineNo, err)
+		}
+		rule.source = fmt.Sprintf("%s:%d %s", path, lineNo, line)
+		if excluded {
+			exclude = append(exclude, rule)
+		} else {
+			include = append(include, rule)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, nil, fmt.Errorf("读取范围文件失败: %w", err)
+	}
+	return include, exclude, nil
+}
+
+// ParseRuleLine 解析单行范围规则：[scheme://]host[:port][/path]、CIDR 或 re: 开头的主机正则
+func ParseRuleLine(line string) config.ScopeRule {
+	if strings.HasPrefix(line, "re:") {
+		return config.ScopeRule{Host: line}
+	}
+	if _, err := netip.ParsePrefix(line); err == nil {
+		return config.ScopeRule{Host: line}
+	}
+
+	var rule config.ScopeRule
+	if scheme, rest, ok := strings.Cut(line, "://"); ok {
+		rule.Scheme = scheme
+		line = rest
+	}
+	if i := strings.Index(line, "/"); i >= 0 {
+		rule.Path = line[i:]
+		line = line[:i]
+	}
+
+	// [IPv6]:port 或 host:port
+	if strings.HasPrefix(line, "[") {
+		if end := strings.Index(line, "]"); end > 0 {
+			rule.Host = line[1:end]
+			rule.Port = strings.TrimPrefix(line[end+1:], ":")
+			return rule
+		}
+	}
+	if host, port, ok := strings.Cut(line, ":"); ok && !strings.Contains(port, ":") {
+		rule.Host, rule.Port = host, port
+	} else {
+		rule.Host = line
+	}
+	return rule
+}
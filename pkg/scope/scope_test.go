@@ -0,0 +1,161 @@
+package scope
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"hackmitm/pkg/config"
+)
+
+func TestParseRuleLine(t *testing.T) {
+	tests := []struct {
+		line string
+		want config.ScopeRule
+	}{
+		{line: "*.example.com", want: config.ScopeRule{Host: "*.example.com"}},
+		{line: "https://app.example.com:8443/api/*", want: config.ScopeRule{Scheme: "https", Host: "app.example.com", Port: "8443", Path: "/api/*"}},
+		{line: "10.0.0.0/8", want: config.ScopeRule{Host: "10.0.0.0/8"}},
+		{line: "2001:db8::/32", want: config.ScopeRule{Host: "2001:db8::/32"}},
+		{line: "[2001:db8::1]:443", want: config.ScopeRule{Host: "2001:db8::1", Port: "443"}},
+		{line: "2001:db8::1", want: config.ScopeRule{Host: "2001:db8::1"}},
+		{line: `re:^api[0-9]+\.example\.com$`, want: config.ScopeRule{Host: `re:^api[0-9]+\.example\.com$`}},
+		{line: "example.com:8000-9000", want: config.ScopeRule{Host: "example.com", Port: "8000-9000"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.line, func(t *testing.T) {
+			if got := ParseRuleLine(tt.line); got != tt.want {
+				t.Errorf("ParseRuleLine(%q) = %+v, want %+v", tt.line, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRuleMatch(t *testing.T) {
+	tests := []struct {
+		name   string
+		rule   string
+		target Target
+		want   bool
+	}{
+		{name: "通配符子域名", rule: "*.example.com", target: Target{Scheme: "https", Host: "app.example.com", Port: 443, Path: "/"}, want: true},
+		{name: "通配符不匹配根域名", rule: "*.example.com", target: Target{Scheme: "https", Host: "example.com", Port: 443, Path: "/"}},
+		{name: "通配符不匹配相似后缀", rule: "*.example.com", target: Target{Scheme: "https", Host: "app.example.com.evil.test", Port: 443, Path: "/"}},
+		{name: "问号匹配单个字符", rule: "api?.example.com", target: Target{Scheme: "http", Host: "api1.example.com", Port: 80, Path: "/"}, want: true},
+		{name: "IPv4 CIDR内", rule: "10.0.0.0/8", target: Target{Scheme: "http", Host: "10.20.30.40", Port: 80, Path: "/"}, want: true},
+		{name: "IPv4 CIDR外", rule: "10.0.0.0/8", target: Target{Scheme: "http", Host: "11.0.0.1", Port: 80, Path: "/"}},
+		{name: "CIDR不匹配域名", rule: "10.0.0.0/8", target: Target{Scheme: "http", Host: "10.example.com", Port: 80, Path: "/"}},
+		{name: "IPv4映射地址", rule: "10.0.0.0/8", target: Target{Scheme: "http", Host: "::ffff:10.0.0.1", Port: 80, Path: "/"}, want: true},
+		{name: "IPv6 CIDR内", rule: "2001:db8::/32", target: Target{Scheme: "https", Host: "2001:db8::42", Port: 443, Path: "/"}, want: true},
+		{name: "单个IP", rule: "192.0.2.7", target: Target{Scheme: "http", Host: "192.0.2.7", Port: 80, Path: "/"}, want: true},
+		{name: "端口范围内", rule: "example.com:8000-9000", target: Target{Scheme: "http", Host: "example.com", Port: 8080, Path: "/"}, want: true},
+		{name: "端口范围外", rule: "example.com:8000-9000", target: Target{Scheme: "http", Host: "example.com", Port: 80, Path: "/"}},
+		{name: "协议不符", rule: "https://example.com", target: Target{Scheme: "http", Host: "example.com", Port: 80, Path: "/"}},
+		{name: "路径通配符", rule: "https://app.example.com:8443/api/*", target: Target{Scheme: "https", Host: "app.example.com", Port: 8443, Path: "/api/users"}, want: true},
+		{name: "路径不符", rule: "https://app.example.com:8443/api/*", target: Target{Scheme: "https", Host: "app.example.com", Port: 8443, Path: "/admin"}},
+		{name: "主机正则", rule: `re:^api[0-9]+\.example\.com$`, target: Target{Scheme: "https", Host: "api42.example.com", Port: 443, Path: "/"}, want: true},
+		{name: "主机正则不匹配", rule: `re:^api[0-9]+\.example\.com$`, target: Target{Scheme: "https", Host: "apix.example.com", Port: 443, Path: "/"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rule, err := NewRule(ParseRuleLine(tt.rule))
+			if err != nil {
+				t.Fatalf("NewRule(%q) error = %v", tt.rule, err)
+			}
+			if got := rule.Match(tt.target); got != tt.want {
+				t.Errorf("Match(%s) = %v, want %v", tt.target, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewRuleInvalid(t *testing.T) {
+	tests := []config.ScopeRule{
+		{Host: "example.com", Port: "abc"},
+		{Host: "example.com", Port: "9000-8000"},
+		{Host: "re:("},
+		{Host: "example.com", Path: "re:["},
+	}
+	for _, rc := range tests {
+		if _, err := NewRule(rc); err == nil {
+			t.Errorf("NewRule(%+v) 未返回错误", rc)
+		}
+	}
+}
+
+func TestScopeInScope(t *testing.T) {
+	s, err := NewScope(config.ScopeConfig{
+		Enabled:    true,
+		OutOfScope: ActionBlock,
+		Include: []config.ScopeRule{
+			{Host: "*.example.com"},
+			{Host: "10.0.0.0/8"},
+		},
+		Exclude: []config.ScopeRule{
+			{Host: "admin.example.com"},
+			{Host: "app.example.com", Path: "/logout*"},
+			{Host: "10.0.0.1"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("NewScope() error = %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		target Target
+		want   bool
+		// wantHost 路径未知时（CONNECT）的结果
+		wantHost bool
+	}{
+		{name: "包含规则", target: Target{Scheme: "https", Host: "app.example.com", Port: 443, Path: "/"}, want: true, wantHost: true},
+		{name: "排除优先于包含", target: Target{Scheme: "https", Host: "admin.example.com", Port: 443, Path: "/"}},
+		{name: "带路径的排除规则只排除该路径", target: Target{Scheme: "https", Host: "app.example.com", Port: 443, Path: "/logout"}, wantHost: true},
+		{name: "CIDR包含", target: Target{Scheme: "http", Host: "10.9.9.9", Port: 80, Path: "/"}, want: true, wantHost: true},
+		{name: "CIDR内被排除的地址", target: Target{Scheme: "http", Host: "10.0.0.1", Port: 80, Path: "/"}},
+		{name: "未包含的主机", target: Target{Scheme: "https", Host: "other.test", Port: 443, Path: "/"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := s.InScope(tt.target); got != tt.want {
+				t.Errorf("InScope(%s) = %v, want %v", tt.target, got, tt.want)
+			}
+			if got := s.HostInScope(tt.target); got != tt.wantHost {
+				t.Errorf("HostInScope(%s) = %v, want %v", tt.target, got, tt.wantHost)
+			}
+		})
+	}
+}
+
+func TestTargetFromRequest(t *testing.T) {
+	tests := []struct {
+		name    string
+		method  string
+		url     string
+		upgrade bool
+		want    Target
+	}{
+		{name: "HTTP默认端口", method: "GET", url: "http://Example.COM/a", want: Target{Scheme: "http", Host: "example.com", Port: 80, Path: "/a"}},
+		{name: "显式端口", method: "GET", url: "http://example.com:8080/", want: Target{Scheme: "http", Host: "example.com", Port: 8080, Path: "/"}},
+		{name: "CONNECT视为https且无路径", method: "CONNECT", url: "example.com:443", want: Target{Scheme: "https", Host: "example.com", Port: 443}},
+		{name: "IPv6", method: "GET", url: "http://[2001:db8::1]:8080/", want: Target{Scheme: "http", Host: "2001:db8::1", Port: 8080, Path: "/"}},
+		{name: "WebSocket升级", method: "GET", url: "http://example.com/ws", upgrade: true, want: Target{Scheme: "ws", Host: "example.com", Port: 80, Path: "/ws"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, tt.url, nil)
+			if tt.method == "CONNECT" {
+				r.Host = tt.url
+			}
+			if tt.upgrade {
+				r.Header.Set("Upgrade", "websocket")
+			}
+			if got := TargetFromRequest(r); got != tt.want {
+				t.Errorf("TargetFromRequest() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -3,13 +3,12 @@
 package security
 
 import (
-	"crypto/sha256"
-	"crypto/subtle"
+	"errors"
 	"fmt"
-	"net"
 	"net/http"
-	"strings"
+	"os"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"hackmitm/pkg/config"
@@ -19,290 +18,437 @@ import (
 // AccessController 访问控制器
 type AccessController struct {
 	// whitelist IP白名单
-	whitelist map[string]bool
+	whitelist *IPList
 	// blacklist IP黑名单
-	blacklist map[string]bool
-	// auth 认证配置
-	auth *AuthConfig
+	blacklist *IPList
+	// listFiles 外部列表文件及其修改时间
+	listFiles map[string]*listFile
+	// janitor 定期重新加载列表文件并清理过期条目
+	janitor *time.Ticker
+	// janitorDone 关闭后清理协程退出
+	janitorDone chan struct{}
+	// stopOnce 保证 Stop 只执行一次
+	stopOnce sync.Once
+	// resolver 客户端IP解析器
+	resolver *ClientIPResolver
+	// auth 代理认证器，未启用认证时为nil
+	auth *Authenticator
+	// certMapper 客户端证书用户映射
+	certMapper *ClientCertMapper
+	// certAuths 通过客户端证书认证的请求数
+	certAuths int64
 	// rateLimiter 限流器
 	rateLimiter *RateLimiter
+	// banner 自动封禁器
+	banner *Banner
 	// mutex 保护并发访问
 	mutex sync.RWMutex
 }
 
-// AuthConfig 认证配置
-type AuthConfig struct {
-	// Username 用户名
-	Username string
-	// PasswordHash 密码哈希
-	PasswordHash []byte
-	// Enabled 是否启用认证
-	Enabled bool
-}
+// 访问被拒绝的原因，Authorize/CheckRequest 返回的错误包装这些错误
+var (
+	// ErrBanned 客户端IP已被封禁
+	ErrBanned = errors.New("IP已被临时封禁")
+	// ErrBlacklisted 客户端IP在黑名单中
+	ErrBlacklisted = errors.New("IP在黑名单中")
+	// ErrNotWhitelisted 启用白名单时客户端IP不在白名单中
+	ErrNotWhitelisted = errors.New("IP不在白名单中")
+)
 
-// RateLimiter 限流器
-type RateLimiter struct {
-	// clients 客户端访问记录
-	clients map[string]*ClientRecord
-	// maxRequests 最大请求数
-	maxRequests int
-	// window 时间窗口
-	window time.Duration
-	// enabled 是否启用限流
-	enabled bool
-	// mutex 保护并发访问
-	mutex sync.RWMutex
-	// cleanup 清理定时器
-	cleanup *time.Ticker
+// DenyRule 返回访问控制错误对应的规则名称，用于审计
+func DenyRule(err error) string {
+	var rateErr *RateLimitError
+	switch {
+	case errors.Is(err, ErrBanned):
+		return "ban"
+	case errors.Is(err, ErrBlacklisted):
+		return ListBlacklist
+	case errors.Is(err, ErrNotWhitelisted):
+		return ListWhitelist
+	case errors.Is(err, ErrProxyAuthRequired):
+		return "auth"
+	case errors.As(err, &rateErr):
+		return "rate_limit:" + rateErr.Rule
+	}
+	return "access_control"
 }
 
-// ClientRecord 客户端记录
-type ClientRecord struct {
-	// requests 请求列表
-	requests []time.Time
-	// lastAccess 最后访问时间
-	lastAccess time.Time
+// 访问列表名称
+const (
+	ListWhitelist = "whitelist"
+	ListBlacklist = "blacklist"
+)
+
+// listJanitorInterval 列表文件检查、过期条目和过期封禁清理间隔
+const listJanitorInterval = 5 * time.Second
+
+// listFile 外部列表文件
+type listFile struct {
+	list    *IPList
+	modTime time.Time
 }
 
 // NewAccessController 创建访问控制器
 func NewAccessController(securityConfig config.SecurityConfig) *AccessController {
 	ac := &AccessController{
-		whitelist: make(map[string]bool),
-		blacklist: make(map[string]bool),
-		rateLimiter: &RateLimiter{
-			clients:     make(map[string]*ClientRecord),
-			maxRequests: securityConfig.RateLimit.MaxRequests,
-			window:      securityConfig.RateLimit.Window,
-			enabled:     securityConfig.RateLimit.Enabled,
-		},
-	}
-
-	// 设置白名单
-	for _, ip := range securityConfig.Whitelist {
-		ac.whitelist[ip] = true
+		whitelist:   NewIPList("IP白名单"),
+		blacklist:   NewIPList("IP黑名单"),
+		listFiles:   make(map[string]*listFile),
+		resolver:    NewClientIPResolver(securityConfig.TrustedProxies),
+		certMapper:  NewClientCertMapper(securityConfig.ClientCert),
+		rateLimiter: NewRateLimiter(securityConfig.RateLimit),
+		banner:      NewBanner(securityConfig.AutoBan),
 	}
 
-	// 设置黑名单
-	for _, ip := range securityConfig.Blacklist {
-		ac.blacklist[ip] = true
-	}
+	// 设置白名单和黑名单
+	ac.applyLists(securityConfig)
+	ac.startJanitor()
 
 	// 设置认证
 	if securityConfig.EnableAuth {
-		ac.SetAuth(securityConfig.Username, securityConfig.Password)
+		auth, err := NewAuthenticator(securityConfig)
+		if err != nil {
+			// 认证配置错误时拒绝所有请求，而不是静默放行
+			logger.Errorf("初始化代理认证失败，所有请求将被拒绝: %v", err)
+			auth = newAuthenticator(securityConfig.AuthRealm)
+		}
+		ac.auth = auth
 	}
 
-	// 启动限流器清理（只有在启用限流时才启动）
-	if ac.rateLimiter.enabled {
-		ac.rateLimiter.startCleanup()
-		logger.Infof("限流器已启用: %d请求/%s", ac.rateLimiter.maxRequests, ac.rateLimiter.window)
-	} else {
+	if !ac.rateLimiter.Enabled() {
 		logger.Info("限流器已禁用")
 	}
 
 	return ac
 }
 
-// SetAuth 设置认证
-func (ac *AccessController) SetAuth(username, password string) {
-	ac.mutex.Lock()
-	defer ac.mutex.Unlock()
-
-	hash := sha256.Sum256([]byte(password))
-	ac.auth = &AuthConfig{
-		Username:     username,
-		PasswordHash: hash[:],
-		Enabled:      true,
+// SetAuth 设置单用户认证，password 可以是明文或密码哈希
+func (ac *AccessController) SetAuth(username, password string) error {
+	auth, err := NewAuthenticator(config.SecurityConfig{Username: username, Password: password})
+	if err != nil {
+		return err
 	}
 
+	ac.mutex.Lock()
+	ac.auth = auth
+	ac.mutex.Unlock()
+
 	logger.Info("访问认证已启用")
+	return nil
 }
 
-// AddToWhitelist 添加到白名单
+// AddToWhitelist 添加到白名单（永久）
 func (ac *AccessController) AddToWhitelist(ip string) {
-	ac.mutex.Lock()
-	defer ac.mutex.Unlock()
-
-	ac.whitelist[ip] = true
-	logger.Infof("IP已添加到白名单: %s", ip)
+	if _, err := ac.AddListEntry(ListWhitelist, ip, 0, ""); err != nil {
+		logger.Errorf("添加白名单失败: %v", err)
+	}
 }
 
-// AddToBlacklist 添加到黑名单
+// AddToBlacklist 添加到黑名单（永久）
 func (ac *AccessController) AddToBlacklist(ip string) {
-	ac.mutex.Lock()
-	defer ac.mutex.Unlock()
+	if _, err := ac.AddListEntry(ListBlacklist, ip, 0, ""); err != nil {
+		logger.Errorf("添加黑名单失败: %v", err)
+	}
+}
 
-	ac.blacklist[ip] = true
-	logger.Infof("IP已添加到黑名单: %s", ip)
+// list 按名称获取访问列表
+func (ac *AccessController) list(name string) (*IPList, error) {
+	switch name {
+	case ListWhitelist:
+		return ac.whitelist, nil
+	case ListBlacklist:
+		return ac.blacklist, nil
+	}
+	return nil, fmt.Errorf("未知的访问列表: %s", name)
 }
 
-// IsAllowed 检查是否允许访问
-func (ac *AccessController) IsAllowed(r *http.Request) error {
-	clientIP := ac.getClientIP(r)
+// AddListEntry 运行时添加访问列表条目，ttl 为0表示永久
+func (ac *AccessController) AddListEntry(name, value string, ttl time.Duration, comment string) (*IPListEntry, error) {
+	list, err := ac.list(name)
+	if err != nil {
+		return nil, err
+	}
+	entry, err := list.Add(value, ttl, comment)
+	if err != nil {
+		return nil, err
+	}
 
-	// 检查黑名单
-	ac.mutex.RLock()
-	if ac.blacklist[clientIP] {
-		ac.mutex.RUnlock()
-		return fmt.Errorf("IP在黑名单中: %s", clientIP)
+	if ttl > 0 {
+		logger.Infof("%s 添加条目: %s (有效期 %s)", list.name, entry.Value, ttl)
+	} else {
+		logger.Infof("%s 添加条目: %s", list.name, entry.Value)
 	}
+	return entry, nil
+}
 
-	// 检查白名单（如果有白名单则只允许白名单IP）
-	if len(ac.whitelist) > 0 && !ac.whitelist[clientIP] {
-		ac.mutex.RUnlock()
-		return fmt.Errorf("IP不在白名单中: %s", clientIP)
+// RemoveListEntry 删除运行时添加的访问列表条目
+func (ac *AccessController) RemoveListEntry(name, value string) error {
+	list, err := ac.list(name)
+	if err != nil {
+		return err
 	}
-	ac.mutex.RUnlock()
+	if err := list.Remove(value); err != nil {
+		return err
+	}
+	logger.Infof("%s 删除条目: %s", list.name, value)
+	return nil
+}
 
-	// 检查认证
-	if err := ac.checkAuth(r); err != nil {
-		return fmt.Errorf("认证失败: %w", err)
+// ListEntries 获取访问列表的全部有效条目
+func (ac *AccessController) ListEntries(name string) ([]IPListEntry, error) {
+	list, err := ac.list(name)
+	if err != nil {
+		return nil, err
 	}
+	return list.Entries(), nil
+}
 
-	// 检查限流
-	if err := ac.rateLimiter.checkRate(clientIP); err != nil {
-		return fmt.Errorf("限流触发: %w", err)
+// applyLists 应用配置中的列表和列表文件
+func (ac *AccessController) applyLists(securityConfig config.SecurityConfig) {
+	ac.whitelist.SetSource(SourceConfig, securityConfig.Whitelist)
+	ac.blacklist.SetSource(SourceConfig, securityConfig.Blacklist)
+
+	ac.mutex.Lock()
+	defer ac.mutex.Unlock()
+
+	// 移除不再配置的文件来源
+	configured := make(map[string]*IPList)
+	for _, path := range securityConfig.WhitelistFiles {
+		configured[path] = ac.whitelist
+	}
+	for _, path := range securityConfig.BlacklistFiles {
+		configured[path] = ac.blacklist
+	}
+	for path, file := range ac.listFiles {
+		if configured[path] != file.list {
+			file.list.SetSource(sourceFilePrefix+path, nil)
+			delete(ac.listFiles, path)
+		}
+	}
+	for path, list := range configured {
+		if _, exists := ac.listFiles[path]; !exists {
+			ac.listFiles[path] = &listFile{list: list}
+		}
 	}
 
-	return nil
+	ac.reloadListFilesLocked()
+}
+
+// reloadListFilesLocked 重新加载已修改的列表文件（调用方需持有锁）
+func (ac *AccessController) reloadListFilesLocked() {
+	for path, file := range ac.listFiles {
+		stat, err := os.Stat(path)
+		if err != nil {
+			if !file.modTime.IsZero() {
+				logger.Errorf("读取访问列表文件失败: %v", err)
+				file.modTime = time.Time{}
+			}
+			continue
+		}
+		if stat.ModTime().Equal(file.modTime) {
+			continue
+		}
+
+		values, err := readIPListFile(path)
+		if err != nil {
+			logger.Errorf("读取访问列表文件失败: %v", err)
+			continue
+		}
+		count := file.list.SetSource(sourceFilePrefix+path, values)
+		if !file.modTime.IsZero() {
+			logger.Infof("%s 文件已重新加载: %s (%d 个条目)", file.list.name, path, count)
+		}
+		file.modTime = stat.ModTime()
+	}
+}
+
+// startJanitor 启动列表文件检查和过期条目清理
+func (ac *AccessController) startJanitor() {
+	ac.janitor = time.NewTicker(listJanitorInterval)
+	ac.janitorDone = make(chan struct{})
+	ticker, done := ac.janitor, ac.janitorDone
+	go func() {
+		for {
+			select {
+			case <-ticker.C:
+				ac.mutex.Lock()
+				ac.reloadListFilesLocked()
+				ac.mutex.Unlock()
+
+				ac.whitelist.Prune()
+				ac.blacklist.Prune()
+				ac.banner.Prune()
+			case <-done:
+				return
+			}
+		}
+	}()
 }
 
-// getClientIP 获取客户端IP
-func (ac *AccessController) getClientIP(r *http.Request) string {
-	// 检查X-Forwarded-For头
-	xff := r.Header.Get("X-Forwarded-For")
-	if xff != "" {
-		ips := strings.Split(xff, ",")
-		return strings.TrimSpace(ips[0])
+// IsAllowed 检查是否允许访问
+func (ac *AccessController) IsAllowed(r *http.Request) error {
+	_, err := ac.Authorize(r)
+	return err
+}
+
+// Authorize 检查是否允许访问，返回认证用户名（未启用认证时为空）
+// 认证失败的错误包装 ErrProxyAuthRequired，调用方应返回 407
+func (ac *AccessController) Authorize(r *http.Request) (string, error) {
+	clientIP := ac.ClientIP(r)
+
+	// 检查自动封禁
+	if ban, banned := ac.banner.Banned(clientIP); banned {
+		return "", fmt.Errorf("%w至 %s: %s (%s)", ErrBanned, ban.ExpiresAt.Format(time.RFC3339), clientIP, ban.Reason)
 	}
 
-	// 检查X-Real-IP头
-	xri := r.Header.Get("X-Real-IP")
-	if xri != "" {
-		return strings.TrimSpace(xri)
+	// 检查黑名单
+	if entry := ac.blacklist.Match(clientIP); entry != nil {
+		return "", fmt.Errorf("%w: %s (%s)", ErrBlacklisted, clientIP, entry.Value)
 	}
 
-	// 使用RemoteAddr
-	host, _, err := net.SplitHostPort(r.RemoteAddr)
-	if err != nil {
-		return r.RemoteAddr
+	// 检查白名单（如果有白名单则只允许白名单IP）
+	if ac.whitelist.Len() > 0 && !ac.whitelist.Contains(clientIP) {
+		return "", fmt.Errorf("%w: %s", ErrNotWhitelisted, clientIP)
 	}
-	return host
-}
 
-// checkAuth 检查认证
-func (ac *AccessController) checkAuth(r *http.Request) error {
 	ac.mutex.RLock()
 	auth := ac.auth
+	certMapper := ac.certMapper
 	ac.mutex.RUnlock()
 
-	if auth == nil || !auth.Enabled {
-		return nil
+	// 检查认证：监听端口已验证的客户端证书优先，其次是 Basic 认证
+	var username string
+	cert := verifiedClientCert(r)
+	if cert != nil {
+		username = certMapper.Username(cert)
+	}
+	if username != "" {
+		atomic.AddInt64(&ac.certAuths, 1)
+		logger.Debugf("客户端证书认证: %s -> %s (%s)", cert.Subject, username, clientIP)
+	} else if auth != nil {
+		var err error
+		if username, err = auth.Authenticate(r, clientIP); err != nil {
+			// 未携带凭据的首次请求只是质询，不计为违规
+			if r.Header.Get("Proxy-Authorization") != "" {
+				ac.banner.Record(clientIP, OffenseAuthFailure)
+			}
+			return "", fmt.Errorf("认证失败: %w", err)
+		}
 	}
 
-	// 检查Proxy-Authorization头
-	proxyAuth := r.Header.Get("Proxy-Authorization")
-	if proxyAuth == "" {
-		return fmt.Errorf("缺少代理认证")
+	// 检查限流。CONNECT 请求不扣令牌：解密的隧道按其中的每个请求计费（CheckRequest），
+	// 透传的隧道在建立时计费一次，避免同一客户端的隧道和隧道内的请求被重复计费
+	if r.Method == http.MethodConnect {
+		return username, nil
 	}
-
-	// 解析Basic认证
-	if !strings.HasPrefix(proxyAuth, "Basic ") {
-		return fmt.Errorf("不支持的认证类型")
+	if err := ac.rateLimiter.Allow(r, clientIP, username); err != nil {
+		ac.banner.Record(clientIP, OffenseRateLimit)
+		return username, fmt.Errorf("限流触发: %w", err)
 	}
 
-	// 这里简化处理，实际应该解码Base64
-	// 为演示目的，假设格式为 "Basic username:password"
-	credentials := strings.TrimPrefix(proxyAuth, "Basic ")
-	parts := strings.Split(credentials, ":")
-	if len(parts) != 2 {
-		return fmt.Errorf("认证格式错误")
-	}
+	return username, nil
+}
 
-	username, password := parts[0], parts[1]
-	if username != auth.Username {
-		return fmt.Errorf("用户名错误")
+// CheckRequest 对已通过访问控制的连接内的后续请求（如 CONNECT 隧道内的请求）检查封禁和限流，
+// 透传的 CONNECT 隧道建立时也以 CONNECT 请求调用一次
+// 客户端IP和用户名取自请求上下文，超出限制时返回包装 *RateLimitError 的错误
+func (ac *AccessController) CheckRequest(r *http.Request) error {
+	clientIP := ac.ClientIP(r)
+	if ban, banned := ac.banner.Banned(clientIP); banned {
+		return fmt.Errorf("%w至 %s: %s (%s)", ErrBanned, ban.ExpiresAt.Format(time.RFC3339), clientIP, ban.Reason)
 	}
-
-	// 验证密码
-	hash := sha256.Sum256([]byte(password))
-	if subtle.ConstantTimeCompare(hash[:], auth.PasswordHash) != 1 {
-		return fmt.Errorf("密码错误")
+	if err := ac.rateLimiter.Allow(r, clientIP, UsernameFromContext(r.Context())); err != nil {
+		ac.banner.Record(clientIP, OffenseRateLimit)
+		return fmt.Errorf("限流触发: %w", err)
 	}
-
 	return nil
 }
 
-// startCleanup 启动清理任务
-func (rl *RateLimiter) startCleanup() {
-	rl.cleanup = time.NewTicker(5 * time.Minute)
-	go func() {
-		for range rl.cleanup.C {
-			rl.cleanupOldRecords()
-		}
-	}()
+// ReportOffense 记录客户端违规（如被插件过滤器拒绝），达到阈值时自动封禁
+func (ac *AccessController) ReportOffense(clientIP, offense string) {
+	ac.banner.Record(clientIP, offense)
 }
 
-// checkRate 检查限流
-func (rl *RateLimiter) checkRate(clientIP string) error {
-	// 如果限流未启用，直接返回
-	if !rl.enabled {
-		return nil
-	}
+// Bans 返回生效中的封禁
+func (ac *AccessController) Bans() []Ban {
+	return ac.banner.Bans()
+}
 
-	rl.mutex.Lock()
-	defer rl.mutex.Unlock()
+// BanIP 手动封禁IP，duration 为0时按递增规则计算时长
+func (ac *AccessController) BanIP(ip string, duration time.Duration) (*Ban, error) {
+	return ac.banner.Ban(ip, duration)
+}
 
-	now := time.Now()
-	record, exists := rl.clients[clientIP]
-	if !exists {
-		record = &ClientRecord{
-			requests:   make([]time.Time, 0),
-			lastAccess: now,
-		}
-		rl.clients[clientIP] = record
+// UnbanIP 解除封禁
+func (ac *AccessController) UnbanIP(ip string) error {
+	return ac.banner.Unban(ip)
+}
+
+// AuthenticateAPI 使用代理账号校验监控API请求的 Authorization: Basic 头，返回用户名
+// 认证失败同样计入自动封禁的违规次数
+func (ac *AccessController) AuthenticateAPI(r *http.Request) (string, error) {
+	clientIP := ac.ClientIP(r)
+	if ban, banned := ac.banner.Banned(clientIP); banned {
+		return "", fmt.Errorf("%w至 %s: %s (%s)", ErrBanned, ban.ExpiresAt.Format(time.RFC3339), clientIP, ban.Reason)
 	}
 
-	// 清理过期请求
-	cutoff := now.Add(-rl.window)
-	validRequests := make([]time.Time, 0)
-	for _, reqTime := range record.requests {
-		if reqTime.After(cutoff) {
-			validRequests = append(validRequests, reqTime)
-		}
+	ac.mutex.RLock()
+	auth := ac.auth
+	ac.mutex.RUnlock()
+	if auth == nil {
+		return "", fmt.Errorf("%w: 未启用代理认证", ErrProxyAuthRequired)
 	}
-	record.requests = validRequests
 
-	// 检查是否超过限制
-	if len(record.requests) >= rl.maxRequests {
-		return fmt.Errorf("请求频率过高，限制: %d/%s", rl.maxRequests, rl.window)
+	username, err := auth.AuthenticateHeader(r.Header.Get("Authorization"), clientIP)
+	if err != nil {
+		if r.Header.Get("Authorization") != "" {
+			ac.banner.Record(clientIP, OffenseAuthFailure)
+		}
+		return "", err
 	}
+	return username, nil
+}
 
-	// 记录当前请求
-	record.requests = append(record.requests, now)
-	record.lastAccess = now
+// AuthChallenge 返回 Proxy-Authenticate 质询，未启用认证时返回空字符串
+func (ac *AccessController) AuthChallenge() string {
+	ac.mutex.RLock()
+	defer ac.mutex.RUnlock()
 
-	return nil
+	if ac.auth == nil {
+		return ""
+	}
+	return ac.auth.Challenge()
 }
 
-// cleanupOldRecords 清理旧记录
-func (rl *RateLimiter) cleanupOldRecords() {
-	rl.mutex.Lock()
-	defer rl.mutex.Unlock()
+// AuthFailures 返回认证失败记录
+func (ac *AccessController) AuthFailures() []AuthFailure {
+	ac.mutex.RLock()
+	auth := ac.auth
+	ac.mutex.RUnlock()
 
-	cutoff := time.Now().Add(-rl.window * 2) // 保留2个窗口的数据
-	for ip, record := range rl.clients {
-		if record.lastAccess.Before(cutoff) {
-			delete(rl.clients, ip)
-		}
+	if auth == nil {
+		return nil
+	}
+	return auth.Failures()
+}
+
+// ClientIP 获取客户端IP，优先使用上下文中已解析的地址
+func (ac *AccessController) ClientIP(r *http.Request) string {
+	if clientIP, ok := r.Context().Value(clientIPKey{}).(string); ok && clientIP != "" {
+		return clientIP
 	}
+	return ac.resolver.Resolve(r)
 }
 
 // Stop 停止访问控制器
 func (ac *AccessController) Stop() {
-	if ac.rateLimiter.cleanup != nil {
-		ac.rateLimiter.cleanup.Stop()
-	}
+	ac.stopOnce.Do(func() {
+		ac.rateLimiter.Stop()
+		if ac.janitor != nil {
+			ac.janitor.Stop()
+			close(ac.janitorDone)
+		}
+	})
 }
 
 // GetStats 获取统计信息
@@ -310,21 +456,24 @@ func (ac *AccessController) GetStats() map[string]interface{} {
 	ac.mutex.RLock()
 	defer ac.mutex.RUnlock()
 
-	ac.rateLimiter.mutex.RLock()
-	defer ac.rateLimiter.mutex.RUnlock()
-
 	stats := map[string]interface{}{
-		"whitelist_size":     len(ac.whitelist),
-		"blacklist_size":     len(ac.blacklist),
-		"auth_enabled":       ac.auth != nil && ac.auth.Enabled,
-		"rate_limit_enabled": ac.rateLimiter.enabled,
-		"active_clients":     len(ac.rateLimiter.clients),
-	}
-
-	if ac.rateLimiter.enabled {
-		stats["rate_limit"] = fmt.Sprintf("%d/%s", ac.rateLimiter.maxRequests, ac.rateLimiter.window)
-	} else {
-		stats["rate_limit"] = "disabled"
+		"whitelist_size":     ac.whitelist.Len(),
+		"blacklist_size":     ac.blacklist.Len(),
+		"auth_enabled":       ac.auth != nil,
+		"cert_auths":         atomic.LoadInt64(&ac.certAuths),
+		"rate_limit_enabled": ac.rateLimiter.Enabled(),
+		"rate_limit":         ac.rateLimiter.GetStats(),
+		"auto_ban":           ac.banner.GetStats(),
+	}
+
+	if ac.auth != nil {
+		authStats := ac.auth.GetStats()
+		failures := ac.auth.Failures()
+		if len(failures) > 10 {
+			failures = failures[:10]
+		}
+		authStats["top_failures"] = failures
+		stats["auth"] = authStats
 	}
 
 	return stats
@@ -332,75 +481,32 @@ func (ac *AccessController) GetStats() map[string]interface{} {
 
 // UpdateConfig 更新配置
 func (ac *AccessController) UpdateConfig(securityConfig config.SecurityConfig) {
+	// 更新白名单和黑名单（保留运行时通过API添加的条目）
+	ac.applyLists(securityConfig)
+	ac.resolver.SetTrustedProxies(securityConfig.TrustedProxies)
+
 	ac.mutex.Lock()
 	defer ac.mutex.Unlock()
 
-	// 更新白名单
-	ac.whitelist = make(map[string]bool)
-	for _, ip := range securityConfig.Whitelist {
-		ac.whitelist[ip] = true
-	}
+	ac.certMapper = NewClientCertMapper(securityConfig.ClientCert)
 
-	// 更新黑名单
-	ac.blacklist = make(map[string]bool)
-	for _, ip := range securityConfig.Blacklist {
-		ac.blacklist[ip] = true
-	}
-
-	// 更新认证
+	// 更新认证（配置错误时保留原认证器，新认证器接管失败记录和未变化凭据的认证缓存）
 	if securityConfig.EnableAuth {
-		ac.SetAuthWithoutLock(securityConfig.Username, securityConfig.Password)
+		if auth, err := NewAuthenticator(securityConfig); err != nil {
+			logger.Errorf("更新代理认证失败，保留原配置: %v", err)
+		} else {
+			if ac.auth != nil {
+				auth.inherit(ac.auth)
+			}
+			ac.auth = auth
+		}
 	} else {
 		ac.auth = nil
 	}
 
-	// 更新限流配置
-	ac.rateLimiter.mutex.Lock()
-	oldEnabled := ac.rateLimiter.enabled
-	ac.rateLimiter.enabled = securityConfig.RateLimit.Enabled
-	ac.rateLimiter.maxRequests = securityConfig.RateLimit.MaxRequests
-	ac.rateLimiter.window = securityConfig.RateLimit.Window
-
-	// 如果限流状态发生变化
-	if !oldEnabled && ac.rateLimiter.enabled {
-		// 从禁用变为启用，启动清理任务
-		ac.rateLimiter.startCleanupWithoutLock()
-		logger.Infof("限流器已启用: %d请求/%s", ac.rateLimiter.maxRequests, ac.rateLimiter.window)
-	} else if oldEnabled && !ac.rateLimiter.enabled {
-		// 从启用变为禁用，停止清理任务
-		if ac.rateLimiter.cleanup != nil {
-			ac.rateLimiter.cleanup.Stop()
-			ac.rateLimiter.cleanup = nil
-		}
-		logger.Info("限流器已禁用")
-	} else if ac.rateLimiter.enabled {
-		// 仍然启用，只是更新参数
-		logger.Infof("限流器配置已更新: %d请求/%s", ac.rateLimiter.maxRequests, ac.rateLimiter.window)
-	}
-	ac.rateLimiter.mutex.Unlock()
+	// 更新限流配置（规则未变化时保留令牌桶状态）
+	ac.rateLimiter.Configure(securityConfig.RateLimit)
+	ac.banner.Configure(securityConfig.AutoBan)
 
 	logger.Info("访问控制配置已更新")
 }
-
-// SetAuthWithoutLock 设置认证（不加锁版本，用于内部调用）
-func (ac *AccessController) SetAuthWithoutLock(username, password string) {
-	hash := sha256.Sum256([]byte(password))
-	ac.auth = &AuthConfig{
-		Username:     username,
-		PasswordHash: hash[:],
-		Enabled:      true,
-	}
-}
-
-// startCleanupWithoutLock 启动清理任务（不加锁版本）
-func (rl *RateLimiter) startCleanupWithoutLock() {
-	if rl.cleanup != nil {
-		rl.cleanup.Stop()
-	}
-	rl.cleanup = time.NewTicker(5 * time.Minute)
-	go func() {
-		for range rl.cleanup.C {
-			rl.cleanupOldRecords()
-		}
-	}()
-}
@@ -0,0 +1,458 @@
+package security
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"hackmitm/pkg/config"
+	"hackmitm/pkg/logger"
+)
+
+// ErrProxyAuthRequired 缺少或无效的代理认证，调用方应返回 407 并携带 Proxy-Authenticate 质询
+var ErrProxyAuthRequired = errors.New("需要代理认证")
+
+const (
+	// defaultAuthRealm 默认认证域
+	defaultAuthRealm = "HackMITM"
+	// verifiedCacheTTL 认证成功结果的缓存时间，避免每个请求都计算 bcrypt/argon2
+	verifiedCacheTTL = 5 * time.Minute
+	// verifiedCacheMax 认证缓存最大条目数
+	verifiedCacheMax = 10000
+	// htpasswdCheckInterval htpasswd 文件变更检查间隔
+	htpasswdCheckInterval = 5 * time.Second
+	// failureRetention 认证失败记录保留时间
+	failureRetention = time.Hour
+)
+
+// AuthFailure 客户端认证失败记录
+type AuthFailure struct {
+	// ClientIP 客户端IP
+	ClientIP string `json:"client_ip"`
+	// LastUsername 最近一次尝试的用户名
+	LastUsername string `json:"last_username"`
+	// Count 连续失败次数（认证成功后清零）
+	Count int `json:"count"`
+	// FirstFailure 首次失败时间
+	FirstFailure time.Time `json:"first_failure"`
+	// LastFailure 最近一次失败时间
+	LastFailure time.Time `json:"last_failure"`
+}
+
+// credential 用户凭据
+type credential struct {
+	// hash 密码哈希，plain 为 true 时为明文密码的 SHA-256
+	hash string
+	// plain 兼容旧配置的明文密码
+	plain bool
+}
+
+// Authenticator 代理 Basic 认证器，支持多用户、密码哈希和 htpasswd 文件
+// Authenticator implements proxy Basic authentication with hashed multi-user credentials
+type Authenticator struct {
+	// realm 质询中的认证域
+	realm string
+	// users 配置文件中的用户
+	users map[string]credential
+	// htpasswdPath htpasswd 文件路径
+	htpasswdPath string
+	// htpasswdUsers htpasswd 文件中的用户
+	htpasswdUsers map[string]credential
+	// htpasswdModTime htpasswd 文件修改时间
+	htpasswdModTime time.Time
+	// htpasswdChecked 上次检查 htpasswd 文件的时间
+	htpasswdChecked time.Time
+	// verified 认证成功缓存，键为用户名和密码摘要
+	verified map[string]time.Time
+	// failures 按客户端IP记录的认证失败
+	failures map[string]*AuthFailure
+	// totalFailures 认证失败总数
+	totalFailures int64
+	// mutex 保护并发访问
+	mutex sync.Mutex
+}
+
+// NewAuthenticator 根据安全配置创建认证器
+// NewAuthenticator creates an authenticator from users, htpasswd file and legacy username/password
+func NewAuthenticator(securityConfig config.SecurityConfig) (*Authenticator, error) {
+	a := newAuthenticator(securityConfig.AuthRealm)
+
+	// 兼容单用户配置
+	if securityConfig.Username != "" {
+		if IsPasswordHash(securityConfig.Password) {
+			a.users[securityConfig.Username] = credential{hash: securityConfig.Password}
+		} else {
+			logger.Warn("security.password 为明文密码，建议改用 bcrypt/argon2id 哈希（hackmitm auth hash）")
+			a.users[securityConfig.Username] = plainCredential(securityConfig.Password)
+		}
+	}
+
+	for _, user := range securityConfig.Users {
+		if !IsPasswordHash(user.PasswordHash) {
+			return nil, fmt.Errorf("用户 %s 的密码哈希格式不受支持", user.Username)
+		}
+		a.users[user.Username] = credential{hash: user.PasswordHash}
+	}
+
+	if securityConfig.HtpasswdFile != "" {
+		a.htpasswdPath = securityConfig.HtpasswdFile
+		if err := a.loadHtpasswd(); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(a.users) == 0 && len(a.htpasswdUsers) == 0 {
+		return nil, fmt.Errorf("未配置任何认证用户")
+	}
+
+	logger.Infof("代理认证已启用: %d 个配置用户, %d 个htpasswd用户", len(a.users), len(a.htpasswdUsers))
+	return a, nil
+}
+
+// inherit 接管旧认证器的运行时状态，配置重新加载时调用，避免无关的配置变更清空状态：
+// 认证失败记录始终保留；用户和密码未变化时保留认证缓存，否则清空以使修改或删除的凭据立即失效
+func (a *Authenticator) inherit(old *Authenticator) {
+	old.mutex.Lock()
+	defer old.mutex.Unlock()
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	a.failures = old.failures
+	a.totalFailures = old.totalFailures
+	if sameCredentials(a.users, old.users) && sameCredentials(a.htpasswdUsers, old.htpasswdUsers) {
+		a.verified = old.verified
+	}
+}
+
+// sameCredentials 两组用户凭据是否完全相同
+func sameCredentials(a, b map[string]credential) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for username, cred := range a {
+		if other, exists := b[username]; !exists || other != cred {
+			return false
+		}
+	}
+	return true
+}
+
+// newAuthenticator 创建没有任何用户的认证器（拒绝所有凭据）
+func newAuthenticator(realm string) *Authenticator {
+	if realm == "" {
+		realm = defaultAuthRealm
+	}
+	return &Authenticator{
+		realm:    realm,
+		users:    make(map[string]credential),
+		verified: make(map[string]time.Time),
+		failures: make(map[string]*AuthFailure),
+	}
+}
+
+var (
+	dummyHashOnce  sync.Once
+	dummyHashValue string
+)
+
+// dummyHash 返回用于不存在用户的占位 bcrypt 哈希
+func dummyHash() string {
+	dummyHashOnce.Do(func() {
+		dummyHashValue, _ = HashPassword("hackmitm-dummy-password", HashBcrypt)
+	})
+	return dummyHashValue
+}
+
+// plainCredential 创建明文密码凭据（只保存摘要）
+func plainCredential(password string) credential {
+	sum := sha256.Sum256([]byte(password))
+	return credential{hash: string(sum[:]), plain: true}
+}
+
+// Challenge 返回 Proxy-Authenticate 响应头的值
+func (a *Authenticator) Challenge() string {
+	return fmt.Sprintf("Basic realm=%q, charset=\"UTF-8\"", a.realm)
+}
+
+// Authenticate 校验请求的 Proxy-Authorization 头，成功时返回用户名
+// 认证失败的错误均包装 ErrProxyAuthRequired
+func (a *Authenticator) Authenticate(r *http.Request, clientIP string) (string, error) {
+	header := r.Header.Get("Proxy-Authorization")
+	if header == "" {
+		// 客户端首次请求通常不带凭据，不计为失败
+		return "", fmt.Errorf("%w: 缺少 Proxy-Authorization", ErrProxyAuthRequired)
+	}
+	return a.AuthenticateHeader(header, clientIP)
+}
+
+// AuthenticateHeader 校验 "Basic base64(用户名:密码)" 形式的凭据，成功时返回用户名
+// 也用于监控API使用代理账号认证（Authorization 头）
+func (a *Authenticator) AuthenticateHeader(header, clientIP string) (string, error) {
+	if header == "" {
+		return "", fmt.Errorf("%w: 缺少凭据", ErrProxyAuthRequired)
+	}
+
+	username, password, ok := parseBasicAuth(header)
+	if !ok {
+		a.recordFailure(clientIP, "")
+		return "", fmt.Errorf("%w: 认证格式错误", ErrProxyAuthRequired)
+	}
+
+	a.refreshHtpasswd()
+	if a.isVerified(username, password) {
+		return username, nil
+	}
+
+	cred, exists := a.lookup(username)
+	if !exists {
+		// 对不存在的用户同样执行一次哈希比较，避免通过耗时判断用户是否存在
+		VerifyPassword(dummyHash(), password)
+		a.recordFailure(clientIP, username)
+		return "", fmt.Errorf("%w: 用户名或密码错误 (%s)", ErrProxyAuthRequired, username)
+	}
+
+	valid, err := cred.verify(password)
+	if err != nil {
+		logger.Errorf("校验用户 %s 的密码失败: %v", username, err)
+	}
+	if !valid {
+		a.recordFailure(clientIP, username)
+		return "", fmt.Errorf("%w: 用户名或密码错误 (%s)", ErrProxyAuthRequired, username)
+	}
+
+	a.recordSuccess(clientIP, username, password)
+	return username, nil
+}
+
+// verify 校验密码
+func (c credential) verify(password string) (bool, error) {
+	if c.plain {
+		sum := sha256.Sum256([]byte(password))
+		return subtle.ConstantTimeCompare(sum[:], []byte(c.hash)) == 1, nil
+	}
+	return VerifyPassword(c.hash, password)
+}
+
+// parseBasicAuth 解析 "Basic base64(username:password)"
+func parseBasicAuth(header string) (string, string, bool) {
+	const prefix = "basic "
+	if len(header) < len(prefix) || !strings.EqualFold(header[:len(prefix)], prefix) {
+		return "", "", false
+	}
+	decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(header[len(prefix):]))
+	if err != nil {
+		return "", "", false
+	}
+	username, password, ok := strings.Cut(string(decoded), ":")
+	if !ok || username == "" {
+		return "", "", false
+	}
+	return username, password, true
+}
+
+// lookup 查找用户凭据，配置文件中的用户优先于 htpasswd
+func (a *Authenticator) lookup(username string) (credential, bool) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	if cred, exists := a.users[username]; exists {
+		return cred, true
+	}
+	cred, exists := a.htpasswdUsers[username]
+	return cred, exists
+}
+
+// refreshHtpasswd 定期检查 htpasswd 文件是否变更
+func (a *Authenticator) refreshHtpasswd() {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	if a.htpasswdPath == "" || time.Since(a.htpasswdChecked) < htpasswdCheckInterval {
+		return
+	}
+	if err := a.loadHtpasswdLocked(); err != nil {
+		logger.Errorf("重新加载htpasswd文件失败: %v", err)
+	}
+}
+
+// verifiedKey 认证缓存键，不保存明文密码
+func verifiedKey(username, password string) string {
+	sum := sha256.Sum256([]byte(username + "\x00" + password))
+	return string(sum[:])
+}
+
+// isVerified 检查凭据是否在认证缓存中
+func (a *Authenticator) isVerified(username, password string) bool {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	expiry, exists := a.verified[verifiedKey(username, password)]
+	return exists && time.Now().Before(expiry)
+}
+
+// recordSuccess 记录认证成功：写入缓存并清除该客户端的失败记录
+func (a *Authenticator) recordSuccess(clientIP, username, password string) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	if len(a.verified) >= verifiedCacheMax {
+		a.verified = make(map[string]time.Time)
+	}
+	a.verified[verifiedKey(username, password)] = time.Now().Add(verifiedCacheTTL)
+	delete(a.failures, clientIP)
+}
+
+// recordFailure 记录认证失败
+func (a *Authenticator) recordFailure(clientIP, username string) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	now := time.Now()
+	a.totalFailures++
+
+	// 顺带清理过期记录
+	for ip, failure := range a.failures {
+		if now.Sub(failure.LastFailure) > failureRetention {
+			delete(a.failures, ip)
+		}
+	}
+
+	failure, exists := a.failures[clientIP]
+	if !exists {
+		failure = &AuthFailure{ClientIP: clientIP, FirstFailure: now}
+		a.failures[clientIP] = failure
+	}
+	failure.Count++
+	failure.LastFailure = now
+	failure.LastUsername = username
+
+	logger.Warnf("代理认证失败: 客户端=%s 用户=%q 连续失败=%d", clientIP, username, failure.Count)
+}
+
+// Failures 返回当前的认证失败记录，按失败次数降序
+func (a *Authenticator) Failures() []AuthFailure {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	list := make([]AuthFailure, 0, len(a.failures))
+	for _, failure := range a.failures {
+		list = append(list, *failure)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Count != list[j].Count {
+			return list[i].Count > list[j].Count
+		}
+		return list[i].ClientIP < list[j].ClientIP
+	})
+	return list
+}
+
+// GetStats 获取认证统计信息
+func (a *Authenticator) GetStats() map[string]interface{} {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	return map[string]interface{}{
+		"users":           len(a.users),
+		"htpasswd_users":  len(a.htpasswdUsers),
+		"failures_total":  a.totalFailures,
+		"failing_clients": len(a.failures),
+	}
+}
+
+// loadHtpasswd 加载 htpasswd 文件
+func (a *Authenticator) loadHtpasswd() error {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	return a.loadHtpasswdLocked()
+}
+
+// loadHtpasswdLocked 文件修改后重新加载 htpasswd（调用方需持有锁）
+func (a *Authenticator) loadHtpasswdLocked() error {
+	a.htpasswdChecked = time.Now()
+
+	stat, err := os.Stat(a.htpasswdPath)
+	if err != nil {
+		return fmt.Errorf("读取htpasswd文件失败: %w", err)
+	}
+	if a.htpasswdUsers != nil && stat.ModTime().Equal(a.htpasswdModTime) {
+		return nil
+	}
+
+	users, err := parseHtpasswd(a.htpasswdPath)
+	if err != nil {
+		return err
+	}
+
+	if a.htpasswdUsers != nil {
+		logger.Infof("htpasswd文件已重新加载: %s (%d 个用户)", a.htpasswdPath, len(users))
+		// 用户或密码可能已变更，清空认证缓存
+		a.verified = make(map[string]time.Time)
+	}
+	a.htpasswdUsers = users
+	a.htpasswdModTime = stat.ModTime()
+	return nil
+}
+
+// parseHtpasswd 解析 htpasswd 文件，跳过空行、注释和不支持的哈希
+func parseHtpasswd(path string) (map[string]credential, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("打开htpasswd文件失败: %w", err)
+	}
+	defer file.Close()
+
+	users := make(map[string]credential)
+	scanner := bufio.NewScanner(file)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		username, hash, ok := strings.Cut(line, ":")
+		if !ok || username == "" {
+			logger.Warnf("htpasswd 第%d行格式错误，已跳过", lineNo)
+			continue
+		}
+		if !IsPasswordHash(hash) {
+			logger.Warnf("htpasswd 第%d行 (%s) 使用不支持的哈希格式，已跳过（请使用 htpasswd -B）", lineNo, username)
+			continue
+		}
+		users[username] = credential{hash: hash}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("读取htpasswd文件失败: %w", err)
+	}
+
+	return users, nil
+}
+
+// usernameKey 上下文中保存认证用户名的键
+type usernameKey struct{}
+
+// WithUsername 将认证用户名保存到上下文
+func WithUsername(ctx context.Context, username string) context.Context {
+	if username == "" {
+		return ctx
+	}
+	return context.WithValue(ctx, usernameKey{}, username)
+}
+
+// UsernameFromContext 获取上下文中的认证用户名，未认证时返回空字符串
+func UsernameFromContext(ctx context.Context) string {
+	username, _ := ctx.Value(usernameKey{}).(string)
+	return username
+}
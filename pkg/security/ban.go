@@ -0,0 +1,405 @@
+package security
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"hackmitm/pkg/config"
+	"hackmitm/pkg/logger"
+)
+
+// 违规类型
+const (
+	OffenseAuthFailure  = "auth_failure"
+	OffenseRateLimit    = "rate_limit"
+	OffenseFilterDenial = "filter_denial"
+	// OffenseManual 通过API手动封禁
+	OffenseManual = "manual"
+)
+
+// ErrBanNotFound 封禁记录不存在
+var ErrBanNotFound = errors.New("封禁记录不存在")
+
+// Ban 封禁记录
+type Ban struct {
+	// IP 被封禁的客户端IP
+	IP string `json:"ip"`
+	// Reason 触发封禁的违规类型
+	Reason string `json:"reason"`
+	// Offense 第几次被封禁，决定封禁时长
+	Offense int `json:"offense"`
+	// BannedAt 封禁时间
+	BannedAt time.Time `json:"banned_at"`
+	// ExpiresAt 解封时间
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// banHistory 封禁历史，用于计算递增的封禁时长
+type banHistory struct {
+	Offenses  int       `json:"offenses"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// offenseCounter 时间窗口内的违规计数
+type offenseCounter struct {
+	count int
+	start time.Time
+}
+
+// banState 持久化的封禁状态
+type banState struct {
+	Bans    []Ban                  `json:"bans"`
+	History map[string]*banHistory `json:"history"`
+}
+
+// Banner 自动封禁器，客户端在时间窗口内违规次数达到阈值时临时封禁，重复违规时封禁时长递增
+// Banner implements fail2ban-style temporary bans with escalating durations
+type Banner struct {
+	// config 自动封禁配置
+	config config.AutoBanConfig
+	// ignore 永不封禁的地址
+	ignore *IPList
+	// counters 按 IP|违规类型 统计的违规次数
+	counters map[string]*offenseCounter
+	// bans 生效中的封禁
+	bans map[string]*Ban
+	// history 封禁历史
+	history map[string]*banHistory
+	// mutex 保护并发访问
+	mutex sync.RWMutex
+}
+
+// NewBanner 创建自动封禁器，并从状态文件恢复未过期的封禁
+func NewBanner(banConfig config.AutoBanConfig) *Banner {
+	b := &Banner{
+		ignore:   NewIPList("封禁豁免"),
+		counters: make(map[string]*offenseCounter),
+		bans:     make(map[string]*Ban),
+		history:  make(map[string]*banHistory),
+	}
+	b.Configure(banConfig)
+	return b
+}
+
+// Configure 应用配置，状态文件变化时从新文件恢复封禁
+func (b *Banner) Configure(banConfig config.AutoBanConfig) {
+	b.ignore.SetSource(SourceConfig, banConfig.Ignore)
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	stateChanged := banConfig.StateFile != b.config.StateFile
+	wasEnabled := b.config.Enabled
+	b.config = banConfig
+
+	if stateChanged && banConfig.StateFile != "" {
+		if err := b.loadLocked(); err != nil {
+			logger.Errorf("加载封禁状态失败: %v", err)
+		}
+	}
+
+	if banConfig.Enabled && !wasEnabled {
+		logger.Infof("自动封禁已启用: 首次封禁 %s，上限 %s", banConfig.BanTime, banConfig.MaxBanTime)
+	} else if !banConfig.Enabled && wasEnabled {
+		logger.Info("自动封禁已禁用，已有封禁在到期前仍然有效")
+	}
+}
+
+// Banned 返回IP当前生效的封禁
+func (b *Banner) Banned(ip string) (*Ban, bool) {
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
+
+	ban, exists := b.bans[normalizeIP(ip)]
+	if !exists || !time.Now().Before(ban.ExpiresAt) {
+		return nil, false
+	}
+	result := *ban
+	return &result, true
+}
+
+// Record 记录一次违规，达到阈值时封禁并返回封禁记录
+func (b *Banner) Record(ip, offense string) *Ban {
+	ip = normalizeIP(ip)
+	if ip == "" || b.ignore.Contains(ip) {
+		return nil
+	}
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if !b.config.Enabled {
+		return nil
+	}
+	threshold := b.thresholdLocked(offense)
+	if threshold <= 0 {
+		return nil
+	}
+	if ban, exists := b.bans[ip]; exists && time.Now().Before(ban.ExpiresAt) {
+		return nil
+	}
+
+	now := time.Now()
+	key := ip + "|" + offense
+	counter := b.counters[key]
+	if counter == nil || now.Sub(counter.start) > b.config.FindTime {
+		counter = &offenseCounter{start: now}
+		b.counters[key] = counter
+	}
+	counter.count++
+	if counter.count < threshold {
+		return nil
+	}
+
+	for k := range b.counters {
+		if strings.HasPrefix(k, ip+"|") {
+			delete(b.counters, k)
+		}
+	}
+	ban := b.banLocked(ip, offense, 0, now)
+	logger.Warnf("客户端 %s 已被自动封禁 %s（%s 达到 %d 次，第 %d 次封禁）",
+		ip, ban.ExpiresAt.Sub(now).Round(time.Second), offense, threshold, ban.Offense)
+	return ban
+}
+
+// Ban 手动封禁IP，duration 为0时按递增规则计算时长
+func (b *Banner) Ban(ip string, duration time.Duration) (*Ban, error) {
+	addr, err := netip.ParseAddr(strings.TrimSpace(ip))
+	if err != nil {
+		return nil, fmt.Errorf("无效的IP地址: %q", ip)
+	}
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	ban := b.banLocked(addr.Unmap().String(), OffenseManual, duration, time.Now())
+	logger.Warnf("客户端 %s 已被手动封禁至 %s", ban.IP, ban.ExpiresAt.Format(time.RFC3339))
+	return ban, nil
+}
+
+// banLocked 创建封禁记录并保存状态（调用方需持有锁）
+func (b *Banner) banLocked(ip, reason string, duration time.Duration, now time.Time) *Ban {
+	history := b.history[ip]
+	if history == nil || now.Sub(history.ExpiresAt) > b.config.MaxBanTime {
+		history = &banHistory{}
+		b.history[ip] = history
+	}
+	history.Offenses++
+
+	if duration <= 0 {
+		duration = b.banDuration(history.Offenses)
+	}
+	ban := &Ban{
+		IP:        ip,
+		Reason:    reason,
+		Offense:   history.Offenses,
+		BannedAt:  now,
+		ExpiresAt: now.Add(duration),
+	}
+	history.ExpiresAt = ban.ExpiresAt
+	b.bans[ip] = ban
+
+	if err := b.saveLocked(); err != nil {
+		logger.Errorf("保存封禁状态失败: %v", err)
+	}
+	result := *ban
+	return &result
+}
+
+// banDuration 计算第 offense 次封禁的时长
+func (b *Banner) banDuration(offense int) time.Duration {
+	multiplier := math.Max(b.config.BanMultiplier, 1)
+	duration := float64(b.config.BanTime) * math.Pow(multiplier, float64(offense-1))
+	if b.config.MaxBanTime > 0 && duration > float64(b.config.MaxBanTime) {
+		return b.config.MaxBanTime
+	}
+	return time.Duration(duration)
+}
+
+// thresholdLocked 返回违规类型对应的阈值
+func (b *Banner) thresholdLocked(offense string) int {
+	switch offense {
+	case OffenseAuthFailure:
+		return b.config.MaxAuthFailures
+	case OffenseRateLimit:
+		return b.config.MaxRateLimitHits
+	case OffenseFilterDenial:
+		return b.config.MaxFilterDenials
+	}
+	return 0
+}
+
+// Unban 解除封禁，封禁历史保留以便再次违规时继续递增
+func (b *Banner) Unban(ip string) error {
+	ip = normalizeIP(ip)
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	ban, exists := b.bans[ip]
+	if !exists || !time.Now().Before(ban.ExpiresAt) {
+		return fmt.Errorf("%w: %s", ErrBanNotFound, ip)
+	}
+	delete(b.bans, ip)
+	if history := b.history[ip]; history != nil {
+		history.ExpiresAt = time.Now()
+	}
+
+	if err := b.saveLocked(); err != nil {
+		logger.Errorf("保存封禁状态失败: %v", err)
+	}
+	logger.Infof("客户端 %s 已解除封禁", ip)
+	return nil
+}
+
+// Bans 返回生效中的封禁，按解封时间排序
+func (b *Banner) Bans() []Ban {
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
+
+	now := time.Now()
+	list := make([]Ban, 0, len(b.bans))
+	for _, ban := range b.bans {
+		if now.Before(ban.ExpiresAt) {
+			list = append(list, *ban)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].ExpiresAt.Before(list[j].ExpiresAt)
+	})
+	return list
+}
+
+// Prune 清理过期的封禁、违规计数和封禁历史
+func (b *Banner) Prune() {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	now := time.Now()
+	for key, counter := range b.counters {
+		if now.Sub(counter.start) > b.config.FindTime {
+			delete(b.counters, key)
+		}
+	}
+
+	changed := false
+	for ip, ban := range b.bans {
+		if !now.Before(ban.ExpiresAt) {
+			delete(b.bans, ip)
+			changed = true
+			logger.Infof("客户端 %s 封禁已到期", ip)
+		}
+	}
+	for ip, history := range b.history {
+		if now.Sub(history.ExpiresAt) > b.config.MaxBanTime {
+			delete(b.history, ip)
+			changed = true
+		}
+	}
+
+	if changed {
+		if err := b.saveLocked(); err != nil {
+			logger.Errorf("保存封禁状态失败: %v", err)
+		}
+	}
+}
+
+// GetStats 获取封禁统计信息
+func (b *Banner) GetStats() map[string]interface{} {
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
+
+	active := 0
+	now := time.Now()
+	for _, ban := range b.bans {
+		if now.Before(ban.ExpiresAt) {
+			active++
+		}
+	}
+	return map[string]interface{}{
+		"enabled":     b.config.Enabled,
+		"active_bans": active,
+		"tracked":     len(b.counters),
+	}
+}
+
+// saveLocked 将封禁状态写入状态文件（调用方需持有锁）
+func (b *Banner) saveLocked() error {
+	path := b.config.StateFile
+	if path == "" {
+		return nil
+	}
+
+	state := banState{Bans: make([]Ban, 0, len(b.bans)), History: b.history}
+	for _, ban := range b.bans {
+		state.Bans = append(state.Bans, *ban)
+	}
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	// 先写临时文件再重命名，避免进程中断时留下不完整的状态文件
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// loadLocked 从状态文件恢复未过期的封禁（调用方需持有锁）
+func (b *Banner) loadLocked() error {
+	data, err := os.ReadFile(b.config.StateFile)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	var state banState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return fmt.Errorf("解析 %s 失败: %w", b.config.StateFile, err)
+	}
+
+	now := time.Now()
+	restored := 0
+	for i := range state.Bans {
+		ban := state.Bans[i]
+		if now.Before(ban.ExpiresAt) {
+			b.bans[ban.IP] = &ban
+			restored++
+		}
+	}
+	for ip, history := range state.History {
+		if history != nil {
+			b.history[ip] = history
+		}
+	}
+
+	if restored > 0 {
+		logger.Infof("已恢复 %d 条封禁记录: %s", restored, b.config.StateFile)
+	}
+	return nil
+}
+
+// normalizeIP 规范化IP地址，无法解析时原样返回
+func normalizeIP(ip string) string {
+	ip = strings.TrimSpace(ip)
+	if addr, err := netip.ParseAddr(ip); err == nil {
+		return addr.Unmap().String()
+	}
+	return ip
+}
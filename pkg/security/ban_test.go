@@ -0,0 +1,224 @@
+package security
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"hackmitm/pkg/config"
+)
+
+// testBanConfig 认证失败3次、限流2次封禁，首次封禁1分钟，每次翻倍，上限10分钟
+func testBanConfig() config.AutoBanConfig {
+	return config.AutoBanConfig{
+		Enabled:          true,
+		FindTime:         time.Minute,
+		MaxAuthFailures:  3,
+		MaxRateLimitHits: 2,
+		BanTime:          time.Minute,
+		BanMultiplier:    2,
+		MaxBanTime:       10 * time.Minute,
+		Ignore:           []string{"10.0.0.0/8"},
+	}
+}
+
+func TestBannerRecord(t *testing.T) {
+	tests := []struct {
+		name string
+		// configure 修改默认测试配置
+		configure func(*config.AutoBanConfig)
+		ip        string
+		offenses  []string
+		// expire 记录前 n 次违规后将计数窗口移到 FindTime 之前，0 表示不移动
+		expire int
+		// wantBanAt 第几次违规时封禁（从1开始），0 表示不封禁
+		wantBanAt int
+	}{
+		{
+			name:      "窗口内达到阈值时封禁",
+			ip:        "192.0.2.1",
+			offenses:  []string{OffenseAuthFailure, OffenseAuthFailure, OffenseAuthFailure},
+			wantBanAt: 3,
+		},
+		{
+			name:      "各违规类型分别计数",
+			ip:        "192.0.2.1",
+			offenses:  []string{OffenseAuthFailure, OffenseRateLimit, OffenseAuthFailure, OffenseRateLimit},
+			wantBanAt: 4,
+		},
+		{
+			name:     "超出窗口的违规重新计数",
+			ip:       "192.0.2.1",
+			offenses: []string{OffenseAuthFailure, OffenseAuthFailure, OffenseAuthFailure},
+			expire:   2,
+		},
+		{
+			name:     "阈值为0的违规类型不统计",
+			ip:       "192.0.2.1",
+			offenses: []string{OffenseFilterDenial, OffenseFilterDenial, OffenseFilterDenial},
+		},
+		{
+			name:     "豁免地址不封禁",
+			ip:       "10.1.2.3",
+			offenses: []string{OffenseRateLimit, OffenseRateLimit, OffenseRateLimit},
+		},
+		{
+			name:      "IPv4映射地址按IPv4计数",
+			ip:        "::ffff:192.0.2.1",
+			offenses:  []string{OffenseRateLimit, OffenseRateLimit},
+			wantBanAt: 2,
+		},
+		{
+			name:      "未启用时不封禁",
+			configure: func(c *config.AutoBanConfig) { c.Enabled = false },
+			ip:        "192.0.2.1",
+			offenses:  []string{OffenseRateLimit, OffenseRateLimit},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			banConfig := testBanConfig()
+			if tt.configure != nil {
+				tt.configure(&banConfig)
+			}
+			b := NewBanner(banConfig)
+
+			bannedAt := 0
+			for i, offense := range tt.offenses {
+				if ban := b.Record(tt.ip, offense); ban != nil && bannedAt == 0 {
+					bannedAt = i + 1
+					if ban.IP != normalizeIP(tt.ip) || ban.Reason != offense || ban.Offense != 1 {
+						t.Errorf("封禁记录 = %+v", ban)
+					}
+				}
+				if i+1 == tt.expire {
+					for _, counter := range b.counters {
+						counter.start = counter.start.Add(-2 * banConfig.FindTime)
+					}
+				}
+			}
+			if bannedAt != tt.wantBanAt {
+				t.Fatalf("第 %d 次违规时封禁, want %d", bannedAt, tt.wantBanAt)
+			}
+			if _, banned := b.Banned(tt.ip); banned != (tt.wantBanAt > 0) {
+				t.Errorf("Banned() = %v, want %v", banned, tt.wantBanAt > 0)
+			}
+		})
+	}
+}
+
+func TestBanDuration(t *testing.T) {
+	tests := []struct {
+		name       string
+		multiplier float64
+		offense    int
+		want       time.Duration
+	}{
+		{name: "首次封禁", multiplier: 2, offense: 1, want: time.Minute},
+		{name: "第二次翻倍", multiplier: 2, offense: 2, want: 2 * time.Minute},
+		{name: "第四次", multiplier: 2, offense: 4, want: 8 * time.Minute},
+		{name: "不超过上限", multiplier: 2, offense: 5, want: 10 * time.Minute},
+		{name: "倍数小于1时不递增", multiplier: 0.5, offense: 3, want: time.Minute},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			banConfig := testBanConfig()
+			banConfig.BanMultiplier = tt.multiplier
+			b := NewBanner(banConfig)
+			if got := b.banDuration(tt.offense); got != tt.want {
+				t.Errorf("banDuration(%d) = %v, want %v", tt.offense, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBannerEscalation(t *testing.T) {
+	b := NewBanner(testBanConfig())
+
+	for offense, want := range []time.Duration{time.Minute, 2 * time.Minute, 4 * time.Minute, 8 * time.Minute, 10 * time.Minute} {
+		ban, err := b.Ban("192.0.2.1", 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ban.Offense != offense+1 || ban.ExpiresAt.Sub(ban.BannedAt) != want {
+			t.Errorf("第 %d 次封禁: offense %d, 时长 %v, want %v", offense+1, ban.Offense, ban.ExpiresAt.Sub(ban.BannedAt), want)
+		}
+	}
+
+	// 封禁结束后超过 MaxBanTime 未再违规，重新从 BanTime 开始
+	b.history["192.0.2.1"].ExpiresAt = time.Now().Add(-11 * time.Minute)
+	ban, _ := b.Ban("192.0.2.1", 0)
+	if ban.Offense != 1 || ban.ExpiresAt.Sub(ban.BannedAt) != time.Minute {
+		t.Errorf("历史过期后封禁: offense %d, 时长 %v", ban.Offense, ban.ExpiresAt.Sub(ban.BannedAt))
+	}
+
+	// 手动指定的时长不受递增规则影响
+	ban, _ = b.Ban("192.0.2.2", time.Hour)
+	if ban.ExpiresAt.Sub(ban.BannedAt) != time.Hour {
+		t.Errorf("手动封禁时长 = %v, want 1h", ban.ExpiresAt.Sub(ban.BannedAt))
+	}
+	if _, err := b.Ban("not-an-ip", 0); err == nil {
+		t.Error("Ban(无效IP) 未返回错误")
+	}
+}
+
+func TestBannerUnbanKeepsHistory(t *testing.T) {
+	b := NewBanner(testBanConfig())
+	if _, err := b.Ban("192.0.2.1", 0); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := b.Unban("::ffff:192.0.2.1"); err != nil {
+		t.Fatalf("Unban() error = %v", err)
+	}
+	if _, banned := b.Banned("192.0.2.1"); banned {
+		t.Error("解除后仍然封禁")
+	}
+	if err := b.Unban("192.0.2.1"); !errors.Is(err, ErrBanNotFound) {
+		t.Errorf("重复 Unban() error = %v, want ErrBanNotFound", err)
+	}
+
+	// 解除封禁不清除历史，再次封禁时长继续递增
+	ban, _ := b.Ban("192.0.2.1", 0)
+	if ban.Offense != 2 || ban.ExpiresAt.Sub(ban.BannedAt) != 2*time.Minute {
+		t.Errorf("解除后再次封禁: offense %d, 时长 %v", ban.Offense, ban.ExpiresAt.Sub(ban.BannedAt))
+	}
+}
+
+func TestBannerStateRoundTrip(t *testing.T) {
+	banConfig := testBanConfig()
+	banConfig.StateFile = filepath.Join(t.TempDir(), "state", "bans.json")
+
+	b := NewBanner(banConfig)
+	if _, err := b.Ban("192.0.2.1", time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	b.mutex.Lock()
+	now := time.Now()
+	b.bans["192.0.2.2"] = &Ban{IP: "192.0.2.2", Reason: OffenseManual, Offense: 1, BannedAt: now.Add(-time.Hour), ExpiresAt: now.Add(-time.Minute)}
+	b.history["192.0.2.2"] = &banHistory{Offenses: 1, ExpiresAt: now.Add(-time.Minute)}
+	if err := b.saveLocked(); err != nil {
+		t.Fatalf("saveLocked() error = %v", err)
+	}
+	b.mutex.Unlock()
+
+	restored := NewBanner(banConfig)
+	if ban, banned := restored.Banned("192.0.2.1"); !banned || ban.Reason != OffenseManual {
+		t.Errorf("未恢复生效中的封禁: %+v", ban)
+	}
+	if len(restored.Bans()) != 1 {
+		t.Errorf("Bans() = %v, 过期的封禁不应恢复", restored.Bans())
+	}
+	if _, exists := restored.bans["192.0.2.2"]; exists {
+		t.Error("恢复了过期的封禁")
+	}
+
+	// 历史随状态恢复，再次封禁继续递增
+	ban, _ := restored.Ban("192.0.2.2", 0)
+	if ban.Offense != 2 {
+		t.Errorf("恢复后再次封禁 offense = %d, want 2", ban.Offense)
+	}
+}
@@ -0,0 +1,200 @@
+package security
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"hackmitm/pkg/config"
+	"hackmitm/pkg/logger"
+)
+
+// ErrCertificateRevoked 客户端证书已被吊销
+var ErrCertificateRevoked = errors.New("客户端证书已被吊销")
+
+// crlCheckInterval CRL 文件变更检查间隔
+const crlCheckInterval = 5 * time.Second
+
+// RevocationChecker 基于 CRL 文件的客户端证书吊销检查，文件修改后自动重新加载
+// RevocationChecker rejects client certificates listed in a CRL file
+type RevocationChecker struct {
+	// path CRL 文件路径
+	path string
+	// crl 已加载的吊销列表
+	crl *x509.RevocationList
+	// revoked 已吊销证书序列号
+	revoked map[string]time.Time
+	// modTime CRL 文件修改时间
+	modTime time.Time
+	// checked 上次检查文件的时间
+	checked time.Time
+	// mutex 保护并发访问
+	mutex sync.Mutex
+}
+
+// NewRevocationChecker 加载 CRL 文件
+func NewRevocationChecker(path string) (*RevocationChecker, error) {
+	rc := &RevocationChecker{path: path}
+	if err := rc.load(); err != nil {
+		return nil, err
+	}
+	return rc, nil
+}
+
+// load 读取并解析 CRL 文件（调用方需持有锁或尚未共享）
+func (rc *RevocationChecker) load() error {
+	info, err := os.Stat(rc.path)
+	if err != nil {
+		return fmt.Errorf("读取CRL文件失败: %w", err)
+	}
+	data, err := os.ReadFile(rc.path)
+	if err != nil {
+		return fmt.Errorf("读取CRL文件失败: %w", err)
+	}
+	if block, _ := pem.Decode(data); block != nil {
+		data = block.Bytes
+	}
+	crl, err := x509.ParseRevocationList(data)
+	if err != nil {
+		return fmt.Errorf("解析CRL文件失败: %w", err)
+	}
+
+	revoked := make(map[string]time.Time, len(crl.RevokedCertificateEntries))
+	for _, entry := range crl.RevokedCertificateEntries {
+		revoked[entry.SerialNumber.String()] = entry.RevocationTime
+	}
+
+	rc.crl = crl
+	rc.revoked = revoked
+	rc.modTime = info.ModTime()
+	logger.Infof("已加载证书吊销列表: %s（%d 个吊销证书）", rc.path, len(revoked))
+	if !crl.NextUpdate.IsZero() && time.Now().After(crl.NextUpdate) {
+		logger.Warnf("证书吊销列表已过期（next_update %s），请及时更新: %s", crl.NextUpdate.Format(time.RFC3339), rc.path)
+	}
+	return nil
+}
+
+// refresh 按间隔检查 CRL 文件，修改后重新加载，失败时保留原列表（调用方需持有锁）
+func (rc *RevocationChecker) refresh() {
+	now := time.Now()
+	if now.Sub(rc.checked) < crlCheckInterval {
+		return
+	}
+	rc.checked = now
+
+	info, err := os.Stat(rc.path)
+	if err != nil || info.ModTime().Equal(rc.modTime) {
+		return
+	}
+	if err := rc.load(); err != nil {
+		logger.Errorf("重新加载证书吊销列表失败，继续使用原列表: %v", err)
+	}
+}
+
+// Check 检查已验证的证书链中由 CRL 签发者签发的证书是否被吊销
+func (rc *RevocationChecker) Check(chains [][]*x509.Certificate) error {
+	rc.mutex.Lock()
+	defer rc.mutex.Unlock()
+
+	rc.refresh()
+	for _, chain := range chains {
+		for i := 0; i+1 < len(chain); i++ {
+			cert, issuer := chain[i], chain[i+1]
+			if !bytes.Equal(cert.RawIssuer, rc.crl.RawIssuer) || rc.crl.CheckSignatureFrom(issuer) != nil {
+				continue
+			}
+			if revokedAt, revoked := rc.revoked[cert.SerialNumber.String()]; revoked {
+				return fmt.Errorf("%w: %s（序列号 %s，吊销于 %s）", ErrCertificateRevoked,
+					cert.Subject, cert.SerialNumber, revokedAt.Format(time.RFC3339))
+			}
+		}
+	}
+	return nil
+}
+
+// VerifyConnection 可用作 tls.Config.VerifyConnection，会话恢复时同样会调用
+func (rc *RevocationChecker) VerifyConnection(state tls.ConnectionState) error {
+	if len(state.VerifiedChains) == 0 {
+		return nil
+	}
+	if err := rc.Check(state.VerifiedChains); err != nil {
+		logger.Warnf("拒绝客户端证书: %v", err)
+		return err
+	}
+	return nil
+}
+
+// ClientCertMapper 将已验证的客户端证书映射为用户名
+type ClientCertMapper struct {
+	field string
+	users map[string]string
+}
+
+// NewClientCertMapper 根据配置创建映射器
+func NewClientCertMapper(certConfig config.ClientCertConfig) *ClientCertMapper {
+	m := &ClientCertMapper{field: certConfig.UsernameField, users: make(map[string]string)}
+	for _, user := range certConfig.Users {
+		m.users[normalizeSubject(user.Subject)] = user.Username
+	}
+	return m
+}
+
+// normalizeSubject 规范化证书主题用于比较（去除空格、不区分大小写、忽略 RDN 顺序）
+// openssl 习惯的 "CN=alice,O=Lab" 与 Go 输出的 "O=Lab,CN=alice" 视为相同
+func normalizeSubject(subject string) string {
+	parts := strings.Split(subject, ",")
+	for i, part := range parts {
+		parts[i] = strings.ToLower(strings.TrimSpace(part))
+	}
+	sort.Strings(parts)
+	return strings.Join(parts, ",")
+}
+
+// Username 返回证书对应的用户名，无法确定时返回空字符串
+// 先按完整 DN、再按 CN 查找显式映射，未命中时取 username_field 指定的字段
+func (m *ClientCertMapper) Username(cert *x509.Certificate) string {
+	if username, ok := m.users[normalizeSubject(cert.Subject.String())]; ok {
+		return username
+	}
+	if cert.Subject.CommonName != "" {
+		if username, ok := m.users[normalizeSubject(cert.Subject.CommonName)]; ok {
+			return username
+		}
+		if username, ok := m.users[normalizeSubject("CN="+cert.Subject.CommonName)]; ok {
+			return username
+		}
+	}
+
+	switch m.field {
+	case "email":
+		if len(cert.EmailAddresses) > 0 {
+			return cert.EmailAddresses[0]
+		}
+	case "dns":
+		if len(cert.DNSNames) > 0 {
+			return cert.DNSNames[0]
+		}
+	case "subject":
+		return cert.Subject.String()
+	default:
+		return cert.Subject.CommonName
+	}
+	return ""
+}
+
+// verifiedClientCert 返回请求所在TLS连接中已验证的客户端证书
+func verifiedClientCert(r *http.Request) *x509.Certificate {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+		return nil
+	}
+	return r.TLS.VerifiedChains[0][0]
+}
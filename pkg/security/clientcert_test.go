@@ -0,0 +1,281 @@
+package security
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"io"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"hackmitm/pkg/config"
+)
+
+// testAuthority 测试用CA
+type testAuthority struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+// newTestAuthority 创建自签名CA
+func newTestAuthority(t *testing.T, name string) *testAuthority {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testAuthority{cert: cert, key: key}
+}
+
+// issue 签发客户端证书，dnsName 不为空时同时可用作服务器证书
+func (a *testAuthority) issue(t *testing.T, serial int64, cn, dnsName string) tls.Certificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: cn, Organization: []string{"Lab"}},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth, x509.ExtKeyUsageServerAuth},
+	}
+	if dnsName != "" {
+		template.DNSNames = []string{dnsName}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, a.cert, &key.PublicKey, a.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}
+}
+
+// writeCRL 写入由CA签发的PEM格式吊销列表
+func (a *testAuthority) writeCRL(t *testing.T, path string, nextUpdate time.Time, revoked ...int64) {
+	t.Helper()
+	template := &x509.RevocationList{
+		Number:     big.NewInt(time.Now().UnixNano()),
+		ThisUpdate: nextUpdate.Add(-24 * time.Hour),
+		NextUpdate: nextUpdate,
+	}
+	for _, serial := range revoked {
+		template.RevokedCertificateEntries = append(template.RevokedCertificateEntries, x509.RevocationListEntry{
+			SerialNumber:   big.NewInt(serial),
+			RevocationTime: time.Now().Add(-time.Minute),
+		})
+	}
+	der, err := x509.CreateRevocationList(rand.Reader, template, a.cert, a.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "X509 CRL", Bytes: der}), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRevocationCheckerCheck(t *testing.T) {
+	ca := newTestAuthority(t, "Test CA")
+	other := newTestAuthority(t, "Other CA")
+
+	tests := []struct {
+		name       string
+		nextUpdate time.Duration
+		// issuer 签发被检查证书的CA
+		issuer  *testAuthority
+		serial  int64
+		revoked []int64
+		want    error
+	}{
+		{name: "未吊销的证书", nextUpdate: time.Hour, issuer: ca, serial: 100, revoked: []int64{200}},
+		{name: "已吊销的序列号", nextUpdate: time.Hour, issuer: ca, serial: 200, revoked: []int64{100, 200}, want: ErrCertificateRevoked},
+		// 过期的CRL只输出警告，其中的吊销记录仍然生效
+		{name: "过期CRL中吊销的证书仍被拒绝", nextUpdate: -time.Hour, issuer: ca, serial: 200, revoked: []int64{200}, want: ErrCertificateRevoked},
+		{name: "过期CRL不影响未吊销的证书", nextUpdate: -time.Hour, issuer: ca, serial: 100, revoked: []int64{200}},
+		// 序列号相同但由其他CA签发，CRL 不适用
+		{name: "其他CA签发的相同序列号", nextUpdate: time.Hour, issuer: other, serial: 200, revoked: []int64{200}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "ca.crl")
+			ca.writeCRL(t, path, time.Now().Add(tt.nextUpdate), tt.revoked...)
+			checker, err := NewRevocationChecker(path)
+			if err != nil {
+				t.Fatalf("NewRevocationChecker() error = %v", err)
+			}
+
+			leaf := tt.issuer.issue(t, tt.serial, "alice", "").Leaf
+			err = checker.Check([][]*x509.Certificate{{leaf, tt.issuer.cert}})
+			if !errors.Is(err, tt.want) || (tt.want == nil && err != nil) {
+				t.Errorf("Check() error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestRevocationCheckerReload(t *testing.T) {
+	ca := newTestAuthority(t, "Test CA")
+	path := filepath.Join(t.TempDir(), "ca.crl")
+	ca.writeCRL(t, path, time.Now().Add(time.Hour))
+	checker, err := NewRevocationChecker(path)
+	if err != nil {
+		t.Fatalf("NewRevocationChecker() error = %v", err)
+	}
+	chain := [][]*x509.Certificate{{ca.issue(t, 100, "alice", "").Leaf, ca.cert}}
+	if err := checker.Check(chain); err != nil {
+		t.Fatalf("吊销前 Check() error = %v", err)
+	}
+
+	// reload 等待检查间隔后按修改时间重新加载
+	reload := func() {
+		modTime := time.Now().Add(time.Minute)
+		if err := os.Chtimes(path, modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+		checker.mutex.Lock()
+		checker.checked = time.Time{}
+		checker.mutex.Unlock()
+	}
+
+	ca.writeCRL(t, path, time.Now().Add(time.Hour), 100)
+	reload()
+	if err := checker.Check(chain); !errors.Is(err, ErrCertificateRevoked) {
+		t.Fatalf("CRL更新后 Check() error = %v, want ErrCertificateRevoked", err)
+	}
+
+	// 新文件无法解析时继续使用原列表
+	if err := os.WriteFile(path, []byte("not a crl"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	reload()
+	if err := checker.Check(chain); !errors.Is(err, ErrCertificateRevoked) {
+		t.Errorf("CRL损坏后 Check() error = %v, want ErrCertificateRevoked", err)
+	}
+
+	if _, err := NewRevocationChecker(filepath.Join(t.TempDir(), "missing.crl")); err == nil {
+		t.Error("CRL文件不存在时未返回错误")
+	}
+}
+
+func TestVerifyConnectionHandshake(t *testing.T) {
+	ca := newTestAuthority(t, "Test CA")
+	untrusted := newTestAuthority(t, "Untrusted CA")
+	path := filepath.Join(t.TempDir(), "ca.crl")
+	ca.writeCRL(t, path, time.Now().Add(time.Hour), 200)
+	checker, err := NewRevocationChecker(path)
+	if err != nil {
+		t.Fatalf("NewRevocationChecker() error = %v", err)
+	}
+
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.cert)
+	serverConfig := &tls.Config{
+		Certificates:     []tls.Certificate{ca.issue(t, 10, "proxy", "proxy.test")},
+		ClientAuth:       tls.RequireAndVerifyClientCert,
+		ClientCAs:        pool,
+		VerifyConnection: checker.VerifyConnection,
+	}
+
+	tests := []struct {
+		name       string
+		clientCert tls.Certificate
+		wantErr    bool
+	}{
+		{name: "有效证书", clientCert: ca.issue(t, 100, "alice", "")},
+		{name: "已吊销的证书", clientCert: ca.issue(t, 200, "bob", ""), wantErr: true},
+		{name: "不受信任的签发者", clientCert: untrusted.issue(t, 100, "mallory", ""), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clientConn, serverConn := net.Pipe()
+			defer clientConn.Close()
+			defer serverConn.Close()
+
+			server := tls.Server(serverConn, serverConfig)
+			serverErr := make(chan error, 1)
+			go func() {
+				serverErr <- server.Handshake()
+				serverConn.Close()
+			}()
+
+			client := tls.Client(clientConn, &tls.Config{
+				RootCAs:      pool,
+				ServerName:   "proxy.test",
+				Certificates: []tls.Certificate{tt.clientCert},
+			})
+			client.Handshake()
+			// TLS 1.3 服务端在握手末尾发送会话票据，net.Pipe 没有缓冲，客户端需要继续读取
+			go io.Copy(io.Discard, client)
+
+			err := <-serverErr
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("服务端握手 error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil {
+				if cert := server.ConnectionState().VerifiedChains[0][0]; cert.Subject.CommonName != "alice" {
+					t.Errorf("已验证的客户端证书 = %s", cert.Subject)
+				}
+			}
+		})
+	}
+}
+
+func TestClientCertMapperUsername(t *testing.T) {
+	ca := newTestAuthority(t, "Test CA")
+	leaf := ca.issue(t, 100, "alice", "alice.lab.test").Leaf
+
+	tests := []struct {
+		name  string
+		field string
+		users []config.ClientCertUser
+		want  string
+	}{
+		{name: "默认取CN", want: "alice"},
+		{name: "取DNS名称", field: "dns", want: "alice.lab.test"},
+		{name: "证书没有邮箱", field: "email"},
+		{name: "完整DN映射忽略顺序和大小写", users: []config.ClientCertUser{{Subject: "cn=Alice, O=Lab", Username: "a"}}, want: "a"},
+		{name: "仅CN映射", users: []config.ClientCertUser{{Subject: "alice", Username: "b"}}, want: "b"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mapper := NewClientCertMapper(config.ClientCertConfig{UsernameField: tt.field, Users: tt.users})
+			if got := mapper.Username(leaf); got != tt.want {
+				t.Errorf("Username() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,135 @@
+package security
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// ClientIPResolver 客户端IP解析器
+// 仅当直连对端属于可信代理时才采信 Forwarded、X-Forwarded-For 和 X-Real-IP，
+// 并从右向左遍历转发链，返回第一个不可信的地址
+// ClientIPResolver resolves the real client IP, honouring forwarding headers only from trusted proxies
+type ClientIPResolver struct {
+	// trusted 可信代理列表
+	trusted *IPList
+}
+
+// NewClientIPResolver 创建客户端IP解析器，trustedProxies 为IP、CIDR或范围
+func NewClientIPResolver(trustedProxies []string) *ClientIPResolver {
+	resolver := &ClientIPResolver{trusted: NewIPList("可信代理")}
+	resolver.SetTrustedProxies(trustedProxies)
+	return resolver
+}
+
+// SetTrustedProxies 替换可信代理列表
+func (cr *ClientIPResolver) SetTrustedProxies(trustedProxies []string) {
+	cr.trusted.SetSource(SourceConfig, trustedProxies)
+}
+
+// Resolve 解析请求的客户端IP
+func (cr *ClientIPResolver) Resolve(r *http.Request) string {
+	peer := remoteHost(r.RemoteAddr)
+	if cr.trusted.Len() == 0 || !cr.trusted.Contains(peer) {
+		return peer
+	}
+
+	if hops := forwardedFor(r.Header.Values("Forwarded")); len(hops) > 0 {
+		return cr.walk(peer, hops)
+	}
+	if hops := splitList(r.Header.Values("X-Forwarded-For")); len(hops) > 0 {
+		return cr.walk(peer, hops)
+	}
+	if xri := strings.TrimSpace(r.Header.Get("X-Real-IP")); xri != "" {
+		if addr, err := netip.ParseAddr(xri); err == nil {
+			return addr.Unmap().String()
+		}
+	}
+	return peer
+}
+
+// walk 从右向左遍历转发链，跳过可信代理；遇到无效地址时返回最后一个有效的地址
+func (cr *ClientIPResolver) walk(peer string, hops []string) string {
+	current := peer
+	for i := len(hops) - 1; i >= 0; i-- {
+		addr, err := netip.ParseAddr(hops[i])
+		if err != nil {
+			return current
+		}
+		current = addr.Unmap().String()
+		if !cr.trusted.Contains(current) {
+			return current
+		}
+	}
+	return current
+}
+
+// remoteHost 从 RemoteAddr 中取出主机部分
+func remoteHost(remoteAddr string) string {
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		host = remoteAddr
+	}
+	if addr, err := netip.ParseAddr(host); err == nil {
+		return addr.Unmap().String()
+	}
+	return host
+}
+
+// splitList 拆分逗号分隔的多行请求头
+func splitList(values []string) []string {
+	var items []string
+	for _, value := range values {
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+	}
+	return items
+}
+
+// forwardedFor 提取 RFC 7239 Forwarded 头中各节点的 for 参数
+// 形如 for=192.0.2.60;proto=http, for="[2001:db8::17]:4711"
+func forwardedFor(values []string) []string {
+	var hops []string
+	for _, element := range splitList(values) {
+		node := ""
+		for _, pair := range strings.Split(element, ";") {
+			key, value, ok := strings.Cut(strings.TrimSpace(pair), "=")
+			if ok && strings.EqualFold(key, "for") {
+				node = strings.Trim(value, `"`)
+			}
+		}
+
+		// 去掉端口和IPv6方括号；unknown 或混淆标识保留原样，遍历时视为无效地址
+		if strings.HasPrefix(node, "[") {
+			if end := strings.Index(node, "]"); end > 0 {
+				node = node[1:end]
+			}
+		} else if host, _, err := net.SplitHostPort(node); err == nil {
+			node = host
+		}
+		hops = append(hops, node)
+	}
+	return hops
+}
+
+// clientIPKey 客户端IP上下文键
+type clientIPKey struct{}
+
+// WithClientIP 在上下文中记录已解析的客户端IP
+func WithClientIP(ctx context.Context, clientIP string) context.Context {
+	return context.WithValue(ctx, clientIPKey{}, clientIP)
+}
+
+// ClientIP 返回请求的客户端IP
+// 优先使用代理服务器解析并记录在上下文中的地址，否则返回直连对端地址（不信任转发头）
+func ClientIP(r *http.Request) string {
+	if clientIP, ok := r.Context().Value(clientIPKey{}).(string); ok && clientIP != "" {
+		return clientIP
+	}
+	return remoteHost(r.RemoteAddr)
+}
@@ -0,0 +1,158 @@
+package security
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClientIPResolverResolve(t *testing.T) {
+	trusted := []string{"10.0.0.0/8", "192.168.1.1", "2001:db8::/32"}
+
+	tests := []struct {
+		name       string
+		trusted    []string
+		remoteAddr string
+		headers    map[string][]string
+		want       string
+	}{
+		{
+			name:       "未配置可信代理时忽略转发头",
+			remoteAddr: "203.0.113.5:1234",
+			headers:    map[string][]string{"X-Forwarded-For": {"198.51.100.7"}},
+			want:       "203.0.113.5",
+		},
+		{
+			name:       "直连对端不可信时忽略转发头",
+			trusted:    trusted,
+			remoteAddr: "203.0.113.5:1234",
+			headers:    map[string][]string{"X-Forwarded-For": {"198.51.100.7"}},
+			want:       "203.0.113.5",
+		},
+		{
+			name:       "可信代理转发的单跳",
+			trusted:    trusted,
+			remoteAddr: "10.1.2.3:1234",
+			headers:    map[string][]string{"X-Forwarded-For": {"198.51.100.7"}},
+			want:       "198.51.100.7",
+		},
+		{
+			name:       "从右向左跳过可信代理",
+			trusted:    trusted,
+			remoteAddr: "10.1.2.3:1234",
+			headers:    map[string][]string{"X-Forwarded-For": {"198.51.100.7, 203.0.113.9, 192.168.1.1, 10.0.0.9"}},
+			want:       "203.0.113.9",
+		},
+		{
+			name:       "客户端伪造的最左侧地址不被采信",
+			trusted:    trusted,
+			remoteAddr: "10.1.2.3:1234",
+			headers:    map[string][]string{"X-Forwarded-For": {"127.0.0.1, 198.51.100.7"}},
+			want:       "198.51.100.7",
+		},
+		{
+			name:       "多行请求头按顺序拼接",
+			trusted:    trusted,
+			remoteAddr: "10.1.2.3:1234",
+			headers:    map[string][]string{"X-Forwarded-For": {"198.51.100.7", "10.0.0.8"}},
+			want:       "198.51.100.7",
+		},
+		{
+			name:       "整条链都可信时返回最左侧地址",
+			trusted:    trusted,
+			remoteAddr: "10.1.2.3:1234",
+			headers:    map[string][]string{"X-Forwarded-For": {"10.0.0.7, 10.0.0.8"}},
+			want:       "10.0.0.7",
+		},
+		{
+			name:       "遇到无效地址时返回最后一个有效地址",
+			trusted:    trusted,
+			remoteAddr: "10.1.2.3:1234",
+			headers:    map[string][]string{"X-Forwarded-For": {"198.51.100.7, garbage, 10.0.0.8"}},
+			want:       "10.0.0.8",
+		},
+		{
+			name:       "IPv4映射的IPv6地址按IPv4处理",
+			trusted:    trusted,
+			remoteAddr: "[::ffff:10.1.2.3]:1234",
+			headers:    map[string][]string{"X-Forwarded-For": {"::ffff:198.51.100.7"}},
+			want:       "198.51.100.7",
+		},
+		{
+			name:       "Forwarded 优先于 X-Forwarded-For",
+			trusted:    trusted,
+			remoteAddr: "10.1.2.3:1234",
+			headers: map[string][]string{
+				"Forwarded":       {`for=198.51.100.7;proto=https, for="[2001:db8::17]:4711"`},
+				"X-Forwarded-For": {"203.0.113.9"},
+			},
+			want: "198.51.100.7",
+		},
+		{
+			name:       "Forwarded 中的 unknown 视为无效地址",
+			trusted:    trusted,
+			remoteAddr: "10.1.2.3:1234",
+			headers:    map[string][]string{"Forwarded": {"for=unknown, for=10.0.0.8"}},
+			want:       "10.0.0.8",
+		},
+		{
+			name:       "没有转发链时使用 X-Real-IP",
+			trusted:    trusted,
+			remoteAddr: "10.1.2.3:1234",
+			headers:    map[string][]string{"X-Real-IP": {"198.51.100.7"}},
+			want:       "198.51.100.7",
+		},
+		{
+			name:       "无效的 X-Real-IP 被忽略",
+			trusted:    trusted,
+			remoteAddr: "10.1.2.3:1234",
+			headers:    map[string][]string{"X-Real-IP": {"not-an-ip"}},
+			want:       "10.1.2.3",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resolver := NewClientIPResolver(tt.trusted)
+			r := httptest.NewRequest("GET", "http://example.test/", nil)
+			r.RemoteAddr = tt.remoteAddr
+			for key, values := range tt.headers {
+				for _, value := range values {
+					r.Header.Add(key, value)
+				}
+			}
+
+			if got := resolver.Resolve(r); got != tt.want {
+				t.Errorf("Resolve() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestForwardedFor(t *testing.T) {
+	tests := []struct {
+		name   string
+		values []string
+		want   []string
+	}{
+		{name: "IPv4", values: []string{"for=192.0.2.60;proto=http"}, want: []string{"192.0.2.60"}},
+		{name: "IPv4带端口", values: []string{`for="192.0.2.60:8080"`}, want: []string{"192.0.2.60"}},
+		{name: "IPv6带端口", values: []string{`for="[2001:db8::17]:4711"`}, want: []string{"2001:db8::17"}},
+		{name: "参数名不区分大小写", values: []string{"proto=http;For=192.0.2.60"}, want: []string{"192.0.2.60"}},
+		{name: "多个节点", values: []string{"for=192.0.2.60, for=198.51.100.17"}, want: []string{"192.0.2.60", "198.51.100.17"}},
+		{name: "混淆标识保留原样", values: []string{"for=_hidden"}, want: []string{"_hidden"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := forwardedFor(tt.values)
+			if len(got) != len(tt.want) {
+				t.Fatalf("forwardedFor() = %q, want %q", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("forwardedFor()[%d] = %q, want %q", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
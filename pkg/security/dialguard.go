@@ -0,0 +1,232 @@
+package security
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/netip"
+	"path"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"hackmitm/pkg/config"
+	"hackmitm/pkg/logger"
+)
+
+// 地址被禁止的原因
+const (
+	DialBlockLoopback  = "loopback"
+	DialBlockPrivate   = "private"
+	DialBlockLinkLocal = "link_local"
+	DialBlockConfig    = "block"
+)
+
+// sharedAddressSpace 运营商级NAT地址（RFC 6598），netip 的 IsPrivate 不包含该段
+var sharedAddressSpace = netip.MustParsePrefix("100.64.0.0/10")
+
+// DialBlockedError 上游连接目标地址被禁止
+type DialBlockedError struct {
+	// Address 请求连接的地址（host:port）
+	Address string
+	// IP 解析出的被禁止的IP
+	IP string
+	// Reason 禁止原因
+	Reason string
+}
+
+// Error 实现 error 接口
+func (e *DialBlockedError) Error() string {
+	return fmt.Sprintf("禁止连接 %s（解析为 %s，%s）", e.Address, e.IP, e.Reason)
+}
+
+// DialGuard 上游连接守卫，在建立TCP连接时检查实际连接的IP，防止代理被用于访问内网（SSRF）
+// 检查发生在解析之后、连接之前，因此 DNS 重绑定无法绕过。
+// 代理的上游连接都经过守卫：HTTP/HTTPS 转发使用 DialContext，WebSocket 和透传隧道使用 Dial 直连目标；
+// 配置上游代理后 HTTP/HTTPS 转发改由 CheckHost 在交给上游代理前检查，WebSocket 和透传隧道仍直连并在连接时检查
+// DialGuard restricts upstream dials to permitted addresses, checked at connect time to defeat DNS rebinding
+type DialGuard struct {
+	// policy 当前策略，未启用时为nil
+	policy atomic.Pointer[dialPolicy]
+	// dialer 基础拨号器
+	dialer net.Dialer
+	// blocked 被拒绝的连接数
+	blocked int64
+}
+
+// dialPolicy 编译后的地址策略
+type dialPolicy struct {
+	blockLoopback  bool
+	blockPrivate   bool
+	blockLinkLocal bool
+	block          *IPList
+	allow          *IPList
+	allowHosts     []string
+}
+
+// NewDialGuard 创建上游连接守卫
+func NewDialGuard(guardConfig config.DialGuardConfig) *DialGuard {
+	g := &DialGuard{
+		dialer: net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second},
+	}
+	g.Configure(guardConfig)
+	return g
+}
+
+// Configure 应用配置
+func (g *DialGuard) Configure(guardConfig config.DialGuardConfig) {
+	if !guardConfig.Enabled {
+		if g.policy.Swap(nil) != nil {
+			logger.Info("上游地址限制已禁用")
+		}
+		return
+	}
+
+	policy := &dialPolicy{
+		blockLoopback:  guardConfig.BlockLoopback,
+		blockPrivate:   guardConfig.BlockPrivate,
+		blockLinkLocal: guardConfig.BlockLinkLocal,
+		block:          NewIPList("上游禁止地址"),
+		allow:          NewIPList("上游允许地址"),
+	}
+	policy.block.SetSource(SourceConfig, guardConfig.Block)
+	policy.allow.SetSource(SourceConfig, guardConfig.Allow)
+	for _, host := range guardConfig.AllowHosts {
+		if host = strings.ToLower(strings.TrimSuffix(strings.TrimSpace(host), ".")); host != "" {
+			policy.allowHosts = append(policy.allowHosts, host)
+		}
+	}
+
+	wasEnabled := g.policy.Swap(policy) != nil
+	if !wasEnabled {
+		logger.Infof("上游地址限制已启用: 回环=%t 私有=%t 链路本地=%t，额外禁止 %d 条，允许 %d 条地址和 %d 个主机",
+			policy.blockLoopback, policy.blockPrivate, policy.blockLinkLocal,
+			policy.block.Len(), policy.allow.Len(), len(policy.allowHosts))
+	}
+}
+
+// Enabled 是否启用
+func (g *DialGuard) Enabled() bool {
+	return g.policy.Load() != nil
+}
+
+// DialContext 建立上游连接，可用作 http.Transport.DialContext
+// 目标地址被禁止时返回 *DialBlockedError（可能被 *net.OpError 包装，使用 errors.As 判断）
+func (g *DialGuard) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	policy := g.policy.Load()
+	if policy == nil {
+		return g.dialer.DialContext(ctx, network, address)
+	}
+
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		host = address
+	}
+	if policy.hostAllowed(host) {
+		return g.dialer.DialContext(ctx, network, address)
+	}
+
+	// Control 在每个解析出的地址实际连接之前调用，拿到的是最终连接的IP
+	dialer := g.dialer
+	dialer.Control = func(_, resolved string, _ syscall.RawConn) error {
+		ipStr, _, err := net.SplitHostPort(resolved)
+		if err != nil {
+			ipStr = resolved
+		}
+		addr, err := netip.ParseAddr(ipStr)
+		if err != nil {
+			return fmt.Errorf("无法解析连接地址: %s", resolved)
+		}
+		if reason := policy.check(addr.Unmap()); reason != "" {
+			atomic.AddInt64(&g.blocked, 1)
+			blockedErr := &DialBlockedError{Address: address, IP: addr.Unmap().String(), Reason: reason}
+			logger.Warnf("已阻止上游连接: %v", blockedErr)
+			return blockedErr
+		}
+		return nil
+	}
+	return dialer.DialContext(ctx, network, address)
+}
+
+// CheckHost 在连接交给上游代理之前检查请求的目标主机：IP直接检查，域名在本地解析后检查所有地址，
+// 本地无法解析的域名被拒绝（allow_hosts 中的主机除外）。
+// 上游代理自行解析域名，因此该检查无法防御 DNS 重绑定，只用于配置了上游代理的场景
+func (g *DialGuard) CheckHost(ctx context.Context, host string) error {
+	policy := g.policy.Load()
+	if policy == nil || policy.hostAllowed(host) {
+		return nil
+	}
+
+	host = strings.Trim(host, "[]")
+	var addrs []netip.Addr
+	if addr, err := netip.ParseAddr(host); err == nil {
+		addrs = []netip.Addr{addr}
+	} else {
+		addrs, err = net.DefaultResolver.LookupNetIP(ctx, "ip", host)
+		if err != nil {
+			return fmt.Errorf("无法解析目标主机 %s，拒绝经上游代理连接: %w", host, err)
+		}
+	}
+
+	for _, addr := range addrs {
+		if reason := policy.check(addr.Unmap()); reason != "" {
+			atomic.AddInt64(&g.blocked, 1)
+			blockedErr := &DialBlockedError{Address: host, IP: addr.Unmap().String(), Reason: reason}
+			logger.Warnf("已阻止经上游代理的连接: %v", blockedErr)
+			return blockedErr
+		}
+	}
+	return nil
+}
+
+// Dial 使用超时建立上游连接
+func (g *DialGuard) Dial(network, address string, timeout time.Duration) (net.Conn, error) {
+	ctx := context.Background()
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	return g.DialContext(ctx, network, address)
+}
+
+// hostAllowed 检查主机名是否在 allow_hosts 中
+func (p *dialPolicy) hostAllowed(host string) bool {
+	host = strings.ToLower(strings.TrimSuffix(strings.Trim(host, "[]"), "."))
+	for _, pattern := range p.allowHosts {
+		if matched, _ := path.Match(pattern, host); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// check 检查IP是否被禁止，返回禁止原因，允许时返回空字符串
+func (p *dialPolicy) check(addr netip.Addr) string {
+	ip := addr.String()
+	if p.allow.Contains(ip) {
+		return ""
+	}
+	if p.block.Contains(ip) {
+		return DialBlockConfig
+	}
+	if p.blockLoopback && (addr.IsLoopback() || addr.IsUnspecified()) {
+		return DialBlockLoopback
+	}
+	if p.blockPrivate && (addr.IsPrivate() || sharedAddressSpace.Contains(addr)) {
+		return DialBlockPrivate
+	}
+	if p.blockLinkLocal && (addr.IsLinkLocalUnicast() || addr.IsLinkLocalMulticast()) {
+		return DialBlockLinkLocal
+	}
+	return ""
+}
+
+// GetStats 获取统计信息
+func (g *DialGuard) GetStats() map[string]interface{} {
+	return map[string]interface{}{
+		"enabled": g.Enabled(),
+		"blocked": atomic.LoadInt64(&g.blocked),
+	}
+}
@@ -0,0 +1,210 @@
+package security
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/netip"
+	"testing"
+	"time"
+
+	"hackmitm/pkg/config"
+)
+
+// testDialGuardConfig 禁止回环、私有和链路本地地址
+func testDialGuardConfig() config.DialGuardConfig {
+	return config.DialGuardConfig{
+		Enabled:        true,
+		BlockLoopback:  true,
+		BlockPrivate:   true,
+		BlockLinkLocal: true,
+	}
+}
+
+func TestDialPolicyCheck(t *testing.T) {
+	tests := []struct {
+		name      string
+		configure func(*config.DialGuardConfig)
+		ip        string
+		want      string
+	}{
+		{name: "IPv4回环", ip: "127.0.0.1", want: DialBlockLoopback},
+		{name: "IPv6回环", ip: "::1", want: DialBlockLoopback},
+		{name: "IPv4映射的回环", ip: "::ffff:127.0.0.1", want: DialBlockLoopback},
+		{name: "IPv4未指定地址", ip: "0.0.0.0", want: DialBlockLoopback},
+		{name: "IPv6未指定地址", ip: "::", want: DialBlockLoopback},
+		{name: "私有地址", ip: "10.1.2.3", want: DialBlockPrivate},
+		{name: "IPv4映射的私有地址", ip: "::ffff:192.168.1.1", want: DialBlockPrivate},
+		{name: "运营商级NAT地址", ip: "100.64.0.1", want: DialBlockPrivate},
+		{name: "IPv6唯一本地地址", ip: "fd00::1", want: DialBlockPrivate},
+		{name: "云服务元数据地址", ip: "169.254.169.254", want: DialBlockLinkLocal},
+		{name: "IPv6链路本地", ip: "fe80::1", want: DialBlockLinkLocal},
+		{name: "公网地址", ip: "93.184.216.34"},
+		{
+			name:      "允许列表优先于禁止规则",
+			configure: func(c *config.DialGuardConfig) { c.Allow = []string{"10.1.0.0/16"} },
+			ip:        "10.1.2.3",
+		},
+		{
+			name:      "允许列表之外的私有地址仍被禁止",
+			configure: func(c *config.DialGuardConfig) { c.Allow = []string{"10.1.0.0/16"} },
+			ip:        "10.2.0.1",
+			want:      DialBlockPrivate,
+		},
+		{
+			name:      "额外禁止的公网地址",
+			configure: func(c *config.DialGuardConfig) { c.Block = []string{"203.0.113.0/24"} },
+			ip:        "203.0.113.7",
+			want:      DialBlockConfig,
+		},
+		{
+			name:      "未禁止回环时允许",
+			configure: func(c *config.DialGuardConfig) { c.BlockLoopback = false },
+			ip:        "127.0.0.1",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			guardConfig := testDialGuardConfig()
+			if tt.configure != nil {
+				tt.configure(&guardConfig)
+			}
+			policy := NewDialGuard(guardConfig).policy.Load()
+			if got := policy.check(netip.MustParseAddr(tt.ip).Unmap()); got != tt.want {
+				t.Errorf("check(%s) = %q, want %q", tt.ip, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDialGuardDialContext(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+	_, port, _ := net.SplitHostPort(listener.Addr().String())
+
+	tests := []struct {
+		name      string
+		configure func(*config.DialGuardConfig)
+		host      string
+		// wantBlocked 期望被守卫拒绝，否则期望连接成功
+		wantBlocked bool
+	}{
+		{name: "回环IP", host: "127.0.0.1", wantBlocked: true},
+		{name: "IPv4映射的回环IP", host: "::ffff:127.0.0.1", wantBlocked: true},
+		// 域名在连接时才解析，守卫检查的是解析出的实际地址
+		{name: "解析为回环地址的域名", host: "localhost", wantBlocked: true},
+		{
+			name:      "允许的主机名不检查地址",
+			configure: func(c *config.DialGuardConfig) { c.AllowHosts = []string{"LOCALHOST."} },
+			host:      "localhost",
+		},
+		{
+			name:      "允许列表中的地址",
+			configure: func(c *config.DialGuardConfig) { c.Allow = []string{"127.0.0.1"} },
+			host:      "127.0.0.1",
+		},
+		{
+			name:      "未启用时不检查",
+			configure: func(c *config.DialGuardConfig) { c.Enabled = false },
+			host:      "127.0.0.1",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			guardConfig := testDialGuardConfig()
+			if tt.configure != nil {
+				tt.configure(&guardConfig)
+			}
+			guard := NewDialGuard(guardConfig)
+
+			conn, err := guard.Dial("tcp", net.JoinHostPort(tt.host, port), 5*time.Second)
+			if conn != nil {
+				conn.Close()
+			}
+			var blockedErr *DialBlockedError
+			if blocked := errors.As(err, &blockedErr); blocked != tt.wantBlocked {
+				t.Fatalf("Dial(%s) error = %v, wantBlocked %v", tt.host, err, tt.wantBlocked)
+			}
+			if tt.wantBlocked {
+				if !netip.MustParseAddr(blockedErr.IP).IsLoopback() || blockedErr.Reason != DialBlockLoopback {
+					t.Errorf("DialBlockedError = %+v", blockedErr)
+				}
+				if blocked, _ := guard.GetStats()["blocked"].(int64); blocked == 0 {
+					t.Error("未统计被拒绝的连接")
+				}
+			} else if err != nil {
+				t.Errorf("Dial(%s) error = %v", tt.host, err)
+			}
+		})
+	}
+}
+
+func TestDialGuardCheckHost(t *testing.T) {
+	tests := []struct {
+		name      string
+		configure func(*config.DialGuardConfig)
+		host      string
+		// want 期望的禁止原因，为空时期望允许
+		want string
+		// wantErr 期望返回非 DialBlockedError 的错误
+		wantErr bool
+	}{
+		{name: "回环IP", host: "127.0.0.1", want: DialBlockLoopback},
+		{name: "带方括号的IPv6回环", host: "[::1]", want: DialBlockLoopback},
+		{name: "IPv4映射的元数据地址", host: "::ffff:169.254.169.254", want: DialBlockLinkLocal},
+		{name: "本机解析为回环地址的域名", host: "localhost", want: DialBlockLoopback},
+		{name: "公网IP", host: "93.184.216.34"},
+		{name: "无法解析的域名被拒绝", host: "nonexistent.invalid", wantErr: true},
+		{
+			name:      "允许的主机名不解析",
+			configure: func(c *config.DialGuardConfig) { c.AllowHosts = []string{"*.invalid"} },
+			host:      "nonexistent.invalid",
+		},
+		{
+			name:      "未启用时不检查",
+			configure: func(c *config.DialGuardConfig) { c.Enabled = false },
+			host:      "127.0.0.1",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			guardConfig := testDialGuardConfig()
+			if tt.configure != nil {
+				tt.configure(&guardConfig)
+			}
+			guard := NewDialGuard(guardConfig)
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			err := guard.CheckHost(ctx, tt.host)
+			var blockedErr *DialBlockedError
+			switch {
+			case tt.want != "":
+				if !errors.As(err, &blockedErr) || blockedErr.Reason != tt.want {
+					t.Errorf("CheckHost(%s) error = %v, want %s", tt.host, err, tt.want)
+				}
+			case tt.wantErr:
+				if err == nil || errors.As(err, &blockedErr) {
+					t.Errorf("CheckHost(%s) error = %v, want 解析错误", tt.host, err)
+				}
+			case err != nil:
+				t.Errorf("CheckHost(%s) error = %v", tt.host, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,413 @@
+package security
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net/netip"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"hackmitm/pkg/logger"
+)
+
+// IP列表条目来源
+const (
+	// SourceConfig 配置文件中的 whitelist/blacklist
+	SourceConfig = "config"
+	// SourceAPI 运行时通过API添加
+	SourceAPI = "api"
+	// sourceFilePrefix 外部列表文件，完整来源为 "file:<路径>"
+	sourceFilePrefix = "file:"
+)
+
+// IP列表操作错误
+var (
+	// ErrIPListEntryNotFound 条目不存在
+	ErrIPListEntryNotFound = errors.New("条目不存在")
+	// ErrIPListEntryReadOnly 条目来自配置或文件，不能通过API删除
+	ErrIPListEntryReadOnly = errors.New("条目来自配置或文件，请修改对应来源")
+)
+
+// IPListEntry IP列表条目，可以是单个IP、CIDR或 "起始IP-结束IP" 范围
+type IPListEntry struct {
+	// Value 规范化后的条目，如 10.0.0.0/8、2001:db8::/32、10.0.0.1-10.0.0.50
+	Value string `json:"value"`
+	// Source 条目来源（config、api 或 file:<路径>）
+	Source string `json:"source"`
+	// Comment 备注
+	Comment string `json:"comment,omitempty"`
+	// AddedAt 添加时间
+	AddedAt time.Time `json:"added_at"`
+	// ExpiresAt 过期时间，nil 表示永久
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+
+	prefixes []netip.Prefix
+}
+
+// expired 检查条目是否已过期
+func (e *IPListEntry) expired(now time.Time) bool {
+	return e.ExpiresAt != nil && !now.Before(*e.ExpiresAt)
+}
+
+// IPList 支持CIDR和范围匹配的IP列表，查找基于前缀树且无锁
+// IPList is an IP allow/deny list backed by a binary prefix tree supporting CIDRs and ranges
+type IPList struct {
+	// name 列表名称，用于日志
+	name string
+	// entries 按 来源|条目 索引的全部条目
+	entries map[string]*IPListEntry
+	// trie 当前生效的前缀树，修改时整体重建
+	trie atomic.Pointer[ipTrie]
+	// mutex 保护 entries 及重建过程
+	mutex sync.Mutex
+}
+
+// NewIPList 创建IP列表
+func NewIPList(name string) *IPList {
+	l := &IPList{name: name, entries: make(map[string]*IPListEntry)}
+	l.trie.Store(newIPTrie())
+	return l
+}
+
+// ParseIPListEntry 解析IP、CIDR或IP范围，返回规范化的值及覆盖的前缀
+// IPv4映射的IPv6地址（::ffff:a.b.c.d）按IPv4处理
+func ParseIPListEntry(value string) (string, []netip.Prefix, error) {
+	value = strings.TrimSpace(value)
+
+	if start, end, ok := strings.Cut(value, "-"); ok {
+		first, err := netip.ParseAddr(strings.TrimSpace(start))
+		if err != nil {
+			return "", nil, fmt.Errorf("无效的范围起始地址: %q", start)
+		}
+		last, err := netip.ParseAddr(strings.TrimSpace(end))
+		if err != nil {
+			return "", nil, fmt.Errorf("无效的范围结束地址: %q", end)
+		}
+		first, last = first.Unmap(), last.Unmap()
+		if first.Is4() != last.Is4() {
+			return "", nil, fmt.Errorf("范围两端地址族不一致: %s", value)
+		}
+		if last.Less(first) {
+			return "", nil, fmt.Errorf("范围结束地址小于起始地址: %s", value)
+		}
+		return first.String() + "-" + last.String(), rangePrefixes(first, last), nil
+	}
+
+	if strings.Contains(value, "/") {
+		prefix, err := netip.ParsePrefix(value)
+		if err != nil {
+			return "", nil, fmt.Errorf("无效的CIDR: %q", value)
+		}
+		prefix = unmapPrefix(prefix.Masked())
+		return prefix.String(), []netip.Prefix{prefix}, nil
+	}
+
+	addr, err := netip.ParseAddr(value)
+	if err != nil {
+		return "", nil, fmt.Errorf("无效的IP地址: %q", value)
+	}
+	addr = addr.Unmap()
+	prefix := netip.PrefixFrom(addr, addr.BitLen())
+	return addr.String(), []netip.Prefix{prefix}, nil
+}
+
+// unmapPrefix 将 ::ffff:0:0/96 内的前缀转换为IPv4前缀
+func unmapPrefix(p netip.Prefix) netip.Prefix {
+	if p.Addr().Is4In6() && p.Bits() >= 96 {
+		return netip.PrefixFrom(p.Addr().Unmap(), p.Bits()-96)
+	}
+	return p
+}
+
+// rangePrefixes 将地址范围拆分为最少的前缀集合
+func rangePrefixes(first, last netip.Addr) []netip.Prefix {
+	var prefixes []netip.Prefix
+	for {
+		// 从最长前缀开始，尽量扩大到仍以 first 对齐且不超过 last 的前缀
+		bits := first.BitLen()
+		for bits > 0 {
+			candidate := netip.PrefixFrom(first, bits-1).Masked()
+			if candidate.Addr() != first || lastAddr(candidate).Compare(last) > 0 {
+				break
+			}
+			bits--
+		}
+
+		prefix := netip.PrefixFrom(first, bits)
+		prefixes = append(prefixes, prefix)
+
+		end := lastAddr(prefix)
+		if end.Compare(last) >= 0 {
+			return prefixes
+		}
+		first = end.Next()
+	}
+}
+
+// lastAddr 返回前缀覆盖的最后一个地址
+func lastAddr(p netip.Prefix) netip.Addr {
+	bytes := p.Addr().AsSlice()
+	for i := p.Bits(); i < len(bytes)*8; i++ {
+		bytes[i/8] |= 1 << (7 - uint(i%8))
+	}
+	addr, _ := netip.AddrFromSlice(bytes)
+	return addr
+}
+
+// Match 查找匹配IP的条目（最长前缀优先），未匹配时返回nil
+func (l *IPList) Match(ip string) *IPListEntry {
+	addr, err := netip.ParseAddr(strings.TrimSpace(ip))
+	if err != nil {
+		return nil
+	}
+	return l.trie.Load().lookup(addr.Unmap(), time.Now())
+}
+
+// Contains 检查IP是否在列表中
+func (l *IPList) Contains(ip string) bool {
+	return l.Match(ip) != nil
+}
+
+// SetSource 替换指定来源的全部条目，无效条目记录警告后跳过，返回生效的条目数
+func (l *IPList) SetSource(source string, values []string) int {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	for key, entry := range l.entries {
+		if entry.Source == source {
+			delete(l.entries, key)
+		}
+	}
+
+	now := time.Now()
+	count := 0
+	for _, value := range values {
+		normalized, prefixes, err := ParseIPListEntry(value)
+		if err != nil {
+			logger.Warnf("%s (%s) 跳过无效条目: %v", l.name, source, err)
+			continue
+		}
+		l.entries[source+"|"+normalized] = &IPListEntry{
+			Value:    normalized,
+			Source:   source,
+			AddedAt:  now,
+			prefixes: prefixes,
+		}
+		count++
+	}
+
+	l.rebuildLocked()
+	return count
+}
+
+// Add 通过API添加条目，ttl 为0表示永久；已存在的API条目会更新过期时间和备注
+func (l *IPList) Add(value string, ttl time.Duration, comment string) (*IPListEntry, error) {
+	normalized, prefixes, err := ParseIPListEntry(value)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	entry := &IPListEntry{
+		Value:    normalized,
+		Source:   SourceAPI,
+		Comment:  comment,
+		AddedAt:  now,
+		prefixes: prefixes,
+	}
+	if ttl > 0 {
+		expiresAt := now.Add(ttl)
+		entry.ExpiresAt = &expiresAt
+	}
+
+	l.mutex.Lock()
+	l.entries[SourceAPI+"|"+normalized] = entry
+	l.rebuildLocked()
+	l.mutex.Unlock()
+
+	result := *entry
+	return &result, nil
+}
+
+// Remove 删除通过API添加的条目，配置或文件中的条目需修改对应来源
+func (l *IPList) Remove(value string) error {
+	normalized, _, err := ParseIPListEntry(value)
+	if err != nil {
+		return err
+	}
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	key := SourceAPI + "|" + normalized
+	if entry, exists := l.entries[key]; !exists || entry.expired(time.Now()) {
+		for _, entry := range l.entries {
+			if entry.Value == normalized && entry.Source != SourceAPI {
+				return fmt.Errorf("%w: %s (%s)", ErrIPListEntryReadOnly, normalized, entry.Source)
+			}
+		}
+		return fmt.Errorf("%w: %s", ErrIPListEntryNotFound, normalized)
+	}
+
+	delete(l.entries, key)
+	l.rebuildLocked()
+	return nil
+}
+
+// Entries 返回未过期的条目，按来源和值排序
+func (l *IPList) Entries() []IPListEntry {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	now := time.Now()
+	list := make([]IPListEntry, 0, len(l.entries))
+	for _, entry := range l.entries {
+		if !entry.expired(now) {
+			list = append(list, *entry)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Source != list[j].Source {
+			return list[i].Source < list[j].Source
+		}
+		return list[i].Value < list[j].Value
+	})
+	return list
+}
+
+// Len 返回未过期的条目数
+func (l *IPList) Len() int {
+	return l.trie.Load().size
+}
+
+// Prune 删除已过期的条目，返回删除数量
+func (l *IPList) Prune() int {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	now := time.Now()
+	removed := 0
+	for key, entry := range l.entries {
+		if entry.expired(now) {
+			delete(l.entries, key)
+			removed++
+		}
+	}
+	if removed > 0 {
+		l.rebuildLocked()
+		logger.Debugf("%s 清理过期条目: %d", l.name, removed)
+	}
+	return removed
+}
+
+// rebuildLocked 根据当前条目重建前缀树（调用方需持有锁）
+func (l *IPList) rebuildLocked() {
+	trie := newIPTrie()
+	now := time.Now()
+	for _, entry := range l.entries {
+		if entry.expired(now) {
+			continue
+		}
+		for _, prefix := range entry.prefixes {
+			trie.insert(prefix, entry)
+		}
+		trie.size++
+	}
+	l.trie.Store(trie)
+}
+
+// readIPListFile 读取列表文件，每行一个条目，支持 # 注释
+func readIPListFile(path string) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var values []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+		if line = strings.TrimSpace(line); line != "" {
+			values = append(values, line)
+		}
+	}
+	return values, scanner.Err()
+}
+
+// ipTrie IPv4/IPv6 二叉前缀树
+type ipTrie struct {
+	v4   *trieNode
+	v6   *trieNode
+	size int
+}
+
+// trieNode 前缀树节点
+type trieNode struct {
+	children [2]*trieNode
+	// entry 以该节点为终点的前缀对应的条目
+	entry *IPListEntry
+}
+
+// newIPTrie 创建空前缀树
+func newIPTrie() *ipTrie {
+	return &ipTrie{v4: &trieNode{}, v6: &trieNode{}}
+}
+
+// insert 插入前缀，同一前缀有多个条目时优先保留永久或更晚过期的条目
+func (t *ipTrie) insert(prefix netip.Prefix, entry *IPListEntry) {
+	node := t.v6
+	if prefix.Addr().Is4() {
+		node = t.v4
+	}
+
+	bytes := prefix.Addr().AsSlice()
+	for i := 0; i < prefix.Bits(); i++ {
+		bit := bytes[i/8] >> (7 - uint(i%8)) & 1
+		if node.children[bit] == nil {
+			node.children[bit] = &trieNode{}
+		}
+		node = node.children[bit]
+	}
+
+	if node.entry == nil || outlives(entry, node.entry) {
+		node.entry = entry
+	}
+}
+
+// outlives 检查条目 a 是否比 b 更晚过期
+func outlives(a, b *IPListEntry) bool {
+	if b.ExpiresAt == nil {
+		return false
+	}
+	return a.ExpiresAt == nil || a.ExpiresAt.After(*b.ExpiresAt)
+}
+
+// lookup 沿地址位查找，返回最长的未过期匹配前缀对应的条目
+func (t *ipTrie) lookup(addr netip.Addr, now time.Time) *IPListEntry {
+	node := t.v6
+	if addr.Is4() {
+		node = t.v4
+	}
+
+	var match *IPListEntry
+	bytes := addr.AsSlice()
+	for i := 0; node != nil; i++ {
+		if node.entry != nil && !node.entry.expired(now) {
+			match = node.entry
+		}
+		if i == len(bytes)*8 {
+			break
+		}
+		node = node.children[bytes[i/8]>>(7-uint(i%8))&1]
+	}
+	return match
+}
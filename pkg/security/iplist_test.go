@@ -0,0 +1,153 @@
+package security
+
+import (
+	"errors"
+	"net/netip"
+	"testing"
+	"time"
+)
+
+func TestParseIPListEntry(t *testing.T) {
+	tests := []struct {
+		name     string
+		value    string
+		want     string
+		prefixes []string
+		wantErr  bool
+	}{
+		{name: "IPv4地址", value: " 192.0.2.1 ", want: "192.0.2.1", prefixes: []string{"192.0.2.1/32"}},
+		{name: "IPv6地址", value: "2001:db8::1", want: "2001:db8::1", prefixes: []string{"2001:db8::1/128"}},
+		{name: "IPv4映射地址按IPv4处理", value: "::ffff:192.0.2.1", want: "192.0.2.1", prefixes: []string{"192.0.2.1/32"}},
+		{name: "CIDR规范化主机位", value: "10.1.2.3/8", want: "10.0.0.0/8", prefixes: []string{"10.0.0.0/8"}},
+		{name: "IPv4映射CIDR", value: "::ffff:10.0.0.0/104", want: "10.0.0.0/8", prefixes: []string{"10.0.0.0/8"}},
+		{name: "对齐的范围合并为单个前缀", value: "10.0.0.0-10.0.0.255", want: "10.0.0.0-10.0.0.255", prefixes: []string{"10.0.0.0/24"}},
+		{name: "非对齐范围拆分为最少前缀", value: "10.0.0.1-10.0.0.6", want: "10.0.0.1-10.0.0.6",
+			prefixes: []string{"10.0.0.1/32", "10.0.0.2/31", "10.0.0.4/31", "10.0.0.6/32"}},
+		{name: "单地址范围", value: "10.0.0.5-10.0.0.5", want: "10.0.0.5-10.0.0.5", prefixes: []string{"10.0.0.5/32"}},
+		{name: "无效地址", value: "not-an-ip", wantErr: true},
+		{name: "无效CIDR", value: "10.0.0.0/33", wantErr: true},
+		{name: "范围结束小于起始", value: "10.0.0.9-10.0.0.1", wantErr: true},
+		{name: "范围地址族不一致", value: "10.0.0.1-2001:db8::1", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, prefixes, err := ParseIPListEntry(tt.value)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("ParseIPListEntry(%q) 未返回错误", tt.value)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseIPListEntry(%q) error = %v", tt.value, err)
+			}
+			if got != tt.want {
+				t.Errorf("value = %q, want %q", got, tt.want)
+			}
+			if len(prefixes) != len(tt.prefixes) {
+				t.Fatalf("prefixes = %v, want %v", prefixes, tt.prefixes)
+			}
+			for i, prefix := range prefixes {
+				if prefix != netip.MustParsePrefix(tt.prefixes[i]) {
+					t.Errorf("prefixes[%d] = %v, want %v", i, prefix, tt.prefixes[i])
+				}
+			}
+		})
+	}
+}
+
+func TestIPListMatch(t *testing.T) {
+	list := NewIPList("测试")
+	list.SetSource(SourceConfig, []string{
+		"10.0.0.0/8",
+		"10.1.0.0/16",
+		"192.168.1.10-192.168.1.20",
+		"2001:db8::/32",
+		"203.0.113.7",
+	})
+
+	tests := []struct {
+		name string
+		ip   string
+		want string
+	}{
+		{name: "CIDR内", ip: "10.200.3.4", want: "10.0.0.0/8"},
+		{name: "最长前缀优先", ip: "10.1.2.3", want: "10.1.0.0/16"},
+		{name: "范围起点", ip: "192.168.1.10", want: "192.168.1.10-192.168.1.20"},
+		{name: "范围终点", ip: "192.168.1.20", want: "192.168.1.10-192.168.1.20"},
+		{name: "范围之前", ip: "192.168.1.9"},
+		{name: "范围之后", ip: "192.168.1.21"},
+		{name: "IPv6 CIDR内", ip: "2001:db8:1::5", want: "2001:db8::/32"},
+		{name: "IPv6 CIDR外", ip: "2001:db9::1"},
+		{name: "单个地址", ip: "203.0.113.7", want: "203.0.113.7"},
+		{name: "相邻地址", ip: "203.0.113.8"},
+		{name: "IPv4映射地址", ip: "::ffff:10.9.8.7", want: "10.0.0.0/8"},
+		{name: "无效地址", ip: "garbage"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entry := list.Match(tt.ip)
+			got := ""
+			if entry != nil {
+				got = entry.Value
+			}
+			if got != tt.want {
+				t.Errorf("Match(%q) = %q, want %q", tt.ip, got, tt.want)
+			}
+			if contains := list.Contains(tt.ip); contains != (tt.want != "") {
+				t.Errorf("Contains(%q) = %v, want %v", tt.ip, contains, tt.want != "")
+			}
+		})
+	}
+}
+
+func TestIPListAPIEntries(t *testing.T) {
+	list := NewIPList("测试")
+	list.SetSource(SourceConfig, []string{"10.0.0.0/8"})
+
+	if _, err := list.Add("192.0.2.0/24", 0, "测试网段"); err != nil {
+		t.Fatalf("Add() error = %v", err)
+	}
+	if _, err := list.Add("198.51.100.1", time.Nanosecond, ""); err != nil {
+		t.Fatalf("Add() error = %v", err)
+	}
+	time.Sleep(time.Millisecond)
+
+	if !list.Contains("192.0.2.55") {
+		t.Error("API添加的永久条目未生效")
+	}
+	if list.Contains("198.51.100.1") {
+		t.Error("已过期的条目仍然匹配")
+	}
+
+	tests := []struct {
+		name    string
+		value   string
+		wantErr error
+	}{
+		{name: "配置中的条目不能删除", value: "10.0.0.0/8", wantErr: ErrIPListEntryReadOnly},
+		{name: "不存在的条目", value: "172.16.0.0/12", wantErr: ErrIPListEntryNotFound},
+		{name: "删除API条目", value: "192.0.2.0/24"},
+		{name: "重复删除", value: "192.0.2.0/24", wantErr: ErrIPListEntryNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := list.Remove(tt.value)
+			if tt.wantErr == nil && err != nil {
+				t.Fatalf("Remove(%q) error = %v", tt.value, err)
+			}
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Remove(%q) error = %v, want %v", tt.value, err, tt.wantErr)
+			}
+		})
+	}
+
+	if list.Contains("192.0.2.55") {
+		t.Error("删除后条目仍然匹配")
+	}
+	if removed := list.Prune(); removed != 1 {
+		t.Errorf("Prune() = %d, want 1", removed)
+	}
+}
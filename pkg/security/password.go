@@ -0,0 +1,212 @@
+package security
+
+import (
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// 支持的密码哈希算法
+const (
+	HashBcrypt   = "bcrypt"
+	HashArgon2id = "argon2id"
+)
+
+// argon2id 默认参数（RFC 9106 推荐的低内存配置）
+const (
+	argon2Time    = 3
+	argon2Memory  = 64 * 1024
+	argon2Threads = 4
+	argon2KeyLen  = 32
+	argon2SaltLen = 16
+)
+
+// 校验 argon2id 哈希时接受的参数上限，远高于默认参数
+const (
+	// argon2MaxMemory 内存上限（KiB），即 256 MiB
+	argon2MaxMemory = 256 * 1024
+	argon2MaxTime   = 16
+	argon2MinKeyLen = 16
+	argon2MaxKeyLen = 64
+)
+
+// HashPassword 使用指定算法生成密码哈希
+// HashPassword hashes a password with bcrypt or argon2id, returning a self-describing hash string
+func HashPassword(password, algorithm string) (string, error) {
+	switch algorithm {
+	case HashBcrypt, "":
+		hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+		if err != nil {
+			return "", err
+		}
+		return string(hash), nil
+
+	case HashArgon2id:
+		salt := make([]byte, argon2SaltLen)
+		if _, err := rand.Read(salt); err != nil {
+			return "", fmt.Errorf("生成盐值失败: %w", err)
+		}
+		key := argon2.IDKey([]byte(password), salt, argon2Time, argon2Memory, argon2Threads, argon2KeyLen)
+		return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+			argon2.Version, argon2Memory, argon2Time, argon2Threads,
+			base64.RawStdEncoding.EncodeToString(salt),
+			base64.RawStdEncoding.EncodeToString(key)), nil
+	}
+
+	return "", fmt.Errorf("不支持的哈希算法: %s", algorithm)
+}
+
+// IsPasswordHash 检查字符串是否为支持的密码哈希格式
+// 支持 bcrypt、argon2id 以及 htpasswd 常用的 $apr1$ 和 {SHA}
+func IsPasswordHash(s string) bool {
+	for _, prefix := range []string{"$2a$", "$2b$", "$2y$", "$argon2id$", "$apr1$", "{SHA}"} {
+		if strings.HasPrefix(s, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// VerifyPassword 校验密码与哈希是否匹配
+// VerifyPassword reports whether password matches the given hash
+func VerifyPassword(hash, password string) (bool, error) {
+	switch {
+	case strings.HasPrefix(hash, "$2a$"), strings.HasPrefix(hash, "$2b$"), strings.HasPrefix(hash, "$2y$"):
+		err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+		if err == bcrypt.ErrMismatchedHashAndPassword {
+			return false, nil
+		}
+		return err == nil, err
+
+	case strings.HasPrefix(hash, "$argon2id$"):
+		return verifyArgon2id(hash, password)
+
+	case strings.HasPrefix(hash, "$apr1$"):
+		parts := strings.SplitN(hash, "$", 4)
+		if len(parts) != 4 {
+			return false, fmt.Errorf("无效的apr1哈希")
+		}
+		computed := apr1Crypt(password, parts[2])
+		return subtle.ConstantTimeCompare([]byte(computed), []byte(hash)) == 1, nil
+
+	case strings.HasPrefix(hash, "{SHA}"):
+		sum := sha1.Sum([]byte(password))
+		computed := "{SHA}" + base64.StdEncoding.EncodeToString(sum[:])
+		return subtle.ConstantTimeCompare([]byte(computed), []byte(hash)) == 1, nil
+	}
+
+	return false, fmt.Errorf("不支持的密码哈希格式")
+}
+
+// verifyArgon2id 校验 PHC 格式的 argon2id 哈希
+func verifyArgon2id(hash, password string) (bool, error) {
+	// $argon2id$v=19$m=65536,t=3,p=4$<salt>$<key>
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 {
+		return false, fmt.Errorf("无效的argon2id哈希")
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return false, fmt.Errorf("不支持的argon2版本: %s", parts[2])
+	}
+
+	var memory, iterations uint32
+	var threads uint8
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &memory, &iterations, &threads); err != nil {
+		return false, fmt.Errorf("无效的argon2id参数: %s", parts[3])
+	}
+	// 参数来自配置中的哈希，限制范围以免 p=0 导致panic、过大的 m 或 t 使每次认证耗尽内存或CPU
+	if threads == 0 || iterations == 0 || iterations > argon2MaxTime || memory > argon2MaxMemory {
+		return false, fmt.Errorf("argon2id参数超出范围: %s（要求 m<=%d, 1<=t<=%d, p>=1）", parts[3], argon2MaxMemory, argon2MaxTime)
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return false, fmt.Errorf("无效的argon2id盐值: %w", err)
+	}
+	expected, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil {
+		return false, fmt.Errorf("无效的argon2id哈希值: %w", err)
+	}
+	if len(expected) < argon2MinKeyLen || len(expected) > argon2MaxKeyLen {
+		return false, fmt.Errorf("argon2id哈希值长度 %d 超出范围 %d-%d", len(expected), argon2MinKeyLen, argon2MaxKeyLen)
+	}
+
+	key := argon2.IDKey([]byte(password), salt, iterations, memory, threads, uint32(len(expected)))
+	return subtle.ConstantTimeCompare(key, expected) == 1, nil
+}
+
+// apr1Itoa64 apr1 使用的base64字母表
+const apr1Itoa64 = "./0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+
+// apr1Crypt 计算 Apache 的 MD5-crypt（htpasswd 默认格式）
+func apr1Crypt(password, salt string) string {
+	const magic = "$apr1$"
+	if len(salt) > 8 {
+		salt = salt[:8]
+	}
+	pw := []byte(password)
+
+	alt := md5.Sum([]byte(password + salt + password))
+
+	ctx := md5.New()
+	ctx.Write([]byte(password + magic + salt))
+	for i := len(pw); i > 0; i -= 16 {
+		n := i
+		if n > 16 {
+			n = 16
+		}
+		ctx.Write(alt[:n])
+	}
+	for i := len(pw); i > 0; i >>= 1 {
+		if i&1 != 0 {
+			ctx.Write([]byte{0})
+		} else {
+			ctx.Write(pw[:1])
+		}
+	}
+	final := ctx.Sum(nil)
+
+	for i := 0; i < 1000; i++ {
+		round := md5.New()
+		if i&1 != 0 {
+			round.Write(pw)
+		} else {
+			round.Write(final)
+		}
+		if i%3 != 0 {
+			round.Write([]byte(salt))
+		}
+		if i%7 != 0 {
+			round.Write(pw)
+		}
+		if i&1 != 0 {
+			round.Write(final)
+		} else {
+			round.Write(pw)
+		}
+		final = round.Sum(nil)
+	}
+
+	var out strings.Builder
+	out.WriteString(magic + salt + "$")
+	to64 := func(v uint32, n int) {
+		for ; n > 0; n-- {
+			out.WriteByte(apr1Itoa64[v&0x3f])
+			v >>= 6
+		}
+	}
+	for _, g := range [][3]int{{0, 6, 12}, {1, 7, 13}, {2, 8, 14}, {3, 9, 15}, {4, 10, 5}} {
+		to64(uint32(final[g[0]])<<16|uint32(final[g[1]])<<8|uint32(final[g[2]]), 4)
+	}
+	to64(uint32(final[11]), 2)
+	return out.String()
+}
@@ -0,0 +1,103 @@
+package security
+
+import (
+	"strings"
+	"testing"
+)
+
+// 已知向量：bcrypt 与 argon2id 取自 golang.org/x/crypto 的测试（argon2id 由参考实现的命令行生成），
+// apr1 由 openssl passwd -apr1 生成，{SHA} 为 base64(sha1(password))
+func TestVerifyPasswordKnownVectors(t *testing.T) {
+	tests := []struct {
+		name     string
+		hash     string
+		password string
+		want     bool
+		wantErr  bool
+	}{
+		{name: "bcrypt $2a$", hash: "$2a$10$XajjQvNhvvRt5GSeFk1xFeyqRrsxkhBkUiQeg0dt.wU1qD4aFDcga", password: "allmine", want: true},
+		{name: "bcrypt $2b$", hash: "$2b$10$XajjQvNhvvRt5GSeFk1xFeyqRrsxkhBkUiQeg0dt.wU1qD4aFDcga", password: "allmine", want: true},
+		{name: "bcrypt $2y$", hash: "$2y$10$XajjQvNhvvRt5GSeFk1xFeyqRrsxkhBkUiQeg0dt.wU1qD4aFDcga", password: "allmine", want: true},
+		{name: "bcrypt 密码错误", hash: "$2a$10$XajjQvNhvvRt5GSeFk1xFeyqRrsxkhBkUiQeg0dt.wU1qD4aFDcga", password: "allmine!"},
+		{name: "bcrypt 哈希被截断", hash: "$2a$10$XajjQvNhvvRt5GSeFk1xFe", password: "allmine", wantErr: true},
+
+		{name: "argon2id t=1 p=1", hash: "$argon2id$v=19$m=64,t=1,p=1$c29tZXNhbHQ$ZVrRXqxlLcWfcXCnMyv0m4Rpvh/bnCi7", password: "password", want: true},
+		{name: "argon2id t=2 p=2", hash: "$argon2id$v=19$m=64,t=2,p=2$c29tZXNhbHQ$NQrDciL0Nsy1wJcvHr079rlYvyBxhBNi", password: "password", want: true},
+		{name: "argon2id 参数不符", hash: "$argon2id$v=19$m=64,t=2,p=1$c29tZXNhbHQ$ZVrRXqxlLcWfcXCnMyv0m4Rpvh/bnCi7", password: "password"},
+		{name: "argon2id 密码错误", hash: "$argon2id$v=19$m=64,t=1,p=1$c29tZXNhbHQ$ZVrRXqxlLcWfcXCnMyv0m4Rpvh/bnCi7", password: "Password"},
+		{name: "argon2id 版本不支持", hash: "$argon2id$v=16$m=64,t=1,p=1$c29tZXNhbHQ$ZVrRXqxlLcWfcXCnMyv0m4Rpvh/bnCi7", password: "password", wantErr: true},
+		{name: "argon2id 字段缺失", hash: "$argon2id$v=19$m=64,t=1,p=1$c29tZXNhbHQ", password: "password", wantErr: true},
+		{name: "argon2id p=0", hash: "$argon2id$v=19$m=64,t=1,p=0$c29tZXNhbHQ$ZVrRXqxlLcWfcXCnMyv0m4Rpvh/bnCi7", password: "password", wantErr: true},
+		{name: "argon2id t=0", hash: "$argon2id$v=19$m=64,t=0,p=1$c29tZXNhbHQ$ZVrRXqxlLcWfcXCnMyv0m4Rpvh/bnCi7", password: "password", wantErr: true},
+		{name: "argon2id t过大", hash: "$argon2id$v=19$m=64,t=4294967295,p=1$c29tZXNhbHQ$ZVrRXqxlLcWfcXCnMyv0m4Rpvh/bnCi7", password: "password", wantErr: true},
+		{name: "argon2id m过大", hash: "$argon2id$v=19$m=4294967295,t=1,p=1$c29tZXNhbHQ$ZVrRXqxlLcWfcXCnMyv0m4Rpvh/bnCi7", password: "password", wantErr: true},
+		{name: "argon2id p超过255", hash: "$argon2id$v=19$m=64,t=1,p=256$c29tZXNhbHQ$ZVrRXqxlLcWfcXCnMyv0m4Rpvh/bnCi7", password: "password", wantErr: true},
+		{name: "argon2id 哈希值过短", hash: "$argon2id$v=19$m=64,t=1,p=1$c29tZXNhbHQ$ZVrRXqxl", password: "password", wantErr: true},
+		{name: "argon2id 哈希值过长", hash: "$argon2id$v=19$m=64,t=1,p=1$c29tZXNhbHQ$" + strings.Repeat("A", 88), password: "password", wantErr: true},
+
+		{name: "apr1", hash: "$apr1$rOioh4Wh$OV5b2gZTOaWnk3SsAEpM21", password: "password", want: true},
+		{name: "apr1 其他盐值", hash: "$apr1$Vc6g0MzT$GwRosqQEkpc0ptTez8ei80", password: "hackmitm", want: true},
+		{name: "apr1 密码错误", hash: "$apr1$rOioh4Wh$OV5b2gZTOaWnk3SsAEpM21", password: "passwore"},
+		{name: "apr1 格式错误", hash: "$apr1$rOioh4Wh", password: "password", wantErr: true},
+
+		{name: "{SHA}", hash: "{SHA}W6ph5Mm5Pz8GgiULbPgzG37mj9g=", password: "password", want: true},
+		{name: "{SHA} 密码错误", hash: "{SHA}W6ph5Mm5Pz8GgiULbPgzG37mj9g=", password: "password1"},
+
+		{name: "不支持的格式", hash: "$1$saltsalt$hash", password: "password", wantErr: true},
+		{name: "明文不是哈希", hash: "password", password: "password", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := VerifyPassword(tt.hash, tt.password)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("VerifyPassword() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("VerifyPassword() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHashPasswordRoundTrip(t *testing.T) {
+	for _, algorithm := range []string{HashBcrypt, HashArgon2id} {
+		t.Run(algorithm, func(t *testing.T) {
+			hash, err := HashPassword("s3cret", algorithm)
+			if err != nil {
+				t.Fatalf("HashPassword() error = %v", err)
+			}
+			if !IsPasswordHash(hash) {
+				t.Fatalf("IsPasswordHash(%q) = false", hash)
+			}
+			if ok, err := VerifyPassword(hash, "s3cret"); err != nil || !ok {
+				t.Errorf("VerifyPassword(正确密码) = %v, %v", ok, err)
+			}
+			if ok, err := VerifyPassword(hash, "wrong"); err != nil || ok {
+				t.Errorf("VerifyPassword(错误密码) = %v, %v", ok, err)
+			}
+		})
+	}
+
+	if _, err := HashPassword("s3cret", "md5"); err == nil {
+		t.Error("HashPassword(md5) 未返回错误")
+	}
+}
+
+func TestIsPasswordHash(t *testing.T) {
+	tests := map[string]bool{
+		"$2a$10$XajjQvNhvvRt5GSeFk1xFeyqRrsxkhBkUiQeg0dt.wU1qD4aFDcga":             true,
+		"$argon2id$v=19$m=64,t=1,p=1$c29tZXNhbHQ$ZVrRXqxlLcWfcXCnMyv0m4Rpvh/bnCi7": true,
+		"$apr1$rOioh4Wh$OV5b2gZTOaWnk3SsAEpM21":                                    true,
+		"{SHA}W6ph5Mm5Pz8GgiULbPgzG37mj9g=":                                        true,
+		"$argon2i$v=19$m=64,t=1,p=1$c29tZXNhbHQ$abc":                               false,
+		"$1$saltsalt$hash": false,
+		"plaintext":        false,
+		"":                 false,
+	}
+	for value, want := range tests {
+		if got := IsPasswordHash(value); got != want {
+			t.Errorf("IsPasswordHash(%q) = %v, want %v", value, got, want)
+		}
+	}
+}
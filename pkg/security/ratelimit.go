@@ -0,0 +1,361 @@
+package security
+
+import (
+	"fmt"
+	"hash/maphash"
+	"math"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"hackmitm/pkg/config"
+	"hackmitm/pkg/logger"
+)
+
+// 限流维度
+const (
+	RateKeyClientIP = "client_ip"
+	RateKeyUser     = "user"
+	RateKeyHost     = "host"
+)
+
+const (
+	// rateLimitShards 令牌桶分片数，降低锁竞争
+	rateLimitShards = 64
+	// rateLimitCleanupInterval 清理已回满的空闲令牌桶的间隔
+	rateLimitCleanupInterval = time.Minute
+)
+
+// RateLimitError 限流错误，RetryAfter 为令牌补充到可用所需的时间
+type RateLimitError struct {
+	// Rule 触发的规则名称
+	Rule string
+	// RetryAfter 建议的重试等待时间
+	RetryAfter time.Duration
+}
+
+// Error 实现 error 接口
+func (e *RateLimitError) Error() string {
+	return fmt.Sprintf("请求频率过高（规则 %s），%s 后重试", e.Rule, e.RetryAfter.Round(time.Millisecond))
+}
+
+// RetryAfterSeconds 返回 Retry-After 头使用的秒数（向上取整，至少1秒）
+func (e *RateLimitError) RetryAfterSeconds() int {
+	return int(math.Max(1, math.Ceil(e.RetryAfter.Seconds())))
+}
+
+// RateLimiter 分片令牌桶限流器，支持按客户端IP、认证用户、目标主机及其组合限流
+// RateLimiter is a sharded token bucket rate limiter keyed on client IP, user and destination host
+type RateLimiter struct {
+	// state 当前规则及令牌桶，未启用时为nil
+	state atomic.Pointer[rateState]
+	// seed 分片哈希种子
+	seed maphash.Seed
+	// limited 被限流的请求数
+	limited int64
+	// cleanup 清理定时器
+	cleanup *time.Ticker
+	// done 关闭后清理协程退出
+	done chan struct{}
+	// stopOnce 保证 Stop 只关闭一次 done
+	stopOnce sync.Once
+}
+
+// rateState 一组规则及其令牌桶，规则变化时整体替换
+type rateState struct {
+	rules  []*rateRule
+	shards [rateLimitShards]bucketShard
+}
+
+// rateRule 解析后的限流规则
+type rateRule struct {
+	name string
+	key  []string
+	// rate 每秒补充的令牌数
+	rate float64
+	// burst 桶容量
+	burst float64
+	// desc 规则描述，用于日志、统计和变更比较
+	desc string
+}
+
+// bucketShard 令牌桶分片
+type bucketShard struct {
+	mutex   sync.Mutex
+	buckets map[string]*tokenBucket
+}
+
+// tokenBucket 令牌桶
+type tokenBucket struct {
+	rule   *rateRule
+	tokens float64
+	last   time.Time
+}
+
+// NewRateLimiter 创建限流器
+func NewRateLimiter(rateConfig config.RateLimitConfig) *RateLimiter {
+	rl := &RateLimiter{seed: maphash.MakeSeed(), done: make(chan struct{})}
+	rl.Configure(rateConfig)
+
+	rl.cleanup = time.NewTicker(rateLimitCleanupInterval)
+	ticker, done := rl.cleanup, rl.done
+	go func() {
+		for {
+			select {
+			case <-ticker.C:
+				rl.cleanupIdle()
+			case <-done:
+				return
+			}
+		}
+	}()
+	return rl
+}
+
+// Configure 应用限流配置，规则未变化时保留现有令牌桶
+func (rl *RateLimiter) Configure(rateConfig config.RateLimitConfig) {
+	if !rateConfig.Enabled {
+		if rl.state.Swap(nil) != nil {
+			logger.Info("限流器已禁用")
+		}
+		return
+	}
+
+	rules := buildRateRules(rateConfig)
+	if current := rl.state.Load(); current != nil && sameRules(current.rules, rules) {
+		return
+	}
+
+	state := &rateState{rules: rules}
+	for i := range state.shards {
+		state.shards[i].buckets = make(map[string]*tokenBucket)
+	}
+	rl.state.Store(state)
+
+	descs := make([]string, len(rules))
+	for i, rule := range rules {
+		descs[i] = rule.desc
+	}
+	logger.Infof("限流器已启用: %s", strings.Join(descs, "; "))
+}
+
+// buildRateRules 将配置转换为限流规则，未配置 rules 时按客户端IP使用 max_requests/window/burst
+func buildRateRules(rateConfig config.RateLimitConfig) []*rateRule {
+	ruleConfigs := rateConfig.Rules
+	if len(ruleConfigs) == 0 {
+		ruleConfigs = []config.RateLimitRule{{
+			Name:     "default",
+			Key:      []string{RateKeyClientIP},
+			Requests: rateConfig.MaxRequests,
+			Window:   rateConfig.Window,
+			Burst:    rateConfig.Burst,
+		}}
+	}
+
+	rules := make([]*rateRule, 0, len(ruleConfigs))
+	for i, rc := range ruleConfigs {
+		if rc.Requests <= 0 || rc.Window <= 0 || len(rc.Key) == 0 {
+			logger.Warnf("跳过无效的限流规则 #%d: %+v", i, rc)
+			continue
+		}
+
+		name := rc.Name
+		if name == "" {
+			name = fmt.Sprintf("rule-%d", i)
+		}
+		burst := rc.Burst
+		if burst <= 0 {
+			burst = rc.Requests
+		}
+
+		key := make([]string, len(rc.Key))
+		for j, k := range rc.Key {
+			key[j] = strings.ToLower(k)
+		}
+
+		rules = append(rules, &rateRule{
+			name:  name,
+			key:   key,
+			rate:  float64(rc.Requests) / rc.Window.Seconds(),
+			burst: float64(burst),
+			desc:  fmt.Sprintf("%s[%s] %d请求/%s 突发%d", name, strings.Join(key, "+"), rc.Requests, rc.Window, burst),
+		})
+	}
+	return rules
+}
+
+// sameRules 比较两组规则是否相同
+func sameRules(a, b []*rateRule) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].desc != b[i].desc {
+			return false
+		}
+	}
+	return true
+}
+
+// Enabled 是否启用限流
+func (rl *RateLimiter) Enabled() bool {
+	return rl.state.Load() != nil
+}
+
+// Allow 检查请求是否超出限流，所有适用规则各消耗一个令牌
+// 任一规则拒绝时返回 *RateLimitError，并退还已从其他规则扣除的令牌
+func (rl *RateLimiter) Allow(r *http.Request, clientIP, username string) error {
+	state := rl.state.Load()
+	if state == nil {
+		return nil
+	}
+
+	now := time.Now()
+	host := requestHost(r)
+
+	var taken []*tokenBucket
+	var takenShards []*bucketShard
+	for i, rule := range state.rules {
+		key, ok := rule.bucketKey(i, clientIP, username, host)
+		if !ok {
+			continue
+		}
+
+		shard := &state.shards[maphash.String(rl.seed, key)%rateLimitShards]
+		shard.mutex.Lock()
+		bucket := shard.buckets[key]
+		if bucket == nil {
+			bucket = &tokenBucket{rule: rule, tokens: rule.burst, last: now}
+			shard.buckets[key] = bucket
+		}
+		bucket.refill(now)
+
+		if bucket.tokens >= 1 {
+			bucket.tokens--
+			shard.mutex.Unlock()
+			taken = append(taken, bucket)
+			takenShards = append(takenShards, shard)
+			continue
+		}
+
+		retryAfter := time.Duration((1 - bucket.tokens) / rule.rate * float64(time.Second))
+		shard.mutex.Unlock()
+
+		for j, b := range taken {
+			takenShards[j].mutex.Lock()
+			b.tokens = math.Min(b.rule.burst, b.tokens+1)
+			takenShards[j].mutex.Unlock()
+		}
+		atomic.AddInt64(&rl.limited, 1)
+		return &RateLimitError{Rule: rule.name, RetryAfter: retryAfter}
+	}
+	return nil
+}
+
+// bucketKey 生成令牌桶键，规则需要的维度缺失时（如未认证请求的 user）返回 false
+func (rule *rateRule) bucketKey(index int, clientIP, username, host string) (string, bool) {
+	parts := make([]string, 0, len(rule.key)+1)
+	parts = append(parts, fmt.Sprint(index))
+	for _, k := range rule.key {
+		var value string
+		switch k {
+		case RateKeyClientIP:
+			value = clientIP
+		case RateKeyUser:
+			value = username
+		case RateKeyHost:
+			value = host
+		}
+		if value == "" {
+			return "", false
+		}
+		parts = append(parts, value)
+	}
+	return strings.Join(parts, "|"), true
+}
+
+// refill 按经过的时间补充令牌
+func (b *tokenBucket) refill(now time.Time) {
+	elapsed := now.Sub(b.last).Seconds()
+	if elapsed > 0 {
+		b.tokens = math.Min(b.rule.burst, b.tokens+elapsed*b.rule.rate)
+		b.last = now
+	}
+}
+
+// requestHost 返回请求的目标主机名（小写，不含端口）
+func requestHost(r *http.Request) string {
+	host := r.Host
+	if r.Method != http.MethodConnect && r.URL != nil && r.URL.Host != "" {
+		host = r.URL.Host
+	}
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	return strings.ToLower(strings.Trim(host, "[]"))
+}
+
+// cleanupIdle 删除已回满的令牌桶，回满的桶与新建的桶等价
+func (rl *RateLimiter) cleanupIdle() {
+	state := rl.state.Load()
+	if state == nil {
+		return
+	}
+
+	now := time.Now()
+	for i := range state.shards {
+		shard := &state.shards[i]
+		shard.mutex.Lock()
+		for key, bucket := range shard.buckets {
+			bucket.refill(now)
+			if bucket.tokens >= bucket.rule.burst {
+				delete(shard.buckets, key)
+			}
+		}
+		shard.mutex.Unlock()
+	}
+}
+
+// Stop 停止清理任务；Ticker.Stop 不会关闭通道，需关闭 done 让清理协程退出
+func (rl *RateLimiter) Stop() {
+	rl.stopOnce.Do(func() {
+		if rl.cleanup != nil {
+			rl.cleanup.Stop()
+		}
+		if rl.done != nil {
+			close(rl.done)
+		}
+	})
+}
+
+// GetStats 获取限流统计信息
+func (rl *RateLimiter) GetStats() map[string]interface{} {
+	stats := map[string]interface{}{
+		"enabled": false,
+		"limited": atomic.LoadInt64(&rl.limited),
+	}
+
+	state := rl.state.Load()
+	if state == nil {
+		return stats
+	}
+
+	rules := make([]string, len(state.rules))
+	for i, rule := range state.rules {
+		rules[i] = rule.desc
+	}
+	buckets := 0
+	for i := range state.shards {
+		state.shards[i].mutex.Lock()
+		buckets += len(state.shards[i].buckets)
+		state.shards[i].mutex.Unlock()
+	}
+
+	stats["enabled"] = true
+	stats["rules"] = rules
+	stats["buckets"] = buckets
+	return stats
+}
@@ -0,0 +1,151 @@
+package security
+
+import (
+	"errors"
+	"math"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"hackmitm/pkg/config"
+)
+
+func TestTokenBucketRefill(t *testing.T) {
+	start := time.Date(2024, 1, 15, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name    string
+		rate    float64
+		burst   float64
+		tokens  float64
+		elapsed time.Duration
+		want    float64
+	}{
+		{name: "补充部分令牌", rate: 10, burst: 20, tokens: 0, elapsed: 500 * time.Millisecond, want: 5},
+		{name: "不超过桶容量", rate: 10, burst: 20, tokens: 15, elapsed: time.Second, want: 20},
+		{name: "空桶补满", rate: 1, burst: 5, tokens: 0, elapsed: time.Minute, want: 5},
+		{name: "低速率按比例补充", rate: 0.5, burst: 5, tokens: 1, elapsed: 3 * time.Second, want: 2.5},
+		{name: "时间未前进不补充", rate: 10, burst: 20, tokens: 3, elapsed: 0, want: 3},
+		{name: "时钟回拨不扣除", rate: 10, burst: 20, tokens: 3, elapsed: -time.Second, want: 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bucket := &tokenBucket{
+				rule:   &rateRule{rate: tt.rate, burst: tt.burst},
+				tokens: tt.tokens,
+				last:   start,
+			}
+			bucket.refill(start.Add(tt.elapsed))
+			if math.Abs(bucket.tokens-tt.want) > 1e-9 {
+				t.Errorf("tokens = %v, want %v", bucket.tokens, tt.want)
+			}
+			if tt.elapsed > 0 && !bucket.last.Equal(start.Add(tt.elapsed)) {
+				t.Errorf("last = %v, want %v", bucket.last, start.Add(tt.elapsed))
+			}
+		})
+	}
+}
+
+func TestRateLimiterAllow(t *testing.T) {
+	tests := []struct {
+		name   string
+		config config.RateLimitConfig
+		// calls 依次发起的请求：客户端IP、用户名、目标URL
+		calls [][3]string
+		// want 每次请求是否放行
+		want []bool
+		// wantRule 最后一次被拒绝的规则名
+		wantRule string
+	}{
+		{
+			name:     "默认按客户端IP，突发用尽后拒绝",
+			config:   config.RateLimitConfig{Enabled: true, MaxRequests: 2, Window: time.Hour},
+			calls:    [][3]string{{"10.0.0.1", "", "http://a.test/"}, {"10.0.0.1", "", "http://a.test/"}, {"10.0.0.1", "", "http://a.test/"}},
+			want:     []bool{true, true, false},
+			wantRule: "default",
+		},
+		{
+			name:   "不同客户端IP使用独立的桶",
+			config: config.RateLimitConfig{Enabled: true, MaxRequests: 1, Window: time.Hour},
+			calls:  [][3]string{{"10.0.0.1", "", "http://a.test/"}, {"10.0.0.2", "", "http://a.test/"}},
+			want:   []bool{true, true},
+		},
+		{
+			name: "包含用户的规则跳过未认证的请求",
+			config: config.RateLimitConfig{Enabled: true, Rules: []config.RateLimitRule{
+				{Name: "per-user", Key: []string{RateKeyUser}, Requests: 1, Window: time.Hour},
+			}},
+			calls:    [][3]string{{"10.0.0.1", "", "http://a.test/"}, {"10.0.0.1", "", "http://a.test/"}, {"10.0.0.1", "alice", "http://a.test/"}, {"10.0.0.1", "alice", "http://a.test/"}},
+			want:     []bool{true, true, true, false},
+			wantRule: "per-user",
+		},
+		{
+			name: "按客户端IP和目标主机组合",
+			config: config.RateLimitConfig{Enabled: true, Rules: []config.RateLimitRule{
+				{Name: "ip-host", Key: []string{RateKeyClientIP, RateKeyHost}, Requests: 1, Window: time.Hour},
+			}},
+			calls:    [][3]string{{"10.0.0.1", "", "http://a.test/"}, {"10.0.0.1", "", "http://b.test/"}, {"10.0.0.1", "", "http://A.TEST:8080/x"}},
+			want:     []bool{true, true, false},
+			wantRule: "ip-host",
+		},
+		{
+			name: "被后一条规则拒绝时退还前一条规则的令牌",
+			config: config.RateLimitConfig{Enabled: true, Rules: []config.RateLimitRule{
+				{Name: "per-ip", Key: []string{RateKeyClientIP}, Requests: 2, Window: time.Hour},
+				{Name: "per-host", Key: []string{RateKeyHost}, Requests: 1, Window: time.Hour},
+			}},
+			// 第二个请求被 per-host 拒绝，per-ip 的令牌退还，因此第三个请求（不同主机）仍可通过
+			calls:    [][3]string{{"10.0.0.1", "", "http://a.test/"}, {"10.0.0.1", "", "http://a.test/"}, {"10.0.0.1", "", "http://b.test/"}},
+			want:     []bool{true, false, true},
+			wantRule: "per-host",
+		},
+		{
+			name:   "未启用时全部放行",
+			config: config.RateLimitConfig{Enabled: false, MaxRequests: 1, Window: time.Hour},
+			calls:  [][3]string{{"10.0.0.1", "", "http://a.test/"}, {"10.0.0.1", "", "http://a.test/"}},
+			want:   []bool{true, true},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rl := NewRateLimiter(tt.config)
+			defer rl.Stop()
+
+			var lastRule string
+			for i, call := range tt.calls {
+				r := httptest.NewRequest("GET", call[2], nil)
+				err := rl.Allow(r, call[0], call[1])
+				if got := err == nil; got != tt.want[i] {
+					t.Fatalf("请求 #%d allowed = %v, want %v (err=%v)", i, got, tt.want[i], err)
+				}
+				if err != nil {
+					var rateErr *RateLimitError
+					if !errors.As(err, &rateErr) {
+						t.Fatalf("请求 #%d 错误类型 %T, want *RateLimitError", i, err)
+					}
+					if rateErr.RetryAfter <= 0 {
+						t.Errorf("请求 #%d RetryAfter = %v, want > 0", i, rateErr.RetryAfter)
+					}
+					lastRule = rateErr.Rule
+				}
+			}
+			if lastRule != tt.wantRule {
+				t.Errorf("被拒绝的规则 = %q, want %q", lastRule, tt.wantRule)
+			}
+		})
+	}
+}
+
+func TestRateLimiterStopIsIdempotent(t *testing.T) {
+	rl := NewRateLimiter(config.RateLimitConfig{Enabled: true, MaxRequests: 1, Window: time.Second})
+	rl.Stop()
+	rl.Stop()
+
+	select {
+	case <-rl.done:
+	default:
+		t.Fatal("Stop 后 done 未关闭，清理协程不会退出")
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"time"
 
 	"hackmitm/pkg/logger"
+	"hackmitm/pkg/security"
 )
 
 // PatternHandler 流量模式识别处理器
@@ -101,20 +102,9 @@ func (ph *PatternHandler) HandleResponse(resp *http.Response, req *http.Request)
 	return nil
 }
 
-// getClientIP 获取客户端IP
+// getClientIP 获取客户端IP（由代理服务器按可信代理配置解析）
 func (ph *PatternHandler) getClientIP(req *http.Request) string {
-	// 检查X-Forwarded-For头
-	if xff := req.Header.Get("X-Forwarded-For"); xff != "" {
-		return xff
-	}
-
-	// 检查X-Real-IP头
-	if xri := req.Header.Get("X-Real-IP"); xri != "" {
-		return xri
-	}
-
-	// 使用RemoteAddr
-	return req.RemoteAddr
+	return security.ClientIP(req)
 }
 
 // cacheResult 缓存识别结果
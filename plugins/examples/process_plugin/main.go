@@ -0,0 +1,100 @@
+// 进程外插件示例：为请求添加标记头，拦截配置中的路径前缀，为配置的路径返回模拟响应，并在响应中标注处理的插件
+//
+// 构建: go build -o plugins/examples/process_plugin/process_plugin ./plugins/examples/process_plugin
+//
+// 配置:
+//
+//	{
+//	  "name": "process-example",
+//	  "enabled": true,
+//	  "runtime": "process",
+//	  "path": "examples/process_plugin/process_plugin",
+//	  "priority": 50,
+//	  "config": {"header_value": "hackmitm", "block_paths": ["/admin"], "mock_paths": {"/api/ping": "{\"ok\":true}"}}
+//	}
+package main
+
+import (
+	"net/http"
+	"strings"
+
+	"hackmitm/pkg/plugin"
+	"hackmitm/pkg/plugin/sdk"
+)
+
+// ProcessExamplePlugin 进程外插件示例
+type ProcessExamplePlugin struct {
+	*plugin.BasePlugin
+	headerValue string
+	blockPaths  []string
+	// mockPaths 路径到模拟响应正文（JSON）的映射
+	mockPaths map[string]string
+}
+
+// NewProcessExamplePlugin 创建插件实例
+func NewProcessExamplePlugin() *ProcessExamplePlugin {
+	return &ProcessExamplePlugin{
+		BasePlugin:  plugin.NewBasePlugin("process-example", "1.0.0", "进程外插件示例"),
+		headerValue: "hackmitm",
+		mockPaths:   make(map[string]string),
+	}
+}
+
+// Initialize 读取配置
+func (p *ProcessExamplePlugin) Initialize(config map[string]interface{}) error {
+	if err := p.BasePlugin.Initialize(config); err != nil {
+		return err
+	}
+	p.headerValue = p.GetConfigString("header_value", p.headerValue)
+	if paths, ok := config["block_paths"].([]interface{}); ok {
+		for _, path := range paths {
+			if s, ok := path.(string); ok && s != "" {
+				p.blockPaths = append(p.blockPaths, s)
+			}
+		}
+	}
+	if mocks, ok := config["mock_paths"].(map[string]interface{}); ok {
+		for path, body := range mocks {
+			if s, ok := body.(string); ok {
+				p.mockPaths[path] = s
+			}
+		}
+	}
+	return nil
+}
+
+// Priority 返回优先级
+func (p *ProcessExamplePlugin) Priority() int {
+	return 50
+}
+
+// ProcessRequest 为请求添加标记头，配置了模拟响应的路径直接返回响应
+func (p *ProcessExamplePlugin) ProcessRequest(req *http.Request, ctx *plugin.RequestContext) error {
+	req.Header.Set("X-HackMITM-Plugin", p.headerValue)
+	ctx.Metadata["process_example"] = true
+	if body, ok := p.mockPaths[req.URL.Path]; ok {
+		header := http.Header{"Content-Type": {"application/json"}}
+		ctx.Response = plugin.NewResponse(req, http.StatusOK, header, []byte(body))
+	}
+	return nil
+}
+
+// ProcessResponse 在响应中标注处理的插件
+func (p *ProcessExamplePlugin) ProcessResponse(resp *http.Response, req *http.Request, ctx *plugin.ResponseContext) error {
+	resp.Header.Set("X-HackMITM-Processed-By", p.Name())
+	return nil
+}
+
+// ShouldAllow 拦截配置的路径前缀
+func (p *ProcessExamplePlugin) ShouldAllow(req *http.Request, ctx *plugin.FilterContext) (bool, error) {
+	for _, prefix := range p.blockPaths {
+		if strings.HasPrefix(req.URL.Path, prefix) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+func main() {
+	sdk.Main(NewProcessExamplePlugin())
+}
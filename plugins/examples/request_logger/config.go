@@ -1,4 +1,4 @@
-package main
+package requestlogger
 
 // Config 请求日志插件配置
 type Config struct {
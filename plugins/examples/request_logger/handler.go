@@ -1,4 +1,4 @@
-package main
+package requestlogger
 
 import (
 	"encoding/json"
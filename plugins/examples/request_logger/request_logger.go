@@ -1,5 +1,8 @@
-// Package main 请求日志插件示例
-package main
+// Package requestlogger 请求日志插件示例
+//
+// 导入本包即可将插件编译进二进制文件（名称 request-logger），
+// 也可以通过 so 子目录构建为 .so 插件
+package requestlogger
 
 import (
 	"context"
@@ -29,6 +32,10 @@ type RequestLoggerPlugin struct {
 	}
 }
 
+func init() {
+	plugin.Register("request-logger", NewPlugin)
+}
+
 // NewPlugin 创建插件实例
 func NewPlugin(config map[string]interface{}) (plugin.Plugin, error) {
 	base := plugin.NewBasePlugin("request-logger", "1.0.0", "记录HTTP请求详细信息的插件")
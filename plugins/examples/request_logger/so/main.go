@@ -0,0 +1,14 @@
+// Package main 将请求日志插件构建为 .so 插件
+//
+// 构建: go build -buildmode=plugin -o plugins/examples/request_logger.so ./plugins/examples/request_logger/so
+package main
+
+import (
+	"hackmitm/pkg/plugin"
+	requestlogger "hackmitm/plugins/examples/request_logger"
+)
+
+// NewPlugin 插件入口函数
+func NewPlugin(config map[string]interface{}) (plugin.Plugin, error) {
+	return requestlogger.NewPlugin(config)
+}
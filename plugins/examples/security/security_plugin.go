@@ -1,5 +1,8 @@
-// Package main 安全检查插件
-package main
+// Package security 安全检查插件
+//
+// 导入本包即可将插件编译进二进制文件（名称 security），
+// 也可以通过 so 子目录构建为 .so 插件
+package security
 
 import (
 	"context"
@@ -60,6 +63,10 @@ type requestCounter struct {
 	startTime time.Time
 }
 
+func init() {
+	plugin.Register("security", NewPlugin)
+}
+
 // NewPlugin 创建插件实例
 func NewPlugin(config map[string]interface{}) (plugin.Plugin, error) {
 	p := &SecurityPlugin{
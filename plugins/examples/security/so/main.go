@@ -0,0 +1,14 @@
+// Package main 将安全检查插件构建为 .so 插件
+//
+// 构建: go build -buildmode=plugin -o plugins/examples/security_plugin.so ./plugins/examples/security/so
+package main
+
+import (
+	"hackmitm/pkg/plugin"
+	"hackmitm/plugins/examples/security"
+)
+
+// NewPlugin 插件入口函数
+func NewPlugin(config map[string]interface{}) (plugin.Plugin, error) {
+	return security.NewPlugin(config)
+}
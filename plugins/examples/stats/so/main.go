@@ -0,0 +1,14 @@
+// Package main 将请求统计插件构建为 .so 插件
+//
+// 构建: go build -buildmode=plugin -o plugins/examples/stats_plugin.so ./plugins/examples/stats/so
+package main
+
+import (
+	"hackmitm/pkg/plugin"
+	"hackmitm/plugins/examples/stats"
+)
+
+// NewPlugin 插件入口函数
+func NewPlugin(config map[string]interface{}) (plugin.Plugin, error) {
+	return stats.NewPlugin(config)
+}
@@ -1,5 +1,8 @@
-// Package main 请求统计插件
-package main
+// Package stats 请求统计插件
+//
+// 导入本包即可将插件编译进二进制文件（名称 stats），
+// 也可以通过 so 子目录构建为 .so 插件
+package stats
 
 import (
 	"context"
@@ -34,6 +37,10 @@ type StatsPlugin struct {
 	}
 }
 
+func init() {
+	plugin.Register("stats", NewPlugin)
+}
+
 // NewPlugin 创建插件实例
 func NewPlugin(config map[string]interface{}) (plugin.Plugin, error) {
 	p := &StatsPlugin{
@@ -0,0 +1,163 @@
+//go:build wasip1
+
+// WebAssembly 插件示例：为请求添加标记头，拦截配置中的路径前缀并返回自定义拦截页面，并在响应中标注处理的插件
+//
+// 构建（需要 Go 1.24 及以上）:
+//
+//	GOOS=wasip1 GOARCH=wasm go build -buildmode=c-shared -o plugins/examples/wasm_filter/wasm_filter.wasm ./plugins/examples/wasm_filter
+//
+// 配置（路径以 .wasm 结尾时自动按 WebAssembly 插件加载）:
+//
+//	{
+//	  "name": "wasm-example",
+//	  "enabled": true,
+//	  "path": "examples/wasm_filter/wasm_filter.wasm",
+//	  "priority": 50,
+//	  "config": {"header_value": "hackmitm", "block_paths": ["/admin"], "block_page": "<h1>Blocked</h1>"},
+//	  "wasm": {"max_memory": 67108864, "call_timeout": "1s"}
+//	}
+//
+// 同样的宿主函数可以在 Rust、TinyGo、AssemblyScript 中从 "hackmitm" 模块导入。
+package main
+
+import (
+	"encoding/json"
+	"net/url"
+	"strings"
+	"unsafe"
+)
+
+// 宿主函数中 kind 参数的取值
+const (
+	kindRequest  = 0
+	kindResponse = 1
+)
+
+//go:wasmimport hackmitm log
+func hostLog(level uint32, ptr unsafe.Pointer, size uint32)
+
+//go:wasmimport hackmitm get_config
+func hostGetConfig(buf unsafe.Pointer, capacity uint32) int32
+
+//go:wasmimport hackmitm get_url
+func hostGetURL(buf unsafe.Pointer, capacity uint32) int32
+
+//go:wasmimport hackmitm set_header
+func hostSetHeader(kind uint32, namePtr unsafe.Pointer, nameLen uint32, valuePtr unsafe.Pointer, valueLen uint32) int32
+
+//go:wasmimport hackmitm set_body
+func hostSetBody(kind uint32, ptr unsafe.Pointer, size uint32) int32
+
+//go:wasmimport hackmitm respond
+func hostRespond(code uint32) int32
+
+//go:wasmimport hackmitm set_metadata
+func hostSetMetadata(keyPtr unsafe.Pointer, keyLen uint32, valuePtr unsafe.Pointer, valueLen uint32) int32
+
+// pluginConfig 插件配置
+type pluginConfig struct {
+	HeaderValue string   `json:"header_value"`
+	BlockPaths  []string `json:"block_paths"`
+	// BlockPage 拦截页面（HTML），为空时使用代理默认的 403 页面
+	BlockPage string `json:"block_page"`
+}
+
+// getString 调用取值宿主函数，缓冲区不足时按返回的长度重试；值不存在时 ok 为 false
+func getString(get func(buf unsafe.Pointer, capacity uint32) int32) (string, bool) {
+	buf := make([]byte, 256)
+	for {
+		n := get(unsafe.Pointer(&buf[0]), uint32(len(buf)))
+		if n < 0 {
+			return "", false
+		}
+		if int(n) <= len(buf) {
+			return string(buf[:n]), true
+		}
+		buf = make([]byte, n)
+	}
+}
+
+// stringPointer 字符串的数据指针，空字符串返回nil
+func stringPointer(s string) unsafe.Pointer {
+	if s == "" {
+		return nil
+	}
+	return unsafe.Pointer(unsafe.StringData(s))
+}
+
+// logf 输出到代理日志
+func logf(level uint32, message string) {
+	hostLog(level, stringPointer(message), uint32(len(message)))
+}
+
+// setHeader 替换请求头或响应头
+func setHeader(kind uint32, name, value string) {
+	hostSetHeader(kind, stringPointer(name), uint32(len(name)), stringPointer(value), uint32(len(value)))
+}
+
+// respond 直接返回响应给客户端，不再转发请求
+func respond(code uint32, contentType, body string) {
+	hostRespond(code)
+	setHeader(kindResponse, "Content-Type", contentType)
+	hostSetBody(kindResponse, stringPointer(body), uint32(len(body)))
+}
+
+// setMetadata 设置元数据
+func setMetadata(key, value string) {
+	hostSetMetadata(stringPointer(key), uint32(len(key)), stringPointer(value), uint32(len(value)))
+}
+
+// loadConfig 读取插件配置
+func loadConfig() pluginConfig {
+	config := pluginConfig{HeaderValue: "hackmitm"}
+	if data, ok := getString(hostGetConfig); ok {
+		if err := json.Unmarshal([]byte(data), &config); err != nil {
+			logf(2, "解析插件配置失败: "+err.Error())
+		}
+	}
+	return config
+}
+
+// onRequest 为请求添加标记头
+//
+//go:wasmexport hackmitm_on_request
+func onRequest() int32 {
+	setHeader(kindRequest, "X-HackMITM-Plugin", loadConfig().HeaderValue)
+	return 0
+}
+
+// onResponse 在响应中标注处理的插件
+//
+//go:wasmexport hackmitm_on_response
+func onResponse() int32 {
+	setHeader(kindResponse, "X-HackMITM-Processed-By", "wasm-example")
+	return 0
+}
+
+// shouldAllow 拦截配置中的路径前缀
+//
+//go:wasmexport hackmitm_should_allow
+func shouldAllow() int32 {
+	rawURL, ok := getString(hostGetURL)
+	if !ok {
+		return -1
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return -1
+	}
+	config := loadConfig()
+	for _, prefix := range config.BlockPaths {
+		if strings.HasPrefix(u.Path, prefix) {
+			setMetadata("blocked_by", "wasm-example")
+			logf(1, "拦截请求: "+u.Path)
+			if config.BlockPage != "" {
+				respond(403, "text/html; charset=utf-8", config.BlockPage)
+			}
+			return 0
+		}
+	}
+	return 1
+}
+
+func main() {}